@@ -112,3 +112,25 @@ func TestCmppActiveTestRspUnpack(t *testing.T) {
 		t.Fatalf("After unpack, seqId in packet is %x, not equal to the expected value: %x\n", p.SeqId, seqId)
 	}
 }
+
+func BenchmarkCmppActiveTestReqPktUnpack(b *testing.B) {
+	data, _ := (&cmpp.CmppActiveTestReqPkt{}).Pack(seqId)
+	p := &cmpp.CmppActiveTestReqPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(data[8:])
+	}
+}
+
+func BenchmarkCmppActiveTestRspPktUnpack(b *testing.B) {
+	data, _ := (&cmpp.CmppActiveTestRspPkt{}).Pack(seqId)
+	p := &cmpp.CmppActiveTestRspPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(data[8:])
+	}
+}
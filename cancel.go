@@ -0,0 +1,54 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp
+
+// Packet length const for cmpp cancel request and response packets.
+const (
+	CmppCancelReqPktLen  uint32 = 12 + 8 //20d, 0x14
+	Cmpp2CancelRspPktLen uint32 = 12 + 1 //13d, 0xd
+	Cmpp3CancelRspPktLen uint32 = 12 + 4 //16d, 0x10
+)
+
+// CmppCancelReqPkt cancels a submitted message that has not been
+// delivered yet. It is the same in cmpp2 and cmpp3.
+//
+//cmpp:packet CMPP_CANCEL
+type CmppCancelReqPkt struct {
+	MsgId uint64
+
+	// session info
+	SeqId uint32 `cmpp:"seqid"`
+}
+
+// Cmpp2CancelRspPkt's SuccessId is 0 if the message is canceled,
+// or 1 if it is not.
+//
+//cmpp:packet CMPP_CANCEL_RESP V21
+type Cmpp2CancelRspPkt struct {
+	SuccessId uint8
+
+	// session info
+	SeqId uint32 `cmpp:"seqid"`
+}
+
+// Cmpp3CancelRspPkt's SuccessId is 0 if the message is canceled,
+// or 1 if it is not.
+//
+//cmpp:packet CMPP_CANCEL_RESP V30
+type Cmpp3CancelRspPkt struct {
+	SuccessId uint32
+
+	// session info
+	SeqId uint32 `cmpp:"seqid"`
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+func TestCmppCancelReqPkt(t *testing.T) {
+	p := &cmpp.CmppCancelReqPkt{MsgId: 13025908756704198656}
+
+	data, err := p.Pack(seqId)
+	if err != nil {
+		t.Fatal("CmppCancelReqPkt pack error:", err)
+	}
+
+	dataExpected := []byte{
+		0x00, 0x00, 0x00, 0x14, 0x00, 0x00, 0x00, 0x07, 0x00, 0x00, 0x00, 0x17,
+		0xb4, 0xc5, 0x53, 0x00, 0x00, 0x01, 0x00, 0x00,
+	}
+	if !bytes.Equal(data, dataExpected) {
+		t.Fatalf("After pack, data is %x, not equal to dataExpected: %x\n", data, dataExpected)
+	}
+
+	p1 := &cmpp.CmppCancelReqPkt{}
+	if err := p1.Unpack(data[8:]); err != nil {
+		t.Fatal("CmppCancelReqPkt unpack error:", err)
+	}
+	if *p1 != *p {
+		t.Fatalf("After unpack, packet is %#v, not equal to the expected value: %#v\n", *p1, *p)
+	}
+}
+
+func TestCmppCancelRspPkt(t *testing.T) {
+	p2 := &cmpp.Cmpp2CancelRspPkt{SuccessId: 1}
+	data, err := p2.Pack(seqId)
+	if err != nil {
+		t.Fatal("Cmpp2CancelRspPkt pack error:", err)
+	}
+	dataExpected := []byte{
+		0x00, 0x00, 0x00, 0x0d, 0x80, 0x00, 0x00, 0x07, 0x00, 0x00, 0x00, 0x17, 0x01,
+	}
+	if !bytes.Equal(data, dataExpected) {
+		t.Fatalf("After pack, data is %x, not equal to dataExpected: %x\n", data, dataExpected)
+	}
+
+	p3 := &cmpp.Cmpp3CancelRspPkt{SuccessId: 1}
+	data, err = p3.Pack(seqId)
+	if err != nil {
+		t.Fatal("Cmpp3CancelRspPkt pack error:", err)
+	}
+	dataExpected = []byte{
+		0x00, 0x00, 0x00, 0x10, 0x80, 0x00, 0x00, 0x07, 0x00, 0x00, 0x00, 0x17, 0x00, 0x00, 0x00, 0x01,
+	}
+	if !bytes.Equal(data, dataExpected) {
+		t.Fatalf("After pack, data is %x, not equal to dataExpected: %x\n", data, dataExpected)
+	}
+
+	p, err := cmpp.DecodePacket(data, cmpp.V30)
+	if err != nil {
+		t.Fatal("Cmpp3CancelRspPkt decode error:", err)
+	}
+	if rsp, ok := p.(*cmpp.Cmpp3CancelRspPkt); !ok || *rsp != *p3 {
+		t.Fatalf("After decode, packet is %#v, not equal to the expected value: %#v\n", p, p3)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package capture records the frames of cmpp connections to capture
+// files, and replays the capture files.
+//
+// A capture file starts with an 8 bytes header:
+//
+//	magic    6 bytes  "CMPPCP"
+//	version  1 byte   1
+//	type     1 byte   the cmpp.Type of the connections, e.g. 0x30
+//
+// followed by the records, each of which is
+//
+//	time     8 bytes  the Unix time in nanoseconds
+//	dir      1 byte   1 for a frame sent, 2 for a frame received
+//	conn id  8 bytes  the cmpp.Conn.ID of the connection
+//	length   4 bytes  the length of the frame
+//	frame    length bytes, the raw bytes of the frame
+//
+// All the integers are in network byte order.
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+const (
+	magic   = "CMPPCP"
+	version = 1
+
+	headerLen       = len(magic) + 2
+	recordHeaderLen = 8 + 1 + 8 + 4
+
+	// maxFrameLen bounds the length of a record, so that a corrupted
+	// file does not make the Reader allocate a huge buffer.
+	maxFrameLen = 1 << 20
+)
+
+// Errors of reading capture files.
+var (
+	ErrInvalidHeader = errors.New("capture: invalid file header")
+	ErrInvalidRecord = errors.New("capture: invalid record")
+)
+
+// Direction tells whether a frame is sent or received.
+type Direction uint8
+
+const (
+	Sent     Direction = 1
+	Received Direction = 2
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Sent:
+		return "sent"
+	case Received:
+		return "received"
+	default:
+		return "unknown"
+	}
+}
+
+// Record is a frame recorded in a capture file.
+type Record struct {
+	Time   time.Time
+	Dir    Direction
+	ConnId uint64
+	Data   []byte // the whole frame, header included.
+}
+
+// Writer writes records to a capture file. It is safe for
+// concurrent use.
+type Writer struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter writes the file header with the protocol version typ
+// to w, and returns a Writer writing the records to w. The records
+// are buffered, call Flush to write them out.
+func NewWriter(w io.Writer, typ cmpp.Type) (*Writer, error) {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(magic)
+	bw.WriteByte(version)
+	bw.WriteByte(byte(typ))
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	return &Writer{w: bw}, nil
+}
+
+// WriteRecord writes r to the capture file.
+func (w *Writer) WriteRecord(r *Record) error {
+	var h [recordHeaderLen]byte
+	binary.BigEndian.PutUint64(h[0:], uint64(r.Time.UnixNano()))
+	h[8] = byte(r.Dir)
+	binary.BigEndian.PutUint64(h[9:], r.ConnId)
+	binary.BigEndian.PutUint32(h[17:], uint32(len(r.Data)))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	if _, w.err = w.w.Write(h[:]); w.err != nil {
+		return w.err
+	}
+	_, w.err = w.w.Write(r.Data)
+	return w.err
+}
+
+// Flush writes the buffered records to the underlying writer.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.w.Flush()
+	return w.err
+}
+
+// Reader reads records from a capture file.
+type Reader struct {
+	r   *bufio.Reader
+	typ cmpp.Type
+}
+
+// NewReader reads the file header from r, and returns a Reader
+// reading the records from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	var h [headerLen]byte
+	if _, err := io.ReadFull(br, h[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrInvalidHeader
+		}
+		return nil, err
+	}
+	if string(h[:len(magic)]) != magic || h[len(magic)] != version {
+		return nil, ErrInvalidHeader
+	}
+	return &Reader{
+		r:   br,
+		typ: cmpp.Type(h[len(magic)+1]),
+	}, nil
+}
+
+// Type returns the protocol version of the connections recorded.
+func (r *Reader) Type() cmpp.Type {
+	return r.typ
+}
+
+// Next returns the next record. It returns io.EOF if there are no
+// more records, and io.ErrUnexpectedEOF if the file is truncated
+// in the middle of a record.
+func (r *Reader) Next() (*Record, error) {
+	var h [recordHeaderLen]byte
+	if _, err := io.ReadFull(r.r, h[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(h[17:])
+	if n > maxFrameLen {
+		return nil, ErrInvalidRecord
+	}
+
+	rec := &Record{
+		Time:   time.Unix(0, int64(binary.BigEndian.Uint64(h[0:]))),
+		Dir:    Direction(h[8]),
+		ConnId: binary.BigEndian.Uint64(h[9:]),
+		Data:   make([]byte, n),
+	}
+	if _, err := io.ReadFull(r.r, rec.Data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return rec, nil
+}
@@ -0,0 +1,252 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+	"github.com/bigwhite/gocmpp/capture"
+)
+
+func TestWriterReader(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := capture.NewWriter(&buf, cmpp.V30)
+	if err != nil {
+		t.Fatal("NewWriter error:", err)
+	}
+	t0 := time.Unix(1500000000, 123)
+	recs := []capture.Record{
+		{Time: t0, Dir: capture.Received, ConnId: 1, Data: []byte{0, 0, 0, 12, 0, 0, 0, 8, 0, 0, 0, 1}},
+		{Time: t0.Add(time.Millisecond), Dir: capture.Sent, ConnId: 1, Data: []byte{0, 0, 0, 12, 0x80, 0, 0, 8, 0, 0, 0, 1}},
+	}
+	for i := range recs {
+		if err := w.WriteRecord(&recs[i]); err != nil {
+			t.Fatal("WriteRecord error:", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal("Flush error:", err)
+	}
+	data := buf.Bytes()
+
+	r, err := capture.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("NewReader error:", err)
+	}
+	if r.Type() != cmpp.V30 {
+		t.Errorf("Type: actual [%v], wanted [%v]", r.Type(), cmpp.V30)
+	}
+	for i := range recs {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next %d error: %v", i, err)
+		}
+		if !rec.Time.Equal(recs[i].Time) || rec.Dir != recs[i].Dir ||
+			rec.ConnId != recs[i].ConnId || !bytes.Equal(rec.Data, recs[i].Data) {
+			t.Errorf("record %d: actual [%+v], wanted [%+v]", i, rec, recs[i])
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Next at the end: actual [%v], wanted [%v]", err, io.EOF)
+	}
+
+	r, _ = capture.NewReader(bytes.NewReader(data[:len(data)-1]))
+	r.Next()
+	if _, err := r.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Next of a truncated record: actual [%v], wanted [%v]", err, io.ErrUnexpectedEOF)
+	}
+
+	if _, err := capture.NewReader(bytes.NewReader([]byte("CMPPXX\x01\x30"))); err != capture.ErrInvalidHeader {
+		t.Errorf("NewReader of a bad magic: actual [%v], wanted [%v]", err, capture.ErrInvalidHeader)
+	}
+	if _, err := capture.NewReader(bytes.NewReader(nil)); err != capture.ErrInvalidHeader {
+		t.Errorf("NewReader of an empty file: actual [%v], wanted [%v]", err, capture.ErrInvalidHeader)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func newServer(t *testing.T, rec *capture.Recorder) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen error:", err)
+	}
+	srv := &cmpp.Server{
+		Handler: cmpp.HandlerFunc(func(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+			if rsp, ok := r.Packer.(*cmpp.Cmpp3ConnRspPkt); ok {
+				rsp.Version = cmpp.V30
+			}
+			return false, nil
+		}),
+		Typ:    cmpp.V30,
+		T:      time.Minute,
+		N:      3,
+		Logger: cmpp.NewNopLogger(),
+	}
+	if rec != nil {
+		srv.SendInterceptors = []cmpp.Interceptor{rec.Send}
+		srv.RecvInterceptors = []cmpp.Interceptor{rec.Recv}
+	}
+	go srv.Serve(ln)
+	return ln
+}
+
+// recordSession records a login and a submit on the server side.
+func recordSession(t *testing.T) []byte {
+	var buf lockedBuffer
+	w, err := capture.NewWriter(&buf, cmpp.V30)
+	if err != nil {
+		t.Fatal("NewWriter error:", err)
+	}
+	ln := newServer(t, capture.NewRecorder(w))
+	defer ln.Close()
+
+	c := cmpp.NewClient(cmpp.V30)
+	if err := c.Connect(ln.Addr().String(), "900001", "888888", time.Second); err != nil {
+		t.Fatal("client connect error:", err)
+	}
+	defer c.Disconnect()
+	if _, err := c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{FeeType: "02"}); err != nil {
+		t.Fatal("send submit error:", err)
+	}
+	if _, err := c.RecvAndUnpackPkt(time.Second); err != nil {
+		t.Fatal("receive submit response error:", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal("Flush error:", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRecorder(t *testing.T) {
+	r, err := capture.NewReader(bytes.NewReader(recordSession(t)))
+	if err != nil {
+		t.Fatal("NewReader error:", err)
+	}
+
+	wanted := []struct {
+		dir capture.Direction
+		cmd cmpp.CommandId
+	}{
+		{capture.Received, cmpp.CMPP_CONNECT},
+		{capture.Sent, cmpp.CMPP_CONNECT_RESP},
+		{capture.Received, cmpp.CMPP_SUBMIT},
+		{capture.Sent, cmpp.CMPP_SUBMIT_RESP},
+	}
+	var connId uint64
+	for i, w := range wanted {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next %d error: %v", i, err)
+		}
+		p, err := cmpp.DecodePacket(rec.Data, r.Type())
+		if err != nil {
+			t.Fatalf("decode record %d error: %v", i, err)
+		}
+		if rec.Dir != w.dir || p.CommandId() != w.cmd {
+			t.Errorf("record %d: actual [%v %v], wanted [%v %v]", i, rec.Dir, p.CommandId(), w.dir, w.cmd)
+		}
+		if connId == 0 {
+			connId = rec.ConnId
+		}
+		if rec.ConnId == 0 || rec.ConnId != connId {
+			t.Errorf("record %d ConnId: actual [%d], wanted [%d]", i, rec.ConnId, connId)
+		}
+	}
+}
+
+func TestReplayToServer(t *testing.T) {
+	r, err := capture.NewReader(bytes.NewReader(recordSession(t)))
+	if err != nil {
+		t.Fatal("NewReader error:", err)
+	}
+
+	ln := newServer(t, nil)
+	defer ln.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal("dial error:", err)
+	}
+	defer conn.Close()
+
+	go (&capture.Replayer{Dir: capture.Received}).Replay(r, conn)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	d := cmpp.NewDecoder(conn, cmpp.V30)
+	for _, cmd := range []cmpp.CommandId{cmpp.CMPP_CONNECT_RESP, cmpp.CMPP_SUBMIT_RESP} {
+		p, err := d.Decode()
+		if err != nil {
+			t.Fatalf("decode %v error: %v", cmd, err)
+		}
+		if p.CommandId() != cmd {
+			t.Fatalf("response: actual [%v], wanted [%v]", p.CommandId(), cmd)
+		}
+		if err := cmpp.ResponseError(p); err != nil {
+			t.Errorf("%v status error: %v", cmd, err)
+		}
+	}
+}
+
+func TestReplayTiming(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := capture.NewWriter(&buf, cmpp.V30)
+	t0 := time.Now()
+	for i, rec := range []capture.Record{
+		{Time: t0, Dir: capture.Sent, ConnId: 1, Data: []byte{1}},
+		{Time: t0, Dir: capture.Sent, ConnId: 2, Data: []byte{2}},
+		{Time: t0.Add(50 * time.Millisecond), Dir: capture.Received, ConnId: 1, Data: []byte{3}},
+		{Time: t0.Add(100 * time.Millisecond), Dir: capture.Sent, ConnId: 1, Data: []byte{4}},
+	} {
+		if err := w.WriteRecord(&rec); err != nil {
+			t.Fatalf("WriteRecord %d error: %v", i, err)
+		}
+	}
+	w.Flush()
+
+	r, _ := capture.NewReader(bytes.NewReader(buf.Bytes()))
+	var out bytes.Buffer
+	start := time.Now()
+	n, err := (&capture.Replayer{Dir: capture.Sent, Speed: 2}).Replay(r, &out)
+	if err != nil {
+		t.Fatal("Replay error:", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Replay at speed 2 takes [%v], wanted at least [%v]", elapsed, 50*time.Millisecond)
+	}
+	if n != 2 || !bytes.Equal(out.Bytes(), []byte{1, 4}) {
+		t.Errorf("Replay: actual [%d %v], wanted [2 [1 4]]", n, out.Bytes())
+	}
+}
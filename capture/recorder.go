@@ -0,0 +1,85 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+// Recorder records the frames sent and received on the connections
+// to a capture file. Its Send and Recv methods are the interceptors
+// doing so, add them to a cmpp.Conn with Record, or to all the
+// connections of a server or a client:
+//
+//	rec := capture.NewRecorder(w)
+//	srv.SendInterceptors = append(srv.SendInterceptors, rec.Send)
+//	srv.RecvInterceptors = append(srv.RecvInterceptors, rec.Recv)
+//
+// A frame received is recorded even if it can not be decoded. A
+// Recorder is safe for concurrent use.
+type Recorder struct {
+	w *Writer
+
+	// ErrorHandler is optionally called with the errors of writing
+	// the capture file. The frames are sent and received anyway.
+	ErrorHandler func(error)
+}
+
+// NewRecorder returns a Recorder writing the records to w.
+func NewRecorder(w *Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Record adds the interceptors of rec to c.
+func (rec *Recorder) Record(c *cmpp.Conn) {
+	c.InterceptSend(rec.Send)
+	c.InterceptRecv(rec.Recv)
+}
+
+// Send is the interceptor recording the frames sent.
+func (rec *Recorder) Send(f *cmpp.Frame, next func(*cmpp.Frame) error) error {
+	err := next(f)
+	if err == nil {
+		rec.write(f, Sent)
+	}
+	return err
+}
+
+// Recv is the interceptor recording the frames received.
+func (rec *Recorder) Recv(f *cmpp.Frame, next func(*cmpp.Frame) error) error {
+	err := next(f)
+	if len(f.Data) > 0 {
+		rec.write(f, Received)
+	}
+	return err
+}
+
+func (rec *Recorder) write(f *cmpp.Frame, dir Direction) {
+	r := &Record{
+		Time: f.Time,
+		Dir:  dir,
+		Data: f.Data,
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if f.Conn != nil {
+		r.ConnId = f.Conn.ID()
+	}
+	if err := rec.w.WriteRecord(r); err != nil && rec.ErrorHandler != nil {
+		rec.ErrorHandler(err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"io"
+	"time"
+)
+
+// Replayer writes the frames of one connection in a capture file
+// to a peer, such as a cmpp.Server or a cmpp.Client, to reproduce
+// what the connection recorded went through.
+//
+// To replay the frames a client sent to a server, dial the server
+// and replay the frames with Dir Sent if the capture was recorded
+// on the client side, or Received if it was recorded on the server
+// side. To replay the frames a server sent to a client, connect the
+// client to a listener and replay the other direction on the
+// accepted connection.
+//
+// The Replayer only writes to the peer. The caller should read and
+// discard(or check) what the peer writes back, e.g. with a
+// cmpp.Decoder, lest the peer block on writing.
+type Replayer struct {
+	// Dir selects the frames to replay.
+	Dir Direction
+
+	// ConnId selects the connection to replay. Zero means the
+	// connection of the first record in the file.
+	ConnId uint64
+
+	// Speed scales the timing of the frames: 1 replays them at the
+	// original pace, 2 twice as fast, and so on. Zero replays them
+	// as fast as possible.
+	Speed float64
+}
+
+// Replay reads the records from r, and writes the frames selected
+// to w, one Write call per frame. It returns the number of frames
+// written.
+func (rp *Replayer) Replay(r *Reader, w io.Writer) (int, error) {
+	connId := rp.ConnId
+	var first time.Time // the time of the first record of the connection.
+	var start time.Time
+	n := 0
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		if connId == 0 {
+			connId = rec.ConnId
+		}
+		if rec.ConnId != connId {
+			continue
+		}
+		if first.IsZero() {
+			first, start = rec.Time, time.Now()
+		}
+		if rec.Dir != rp.Dir {
+			continue
+		}
+
+		if rp.Speed > 0 {
+			offset := time.Duration(float64(rec.Time.Sub(first)) / rp.Speed)
+			if d := time.Until(start.Add(offset)); d > 0 {
+				time.Sleep(d)
+			}
+		}
+		if _, err = w.Write(rec.Data); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
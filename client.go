@@ -14,8 +14,10 @@
 package cmpp
 
 import (
+	"crypto/tls"
 	"errors"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -27,24 +29,131 @@ var ErrRespNotMatch = errors.New("the response is not matched with the request")
 type Client struct {
 	conn *Conn
 	typ  Type
+
+	// SeqGen generates the Sequence_Id of the requests. It is shared
+	// by all the connections of the client, so the ids keep increasing
+	// across reconnects. NewClient sets a new default generator.
+	SeqGen SequenceGenerator
+
+	// TLSConfig optionally makes Connect and Dial speak cmpp over
+	// TLS with the configuration. Set its Certificates for mutual TLS.
+	TLSConfig *tls.Config
+
+	// WriteTimeout is the max duration for writing a packet.
+	// Zero means no timeout.
+	WriteTimeout time.Duration
+
+	// WriteBufferSize and MaxWriteDelay optionally enable the
+	// buffered writes of the connection, see Conn.EnableWriteBuffer.
+	WriteBufferSize int
+	MaxWriteDelay   time.Duration
+
+	// Logger optionally logs the logins, and the packets sent and
+	// received at the debug level. If nil, nothing is logged.
+	Logger Logger
+	log    Logger // Logger with the fields of the connection.
+
+	// SendInterceptors and RecvInterceptors are added to the
+	// connection, see Conn.InterceptSend and InterceptRecv.
+	SendInterceptors []Interceptor
+	RecvInterceptors []Interceptor
+
+	// Metrics optionally receives the metrics of the client.
+	Metrics Metrics
+	labels  Labels
+	dialed  bool // whether ConnectConn has been called before.
+
+	pmu     sync.Mutex
+	pending map[uint32]pendingReq // the requests not answered yet.
+}
+
+// maxPendingRequests bounds the number of requests the client
+// tracks for measuring the latencies.
+const maxPendingRequests = 1 << 16
+
+// pendingReq is a request sent by the client and not answered yet.
+type pendingReq struct {
+	cmd  CommandId
+	sent time.Time
 }
 
 // New establishes a new cmpp client.
 func NewClient(typ Type) *Client {
 	return &Client{
-		typ: typ,
+		typ:    typ,
+		SeqGen: NewSequenceGenerator(0),
 	}
 }
 
+// A Dialer dials the cmpp server. *net.Dialer satisfies the
+// interface, and so do most proxy dialers.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
 // Connect connect to the cmpp server in block mode.
 // It sends login packet, receive and parse connect response packet.
 func (cli *Client) Connect(servAddr, user, password string, timeout time.Duration) error {
-	var err error
-	conn, err := net.DialTimeout("tcp", servAddr, timeout)
+	return cli.Dial(&net.Dialer{Timeout: timeout}, "tcp", servAddr, user, password, timeout)
+}
+
+// Dial is like Connect, but it dials the server on the named network
+// with d, e.g. a *net.Dialer with custom options, or a dialer
+// tunneling the connection through a proxy.
+func (cli *Client) Dial(d Dialer, network, servAddr, user, password string, timeout time.Duration) error {
+	conn, err := d.Dial(network, servAddr)
 	if err != nil {
 		return err
 	}
+
+	if cli.TLSConfig != nil {
+		conn, err = tlsHandshake(conn, cli.TLSConfig, servAddr, timeout)
+		if err != nil {
+			return err
+		}
+	}
+	return cli.ConnectConn(conn, user, password, timeout)
+}
+
+// tlsHandshake runs the client side TLS handshake over conn.
+func tlsHandshake(conn net.Conn, config *tls.Config, servAddr string, timeout time.Duration) (net.Conn, error) {
+	if config.ServerName == "" && !config.InsecureSkipVerify {
+		host, _, err := net.SplitHostPort(servAddr)
+		if err != nil {
+			host = servAddr
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	tc := tls.Client(conn, config)
+	if timeout != 0 {
+		tc.SetDeadline(time.Now().Add(timeout))
+		defer tc.SetDeadline(noDeadline)
+	}
+	if err := tc.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// ConnectConn logs in to the cmpp server over the established conn
+// in block mode. conn may be any stream oriented net.Conn. It is
+// closed if the login fails.
+func (cli *Client) ConnectConn(conn net.Conn, user, password string, timeout time.Duration) error {
+	var err error
 	cli.conn = NewConn(conn, cli.typ)
+	if cli.SeqGen == nil {
+		cli.SeqGen = NewSequenceGenerator(0)
+	}
+	cli.conn.SeqGen = cli.SeqGen
+	cli.conn.WriteTimeout = cli.WriteTimeout
+	cli.conn.InterceptSend(cli.SendInterceptors...)
+	cli.conn.InterceptRecv(cli.RecvInterceptors...)
+	if cli.WriteBufferSize > 0 {
+		cli.conn.EnableWriteBuffer(cli.WriteBufferSize, cli.MaxWriteDelay)
+	}
 	defer func() {
 		if err != nil {
 			if cli.conn != nil {
@@ -54,6 +163,19 @@ func (cli *Client) Connect(servAddr, user, password string, timeout time.Duratio
 	}()
 	cli.conn.SetState(CONN_CONNECTED)
 
+	cli.log = cli.Logger
+	if cli.log == nil {
+		cli.log = NewNopLogger()
+	}
+	cli.log = cli.log.With(Field{LogKeyRemoteAddr, conn.RemoteAddr()})
+
+	cli.dropPending()
+	cli.labels = Labels{Conn: conn.RemoteAddr().String(), Account: user}
+	if cli.dialed {
+		cli.metrics().Reconnected(cli.labels)
+	}
+	cli.dialed = true
+
 	// Login to the server.
 	req := &CmppConnReqPkt{
 		SrcAddr: user,
@@ -65,42 +187,35 @@ func (cli *Client) Connect(servAddr, user, password string, timeout time.Duratio
 	if err != nil {
 		return err
 	}
+	if err = cli.conn.Flush(); err != nil {
+		return err
+	}
 
-	p, err := cli.conn.RecvAndUnpackPkt(timeout)
+	p, err := cli.RecvAndUnpackPkt(timeout)
 	if err != nil {
 		return err
 	}
 
+	var rsp Pdu
 	var ok bool
-	var status uint8
 	if cli.typ == V20 || cli.typ == V21 {
-		var rsp *Cmpp2ConnRspPkt
 		rsp, ok = p.(*Cmpp2ConnRspPkt)
-		if !ok {
-			err = ErrRespNotMatch
-			return err
-		}
-		status = rsp.Status
 	} else {
-		var rsp *Cmpp3ConnRspPkt
 		rsp, ok = p.(*Cmpp3ConnRspPkt)
-		if !ok {
-			err = ErrRespNotMatch
-			return err
-		}
-		status = uint8(rsp.Status)
+	}
+	if !ok {
+		err = ErrRespNotMatch
+		return err
 	}
 
-	if status != 0 {
-		if status <= ErrnoConnOthers { //ErrnoConnOthers = 5
-			err = ConnRspStatusErrMap[status]
-		} else {
-			err = ConnRspStatusErrMap[ErrnoConnOthers]
-		}
+	if err = ResponseError(rsp); err != nil {
+		cli.log.Warn("login refused", Field{LogKeyAccount, user}, Field{LogKeyError, err})
 		return err
 	}
 
 	cli.conn.SetState(CONN_AUTHOK)
+	cli.log = cli.log.With(Field{LogKeyAccount, user})
+	cli.log.Info("login ok")
 	return nil
 }
 
@@ -108,20 +223,97 @@ func (cli *Client) Disconnect() {
 	if cli.conn != nil {
 		cli.conn.Close()
 	}
+	cli.dropPending()
+}
+
+// metrics returns the Metrics of the client, which is never nil.
+func (cli *Client) metrics() Metrics {
+	if cli.Metrics != nil {
+		return cli.Metrics
+	}
+	return nopMetrics{}
+}
+
+// addPending tracks the request p sent with seqId.
+func (cli *Client) addPending(p Pdu, seqId uint32) {
+	cli.pmu.Lock()
+	defer cli.pmu.Unlock()
+	if len(cli.pending) >= maxPendingRequests {
+		return
+	}
+	if cli.pending == nil {
+		cli.pending = make(map[uint32]pendingReq)
+	}
+	if _, ok := cli.pending[seqId]; !ok {
+		cli.Metrics.InFlight(cli.labels, 1)
+	}
+	cli.pending[seqId] = pendingReq{cmd: p.CommandId(), sent: time.Now()}
+}
+
+// donePending observes the latency of the request answered by p.
+func (cli *Client) donePending(p Pdu) {
+	cli.pmu.Lock()
+	defer cli.pmu.Unlock()
+	req, ok := cli.pending[p.SequenceId()]
+	if !ok || req.cmd.Response() != p.CommandId() {
+		return
+	}
+	delete(cli.pending, p.SequenceId())
+	cli.Metrics.InFlight(cli.labels, -1)
+	cli.Metrics.RequestLatency(cli.labels, req.cmd, time.Since(req.sent))
+}
+
+// dropPending stops tracking the requests not answered.
+func (cli *Client) dropPending() {
+	cli.pmu.Lock()
+	defer cli.pmu.Unlock()
+	if n := len(cli.pending); n > 0 {
+		cli.metrics().InFlight(cli.labels, -n)
+	}
+	cli.pending = nil
 }
 
 // SendReqPkt pack the cmpp request packet structure and send it to the other peer.
 func (cli *Client) SendReqPkt(packet Packer) (uint32, error) {
-	seq := <-cli.conn.SeqId
-	return seq, cli.conn.SendPkt(packet, seq)
+	seq := cli.conn.NextSeqId()
+	return seq, cli.send(packet, seq)
 }
 
 // SendRspPkt pack the cmpp response packet structure and send it to the other peer.
 func (cli *Client) SendRspPkt(packet Packer, seqId uint32) error {
+	return cli.send(packet, seqId)
+}
+
+// send sends packet to the server, logging it at the debug level
+// and counting it in the metrics.
+func (cli *Client) send(packet Packer, seqId uint32) error {
+	if p, ok := packet.(Pdu); ok {
+		cli.log.Debug("send a packet",
+			Field{LogKeyCommand, p.CommandId()}, Field{LogKeySeqId, seqId})
+		if cli.Metrics != nil && p.CommandId().IsRequest() {
+			cli.addPending(p, seqId)
+		}
+	}
+	observeSent(cli.metrics(), cli.labels, packet)
 	return cli.conn.SendPkt(packet, seqId)
 }
 
+// Flush writes the buffered packets to the server at once.
+// It is a no-op if WriteBufferSize is not set.
+func (cli *Client) Flush() error {
+	return cli.conn.Flush()
+}
+
 // RecvAndUnpackPkt receives cmpp byte stream, and unpack it to some cmpp packet structure.
 func (cli *Client) RecvAndUnpackPkt(timeout time.Duration) (interface{}, error) {
-	return cli.conn.RecvAndUnpackPkt(timeout)
+	i, err := cli.conn.RecvAndUnpackPkt(timeout)
+	if p, ok := i.(Pdu); ok {
+		cli.log.Debug("receive a packet",
+			Field{LogKeyCommand, p.CommandId()}, Field{LogKeySeqId, p.SequenceId()})
+		observeReceived(cli.metrics(), cli.labels, p)
+		if cli.Metrics != nil && !p.CommandId().IsRequest() {
+			cli.donePending(p)
+		}
+	}
+	return i, err
 }
@@ -0,0 +1,50 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp_test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+func TestClientConnectRespNotMatch(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go func() {
+		srv := cmpp.NewConn(c2, cmpp.V30)
+		srv.SetState(cmpp.CONN_CONNECTED)
+		i, err := srv.RecvAndUnpackPkt(time.Second)
+		if err != nil {
+			t.Error("server receive error:", err)
+			return
+		}
+		// answer the connect request with another packet.
+		srv.SendPkt(&cmpp.CmppQueryRspPkt{}, i.(cmpp.Pdu).SequenceId())
+	}()
+
+	c := cmpp.NewClient(cmpp.V30)
+	if err := c.ConnectConn(c1, "900001", "888888", time.Second); err != cmpp.ErrRespNotMatch {
+		t.Fatalf("connect with a mismatched response: actual [%v], wanted [%v]\n", err, cmpp.ErrRespNotMatch)
+	}
+
+	// the conn is closed by the failed login.
+	c2.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := c2.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read from the peer of the conn: actual [%v], wanted [%v]\n", err, io.EOF)
+	}
+}
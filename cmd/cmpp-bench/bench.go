@@ -0,0 +1,456 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+	"github.com/bigwhite/gocmpp/utils"
+)
+
+// recvTick is the max duration a receiver blocks without checking
+// the submits timed out.
+const recvTick = 100 * time.Millisecond
+
+// options are the options of a benchmark run.
+type options struct {
+	addr     string
+	user     string
+	password string
+	typ      cmpp.Type
+
+	conns    int           // the number of the connections.
+	window   int           // the max submits not answered on a connection.
+	rate     float64       // the submits per second, 0 for no limit.
+	total    int64         // the submits to send, 0 for no limit.
+	duration time.Duration // how long to send, 0 for no limit.
+	timeout  time.Duration // how long to wait for a submit response.
+
+	report     bool          // ask for and wait for the status reports.
+	reportWait time.Duration // how long to wait for the reports after the last response.
+
+	srcId   string
+	dest    string
+	content string
+
+	progress io.Writer     // where to print the progress, nil for nowhere.
+	interval time.Duration // the interval of the progress.
+}
+
+// bench runs a benchmark.
+type bench struct {
+	opts    *options
+	limiter *limiter
+
+	reserved  int64 // the submits about to be sent.
+	sent      int64
+	answered  int64
+	timedOut  int64
+	errors    int64
+	reports   int64
+	unmatched int64
+
+	results       counter
+	stats         counter
+	latency       latencies
+	reportLatency latencies
+
+	rmu     sync.Mutex
+	waiting map[uint64]time.Time // the submits waiting for the reports, by MsgId.
+}
+
+func newBench(opts *options) *bench {
+	b := &bench{
+		opts:    opts,
+		waiting: make(map[uint64]time.Time),
+	}
+	if opts.rate > 0 {
+		b.limiter = &limiter{interval: time.Duration(float64(time.Second) / opts.rate)}
+	}
+	return b
+}
+
+// run runs the benchmark and returns its report.
+func (b *bench) run() (*report, error) {
+	workers := make([]*worker, 0, b.opts.conns)
+	defer func() {
+		for _, w := range workers {
+			w.cli.Disconnect()
+		}
+	}()
+	for i := 0; i < b.opts.conns; i++ {
+		cli := cmpp.NewClient(b.opts.typ)
+		if err := cli.Connect(b.opts.addr, b.opts.user, b.opts.password, 5*time.Second); err != nil {
+			return nil, fmt.Errorf("connection %d: %v", i, err)
+		}
+		workers = append(workers, newWorker(b, cli))
+	}
+
+	stop, quit := make(chan struct{}), make(chan struct{})
+	var senders, receivers sync.WaitGroup
+	start := time.Now()
+	for _, w := range workers {
+		senders.Add(1)
+		receivers.Add(1)
+		go func(w *worker) {
+			defer senders.Done()
+			w.send(stop)
+		}(w)
+		go func(w *worker) {
+			defer receivers.Done()
+			w.recv(quit)
+		}(w)
+	}
+	if d := b.opts.duration; d > 0 {
+		t := time.AfterFunc(d, func() { close(stop) })
+		defer t.Stop()
+	}
+	if b.opts.progress != nil && b.opts.interval > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go b.printProgress(start, done)
+	}
+
+	// wait for the submits to be sent and answered(or timed out).
+	senders.Wait()
+	for !idle(workers) {
+		time.Sleep(time.Millisecond)
+	}
+	elapsed := time.Since(start)
+
+	if b.opts.report {
+		deadline := time.Now().Add(b.opts.reportWait)
+		for b.waitingReports() > 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	close(quit)
+	receivers.Wait()
+	return b.report(elapsed), nil
+}
+
+// idle reports whether none of the workers has a submit not answered.
+func idle(workers []*worker) bool {
+	for _, w := range workers {
+		if w.pendings() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// take takes a submit to send from the total, and reports whether
+// there is one left.
+func (b *bench) take() bool {
+	return b.opts.total <= 0 || atomic.AddInt64(&b.reserved, 1) <= b.opts.total
+}
+
+// newSubmit returns a new submit request to send.
+func (b *bench) newSubmit() cmpp.Packer {
+	var registered uint8
+	if b.opts.report {
+		registered = 1
+	}
+	var msgFmt uint8 = cmpp.MsgFmtASCII
+	content := b.opts.content
+	if strings.IndexFunc(content, func(r rune) bool { return r >= 0x80 }) >= 0 {
+		msgFmt = cmpp.MsgFmtUCS2
+		content, _ = cmpputils.Utf8ToUcs2(content)
+	}
+
+	if b.opts.typ == cmpp.V30 {
+		return &cmpp.Cmpp3SubmitReqPkt{
+			RegisteredDelivery: registered,
+			MsgFmt:             msgFmt,
+			MsgSrc:             b.opts.user,
+			FeeType:            "01",
+			SrcId:              b.opts.srcId,
+			DestUsrTl:          1,
+			DestTerminalId:     []string{b.opts.dest},
+			MsgLength:          uint8(len(content)),
+			MsgContent:         content,
+		}
+	}
+	return &cmpp.Cmpp2SubmitReqPkt{
+		RegisteredDelivery: registered,
+		MsgFmt:             msgFmt,
+		MsgSrc:             b.opts.user,
+		FeeType:            "01",
+		SrcId:              b.opts.srcId,
+		DestUsrTl:          1,
+		DestTerminalId:     []string{b.opts.dest},
+		MsgLength:          uint8(len(content)),
+		MsgContent:         content,
+	}
+}
+
+// recordAnswer records the submit sent at t and answered with result
+// and msgId.
+func (b *bench) recordAnswer(t time.Time, msgId uint64, r uint32) {
+	atomic.AddInt64(&b.answered, 1)
+	b.latency.add(time.Since(t))
+	b.results.add(result(r))
+	if b.opts.report && r == 0 {
+		b.rmu.Lock()
+		b.waiting[msgId] = t
+		b.rmu.Unlock()
+	}
+}
+
+// delivered records the deliver request with content.
+func (b *bench) delivered(registered uint8, content string) {
+	if registered != 1 {
+		return // an MO message.
+	}
+	var rpt cmpp.CmppReceiptPkt
+	if err := rpt.Unpack([]byte(content)); err != nil {
+		atomic.AddInt64(&b.unmatched, 1)
+		return
+	}
+
+	b.rmu.Lock()
+	t, ok := b.waiting[rpt.MsgId]
+	delete(b.waiting, rpt.MsgId)
+	b.rmu.Unlock()
+	if !ok {
+		atomic.AddInt64(&b.unmatched, 1)
+		return
+	}
+	atomic.AddInt64(&b.reports, 1)
+	b.reportLatency.add(time.Since(t))
+	b.stats.add(rpt.Stat)
+}
+
+func (b *bench) waitingReports() int {
+	b.rmu.Lock()
+	defer b.rmu.Unlock()
+	return len(b.waiting)
+}
+
+// printProgress prints the progress every interval until done.
+func (b *bench) printProgress(start time.Time, done <-chan struct{}) {
+	t := time.NewTicker(b.opts.interval)
+	defer t.Stop()
+	var last int64
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-t.C:
+			answered := atomic.LoadInt64(&b.answered)
+			fmt.Fprintf(b.opts.progress, "%6.1fs  sent %d  answered %d  timed out %d  reports %d  %.1f submits/s\n",
+				now.Sub(start).Seconds(), atomic.LoadInt64(&b.sent), answered,
+				atomic.LoadInt64(&b.timedOut), atomic.LoadInt64(&b.reports),
+				float64(answered-last)/b.opts.interval.Seconds())
+			last = answered
+		}
+	}
+}
+
+func (b *bench) report(elapsed time.Duration) *report {
+	r := &report{
+		Elapsed:       elapsed,
+		Sent:          atomic.LoadInt64(&b.sent),
+		Answered:      atomic.LoadInt64(&b.answered),
+		TimedOut:      atomic.LoadInt64(&b.timedOut),
+		Errors:        atomic.LoadInt64(&b.errors),
+		Results:       b.results.snapshot(),
+		Latency:       b.latency.summary(),
+		Reports:       atomic.LoadInt64(&b.reports),
+		Unmatched:     atomic.LoadInt64(&b.unmatched),
+		Stats:         b.stats.snapshot(),
+		ReportLatency: b.reportLatency.summary(),
+	}
+	if s := elapsed.Seconds(); s > 0 {
+		r.TPS = float64(r.Answered) / s
+	}
+	return r
+}
+
+// worker sends the submits on a connection and receives the
+// responses and the reports.
+type worker struct {
+	b      *bench
+	cli    *cmpp.Client
+	window chan struct{}
+	broken chan struct{} // closed when the connection is broken.
+
+	mu      sync.Mutex
+	pending map[uint32]time.Time // the submits not answered, by SeqId.
+}
+
+func newWorker(b *bench, cli *cmpp.Client) *worker {
+	return &worker{
+		b:       b,
+		cli:     cli,
+		window:  make(chan struct{}, b.opts.window),
+		broken:  make(chan struct{}),
+		pending: make(map[uint32]time.Time),
+	}
+}
+
+// send sends the submits until stop is closed, the total is sent
+// or the connection is broken.
+func (w *worker) send(stop <-chan struct{}) {
+	for {
+		select {
+		case w.window <- struct{}{}:
+		case <-stop:
+			return
+		case <-w.broken:
+			return
+		}
+		if !w.b.take() || !w.b.limiter.wait(stop) {
+			<-w.window
+			return
+		}
+
+		p := w.b.newSubmit()
+		w.mu.Lock()
+		t := time.Now()
+		seqId, err := w.cli.SendReqPkt(p)
+		if err == nil {
+			w.pending[seqId] = t
+		}
+		w.mu.Unlock()
+		if err != nil {
+			atomic.AddInt64(&w.b.errors, 1)
+			<-w.window
+			if e, ok := err.(net.Error); !ok || !e.Timeout() {
+				return
+			}
+			continue
+		}
+		atomic.AddInt64(&w.b.sent, 1)
+	}
+}
+
+// recv receives the packets until quit is closed or the connection
+// is broken.
+func (w *worker) recv(quit <-chan struct{}) {
+	defer w.expire(true)
+	for {
+		select {
+		case <-quit:
+			return
+		default:
+		}
+
+		i, err := w.cli.RecvAndUnpackPkt(recvTick)
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				w.expire(false)
+				continue
+			}
+			close(w.broken)
+			return
+		}
+
+		switch p := i.(type) {
+		case *cmpp.Cmpp2SubmitRspPkt:
+			w.answered(p.SeqId, p.MsgId, uint32(p.Result))
+		case *cmpp.Cmpp3SubmitRspPkt:
+			w.answered(p.SeqId, p.MsgId, p.Result)
+		case *cmpp.Cmpp2DeliverReqPkt:
+			w.b.delivered(p.RegisterDelivery, p.MsgContent)
+			w.cli.SendRspPkt(&cmpp.Cmpp2DeliverRspPkt{MsgId: p.MsgId}, p.SeqId)
+		case *cmpp.Cmpp3DeliverReqPkt:
+			w.b.delivered(p.RegisterDelivery, p.MsgContent)
+			w.cli.SendRspPkt(&cmpp.Cmpp3DeliverRspPkt{MsgId: p.MsgId}, p.SeqId)
+		case *cmpp.CmppActiveTestReqPkt:
+			w.cli.SendRspPkt(&cmpp.CmppActiveTestRspPkt{}, p.SeqId)
+		case *cmpp.CmppTerminateReqPkt:
+			w.cli.SendRspPkt(&cmpp.CmppTerminateRspPkt{}, p.SeqId)
+			close(w.broken)
+			return
+		}
+	}
+}
+
+// answered records the response of the submit of seqId.
+func (w *worker) answered(seqId uint32, msgId uint64, r uint32) {
+	w.mu.Lock()
+	t, ok := w.pending[seqId]
+	delete(w.pending, seqId)
+	w.mu.Unlock()
+	if !ok {
+		return // timed out already.
+	}
+	<-w.window
+	w.b.recordAnswer(t, msgId, r)
+}
+
+// expire counts the submits not answered within the timeout, or all
+// of them if all is true, as timed out.
+func (w *worker) expire(all bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for seqId, t := range w.pending {
+		if all || time.Since(t) > w.b.opts.timeout {
+			delete(w.pending, seqId)
+			atomic.AddInt64(&w.b.timedOut, 1)
+			<-w.window
+		}
+	}
+}
+
+func (w *worker) pendings() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
+
+// limiter paces the submits at a fixed interval.
+type limiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait waits for the next slot to send a submit, and returns false
+// if stop is closed before that. A nil limiter never waits.
+func (l *limiter) wait(stop <-chan struct{}) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now // no bursts to catch up.
+	}
+	t := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	d := t.Sub(now)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
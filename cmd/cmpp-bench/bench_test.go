@@ -0,0 +1,183 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+// startGateway starts a gateway answering the submits, and sending
+// back the status reports if asked for. Every n-th submit is refused
+// by the flow control if n > 0.
+func startGateway(t *testing.T, typ cmpp.Type, n uint64) net.Listener {
+	var msgId uint64
+	handler := cmpp.HandlerFunc(func(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+		var registered uint8
+		var dests []string
+		switch req := p.Packer.(type) {
+		case *cmpp.CmppConnReqPkt:
+			switch rsp := r.Packer.(type) {
+			case *cmpp.Cmpp2ConnRspPkt:
+				rsp.Version = typ
+			case *cmpp.Cmpp3ConnRspPkt:
+				rsp.Version = typ
+			}
+			return false, nil
+		case *cmpp.Cmpp2SubmitReqPkt:
+			registered, dests = req.RegisteredDelivery, req.DestTerminalId
+		case *cmpp.Cmpp3SubmitReqPkt:
+			registered, dests = req.RegisteredDelivery, req.DestTerminalId
+		default:
+			return false, nil
+		}
+
+		id := atomic.AddUint64(&msgId, 1)
+		var result uint32
+		if n > 0 && id%n == 0 {
+			result = uint32(cmpp.ErrnoSubmitNotPassFlowControl)
+		}
+		switch rsp := r.Packer.(type) {
+		case *cmpp.Cmpp2SubmitRspPkt:
+			rsp.MsgId, rsp.Result = id, uint8(result)
+		case *cmpp.Cmpp3SubmitRspPkt:
+			rsp.MsgId, rsp.Result = id, result
+		}
+		if registered == 1 && result == 0 {
+			rpt, _ := (&cmpp.CmppReceiptPkt{MsgId: id, Stat: "DELIVRD", DestTerminalId: dests[0]}).Pack()
+			time.AfterFunc(time.Millisecond, func() {
+				var d cmpp.Packer = &cmpp.Cmpp3DeliverReqPkt{
+					RegisterDelivery: 1, MsgLength: uint8(len(rpt)), MsgContent: string(rpt)}
+				if typ == cmpp.V21 {
+					d = &cmpp.Cmpp2DeliverReqPkt{
+						RegisterDelivery: 1, MsgLength: uint8(len(rpt)), MsgContent: string(rpt)}
+				}
+				p.Conn.SendPkt(d, p.Conn.NextSeqId())
+			})
+		}
+		return false, nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen error:", err)
+	}
+	srv := &cmpp.Server{Handler: handler, Typ: typ, T: time.Minute, N: 3, Window: 16, Logger: cmpp.NewNopLogger()}
+	go srv.Serve(ln)
+	return ln
+}
+
+func testOptions(addr string, typ cmpp.Type) *options {
+	return &options{
+		addr:       addr,
+		user:       "900001",
+		password:   "888888",
+		typ:        typ,
+		conns:      2,
+		window:     8,
+		total:      200,
+		timeout:    time.Second,
+		reportWait: time.Second,
+		srcId:      "10690001",
+		dest:       "13500002696",
+		content:    "你好",
+	}
+}
+
+func TestBench(t *testing.T) {
+	for _, typ := range []cmpp.Type{cmpp.V21, cmpp.V30} {
+		ln := startGateway(t, typ, 10)
+		opts := testOptions(ln.Addr().String(), typ)
+		opts.report = true
+		r, err := run(opts)
+		ln.Close()
+		if err != nil {
+			t.Fatalf("%v: run error: %v", typ, err)
+		}
+
+		if r.Sent != 200 || r.Answered != 200 || r.TimedOut != 0 || r.Errors != 0 || r.TPS <= 0 {
+			t.Errorf("%v: report: %+v", typ, r)
+		}
+		if r.Results["0"] != 180 || r.Results["8 (not pass the flow control)"] != 20 {
+			t.Errorf("%v: results: %v", typ, r.Results)
+		}
+		if r.Latency.Count != 200 || r.Latency.Min > r.Latency.P50 || r.Latency.P50 > r.Latency.Max {
+			t.Errorf("%v: latency: %+v", typ, r.Latency)
+		}
+		if r.Reports != 180 || r.Unmatched != 0 || r.Stats["DELIVRD"] != 180 || r.ReportLatency.Count != 180 {
+			t.Errorf("%v: reports: %+v", typ, r)
+		}
+
+		var b strings.Builder
+		r.print(&b)
+		for _, s := range []string{"200 sent, 200 answered", "8 (not pass the flow control)", "DELIVRD"} {
+			if !strings.Contains(b.String(), s) {
+				t.Errorf("%v: %q is not in the report:\n%s", typ, s, b.String())
+			}
+		}
+	}
+}
+
+func TestBenchRate(t *testing.T) {
+	ln := startGateway(t, cmpp.V30, 0)
+	defer ln.Close()
+	opts := testOptions(ln.Addr().String(), cmpp.V30)
+	opts.total, opts.rate = 20, 200
+
+	r, err := run(opts)
+	if err != nil {
+		t.Fatal("run error:", err)
+	}
+	// the 20 submits are paced 5ms apart.
+	if r.Answered != 20 || r.Elapsed < 90*time.Millisecond {
+		t.Errorf("report: %+v", r)
+	}
+}
+
+func TestBenchDuration(t *testing.T) {
+	ln := startGateway(t, cmpp.V30, 0)
+	defer ln.Close()
+	opts := testOptions(ln.Addr().String(), cmpp.V30)
+	opts.total, opts.duration = 0, 100*time.Millisecond
+
+	r, err := run(opts)
+	if err != nil {
+		t.Fatal("run error:", err)
+	}
+	if r.Sent == 0 || r.Answered != r.Sent || r.Elapsed < 100*time.Millisecond {
+		t.Errorf("report: %+v", r)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var l latencies
+	for i := 100; i >= 1; i-- {
+		l.add(time.Duration(i) * time.Millisecond)
+	}
+	s := l.summary()
+	if s.Count != 100 || s.Min != time.Millisecond || s.Max != 100*time.Millisecond ||
+		s.P50 != 50*time.Millisecond || s.P90 != 90*time.Millisecond ||
+		s.P99 != 99*time.Millisecond || s.P999 != 100*time.Millisecond ||
+		s.Mean != 50500*time.Microsecond {
+		t.Errorf("summary: %+v", s)
+	}
+	if s := (&latencies{}).summary(); s.Count != 0 || s.String() != "-" {
+		t.Errorf("empty summary: %+v", s)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Cmpp-bench measures the end-to-end throughput and latencies of a
+// cmpp gateway, as an SP submitting messages to it.
+//
+// Usage:
+//
+//	cmpp-bench [flags]
+//
+// It opens -c connections to the gateway, and submits on each of them
+// with at most -w submits not answered, at the total rate of -r per
+// second or as fast as the windows allow. It stops after -n submits
+// or -d, and then waits for the responses not received yet for at
+// most -timeout. With -report, the submits ask for the status reports,
+// which are waited for at most -report-wait after the last response.
+//
+// The report includes the submits per second answered, the latency
+// percentiles of the submit responses and the status reports, and
+// the breakdowns of the Results and the report Stats:
+//
+//	cmpp-bench -addr 127.0.0.1:7890 -u 900001 -p 888888 -c 4 -w 16 -n 100000 -report
+//
+// To benchmark the library itself, point it at a local ismg-sim.
+// With -json, the report is printed in JSON, the durations in
+// nanoseconds.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+func main() {
+	var opts options
+	var version string
+	var quiet, jsonOut bool
+	flag.StringVar(&opts.addr, "addr", "127.0.0.1:7890", "the address of the gateway")
+	flag.StringVar(&opts.user, "u", "900001", "the account to log in")
+	flag.StringVar(&opts.password, "p", "888888", "the secret of the account")
+	flag.StringVar(&version, "v", "3", "the protocol version: 2 or 3")
+	flag.IntVar(&opts.conns, "c", 1, "the number of the connections")
+	flag.IntVar(&opts.window, "w", 16, "the max submits not answered on a connection")
+	flag.Float64Var(&opts.rate, "r", 0, "the submits per second, 0 for as fast as the windows allow")
+	flag.Int64Var(&opts.total, "n", 10000, "the submits to send, 0 for no limit")
+	flag.DurationVar(&opts.duration, "d", 0, "how long to send the submits, 0 for no limit")
+	flag.DurationVar(&opts.timeout, "timeout", 10*time.Second, "how long to wait for a submit response")
+	flag.BoolVar(&opts.report, "report", false, "ask for and wait for the status reports")
+	flag.DurationVar(&opts.reportWait, "report-wait", 30*time.Second, "how long to wait for the status reports after the last response")
+	flag.StringVar(&opts.srcId, "src", "10690001", "the SrcId of the submits")
+	flag.StringVar(&opts.dest, "dest", "13500002696", "the DestTerminalId of the submits")
+	flag.StringVar(&opts.content, "content", "cmpp-bench", "the content of the submits, in UTF-8")
+	flag.DurationVar(&opts.interval, "i", time.Second, "the interval of the progress")
+	flag.BoolVar(&quiet, "q", false, "do not print the progress")
+	flag.BoolVar(&jsonOut, "json", false, "print the report in JSON")
+	flag.Parse()
+
+	switch version {
+	case "2":
+		opts.typ = cmpp.V21
+	case "3":
+		opts.typ = cmpp.V30
+	default:
+		fmt.Fprintf(os.Stderr, "cmpp-bench: unknown protocol version %q\n", version)
+		os.Exit(2)
+	}
+	if !quiet {
+		opts.progress = os.Stderr
+	}
+
+	r, err := run(&opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cmpp-bench:", err)
+		os.Exit(1)
+	}
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(r)
+		return
+	}
+	r.print(os.Stdout)
+}
+
+func run(opts *options) (*report, error) {
+	switch {
+	case opts.conns <= 0:
+		return nil, errors.New("no connections")
+	case opts.window <= 0:
+		return nil, errors.New("invalid window size")
+	case opts.total <= 0 && opts.duration <= 0:
+		return nil, errors.New("neither the submits to send nor the duration is limited")
+	case opts.timeout <= 0:
+		return nil, errors.New("invalid timeout")
+	}
+	return newBench(opts).run()
+}
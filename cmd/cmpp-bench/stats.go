@@ -0,0 +1,195 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+// latencies records the latencies of a kind of the responses.
+type latencies struct {
+	mu sync.Mutex
+	ds []time.Duration
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.mu.Lock()
+	l.ds = append(l.ds, d)
+	l.mu.Unlock()
+}
+
+// summary is the summary of the latencies.
+type summary struct {
+	Count int           `json:"count"`
+	Min   time.Duration `json:"min"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	P999  time.Duration `json:"p999"`
+	Max   time.Duration `json:"max"`
+}
+
+func (l *latencies) summary() summary {
+	l.mu.Lock()
+	ds := append([]time.Duration(nil), l.ds...)
+	l.mu.Unlock()
+
+	s := summary{Count: len(ds)}
+	if len(ds) == 0 {
+		return s
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	var sum time.Duration
+	for _, d := range ds {
+		sum += d
+	}
+	s.Min, s.Max = ds[0], ds[len(ds)-1]
+	s.Mean = sum / time.Duration(len(ds))
+	s.P50 = percentile(ds, 50)
+	s.P90 = percentile(ds, 90)
+	s.P99 = percentile(ds, 99)
+	s.P999 = percentile(ds, 99.9)
+	return s
+}
+
+// percentile returns the p-th percentile of the sorted ds, by the
+// nearest-rank method.
+func percentile(ds []time.Duration, p float64) time.Duration {
+	rank := int(p/100*float64(len(ds)) + 0.999999)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(ds) {
+		rank = len(ds)
+	}
+	return ds[rank-1]
+}
+
+func (s summary) String() string {
+	if s.Count == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("min %v  mean %v  p50 %v  p90 %v  p99 %v  p99.9 %v  max %v",
+		round(s.Min), round(s.Mean), round(s.P50), round(s.P90), round(s.P99), round(s.P999), round(s.Max))
+}
+
+// round rounds d to 3 significant digits or so, for reading.
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// counter counts the occurrences of the keys.
+type counter struct {
+	mu sync.Mutex
+	m  map[string]int
+}
+
+func (c *counter) add(key string) {
+	c.mu.Lock()
+	if c.m == nil {
+		c.m = make(map[string]int)
+	}
+	c.m[key]++
+	c.mu.Unlock()
+}
+
+func (c *counter) snapshot() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := make(map[string]int, len(c.m))
+	for k, v := range c.m {
+		m[k] = v
+	}
+	return m
+}
+
+// result describes the Result of a submit response.
+func result(r uint32) string {
+	if r == 0 {
+		return "0"
+	}
+	if err, ok := cmpp.SubmitRspResultErrMap[uint8(r)]; ok && r <= 0xff {
+		return fmt.Sprintf("%d (%s)", r, strings.TrimPrefix(err.Error(), "submit response status: "))
+	}
+	return fmt.Sprint(r)
+}
+
+// report is the report of a benchmark run.
+type report struct {
+	Elapsed       time.Duration  `json:"elapsed"`
+	Sent          int64          `json:"sent"`
+	Answered      int64          `json:"answered"`
+	TimedOut      int64          `json:"timed_out"`
+	Errors        int64          `json:"errors"` // the submits failed to be sent.
+	TPS           float64        `json:"tps"`    // the submits answered per second.
+	Results       map[string]int `json:"results"`
+	Latency       summary        `json:"latency"`
+	Reports       int64          `json:"reports"`
+	Unmatched     int64          `json:"unmatched_reports"` // the reports of no submit sent.
+	Stats         map[string]int `json:"stats,omitempty"`
+	ReportLatency summary        `json:"report_latency"`
+}
+
+// print prints r in text.
+func (r *report) print(w io.Writer) {
+	fmt.Fprintf(w, "elapsed:         %v\n", round(r.Elapsed))
+	fmt.Fprintf(w, "submits:         %d sent, %d answered, %d timed out, %d errors\n",
+		r.Sent, r.Answered, r.TimedOut, r.Errors)
+	fmt.Fprintf(w, "throughput:      %.1f submits/s\n", r.TPS)
+	fmt.Fprintf(w, "submit latency:  %v\n", r.Latency)
+	fmt.Fprintf(w, "results:\n")
+	printCounts(w, r.Results, r.Answered)
+	if r.Reports == 0 && r.Unmatched == 0 {
+		return
+	}
+	fmt.Fprintf(w, "reports:         %d received, %d unmatched\n", r.Reports, r.Unmatched)
+	fmt.Fprintf(w, "report latency:  %v\n", r.ReportLatency)
+	fmt.Fprintf(w, "stats:\n")
+	printCounts(w, r.Stats, r.Reports)
+}
+
+// printCounts prints the counts in m, the most frequent first.
+func printCounts(w io.Writer, m map[string]int, total int64) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	for _, k := range keys {
+		pct := 0.0
+		if total > 0 {
+			pct = float64(m[k]) * 100 / float64(total)
+		}
+		fmt.Fprintf(w, "  %-40s %10d  %6.2f%%\n", k, m[k], pct)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+	"github.com/bigwhite/gocmpp/utils"
+)
+
+// frame is a cmpp frame read from the input, or an error about
+// the bytes that are not part of any frame.
+type frame struct {
+	time time.Time // zero if unknown.
+	src  string    // the sender, empty if unknown.
+	dst  string    // the receiver, empty if unknown.
+	conv string    // the conversation, i.e. the tcp connection, the frame is in.
+	data []byte    // the whole frame, header included.
+	err  error
+}
+
+// record is a frame decoded, as printed.
+type record struct {
+	Time    *time.Time       `json:"time,omitempty"`
+	Src     string           `json:"src,omitempty"`
+	Dst     string           `json:"dst,omitempty"`
+	Version string           `json:"version,omitempty"`
+	Command string           `json:"command,omitempty"`
+	SeqId   uint32           `json:"seq_id"`
+	Length  int              `json:"length"`
+	Packet  cmpp.Pdu         `json:"packet,omitempty"`
+	Content string           `json:"content,omitempty"`
+	Binary  string           `json:"content_hex,omitempty"` // the content not in text, or the UDH.
+	MsgId   *cmpp.MsgIdParts `json:"msg_id,omitempty"`
+
+	// the status report carried by a deliver request, and its Msg_Id
+	// split.
+	Receipt      *cmpp.CmppReceiptPkt `json:"receipt,omitempty"`
+	ReceiptMsgId *cmpp.MsgIdParts     `json:"receipt_msg_id,omitempty"`
+
+	Hex   string `json:"hex,omitempty"` // the frame, if it can not be decoded.
+	Error string `json:"error,omitempty"`
+}
+
+// dumper decodes the frames into records. If typ is 0, it detects
+// the protocol version of each conversation, from the version in
+// the connect request or from the lengths of the frames.
+type dumper struct {
+	typ      cmpp.Type
+	versions map[string]cmpp.Type
+}
+
+func newDumper(typ cmpp.Type) *dumper {
+	return &dumper{
+		typ:      typ,
+		versions: make(map[string]cmpp.Type),
+	}
+}
+
+func (d *dumper) decode(f *frame) *record {
+	r := &record{
+		Src:    f.src,
+		Dst:    f.dst,
+		Length: len(f.data),
+	}
+	if !f.time.IsZero() {
+		t := f.time
+		r.Time = &t
+	}
+	if f.err != nil {
+		r.Error = f.err.Error()
+		if len(f.data) > 0 {
+			r.Hex = hex.EncodeToString(f.data)
+		}
+		return r
+	}
+
+	id := cmpp.CommandId(binary.BigEndian.Uint32(f.data[4:]))
+	r.Command = id.String()
+	r.SeqId = binary.BigEndian.Uint32(f.data[8:])
+
+	typ := d.version(f)
+	r.Version = typ.String()
+	p, err := cmpp.DecodePacket(f.data, typ)
+	if err != nil {
+		r.Error = err.Error()
+		r.Hex = hex.EncodeToString(f.data)
+		return r
+	}
+	r.Packet = p
+
+	if c, ok := p.(*cmpp.CmppConnReqPkt); ok && d.typ == 0 {
+		// the connect request tells the version of the conversation.
+		typ = cmpp.V21
+		if c.Version >= cmpp.V30 {
+			typ = cmpp.V30
+		}
+		d.versions[f.conv] = typ
+		r.Version = typ.String()
+	}
+
+	if id := msgId(p); id != 0 {
+		parts := cmpp.SplitMsgId(id)
+		r.MsgId = &parts
+	}
+	d.decodeMessage(r, p)
+	return r
+}
+
+// version returns the protocol version to decode f with.
+func (d *dumper) version(f *frame) cmpp.Type {
+	if d.typ != 0 {
+		return d.typ
+	}
+	if typ, ok := d.versions[f.conv]; ok {
+		return typ
+	}
+
+	// The packets of the two versions differ in the lengths, tell
+	// the version by the one decoding the frame exactly.
+	var matched []cmpp.Type
+	for _, typ := range []cmpp.Type{cmpp.V30, cmpp.V21} {
+		p, err := cmpp.DecodePacket(f.data, typ)
+		if err == nil && packetLen(p) == len(f.data) {
+			matched = append(matched, typ)
+		}
+	}
+	if len(matched) == 1 {
+		d.versions[f.conv] = matched[0]
+		return matched[0]
+	}
+	return cmpp.V30
+}
+
+// packetLen returns the Total_Length of p as packed.
+func packetLen(p cmpp.Pdu) int {
+	if l, ok := p.(interface{ Len() uint32 }); ok {
+		return int(l.Len())
+	}
+	switch p.(type) {
+	case *cmpp.Cmpp2ConnRspPkt:
+		return int(cmpp.Cmpp2ConnRspPktLen)
+	case *cmpp.Cmpp3ConnRspPkt:
+		return int(cmpp.Cmpp3ConnRspPktLen)
+	}
+	return int(cmpp.CmppConnReqPktLen)
+}
+
+// msgId returns the Msg_Id of p, or 0 if p has none.
+func msgId(p cmpp.Pdu) uint64 {
+	v := reflect.ValueOf(p).Elem().FieldByName("MsgId")
+	if !v.IsValid() || v.Kind() != reflect.Uint64 {
+		return 0
+	}
+	return v.Uint()
+}
+
+// decodeMessage decodes the content, or the status report, of the
+// packets carrying a short message.
+func (d *dumper) decodeMessage(r *record, p cmpp.Pdu) {
+	var content string
+	var msgFmt, udhi uint8
+	switch p := p.(type) {
+	case *cmpp.Cmpp2SubmitReqPkt:
+		content, msgFmt, udhi = p.MsgContent, p.MsgFmt, p.TpUdhi
+	case *cmpp.Cmpp3SubmitReqPkt:
+		content, msgFmt, udhi = p.MsgContent, p.MsgFmt, p.TpUdhi
+	case *cmpp.Cmpp2FwdReqPkt:
+		content, msgFmt, udhi = p.MsgContent, p.MsgFmt, p.TpUdhi
+	case *cmpp.Cmpp3FwdReqPkt:
+		content, msgFmt, udhi = p.MsgContent, p.MsgFmt, p.TpUdhi
+	case *cmpp.Cmpp2DeliverReqPkt:
+		if p.RegisterDelivery == 1 {
+			d.decodeReceipt(r, p.MsgContent)
+			return
+		}
+		content, msgFmt, udhi = p.MsgContent, p.MsgFmt, p.TpUdhi
+	case *cmpp.Cmpp3DeliverReqPkt:
+		if p.RegisterDelivery == 1 {
+			d.decodeReceipt(r, p.MsgContent)
+			return
+		}
+		content, msgFmt, udhi = p.MsgContent, p.MsgFmt, p.TpUdhi
+	default:
+		return
+	}
+
+	text, bin, err := decodeContent(content, msgFmt, udhi)
+	r.Content, r.Binary = text, bin
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+func (d *dumper) decodeReceipt(r *record, content string) {
+	var rpt cmpp.CmppReceiptPkt
+	if err := rpt.Unpack([]byte(content)); err != nil {
+		r.Error = "invalid status report: " + err.Error()
+		return
+	}
+	parts := cmpp.SplitMsgId(rpt.MsgId)
+	r.Receipt, r.ReceiptMsgId = &rpt, &parts
+}
+
+// decodeContent converts the message content of msgFmt to UTF-8.
+// The UDH, if udhi is set, and the contents not in text are returned
+// in hex in bin.
+func decodeContent(content string, msgFmt, udhi uint8) (text, bin string, err error) {
+	if udhi == 1 && len(content) > 0 {
+		n := int(content[0]) + 1
+		if n > len(content) {
+			return "", hex.EncodeToString([]byte(content)), errInvalidUDH
+		}
+		bin = hex.EncodeToString([]byte(content[:n]))
+		content = content[n:]
+	}
+
+	switch msgFmt {
+	case cmpp.MsgFmtUCS2:
+		text, err = cmpputils.Ucs2ToUtf8(content)
+	case cmpp.MsgFmtGB:
+		text, err = cmpputils.GB18030ToUtf8(content)
+	case cmpp.MsgFmtCard, cmpp.MsgFmtBinary:
+		bin += hex.EncodeToString([]byte(content))
+	default: // MsgFmtASCII and the others.
+		text = content
+	}
+	return text, bin, err
+}
@@ -0,0 +1,293 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bigwhite/gocmpp"
+	"github.com/bigwhite/gocmpp/capture"
+)
+
+var (
+	errInvalidUDH     = errors.New("invalid user data header")
+	errUnknownFormat  = errors.New("unknown input format")
+	errPcapNG         = errors.New("pcapng is not supported, convert it with: editcap -F pcap in.pcapng out.pcap")
+	errTruncatedFrame = errors.New("truncated frame")
+)
+
+// The input formats.
+const (
+	formatHex     = "hex"
+	formatRaw     = "raw"
+	formatPcap    = "pcap"
+	formatCapture = "capture"
+)
+
+// guessFormat tells the format of the input by its first bytes.
+func guessFormat(head []byte) string {
+	if len(head) >= 4 {
+		switch binary.BigEndian.Uint32(head) {
+		case pcapMagic, pcapMagicNano, pcapMagicSwapped, pcapMagicNanoSwapped, pcapNGMagic:
+			return formatPcap
+		}
+	}
+	if bytes.HasPrefix(head, []byte("CMPPCP")) {
+		return formatCapture
+	}
+	for _, b := range head {
+		if b >= 0x80 || (b < 0x20 && b != '\n' && b != '\r' && b != '\t') {
+			return formatRaw
+		}
+	}
+	return formatHex
+}
+
+// readFrames reads the frames from r in format, and calls fn with
+// each of them in order. typ is set to the protocol version recorded
+// in a capture file.
+func readFrames(r io.Reader, format string, port int, typ *cmpp.Type, fn func(*frame)) error {
+	switch format {
+	case formatHex:
+		return readHex(r, fn)
+	case formatRaw:
+		s := &splitter{emit: fn}
+		if _, err := io.Copy(s, r); err != nil {
+			return err
+		}
+		s.close()
+		return nil
+	case formatPcap:
+		return readPcap(r, port, fn)
+	case formatCapture:
+		return readCapture(r, typ, fn)
+	}
+	return errUnknownFormat
+}
+
+// readCapture reads the frames of a capture file recorded by the
+// capture package.
+func readCapture(r io.Reader, typ *cmpp.Type, fn func(*frame)) error {
+	cr, err := capture.NewReader(r)
+	if err != nil {
+		return err
+	}
+	if *typ == 0 && (cr.Type() == cmpp.V30 || cr.Type() == cmpp.V21 || cr.Type() == cmpp.V20) {
+		*typ = cr.Type()
+	}
+	for {
+		rec, err := cr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		conn := fmt.Sprintf("conn#%d", rec.ConnId)
+		f := &frame{
+			time: rec.Time,
+			conv: conn,
+			data: rec.Data,
+		}
+		if rec.Dir == capture.Sent {
+			f.src, f.dst = "local", conn
+		} else {
+			f.src, f.dst = conn, "local"
+		}
+		if len(f.data) < int(cmpp.CMPP_HEADER_LEN) {
+			f.err = errTruncatedFrame
+		}
+		fn(f)
+	}
+}
+
+// readHex reads the hex dumps. A dump is made of the lines of hex
+// bytes, optionally led by an offset ending with ':', such as the
+// output of xxd, hexdump -C, tcpdump -x or -X. The text after two
+// spaces, e.g. the ASCII column, is ignored. The dumps are separated
+// by the lines not in hex, e.g. the packet lines of tcpdump. A dump
+// of an IP packet is reassembled into its tcp stream, the other
+// dumps are joined into one stream of frames.
+func readHex(r io.Reader, fn func(*frame)) error {
+	raw := &splitter{emit: fn}
+	asm := newAssembler(0, fn)
+
+	var dump []byte
+	flush := func() {
+		if len(dump) == 0 {
+			return
+		}
+		if isIPPacket(dump) {
+			asm.ipPacket(dump, time.Time{})
+		} else {
+			raw.Write(dump)
+		}
+		dump = nil
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		b, ok := parseHexLine(sc.Text())
+		if !ok {
+			flush()
+			continue
+		}
+		dump = append(dump, b...)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	flush()
+	asm.close()
+	raw.close()
+	return nil
+}
+
+// parseHexLine parses a line of a hex dump. It returns false if the
+// line is not in hex.
+func parseHexLine(line string) ([]byte, bool) {
+	line = strings.TrimSpace(line)
+	if i := strings.Index(line, "|"); i >= 0 {
+		// hexdump -C, with an offset not ended by ':', and the
+		// ASCII column between '|'s.
+		line = line[:i]
+		if fs := strings.Fields(line); len(fs) > 0 && isOffset(fs[0]) {
+			line = strings.Join(fs[1:], " ")
+		}
+	} else {
+		if i := strings.Index(line, ":"); i >= 0 && isOffset(line[:i]) {
+			line = strings.TrimLeft(line[i+1:], " \t")
+		}
+		if i := strings.Index(line, "  "); i >= 0 {
+			line = line[:i] // the ASCII column.
+		}
+	}
+
+	var b []byte
+	for _, tok := range strings.FieldsFunc(line, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ','
+	}) {
+		tok = strings.TrimPrefix(strings.TrimPrefix(tok, "0x"), "0X")
+		d, err := hex.DecodeString(tok)
+		if err != nil {
+			return nil, false
+		}
+		b = append(b, d...)
+	}
+	return b, len(b) > 0
+}
+
+// isOffset reports whether s is the offset of a hex dump line.
+func isOffset(s string) bool {
+	s = strings.TrimPrefix(s, "0x")
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !unicode.Is(unicode.ASCII_Hex_Digit, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitter splits a byte stream into frames. The bytes that do not
+// look like a frame header are skipped, so that it resyncs after a
+// gap in the stream, or if the stream starts in the middle of a frame.
+type splitter struct {
+	buf  []byte
+	emit func(*frame)
+
+	// the template of the frames emitted.
+	tmpl frame
+}
+
+func (s *splitter) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	s.split()
+	return len(p), nil
+}
+
+func (s *splitter) split() {
+	skipped := 0
+	for len(s.buf) >= int(cmpp.CMPP_HEADER_LEN) {
+		n := frameLen(s.buf)
+		if n < 0 {
+			s.buf = s.buf[1:]
+			skipped++
+			continue
+		}
+		if len(s.buf) < n {
+			break
+		}
+		s.skip(skipped)
+		skipped = 0
+
+		f := s.tmpl
+		f.data = append([]byte(nil), s.buf[:n]...)
+		s.emit(&f)
+		s.buf = s.buf[n:]
+	}
+	s.skip(skipped)
+
+	// do not keep the bytes of the frames emitted alive.
+	if len(s.buf) == 0 {
+		s.buf = nil
+	}
+}
+
+func (s *splitter) skip(n int) {
+	if n == 0 {
+		return
+	}
+	f := s.tmpl
+	f.err = fmt.Errorf("%d bytes skipped, not in any frame", n)
+	s.emit(&f)
+}
+
+// close reports the bytes left, which are not a whole frame.
+func (s *splitter) close() {
+	if len(s.buf) == 0 {
+		return
+	}
+	f := s.tmpl
+	f.data, f.err = s.buf, errTruncatedFrame
+	s.emit(&f)
+	s.buf = nil
+}
+
+// frameLen returns the Total_Length in the frame header at the start
+// of b, or -1 if b does not start with a frame header.
+func frameLen(b []byte) int {
+	n := binary.BigEndian.Uint32(b)
+	if n < cmpp.CMPP_HEADER_LEN || n > cmpp.CMPP3_PACKET_MAX {
+		return -1
+	}
+	id := cmpp.CommandId(binary.BigEndian.Uint32(b[4:]))
+	if !id.IsRequest() && !(id > cmpp.CMPP_RESPONSE_MIN && id < cmpp.CMPP_RESPONSE_MAX) {
+		return -1
+	}
+	return int(n)
+}
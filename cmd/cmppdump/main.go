@@ -0,0 +1,145 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Cmppdump decodes the cmpp traffic in hex dumps, raw frame streams,
+// libpcap files or capture files, and prints the frames as a table
+// or as JSON objects, one per line.
+//
+// Usage:
+//
+//	cmppdump [flags] [file]
+//
+// The input is read from the standard input if no file is given.
+// The flags are:
+//
+//	-f format
+//		the input format: hex, raw, pcap or capture. By default
+//		it is guessed from the content.
+//	-v version
+//		the protocol version: 2, 3 or auto. In the auto mode, the
+//		version of a connection is the one in its connect request,
+//		or the one decoding its frames exactly.
+//	-o output
+//		the output format: table or json. The default is table.
+//	-port port
+//		only read the tcp streams from or to port in a pcap file.
+//
+// For example, to decode the cmpp traffic on port 7890:
+//
+//	tcpdump -i any -w cmpp.pcap tcp port 7890
+//	cmppdump -o json cmpp.pcap
+//
+// or to decode a frame copied from a log:
+//
+//	echo 0000002700000001... | cmppdump
+//
+// The message contents are converted to UTF-8 from UCS2 or GB18030,
+// the status reports in the deliver requests are decoded, and the
+// Msg_Ids are split into their components.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+func main() {
+	format := flag.String("f", "", "the input format: hex, raw, pcap or capture (default guessed from the content)")
+	version := flag.String("v", "auto", "the protocol version: 2, 3 or auto")
+	output := flag.String("o", "table", "the output format: table or json")
+	port := flag.Int("port", 0, "only read the tcp streams from or to port in a pcap file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: cmppdump [flags] [file]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(*format, *version, *output, *port, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "cmppdump:", err)
+		os.Exit(1)
+	}
+}
+
+func run(format, version, output string, port int, args []string) error {
+	var typ cmpp.Type
+	switch version {
+	case "2":
+		typ = cmpp.V21
+	case "3":
+		typ = cmpp.V30
+	case "auto":
+	default:
+		return fmt.Errorf("unknown protocol version %q", version)
+	}
+
+	in := io.Reader(os.Stdin)
+	if len(args) > 1 {
+		return fmt.Errorf("too many files")
+	}
+	if len(args) == 1 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	var p printer
+	switch output {
+	case "table":
+		p = newTablePrinter(w)
+	case "json":
+		p = newJSONPrinter(w)
+	default:
+		return fmt.Errorf("unknown output format %q", output)
+	}
+
+	if err := dump(in, format, typ, port, p); err != nil {
+		return err
+	}
+	return p.flush()
+}
+
+// dump reads the frames from r in format, and prints them with p.
+// If format is empty, it is guessed from the content.
+func dump(r io.Reader, format string, typ cmpp.Type, port int, p printer) error {
+	br := bufio.NewReader(r)
+	if format == "" {
+		head, _ := br.Peek(512)
+		format = guessFormat(head)
+	}
+
+	var d *dumper
+	var perr error
+	err := readFrames(br, format, port, &typ, func(f *frame) {
+		if d == nil {
+			// typ may be set by the capture file header.
+			d = newDumper(typ)
+		}
+		if perr == nil {
+			perr = p.print(d.decode(f))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return perr
+}
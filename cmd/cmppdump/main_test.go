@@ -0,0 +1,309 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+	"github.com/bigwhite/gocmpp/capture"
+	"github.com/bigwhite/gocmpp/utils"
+)
+
+func pack(t *testing.T, p cmpp.Packer, seqId uint32) []byte {
+	data, err := p.Pack(seqId)
+	if err != nil {
+		t.Fatalf("pack %T error: %v", p, err)
+	}
+	return data
+}
+
+// collect dumps the input into records.
+func collect(t *testing.T, in []byte, format string, typ cmpp.Type) []*record {
+	var rs []*record
+	p := printerFunc(func(r *record) error {
+		rs = append(rs, r)
+		return nil
+	})
+	if err := dump(bytes.NewReader(in), format, typ, 0, p); err != nil {
+		t.Fatal("dump error:", err)
+	}
+	return rs
+}
+
+type printerFunc func(r *record) error
+
+func (f printerFunc) print(r *record) error { return f(r) }
+func (f printerFunc) flush() error          { return nil }
+
+func TestDumpHex(t *testing.T) {
+	ucs2, _ := cmpputils.Utf8ToUcs2("你好")
+	submit := pack(t, &cmpp.Cmpp3SubmitReqPkt{
+		PkTotal:        1,
+		PkNumber:       1,
+		MsgFmt:         8,
+		FeeType:        "02",
+		DestUsrTl:      1,
+		DestTerminalId: []string{"13500002696"},
+		MsgLength:      uint8(len(ucs2)),
+		MsgContent:     ucs2,
+	}, 7)
+	rsp := pack(t, &cmpp.Cmpp3SubmitRspPkt{MsgId: 0xb2b9da8000010000}, 7)
+
+	// one frame in plain hex, the other in the xxd format.
+	var in bytes.Buffer
+	in.WriteString(hex.EncodeToString(submit) + "\n\n")
+	for i := 0; i < len(rsp); i += 16 {
+		end := i + 16
+		if end > len(rsp) {
+			end = len(rsp)
+		}
+		in.WriteString(strings.Repeat("0", 7) + hex.EncodeToString([]byte{byte(i)})[1:] + ": ")
+		for j := i; j < end; j += 2 {
+			in.WriteString(hex.EncodeToString(rsp[j:min(j+2, end)]) + " ")
+		}
+		in.WriteString(" ................\n")
+	}
+
+	rs := collect(t, in.Bytes(), "", 0)
+	if len(rs) != 2 {
+		t.Fatalf("records: actual [%d], wanted [2]", len(rs))
+	}
+	if r := rs[0]; r.Command != "CMPP_SUBMIT" || r.SeqId != 7 || r.Version != "cmpp30" ||
+		r.Content != "你好" || r.Error != "" {
+		t.Errorf("submit record: %+v", r)
+	}
+	wanted := cmpp.MsgIdParts{Month: 11, Day: 5, Hour: 14, Minute: 29, Second: 42, GatewayId: 1}
+	if r := rs[1]; r.Command != "CMPP_SUBMIT_RESP" || r.MsgId == nil || *r.MsgId != wanted {
+		t.Errorf("submit response record: %+v", r)
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func TestDumpReceipt(t *testing.T) {
+	rpt, _ := (&cmpp.CmppReceiptPkt{
+		MsgId:          0xb2b9da8000010001,
+		Stat:           "DELIVRD",
+		SubmitTime:     "1711051429",
+		DoneTime:       "1711051430",
+		DestTerminalId: "13500002696",
+		SmscSequence:   3,
+	}).Pack()
+	gb, _ := cmpputils.Utf8ToGB18030("中文")
+	var in []byte
+	in = append(in, pack(t, &cmpp.Cmpp2DeliverReqPkt{
+		RegisterDelivery: 1,
+		MsgLength:        uint8(len(rpt)),
+		MsgContent:       string(rpt),
+	}, 1)...)
+	in = append(in, 0xff, 0xff) // garbage between the frames.
+	in = append(in, pack(t, &cmpp.Cmpp2DeliverReqPkt{
+		MsgFmt:     15,
+		MsgLength:  uint8(len(gb)),
+		MsgContent: gb,
+	}, 2)...)
+	in = append(in, 0, 0, 0, 20) // a truncated frame.
+
+	rs := collect(t, in, "raw", 0)
+	if len(rs) != 4 {
+		t.Fatalf("records: actual [%d], wanted [4]", len(rs))
+	}
+	r := rs[0]
+	if r.Version != "cmpp21" || r.Receipt == nil || r.Receipt.Stat != "DELIVRD" ||
+		r.ReceiptMsgId.Seq != 1 || r.Receipt.SmscSequence != 3 {
+		t.Errorf("receipt record: %+v, %+v", r, r.Receipt)
+	}
+	if r := rs[1]; r.Error != "2 bytes skipped, not in any frame" {
+		t.Errorf("garbage record: %+v", r)
+	}
+	if r := rs[2]; r.Content != "中文" || r.Version != "cmpp21" {
+		t.Errorf("deliver record: %+v", r)
+	}
+	if r := rs[3]; r.Error != errTruncatedFrame.Error() || r.Hex != "00000014" {
+		t.Errorf("truncated record: %+v", r)
+	}
+}
+
+// pcapFile builds a pcap file of ethernet frames.
+type pcapFile struct {
+	bytes.Buffer
+}
+
+func newPcapFile() *pcapFile {
+	f := &pcapFile{}
+	var h [24]byte
+	binary.LittleEndian.PutUint32(h[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(h[4:], 2)
+	binary.LittleEndian.PutUint16(h[6:], 4)
+	binary.LittleEndian.PutUint32(h[16:], 65535)
+	binary.LittleEndian.PutUint32(h[20:], linkEthernet)
+	f.Write(h[:])
+	return f
+}
+
+// segment writes a tcp segment from port sp to dp.
+func (f *pcapFile) segment(t time.Time, sp, dp uint16, seq uint32, syn bool, payload []byte) {
+	tcp := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp[0:], sp)
+	binary.BigEndian.PutUint16(tcp[2:], dp)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12] = 5 << 4
+	tcp[13] = 0x10
+	if syn {
+		tcp[13] = 0x02
+	}
+	tcp = append(tcp, payload...)
+
+	ip := make([]byte, 20, 20+len(tcp))
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+	ip[8], ip[9] = 64, protoTCP
+	copy(ip[12:], []byte{10, 0, 0, 1})
+	copy(ip[16:], []byte{10, 0, 0, 2})
+	if sp == 7890 {
+		copy(ip[12:], []byte{10, 0, 0, 2})
+		copy(ip[16:], []byte{10, 0, 0, 1})
+	}
+	ip = append(ip, tcp...)
+
+	eth := make([]byte, 14, 14+len(ip))
+	binary.BigEndian.PutUint16(eth[12:], etherTypeIPv4)
+	eth = append(eth, ip...)
+
+	var h [16]byte
+	binary.LittleEndian.PutUint32(h[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(h[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(h[8:], uint32(len(eth)))
+	binary.LittleEndian.PutUint32(h[12:], uint32(len(eth)))
+	f.Write(h[:])
+	f.Write(eth)
+}
+
+func TestDumpPcap(t *testing.T) {
+	conn := pack(t, &cmpp.CmppConnReqPkt{SrcAddr: "900001", AuthSrc: string(make([]byte, 16)), Version: cmpp.V21}, 1)
+	connRsp := pack(t, &cmpp.Cmpp2ConnRspPkt{Version: cmpp.V21, AuthIsmg: string(make([]byte, 16))}, 1)
+	submit := pack(t, &cmpp.Cmpp2SubmitReqPkt{MsgLength: 5, MsgContent: "hello", DestUsrTl: 1, DestTerminalId: []string{"13500002696"}}, 2)
+	active := pack(t, &cmpp.CmppActiveTestReqPkt{}, 3)
+
+	t0 := time.Unix(1500000000, 0)
+	const cp, sp = 40000, 7890
+	f := newPcapFile()
+	f.segment(t0, cp, sp, 99, true, nil)
+	f.segment(t0, sp, cp, 499, true, nil)
+	f.segment(t0, cp, sp, 100, false, conn)
+	f.segment(t0.Add(time.Millisecond), sp, cp, 500, false, connRsp)
+	// the submit in two segments out of order, the second one
+	// retransmitted, followed by an active test.
+	seq := uint32(100 + len(conn))
+	f.segment(t0.Add(2*time.Millisecond), cp, sp, seq+10, false, submit[10:])
+	f.segment(t0.Add(3*time.Millisecond), cp, sp, seq, false, submit[:10])
+	f.segment(t0.Add(4*time.Millisecond), cp, sp, seq+10, false, submit[10:])
+	seq += uint32(len(submit))
+	f.segment(t0.Add(5*time.Millisecond), cp, sp, seq, false, active)
+
+	var buf bytes.Buffer
+	if err := dump(bytes.NewReader(f.Bytes()), "", 0, 0, newJSONPrinter(&buf)); err != nil {
+		t.Fatal("dump error:", err)
+	}
+
+	var cmds []string
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var r struct {
+			Time    time.Time
+			Src     string
+			Version string
+			Command string
+			Content string
+			Error   string
+		}
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal("decode json error:", err)
+		}
+		if r.Error != "" {
+			t.Errorf("%s error: %s", r.Command, r.Error)
+		}
+		if r.Version != "cmpp21" {
+			t.Errorf("%s version: actual [%s], wanted [cmpp21]", r.Command, r.Version)
+		}
+		if r.Command == "CMPP_SUBMIT" {
+			if r.Content != "hello" || r.Src != "10.0.0.1:40000" ||
+				!r.Time.Equal(t0.Add(3*time.Millisecond)) {
+				t.Errorf("submit record: %+v", r)
+			}
+		}
+		cmds = append(cmds, r.Command)
+	}
+	wanted := "CMPP_CONNECT CMPP_CONNECT_RESP CMPP_SUBMIT CMPP_ACTIVE_TEST"
+	if s := strings.Join(cmds, " "); s != wanted {
+		t.Errorf("commands: actual [%s], wanted [%s]", s, wanted)
+	}
+}
+
+func TestDumpCapture(t *testing.T) {
+	var in bytes.Buffer
+	w, _ := capture.NewWriter(&in, cmpp.V21)
+	w.WriteRecord(&capture.Record{
+		Time:   time.Unix(1500000000, 0),
+		Dir:    capture.Received,
+		ConnId: 3,
+		Data:   pack(t, &cmpp.Cmpp2SubmitRspPkt{Result: 8}, 5),
+	})
+	w.Flush()
+
+	var out bytes.Buffer
+	p := newTablePrinter(&out)
+	if err := dump(&in, "", 0, 0, p); err != nil {
+		t.Fatal("dump error:", err)
+	}
+	p.flush()
+	s := out.String()
+	for _, sub := range []string{"conn#3 > local", "cmpp21", "CMPP_SUBMIT_RESP", "Result=8"} {
+		if !strings.Contains(s, sub) {
+			t.Errorf("%q is not in the output:\n%s", sub, s)
+		}
+	}
+}
+
+func TestParseHexLine(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		hex  string
+	}{
+		{"0000000c00000008", "0000000c00000008"},
+		{"00 00 00 0c 0x00, 0x00", "0000000c0000"},
+		{"00000000: 0000 000c 8000 0008  ........", "0000000c80000008"},
+		{"\t0x0010:  0a00 0001 0a00  ......", "0a0000010a00"},
+		{"00000000  00 00 00 0c 00 00 00 08  00 00 00 01 |............|", "0000000c0000000800000001"},
+		{"12:00:00.000000 IP 10.0.0.1.40000 > 10.0.0.2.7890: Flags [P.]", ""},
+		{"", ""},
+	} {
+		b, ok := parseHexLine(tt.line)
+		if hex.EncodeToString(b) != tt.hex || ok != (tt.hex != "") {
+			t.Errorf("parseHexLine(%q): actual [%x %v], wanted [%s]", tt.line, b, ok, tt.hex)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+	"unicode/utf8"
+)
+
+// printer prints the records.
+type printer interface {
+	print(r *record) error
+	flush() error
+}
+
+// jsonPrinter prints a JSON object per line.
+type jsonPrinter struct {
+	enc *json.Encoder
+}
+
+func newJSONPrinter(w io.Writer) *jsonPrinter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &jsonPrinter{enc: enc}
+}
+
+func (p *jsonPrinter) print(r *record) error {
+	return p.enc.Encode(r)
+}
+
+func (p *jsonPrinter) flush() error {
+	return nil
+}
+
+// tablePrinter prints a line per record, with the fields of the
+// packet not zero in the last column.
+type tablePrinter struct {
+	tw *tabwriter.Writer
+}
+
+func newTablePrinter(w io.Writer) *tablePrinter {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tFLOW\tVERSION\tCOMMAND\tSEQ\tLEN\tDETAILS")
+	return &tablePrinter{tw: tw}
+}
+
+func (p *tablePrinter) print(r *record) error {
+	tm := "-"
+	if r.Time != nil {
+		tm = r.Time.Format("15:04:05.000000")
+	}
+	flow := "-"
+	if r.Src != "" || r.Dst != "" {
+		flow = r.Src + " > " + r.Dst
+	}
+	cmd, ver := "-", "-"
+	if r.Command != "" {
+		cmd = r.Command
+	}
+	if r.Version != "" {
+		ver = r.Version
+	}
+	_, err := fmt.Fprintf(p.tw, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
+		tm, flow, ver, cmd, r.SeqId, r.Length, details(r))
+	return err
+}
+
+func (p *tablePrinter) flush() error {
+	return p.tw.Flush()
+}
+
+// details formats the fields of r.Packet not zero, and the content,
+// the Msg_Id and the status report decoded.
+func details(r *record) string {
+	var b strings.Builder
+	add := func(k, v string) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(v)
+	}
+
+	if r.Packet != nil {
+		v := reflect.ValueOf(r.Packet).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			name := v.Type().Field(i).Name
+			switch name {
+			case "SeqId", "MsgContent", "MsgLength":
+				continue
+			}
+			if s, ok := formatField(v.Field(i)); ok {
+				add(name, s)
+			}
+		}
+	}
+	if r.MsgId != nil {
+		add("msg_id", r.MsgId.String())
+	}
+	if r.Content != "" {
+		add("content", strconv.Quote(r.Content))
+	}
+	if r.Binary != "" {
+		add("content_hex", r.Binary)
+	}
+	if rpt := r.Receipt; rpt != nil {
+		add("receipt", fmt.Sprintf("{msg_id=%s stat=%s submit=%s done=%s dest=%s smsc_seq=%d}",
+			r.ReceiptMsgId, rpt.Stat, rpt.SubmitTime, rpt.DoneTime, rpt.DestTerminalId, rpt.SmscSequence))
+	}
+	if r.Error != "" {
+		add("error", strconv.Quote(r.Error))
+	}
+	if r.Hex != "" {
+		add("hex", r.Hex)
+	}
+	return b.String()
+}
+
+// formatField formats a field of a packet. It returns false if the
+// field is zero.
+func formatField(v reflect.Value) (string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.Len() == 0 {
+			return "", false
+		}
+		return formatString(v.String()), true
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return "", false
+		}
+		ss := make([]string, v.Len())
+		for i := range ss {
+			ss[i] = formatString(v.Index(i).String())
+		}
+		return "[" + strings.Join(ss, ",") + "]", true
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() == 0 {
+			return "", false
+		}
+		return strconv.FormatUint(v.Uint(), 10), true
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() == 0 {
+			return "", false
+		}
+		return "0x" + strconv.FormatInt(v.Int(), 16), true // the Version.
+	}
+	return "", false
+}
+
+// formatString quotes s if it is printable, or formats it in hex,
+// e.g. the AuthenticatorSource.
+func formatString(s string) string {
+	if utf8.ValidString(s) && strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsPrint(r)
+	}) < 0 {
+		return strconv.Quote(s)
+	}
+	return "0x" + hex.EncodeToString([]byte(s))
+}
@@ -0,0 +1,387 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// The magic numbers of the capture files, as read in big endian.
+const (
+	pcapMagic            = 0xa1b2c3d4
+	pcapMagicNano        = 0xa1b23c4d
+	pcapMagicSwapped     = 0xd4c3b2a1
+	pcapMagicNanoSwapped = 0x4d3cb2a1
+	pcapNGMagic          = 0x0a0d0d0a
+)
+
+// The link types supported.
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLoop     = 108
+	linkSLL      = 113
+	linkSLL2     = 276
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+
+	protoTCP = 6
+
+	// maxPending is the number of out of order segments buffered in
+	// a stream. Beyond it, the missing segments are taken as lost.
+	maxPending = 256
+)
+
+var errPcapHeader = errors.New("invalid pcap file header")
+
+// readPcap reads the cmpp frames in the tcp streams of a libpcap file.
+// If port is not 0, only the streams from or to port are read.
+func readPcap(r io.Reader, port int, fn func(*frame)) error {
+	var h [24]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return errPcapHeader
+	}
+
+	var order binary.ByteOrder = binary.BigEndian
+	nano := false
+	switch binary.BigEndian.Uint32(h[:]) {
+	case pcapMagic:
+	case pcapMagicNano:
+		nano = true
+	case pcapMagicSwapped:
+		order = binary.LittleEndian
+	case pcapMagicNanoSwapped:
+		order, nano = binary.LittleEndian, true
+	case pcapNGMagic:
+		return errPcapNG
+	default:
+		return errPcapHeader
+	}
+	link := order.Uint32(h[20:])
+	switch link {
+	case linkNull, linkEthernet, linkRaw, linkLoop, linkSLL, linkSLL2:
+	default:
+		return fmt.Errorf("unsupported pcap link type %d", link)
+	}
+
+	asm := newAssembler(port, fn)
+	var ph [16]byte
+	var data []byte
+	for {
+		if _, err := io.ReadFull(r, ph[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("truncated pcap file: %v", err)
+		}
+		sec, frac := order.Uint32(ph[0:]), order.Uint32(ph[4:])
+		n := order.Uint32(ph[8:])
+		if n > 1<<20 {
+			return fmt.Errorf("invalid pcap record length %d", n)
+		}
+		if cap(data) < int(n) {
+			data = make([]byte, n)
+		}
+		data = data[:n]
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("truncated pcap file: %v", err)
+		}
+
+		t := time.Unix(int64(sec), int64(frac)*1000)
+		if nano {
+			t = time.Unix(int64(sec), int64(frac))
+		}
+		if ip := linkPayload(link, data); ip != nil {
+			asm.ipPacket(ip, t)
+		}
+	}
+	asm.close()
+	return nil
+}
+
+// linkPayload returns the IP packet in the link layer frame data,
+// or nil if it carries no IP packet.
+func linkPayload(link uint32, data []byte) []byte {
+	switch link {
+	case linkNull, linkLoop:
+		if len(data) < 4 {
+			return nil
+		}
+		return data[4:]
+	case linkEthernet:
+		if len(data) < 14 {
+			return nil
+		}
+		typ, data := binary.BigEndian.Uint16(data[12:]), data[14:]
+		for typ == etherTypeVLAN && len(data) >= 4 {
+			typ, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+		}
+		if typ != etherTypeIPv4 && typ != etherTypeIPv6 {
+			return nil
+		}
+		return data
+	case linkRaw:
+		return data
+	case linkSLL:
+		if len(data) < 16 {
+			return nil
+		}
+		return data[16:]
+	case linkSLL2:
+		if len(data) < 20 {
+			return nil
+		}
+		return data[20:]
+	}
+	return nil
+}
+
+// isIPPacket reports whether data starts with an IPv4 or IPv6 header
+// of a tcp segment. A cmpp frame never does, since its Total_Length
+// is less than 1<<24.
+func isIPPacket(data []byte) bool {
+	if len(data) < 20 {
+		return false
+	}
+	switch data[0] >> 4 {
+	case 4:
+		return data[0]&0x0f >= 5 && data[9] == protoTCP
+	case 6:
+		return len(data) >= 40 && data[6] == protoTCP
+	}
+	return false
+}
+
+// segment is a tcp segment.
+type segment struct {
+	src, dst string
+	seq      uint32
+	syn      bool
+	payload  []byte
+}
+
+// parseIP parses the tcp segment in the IP packet data. It returns
+// false if data is not a tcp segment, or a fragment of it.
+func parseIP(data []byte) (*segment, bool) {
+	if len(data) < 20 {
+		return nil, false
+	}
+
+	var srcIP, dstIP net.IP
+	var tcp []byte
+	switch data[0] >> 4 {
+	case 4:
+		hl := int(data[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(data[2:]))
+		if hl < 20 || total < hl || len(data) < total || data[9] != protoTCP {
+			return nil, false
+		}
+		if binary.BigEndian.Uint16(data[6:])&0x3fff != 0 {
+			return nil, false // a fragment.
+		}
+		srcIP, dstIP = net.IP(data[12:16]), net.IP(data[16:20])
+		tcp = data[hl:total] // without the link layer padding.
+	case 6:
+		if len(data) < 40 || data[6] != protoTCP {
+			return nil, false
+		}
+		total := 40 + int(binary.BigEndian.Uint16(data[4:]))
+		if len(data) < total {
+			return nil, false
+		}
+		srcIP, dstIP = net.IP(data[8:24]), net.IP(data[24:40])
+		tcp = data[40:total]
+	default:
+		return nil, false
+	}
+
+	if len(tcp) < 20 {
+		return nil, false
+	}
+	off := int(tcp[12]>>4) * 4
+	if off < 20 || off > len(tcp) {
+		return nil, false
+	}
+	srcPort, dstPort := binary.BigEndian.Uint16(tcp[0:]), binary.BigEndian.Uint16(tcp[2:])
+	return &segment{
+		src:     net.JoinHostPort(srcIP.String(), strconv.Itoa(int(srcPort))),
+		dst:     net.JoinHostPort(dstIP.String(), strconv.Itoa(int(dstPort))),
+		seq:     binary.BigEndian.Uint32(tcp[4:]),
+		syn:     tcp[13]&0x02 != 0,
+		payload: tcp[off:],
+	}, true
+}
+
+// stream is one direction of a tcp connection being reassembled.
+type stream struct {
+	started bool
+	next    uint32 // the sequence number of the next byte expected.
+	pending map[uint32][]byte
+	split   splitter
+}
+
+// assembler reassembles the tcp streams, and splits them into frames.
+type assembler struct {
+	port    string
+	emit    func(*frame)
+	streams map[string]*stream
+	order   []string // the keys of streams, in the order they are seen.
+}
+
+func newAssembler(port int, emit func(*frame)) *assembler {
+	a := &assembler{
+		emit:    emit,
+		streams: make(map[string]*stream),
+	}
+	if port != 0 {
+		a.port = strconv.Itoa(port)
+	}
+	return a
+}
+
+// ipPacket feeds an IP packet captured at t to the assembler.
+func (a *assembler) ipPacket(data []byte, t time.Time) {
+	seg, ok := parseIP(data)
+	if !ok || !a.match(seg) {
+		return
+	}
+
+	key := seg.src + ">" + seg.dst
+	s := a.streams[key]
+	if s == nil {
+		s = &stream{pending: make(map[uint32][]byte)}
+		s.split.emit = a.emit
+		s.split.tmpl = frame{src: seg.src, dst: seg.dst, conv: conversation(seg.src, seg.dst)}
+		a.streams[key] = s
+		a.order = append(a.order, key)
+	}
+	s.split.tmpl.time = t
+
+	if seg.syn {
+		s.started, s.next = true, seg.seq+1
+		s.pending = make(map[uint32][]byte)
+		s.split.buf = nil
+		return
+	}
+	if len(seg.payload) == 0 {
+		return
+	}
+	if !s.started {
+		// the capture starts in the middle of the connection.
+		s.started, s.next = true, seg.seq
+	}
+	s.segment(seg.seq, seg.payload)
+}
+
+func (a *assembler) match(seg *segment) bool {
+	if a.port == "" {
+		return true
+	}
+	_, sp, _ := net.SplitHostPort(seg.src)
+	_, dp, _ := net.SplitHostPort(seg.dst)
+	return sp == a.port || dp == a.port
+}
+
+// segment adds the payload at seq to the stream.
+func (s *stream) segment(seq uint32, payload []byte) {
+	if int32(seq-s.next) > 0 {
+		// out of order, keep it until the gap is filled.
+		if _, ok := s.pending[seq]; !ok {
+			s.pending[seq] = append([]byte(nil), payload...)
+		}
+		if len(s.pending) > maxPending {
+			s.skipGap()
+		}
+		return
+	}
+
+	s.append(seq, payload)
+	for len(s.pending) > 0 {
+		progressed := false
+		for seq, p := range s.pending {
+			if int32(seq-s.next) <= 0 {
+				delete(s.pending, seq)
+				s.append(seq, p)
+				progressed = true
+			}
+		}
+		if !progressed {
+			return
+		}
+	}
+}
+
+// append adds the part after s.next of the payload at seq, which
+// does not start after s.next.
+func (s *stream) append(seq uint32, payload []byte) {
+	overlap := int(s.next - seq)
+	if overlap >= len(payload) {
+		return // a retransmission.
+	}
+	payload = payload[overlap:]
+	s.next += uint32(len(payload))
+	s.split.Write(payload)
+}
+
+// skipGap gives up the missing bytes before the first pending
+// segment, and goes on from it.
+func (s *stream) skipGap() {
+	first := true
+	var min uint32
+	for seq := range s.pending {
+		if first || int32(seq-min) < 0 {
+			min, first = seq, false
+		}
+	}
+
+	s.split.close()
+	f := s.split.tmpl
+	f.err = fmt.Errorf("%d bytes lost in the capture", min-s.next)
+	s.split.emit(&f)
+
+	s.next = min
+	p := s.pending[min]
+	delete(s.pending, min)
+	s.segment(min, p)
+}
+
+// close reports the bytes left in the streams.
+func (a *assembler) close() {
+	for _, key := range a.order {
+		s := a.streams[key]
+		for len(s.pending) > 0 {
+			s.skipGap()
+		}
+		s.split.close()
+	}
+}
+
+// conversation returns the key of the tcp connection between a and b.
+func conversation(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + "-" + b
+}
@@ -0,0 +1,183 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+// Defaults of the config.
+const (
+	defaultAddr      = ":7890"
+	defaultControl   = "127.0.0.1:7891"
+	defaultSlowDelay = 5 * time.Second
+)
+
+// config is the configuration of the simulator, read from a JSON file.
+type config struct {
+	Addr      string    `json:"addr"`       // the address of the cmpp service.
+	Control   string    `json:"control"`    // the address of the control API.
+	Version   string    `json:"version"`    // the protocol version: "2" or "3".
+	GatewayId uint32    `json:"gateway_id"` // the gateway id in the MsgIds.
+	Seed      int64     `json:"seed"`       // the seed of the randomness, 0 for the current time.
+	Accounts  []account `json:"accounts"`
+	Reports   reports   `json:"reports"`
+	Faults    faults    `json:"faults"`
+}
+
+// account is an SP allowed to log in.
+type account struct {
+	Account string `json:"account"`
+	Secret  string `json:"secret"`
+	SrcId   string `json:"src_id"` // the default DestId of the MO messages.
+}
+
+// reports configures the status reports of the submits asking for
+// them. A report is sent Delay plus a random duration up to Jitter
+// after the submit response, with a Stat drawn from Stats, which
+// maps the Stats to their weights.
+type reports struct {
+	Delay  duration           `json:"delay"`
+	Jitter duration           `json:"jitter"`
+	Stats  map[string]float64 `json:"stats"`
+}
+
+// faults configures the faults injected in the submit responses.
+// The rates are the probabilities of a submit being answered with
+// the flow control result, not being answered, being answered after
+// SlowDelay, or having its connection closed abruptly.
+type faults struct {
+	FlowControl float64  `json:"flow_control"`
+	Drop        float64  `json:"drop"`
+	Slow        float64  `json:"slow"`
+	SlowDelay   duration `json:"slow_delay"`
+	Disconnect  float64  `json:"disconnect"`
+}
+
+func (f *faults) validate() error {
+	var sum float64
+	for _, r := range []float64{f.FlowControl, f.Drop, f.Slow, f.Disconnect} {
+		if r < 0 || r > 1 {
+			return fmt.Errorf("invalid fault rate %v, not in [0, 1]", r)
+		}
+		sum += r
+	}
+	if sum > 1 {
+		return errors.New("the fault rates add up to more than 1")
+	}
+	if f.SlowDelay < 0 {
+		return errors.New("negative slow_delay")
+	}
+	if f.SlowDelay == 0 {
+		f.SlowDelay = duration(defaultSlowDelay)
+	}
+	return nil
+}
+
+// duration is a time.Duration in the form of "1.5s" in JSON.
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// loadConfig reads the config in file.
+func loadConfig(file string) (*config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(data)
+}
+
+// parseConfig parses the config in data, and fills the defaults.
+func parseConfig(data []byte) (*config, error) {
+	var c config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+
+	if c.Addr == "" {
+		c.Addr = defaultAddr
+	}
+	if c.Control == "" {
+		c.Control = defaultControl
+	}
+	if _, err := c.typ(); err != nil {
+		return nil, err
+	}
+	if len(c.Accounts) == 0 {
+		return nil, errors.New("invalid config: no accounts")
+	}
+	for _, a := range c.Accounts {
+		if a.Account == "" || len(a.Account) > 6 {
+			return nil, fmt.Errorf("invalid config: invalid account %q", a.Account)
+		}
+	}
+
+	if c.Reports.Delay < 0 || c.Reports.Jitter < 0 {
+		return nil, errors.New("invalid config: negative report delay")
+	}
+	if len(c.Reports.Stats) == 0 {
+		c.Reports.Stats = map[string]float64{"DELIVRD": 1}
+	}
+	var sum float64
+	for stat, w := range c.Reports.Stats {
+		if len(stat) > 7 || w < 0 {
+			return nil, fmt.Errorf("invalid config: invalid report stat %q: %v", stat, w)
+		}
+		sum += w
+	}
+	if sum == 0 {
+		return nil, errors.New("invalid config: all the report stats weigh 0")
+	}
+
+	if err := c.Faults.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	return &c, nil
+}
+
+// typ returns the protocol version of c.
+func (c *config) typ() (cmpp.Type, error) {
+	switch c.Version {
+	case "2":
+		return cmpp.V21, nil
+	case "3", "":
+		return cmpp.V30, nil
+	}
+	return 0, fmt.Errorf("invalid config: unknown protocol version %q", c.Version)
+}
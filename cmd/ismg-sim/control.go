@@ -0,0 +1,121 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+// controlHandler returns the handler of the control API of s:
+//
+//	POST /mo           send an MO message, see mo.
+//	GET  /sessions     list the sessions logged in.
+//	GET  /faults       show the faults injected.
+//	PUT  /faults       replace the faults injected.
+//	POST /disconnect   close the connections of ?account= abruptly.
+func controlHandler(s *simulator) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mo", func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, http.MethodPost) {
+			return
+		}
+		var m mo
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		msgId, err := s.sendMO(&m)
+		switch err {
+		case nil:
+		case errNoSession:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reply(w, struct {
+			MsgId string `json:"msg_id"`
+		}{strconv.FormatUint(msgId, 10)})
+	})
+
+	mux.HandleFunc("/sessions", func(w http.ResponseWriter, r *http.Request) {
+		if allow(w, r, http.MethodGet) {
+			reply(w, s.sessionList())
+		}
+	})
+
+	mux.HandleFunc("/faults", func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, http.MethodGet, http.MethodPut) {
+			return
+		}
+		if r.Method == http.MethodPut {
+			var f faults
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&f); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := s.setFaults(f); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.log.Info("set the faults", cmpp.Field{Key: "faults", Value: s.currentFaults()})
+		}
+		reply(w, s.currentFaults())
+	})
+
+	mux.HandleFunc("/disconnect", func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, http.MethodPost) {
+			return
+		}
+		account := r.URL.Query().Get("account")
+		if _, ok := s.accounts[account]; !ok {
+			http.Error(w, errUnknownAccount.Error(), http.StatusBadRequest)
+			return
+		}
+		reply(w, struct {
+			Closed int `json:"closed"`
+		}{s.disconnect(account)})
+	})
+	return mux
+}
+
+// allow replies 405 and returns false unless the method of r is one
+// of methods.
+func allow(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	for _, m := range methods {
+		w.Header().Add("Allow", m)
+	}
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// reply writes v in JSON.
+func reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,147 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Ismg-sim simulates an ISMG(the cmpp gateway) for the integration
+// tests of the SPs.
+//
+// Usage:
+//
+//	ismg-sim [flags] config.json
+//
+// The flags are:
+//
+//	-debug
+//		log the packets sent and received.
+//
+// It logs the SPs in with the accounts in the config file, answers
+// the submits with the MsgIds of the real format, and sends back
+// the status reports of the submits with RegisteredDelivery set,
+// after a delay and with the Stats drawn from a distribution.
+// Faults may be injected into the submit responses: the flow control
+// result, the responses dropped, the responses slowed down, and the
+// connections closed abruptly.
+//
+// The config file is like:
+//
+//	{
+//		"addr": ":7890",
+//		"control": "127.0.0.1:7891",
+//		"version": "3",
+//		"gateway_id": 1,
+//		"accounts": [
+//			{"account": "900001", "secret": "888888", "src_id": "10690001"}
+//		],
+//		"reports": {
+//			"delay": "2s",
+//			"jitter": "1s",
+//			"stats": {"DELIVRD": 95, "UNDELIV": 3, "EXPIRED": 2}
+//		},
+//		"faults": {
+//			"flow_control": 0.01,
+//			"drop": 0.01,
+//			"slow": 0.01,
+//			"slow_delay": "5s",
+//			"disconnect": 0.001
+//		}
+//	}
+//
+// The version is "2" or "3"; the reports are all DELIVRD without
+// delay, and no faults are injected, by default.
+//
+// The control API, served in JSON on the control address, sends MO
+// messages on demand and changes the faults at run time:
+//
+//	curl -d '{"account": "900001", "src": "13500002696", "content": "hello"}' \
+//		http://127.0.0.1:7891/mo
+//	curl http://127.0.0.1:7891/sessions
+//	curl -X PUT -d '{"drop": 0.5}' http://127.0.0.1:7891/faults
+//	curl -X POST http://127.0.0.1:7891/disconnect?account=900001
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+func main() {
+	debug := flag.Bool("debug", false, "log the packets sent and received")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: ismg-sim [flags] config.json\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *debug); err != nil {
+		fmt.Fprintln(os.Stderr, "ismg-sim:", err)
+		os.Exit(1)
+	}
+}
+
+func run(file string, debug bool) error {
+	c, err := loadConfig(file)
+	if err != nil {
+		return err
+	}
+
+	level := cmpp.LevelInfo
+	if debug {
+		level = cmpp.LevelDebug
+	}
+	logger := cmpp.NewStdLogger(log.New(os.Stderr, "ismg-sim: ", log.LstdFlags), level)
+
+	s, err := newSimulator(c, logger)
+	if err != nil {
+		return err
+	}
+
+	ctl, err := net.Listen("tcp", c.Control)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := http.Serve(ctl, controlHandler(s)); err != nil {
+			logger.Error("serve the control API error", cmpp.Field{Key: cmpp.LogKeyError, Value: err})
+		}
+	}()
+
+	srv := newServer(c.Addr, s)
+	logger.Info("listening", cmpp.Field{Key: "addr", Value: c.Addr},
+		cmpp.Field{Key: "control", Value: c.Control})
+	return srv.ListenAndServe()
+}
+
+// newServer returns the cmpp server of s.
+func newServer(addr string, s *simulator) *cmpp.Server {
+	return &cmpp.Server{
+		Addr:    addr,
+		Handler: s,
+		Typ:     s.typ,
+		T:       10 * time.Second,
+		N:       3,
+		Window:  16,
+		Logger:  s.log,
+
+		SendInterceptors: []cmpp.Interceptor{s.hooks.Intercept},
+	}
+}
@@ -0,0 +1,426 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+	"github.com/bigwhite/gocmpp/internal/ismg"
+)
+
+// errors of the simulator
+var (
+	errNoSession       = errors.New("the account has no session")
+	errUnknownAccount  = errors.New("unknown account")
+	errContentTooLong  = errors.New("the message content is longer than 140 bytes")
+	errNoSrcTerminalId = errors.New("no src terminal id")
+)
+
+// deferSlack is added to the delay of a slow response as the timeout
+// of the deferred response, so that it never times out first.
+const deferSlack = time.Second
+
+// The time layout of the SubmitTime and DoneTime in the reports.
+const reportTimeLayout = "0601021504"
+
+// A fault is the fault injected in a submit response.
+type fault int
+
+const (
+	faultNone fault = iota
+	faultDisconnect
+	faultDrop
+	faultFlowControl
+	faultSlow
+)
+
+// simulator is a cmpp.Handler acting as an ISMG: it logs the SPs in,
+// answers the submits and sends back the status reports and the MO
+// messages.
+type simulator struct {
+	typ      cmpp.Type
+	accounts map[string]account
+	secrets  map[string]string // the secrets of the accounts.
+	reports  reports
+	stats    []string // the keys of reports.Stats, sorted.
+	log      cmpp.Logger
+
+	msgIds  ismg.MsgIdGenerator
+	smscSeq uint32         // the last SmscSequence of the reports.
+	hooks   ismg.SentHooks // scheduling the reports once the submit responses are sent.
+
+	rmu sync.Mutex
+	rnd *rand.Rand
+
+	fmu    sync.RWMutex
+	faults faults
+
+	mu       sync.Mutex
+	sessions map[string][]*session // the sessions by account.
+}
+
+// session is a logged in connection.
+type session struct {
+	conn      *cmpp.Conn
+	loginTime time.Time
+}
+
+func newSimulator(c *config, log cmpp.Logger) (*simulator, error) {
+	typ, err := c.typ()
+	if err != nil {
+		return nil, err
+	}
+	seed := c.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	s := &simulator{
+		typ:      typ,
+		accounts: make(map[string]account),
+		secrets:  make(map[string]string),
+		reports:  c.Reports,
+		log:      log,
+		msgIds:   ismg.MsgIdGenerator{GatewayId: c.GatewayId},
+		rnd:      rand.New(rand.NewSource(seed)),
+		faults:   c.Faults,
+		sessions: make(map[string][]*session),
+	}
+	for _, a := range c.Accounts {
+		s.accounts[a.Account] = a
+		s.secrets[a.Account] = a.Secret
+	}
+	for stat := range c.Reports.Stats {
+		s.stats = append(s.stats, stat)
+	}
+	sort.Strings(s.stats)
+	return s, nil
+}
+
+// ServeCmpp implements the cmpp.Handler interface.
+func (s *simulator) ServeCmpp(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+	switch req := p.Packer.(type) {
+	case *cmpp.CmppConnReqPkt:
+		return false, s.login(r, p, req, l)
+	case *cmpp.Cmpp2SubmitReqPkt:
+		s.submit(r, p, l, req.RegisteredDelivery, req.SrcId, req.DestTerminalId)
+	case *cmpp.Cmpp3SubmitReqPkt:
+		s.submit(r, p, l, req.RegisteredDelivery, req.SrcId, req.DestTerminalId)
+	}
+	// the other requests are answered with the default responses.
+	return false, nil
+}
+
+// login checks the account and the authenticator in req, and sets
+// the status of the connect response.
+func (s *simulator) login(r *cmpp.Response, p *cmpp.Packet, req *cmpp.CmppConnReqPkt, l cmpp.Logger) error {
+	name := strings.TrimRight(req.SrcAddr, "\x00")
+	if status := ismg.Login(r, req, s.secrets, s.typ); status != 0 {
+		err := cmpp.ConnRspStatusErrMap[status]
+		l.Warn("refuse the login", cmpp.Field{Key: cmpp.LogKeyAccount, Value: name},
+			cmpp.Field{Key: cmpp.LogKeyError, Value: err})
+		return err
+	}
+
+	s.addSession(name, p.Conn)
+	return nil
+}
+
+// addSession adds the connection logged in as account, until it
+// is closed.
+func (s *simulator) addSession(account string, c *cmpp.Conn) {
+	ss := &session{conn: c, loginTime: time.Now()}
+	s.mu.Lock()
+	s.sessions[account] = append(s.sessions[account], ss)
+	s.mu.Unlock()
+
+	go func() {
+		<-c.Done()
+		s.hooks.Forget(c)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		list := s.sessions[account]
+		for i := range list {
+			if list[i] == ss {
+				list = append(list[:i:i], list[i+1:]...)
+				break
+			}
+		}
+		if len(list) == 0 {
+			delete(s.sessions, account)
+		} else {
+			s.sessions[account] = list
+		}
+	}()
+}
+
+// conn returns the connection to send the packets to account on:
+// c if it is still open, or else any other connection of account.
+func (s *simulator) conn(account string, c *cmpp.Conn) *cmpp.Conn {
+	if c != nil && c.State() != cmpp.CONN_CLOSED {
+		return c
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ss := range s.sessions[account] {
+		if ss.conn.State() != cmpp.CONN_CLOSED {
+			return ss.conn
+		}
+	}
+	return nil
+}
+
+// submit answers a submit request, injecting a fault maybe, and
+// schedules the status reports to dests if registered is 1.
+func (s *simulator) submit(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger, registered uint8, srcId string, dests []string) {
+	f := s.fault()
+	switch f {
+	case faultDisconnect:
+		l.Info("inject a fault: disconnect", cmpp.Field{Key: cmpp.LogKeySeqId, Value: r.SeqId})
+		r.Packer = nil
+		p.Conn.Close()
+		return
+	case faultDrop:
+		l.Info("inject a fault: drop the response", cmpp.Field{Key: cmpp.LogKeySeqId, Value: r.SeqId})
+		r.Packer = nil
+		return
+	case faultFlowControl:
+		l.Info("inject a fault: flow control", cmpp.Field{Key: cmpp.LogKeySeqId, Value: r.SeqId})
+		ismg.SetSubmitRsp(r.Packer, 0, uint32(cmpp.ErrnoSubmitNotPassFlowControl))
+		return
+	}
+
+	now := time.Now()
+	msgId := s.msgIds.Next(now)
+	ismg.SetSubmitRsp(r.Packer, msgId, 0)
+	if f == faultSlow {
+		delay := time.Duration(s.currentFaults().SlowDelay)
+		l.Info("inject a fault: slow response", cmpp.Field{Key: cmpp.LogKeySeqId, Value: r.SeqId},
+			cmpp.Field{Key: "delay", Value: delay})
+		r.Defer(delay + deferSlack)
+		time.AfterFunc(delay, func() { r.Finish() })
+	}
+
+	if registered != 1 {
+		return
+	}
+	account := p.Session().Account()
+	for _, dest := range dests {
+		rpt := &cmpp.CmppReceiptPkt{
+			MsgId:          msgId,
+			Stat:           s.reportStat(),
+			SubmitTime:     now.Format(reportTimeLayout),
+			DestTerminalId: dest,
+		}
+		delay := s.reportDelay()
+		s.hooks.Add(p.Conn, r.SeqId, func() {
+			time.AfterFunc(delay, func() {
+				s.sendReport(account, p.Conn, srcId, rpt)
+			})
+		})
+	}
+}
+
+// sendReport sends the status report rpt of a submit from srcId
+// to account, on c if it is still open.
+func (s *simulator) sendReport(account string, c *cmpp.Conn, srcId string, rpt *cmpp.CmppReceiptPkt) {
+	rpt.DoneTime = time.Now().Format(reportTimeLayout)
+	rpt.SmscSequence = atomic.AddUint32(&s.smscSeq, 1)
+	d, err := ismg.NewReport(rpt, srcId)
+	if err != nil {
+		s.log.Error("pack the status report error", cmpp.Field{Key: cmpp.LogKeyError, Value: err})
+		return
+	}
+	if _, err := s.deliver(account, c, d); err != nil {
+		s.log.Warn("send the status report error", cmpp.Field{Key: cmpp.LogKeyAccount, Value: account},
+			cmpp.Field{Key: "msg_id", Value: rpt.MsgId}, cmpp.Field{Key: cmpp.LogKeyError, Value: err})
+	}
+}
+
+// mo is an MO message sent through the control API.
+type mo struct {
+	Account   string `json:"account"`
+	Src       string `json:"src"`        // the SrcTerminalId.
+	Dest      string `json:"dest"`       // the DestId, the src_id of the account by default.
+	ServiceId string `json:"service_id"` // optional.
+	Content   string `json:"content"`    // in UTF-8.
+
+	// MsgFmt is the msg_fmt to encode Content in, ASCII if Content
+	// is ASCII only and UCS2 otherwise by default.
+	MsgFmt *uint8 `json:"msg_fmt,omitempty"`
+}
+
+// sendMO sends the MO message m to its account, and returns the
+// MsgId of the deliver request.
+func (s *simulator) sendMO(m *mo) (uint64, error) {
+	a, ok := s.accounts[m.Account]
+	if !ok {
+		return 0, errUnknownAccount
+	}
+	if m.Src == "" {
+		return 0, errNoSrcTerminalId
+	}
+	dest := m.Dest
+	if dest == "" {
+		dest = a.SrcId
+	}
+	msgFmt := ismg.ContentMsgFmt(m.Content)
+	if m.MsgFmt != nil {
+		msgFmt = *m.MsgFmt
+	}
+
+	d, err := ismg.NewMO(m.Src, dest, m.Content, msgFmt)
+	if err != nil {
+		return 0, err
+	}
+	if len(d.MsgContent) > 140 {
+		return 0, errContentTooLong
+	}
+	d.ServiceId = m.ServiceId
+	return s.deliver(m.Account, nil, d)
+}
+
+// deliver sends d to account, on c if it is still open, and returns
+// the MsgId of the deliver request.
+func (s *simulator) deliver(account string, c *cmpp.Conn, d *ismg.Deliver) (uint64, error) {
+	c = s.conn(account, c)
+	if c == nil {
+		return 0, errNoSession
+	}
+
+	d.MsgId = s.msgIds.Next(time.Now())
+	if err := c.SendPkt(d.Packet(s.typ), c.NextSeqId()); err != nil {
+		return 0, err
+	}
+	return d.MsgId, nil
+}
+
+// fault draws the fault to inject in a submit response.
+func (s *simulator) fault() fault {
+	f := s.currentFaults()
+	x := s.float64()
+	for _, c := range []struct {
+		rate  float64
+		fault fault
+	}{
+		{f.Disconnect, faultDisconnect},
+		{f.Drop, faultDrop},
+		{f.FlowControl, faultFlowControl},
+		{f.Slow, faultSlow},
+	} {
+		if x < c.rate {
+			return c.fault
+		}
+		x -= c.rate
+	}
+	return faultNone
+}
+
+func (s *simulator) currentFaults() faults {
+	s.fmu.RLock()
+	defer s.fmu.RUnlock()
+	return s.faults
+}
+
+func (s *simulator) setFaults(f faults) error {
+	if err := f.validate(); err != nil {
+		return err
+	}
+	s.fmu.Lock()
+	defer s.fmu.Unlock()
+	s.faults = f
+	return nil
+}
+
+// reportStat draws the Stat of a status report.
+func (s *simulator) reportStat() string {
+	var sum float64
+	for _, stat := range s.stats {
+		sum += s.reports.Stats[stat]
+	}
+	x := s.float64() * sum
+	for _, stat := range s.stats {
+		if x < s.reports.Stats[stat] {
+			return stat
+		}
+		x -= s.reports.Stats[stat]
+	}
+	return s.stats[len(s.stats)-1]
+}
+
+// reportDelay draws the delay of a status report.
+func (s *simulator) reportDelay() time.Duration {
+	d := time.Duration(s.reports.Delay)
+	if j := time.Duration(s.reports.Jitter); j > 0 {
+		s.rmu.Lock()
+		d += time.Duration(s.rnd.Int63n(int64(j)))
+		s.rmu.Unlock()
+	}
+	return d
+}
+
+func (s *simulator) float64() float64 {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	return s.rnd.Float64()
+}
+
+// sessionInfo describes a session in the control API.
+type sessionInfo struct {
+	Account    string    `json:"account"`
+	RemoteAddr string    `json:"remote_addr"`
+	LoginTime  time.Time `json:"login_time"`
+}
+
+// sessionList returns the sessions of all the accounts.
+func (s *simulator) sessionList() []sessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []sessionInfo{}
+	for account, ss := range s.sessions {
+		for _, x := range ss {
+			list = append(list, sessionInfo{
+				Account:    account,
+				RemoteAddr: x.conn.RemoteAddr().String(),
+				LoginTime:  x.loginTime,
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Account != list[j].Account {
+			return list[i].Account < list[j].Account
+		}
+		return list[i].LoginTime.Before(list[j].LoginTime)
+	})
+	return list
+}
+
+// disconnect closes all the connections of account abruptly, and
+// returns the number of the connections closed.
+func (s *simulator) disconnect(account string) int {
+	s.mu.Lock()
+	ss := append([]*session(nil), s.sessions[account]...)
+	s.mu.Unlock()
+	for _, x := range ss {
+		x.conn.Close()
+	}
+	return len(ss)
+}
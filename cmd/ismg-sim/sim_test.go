@@ -0,0 +1,286 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+	"github.com/bigwhite/gocmpp/utils"
+)
+
+const testConfig = `{
+	"version": "3",
+	"gateway_id": 7,
+	"seed": 1,
+	"accounts": [{"account": "900001", "secret": "888888", "src_id": "10690001"}],
+	"reports": {"delay": "10ms", "stats": {"DELIVRD": 1}}
+}`
+
+// startSim starts a simulator with the config, and returns it with
+// the listener of its cmpp service.
+func startSim(t *testing.T, config string) (*simulator, net.Listener) {
+	c, err := parseConfig([]byte(config))
+	if err != nil {
+		t.Fatal("parse config error:", err)
+	}
+	s, err := newSimulator(c, cmpp.NewNopLogger())
+	if err != nil {
+		t.Fatal("new simulator error:", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen error:", err)
+	}
+	go newServer("", s).Serve(ln)
+	return s, ln
+}
+
+func connect(t *testing.T, addr string) *cmpp.Client {
+	cli := cmpp.NewClient(cmpp.V30)
+	if err := cli.Connect(addr, "900001", "888888", time.Second); err != nil {
+		t.Fatal("connect error:", err)
+	}
+	return cli
+}
+
+func submit(t *testing.T, cli *cmpp.Client, registered uint8, dests ...string) uint32 {
+	seqId, err := cli.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{
+		RegisteredDelivery: registered,
+		MsgSrc:             "900001",
+		FeeType:            "02",
+		SrcId:              "10690001",
+		DestUsrTl:          uint8(len(dests)),
+		DestTerminalId:     dests,
+		MsgLength:          5,
+		MsgContent:         "hello",
+	})
+	if err != nil {
+		t.Fatal("send submit error:", err)
+	}
+	return seqId
+}
+
+// recv receives a packet, answering the active tests.
+func recv(t *testing.T, cli *cmpp.Client, timeout time.Duration) (interface{}, error) {
+	for {
+		i, err := cli.RecvAndUnpackPkt(timeout)
+		if p, ok := i.(*cmpp.CmppActiveTestReqPkt); ok {
+			cli.SendRspPkt(&cmpp.CmppActiveTestRspPkt{}, p.SeqId)
+			continue
+		}
+		return i, err
+	}
+}
+
+func TestSubmitAndReport(t *testing.T) {
+	_, ln := startSim(t, testConfig)
+	defer ln.Close()
+	cli := connect(t, ln.Addr().String())
+	defer cli.Disconnect()
+	seqId := submit(t, cli, 1, "13500002696", "13500002697")
+
+	i, err := recv(t, cli, time.Second)
+	if err != nil {
+		t.Fatal("receive submit response error:", err)
+	}
+	rsp, ok := i.(*cmpp.Cmpp3SubmitRspPkt)
+	if !ok || rsp.SeqId != seqId || rsp.Result != 0 {
+		t.Fatalf("submit response: %v", i)
+	}
+	if parts := cmpp.SplitMsgId(rsp.MsgId); parts.GatewayId != 7 || parts.Month != uint8(time.Now().Month()) {
+		t.Errorf("MsgId: %v", parts)
+	}
+
+	dests := map[string]bool{}
+	for len(dests) < 2 {
+		i, err := recv(t, cli, time.Second)
+		if err != nil {
+			t.Fatal("receive status report error:", err)
+		}
+		d, ok := i.(*cmpp.Cmpp3DeliverReqPkt)
+		if !ok || d.RegisterDelivery != 1 || d.DestId != "10690001" {
+			t.Fatalf("status report: %v", i)
+		}
+		var rpt cmpp.CmppReceiptPkt
+		if err := rpt.Unpack([]byte(d.MsgContent)); err != nil {
+			t.Fatal("unpack status report error:", err)
+		}
+		if rpt.MsgId != rsp.MsgId || rpt.Stat != "DELIVRD" || rpt.DestTerminalId != d.SrcTerminalId {
+			t.Errorf("status report: %v", &rpt)
+		}
+		dests[rpt.DestTerminalId] = true
+		cli.SendRspPkt(&cmpp.Cmpp3DeliverRspPkt{MsgId: d.MsgId}, d.SeqId)
+	}
+}
+
+func TestLoginRefused(t *testing.T) {
+	_, ln := startSim(t, testConfig)
+	defer ln.Close()
+	addr := ln.Addr().String()
+	cli := cmpp.NewClient(cmpp.V30)
+	err := cli.Connect(addr, "900001", "wrong", time.Second)
+	if !errors.Is(err, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnAuthFailed]) {
+		t.Errorf("connect with a wrong secret: %v", err)
+	}
+	cli = cmpp.NewClient(cmpp.V30)
+	err = cli.Connect(addr, "900002", "888888", time.Second)
+	if !errors.Is(err, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnInvalidSrcAddr]) {
+		t.Errorf("connect with an unknown account: %v", err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	s, ln := startSim(t, testConfig)
+	defer ln.Close()
+	cli := connect(t, ln.Addr().String())
+	defer cli.Disconnect()
+
+	s.setFaults(faults{FlowControl: 1})
+	submit(t, cli, 0, "13500002696")
+	i, err := recv(t, cli, time.Second)
+	if rsp, ok := i.(*cmpp.Cmpp3SubmitRspPkt); err != nil || !ok ||
+		rsp.Result != uint32(cmpp.ErrnoSubmitNotPassFlowControl) {
+		t.Errorf("flow control: %v, %v", i, err)
+	}
+
+	s.setFaults(faults{Drop: 1})
+	submit(t, cli, 0, "13500002696")
+	i, err = recv(t, cli, 200*time.Millisecond)
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Errorf("drop: %v, %v", i, err)
+	}
+
+	s.setFaults(faults{Slow: 1, SlowDelay: duration(300 * time.Millisecond)})
+	start := time.Now()
+	submit(t, cli, 0, "13500002696")
+	i, err = recv(t, cli, time.Second)
+	if _, ok := i.(*cmpp.Cmpp3SubmitRspPkt); err != nil || !ok || time.Since(start) < 300*time.Millisecond {
+		t.Errorf("slow: %v, %v after %v", i, err, time.Since(start))
+	}
+
+	s.setFaults(faults{Disconnect: 1})
+	submit(t, cli, 0, "13500002696")
+	if i, err = recv(t, cli, time.Second); err == nil {
+		t.Errorf("disconnect: %v", i)
+	}
+
+	if err := s.setFaults(faults{Drop: 0.6, Slow: 0.6}); err == nil {
+		t.Errorf("set faults adding up to more than 1: no error")
+	}
+}
+
+func TestControlAPI(t *testing.T) {
+	s, ln := startSim(t, testConfig)
+	defer ln.Close()
+	ts := httptest.NewServer(controlHandler(s))
+	defer ts.Close()
+
+	post := func(path, data string) (int, string) {
+		rsp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(data))
+		if err != nil {
+			t.Fatal("post error:", err)
+		}
+		defer rsp.Body.Close()
+		body, err := ioutil.ReadAll(rsp.Body)
+		if err != nil {
+			t.Fatal("read body error:", err)
+		}
+		return rsp.StatusCode, string(body)
+	}
+
+	mo := `{"account": "900001", "src": "13500002696", "content": "你好"}`
+	if code, body := post("/mo", mo); code != http.StatusConflict {
+		t.Errorf("MO without session: %d %s", code, body)
+	}
+
+	cli := connect(t, ln.Addr().String())
+	defer cli.Disconnect()
+	code, body := post("/mo", mo)
+	if code != http.StatusOK {
+		t.Fatalf("MO: %d %s", code, body)
+	}
+	i, err := recv(t, cli, time.Second)
+	if err != nil {
+		t.Fatal("receive MO error:", err)
+	}
+	d, ok := i.(*cmpp.Cmpp3DeliverReqPkt)
+	if !ok || d.MsgFmt != cmpp.MsgFmtUCS2 || d.SrcTerminalId != "13500002696" || d.DestId != "10690001" {
+		t.Fatalf("MO: %v", i)
+	}
+	if content, _ := cmpputils.Ucs2ToUtf8(d.MsgContent); content != "你好" {
+		t.Errorf("MO content: %q", content)
+	}
+
+	rsp, err := http.Get(ts.URL + "/sessions")
+	if err != nil {
+		t.Fatal("get sessions error:", err)
+	}
+	var list []sessionInfo
+	json.NewDecoder(rsp.Body).Decode(&list)
+	rsp.Body.Close()
+	if len(list) != 1 || list[0].Account != "900001" {
+		t.Errorf("sessions: %+v", list)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/faults", strings.NewReader(`{"drop": 0.5}`))
+	if rsp, err := http.DefaultClient.Do(req); err != nil || rsp.StatusCode != http.StatusOK {
+		t.Errorf("put faults: %v, %v", rsp, err)
+	} else {
+		rsp.Body.Close()
+	}
+	if f := s.currentFaults(); f.Drop != 0.5 || f.SlowDelay != duration(defaultSlowDelay) {
+		t.Errorf("faults: %+v", f)
+	}
+
+	if code, body := post("/disconnect?account=900001", ""); code != http.StatusOK || !strings.Contains(body, `"closed": 1`) {
+		t.Errorf("disconnect: %d %s", code, body)
+	}
+	if i, err := recv(t, cli, time.Second); err == nil {
+		t.Errorf("receive after disconnect: %v", i)
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	for _, c := range []string{
+		`{}`,
+		`{"accounts": [{"account": "9000001"}]}`,
+		`{"version": "4", "accounts": [{"account": "900001"}]}`,
+		`{"accounts": [{"account": "900001"}], "faults": {"drop": 2}}`,
+		`{"accounts": [{"account": "900001"}], "reports": {"stats": {"DELIVRD": 0}}}`,
+		`{"accounts": [{"account": "900001"}], "reports": {"delay": "soon"}}`,
+		`{"accounts": [{"account": "900001"}], "unknown": 1}`,
+	} {
+		if _, err := parseConfig([]byte(c)); err == nil {
+			t.Errorf("parse %s: no error", c)
+		}
+	}
+
+	c, err := parseConfig([]byte(`{"accounts": [{"account": "900001"}]}`))
+	if err != nil {
+		t.Fatal("parse config error:", err)
+	}
+	if c.Addr != defaultAddr || c.Control != defaultControl || c.Reports.Stats["DELIVRD"] != 1 {
+		t.Errorf("defaults: %+v", c)
+	}
+}
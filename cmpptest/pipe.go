@@ -0,0 +1,265 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpptest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrListenerClosed is returned by the in-memory listener and its
+// dialer once the listener is closed.
+var ErrListenerClosed = errors.New("cmpptest: listener closed")
+
+// pipeAddr is the address of the in-memory connections.
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// pipeListener is an in-memory net.Listener, whose connections are
+// made by its Dial.
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, ErrListenerClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// Dial implements the cmpp.Dialer interface, the network and
+// address are ignored.
+func (l *pipeListener) Dial(network, address string) (net.Conn, error) {
+	client, server := newPipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		client.Close()
+		server.Close()
+		return nil, ErrListenerClosed
+	}
+}
+
+// pipeBuffer is a direction of a pipe. Unlike the one of net.Pipe,
+// it buffers the data written, so that a write never waits for the
+// peer to read, like a socket.
+type pipeBuffer struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	closed   bool
+	deadline time.Time     // of the reads.
+	notify   chan struct{} // closed and renewed on any change.
+}
+
+func newPipeBuffer() *pipeBuffer {
+	return &pipeBuffer{notify: make(chan struct{})}
+}
+
+// signal wakes up the reads waiting. b.mu must be held.
+func (b *pipeBuffer) signal() {
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+func (b *pipeBuffer) read(p []byte) (int, error) {
+	for {
+		b.mu.Lock()
+		if b.buf.Len() > 0 {
+			n, _ := b.buf.Read(p)
+			b.mu.Unlock()
+			return n, nil
+		}
+		if b.closed {
+			b.mu.Unlock()
+			return 0, io.EOF
+		}
+		deadline, notify := b.deadline, b.notify
+		b.mu.Unlock()
+
+		if deadline.IsZero() {
+			<-notify
+			continue
+		}
+		d := time.Until(deadline)
+		if d <= 0 {
+			return 0, timeoutError{}
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-notify:
+			t.Stop()
+		case <-t.C:
+			return 0, timeoutError{}
+		}
+	}
+}
+
+func (b *pipeBuffer) write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+	b.buf.Write(p)
+	b.signal()
+	return len(p), nil
+}
+
+func (b *pipeBuffer) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		b.signal()
+	}
+}
+
+func (b *pipeBuffer) setDeadline(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deadline = t
+	b.signal()
+}
+
+// timeoutError is returned by the reads timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "cmpptest: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// pipeConn is an end of an in-memory connection.
+type pipeConn struct {
+	r, w *pipeBuffer
+}
+
+// newPipe returns the two ends of a new in-memory connection.
+func newPipe() (net.Conn, net.Conn) {
+	a, b := newPipeBuffer(), newPipeBuffer()
+	return &pipeConn{r: a, w: b}, &pipeConn{r: b, w: a}
+}
+
+func (c *pipeConn) Read(p []byte) (int, error)  { return c.r.read(p) }
+func (c *pipeConn) Write(p []byte) (int, error) { return c.w.write(p) }
+
+// Close closes both directions, the data written but not read by
+// the peer is still readable.
+func (c *pipeConn) Close() error {
+	c.r.close()
+	c.w.close()
+	return nil
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return pipeAddr{} }
+func (c *pipeConn) RemoteAddr() net.Addr { return pipeAddr{} }
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.r.setDeadline(t)
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.r.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline does nothing, as the writes never block.
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// trackListener tracks the connections it accepts, to close them
+// along with itself.
+type trackListener struct {
+	net.Listener
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+func (l *trackListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		c.Close()
+		return nil, ErrListenerClosed
+	}
+	if l.conns == nil {
+		l.conns = make(map[net.Conn]struct{})
+	}
+	tc := &trackConn{Conn: c, l: l}
+	l.conns[tc] = struct{}{}
+	return tc, nil
+}
+
+// Close closes the listener and all the connections accepted.
+func (l *trackListener) Close() error {
+	err := l.Listener.Close()
+	l.mu.Lock()
+	l.closed = true
+	conns := l.conns
+	l.conns = nil
+	l.mu.Unlock()
+	for c := range conns {
+		c.Close()
+	}
+	return err
+}
+
+// trackConn removes itself from its listener once closed.
+type trackConn struct {
+	net.Conn
+	l *trackListener
+}
+
+func (c *trackConn) Close() error {
+	c.l.mu.Lock()
+	delete(c.l.conns, c)
+	c.l.mu.Unlock()
+	return c.Conn.Close()
+}
@@ -0,0 +1,386 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmpptest provides a cmpp server for the tests of the code
+// built on cmpp.Client, like net/http/httptest does for http.
+//
+// A Server is a real cmpp.Server listening on a loopback address, or
+// on an in-memory listener. It logs the clients in, answers the
+// submits, optionally sends back the status reports, pushes the
+// deliver requests on demand, and records every packet it receives:
+//
+//	ts := cmpptest.NewServer(cmpp.V30)
+//	defer ts.Close()
+//	ts.ReportStat = "DELIVRD"
+//
+//	cli, err := ts.Connect("900001", "888888")
+//	... // the code under test submits with cli.
+//
+//	submits, err := ts.WaitReceived(cmpp.CMPP_SUBMIT, 1, time.Second)
+package cmpptest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+	"github.com/bigwhite/gocmpp/internal/ismg"
+)
+
+// errors of the test server
+var (
+	ErrNoConn  = errors.New("cmpptest: no connection logged in")
+	ErrTimeout = errors.New("cmpptest: timed out waiting for the packets")
+)
+
+// DefaultTimeout is the timeout of Connect.
+const DefaultTimeout = 5 * time.Second
+
+// A Server is a cmpp server listening on a loopback address or in
+// memory, for the tests.
+//
+// The fields configuring the behaviors should be set before Start,
+// or before the clients connect to a started Server.
+type Server struct {
+	// Addr is the address the server listens on, in the form of
+	// "127.0.0.1:7890", or "pipe" for an in-memory server.
+	Addr     string
+	Listener net.Listener
+
+	// Config is the underlying server. It may be changed after
+	// NewUnstartedServer and before Start, but its Handler is set,
+	// and interceptors are added to it, by Start.
+	Config *cmpp.Server
+
+	// Accounts maps the accounts allowed to log in to their secrets.
+	// If nil, any account logs in with any secret.
+	Accounts map[string]string
+
+	// Handler optionally handles the packets before the server does.
+	// If it returns false, the server does not handle the packet.
+	Handler cmpp.Handler
+
+	// SubmitResult optionally returns the Result of the response of
+	// a submit request. By default, all the submits succeed.
+	SubmitResult func(req cmpp.Packer) uint32
+
+	// ReportStat, if not empty, is the Stat of the status reports
+	// sent back for the submits asking for them.
+	ReportStat string
+
+	pipe   *pipeListener // the in-memory listener, if any.
+	msgIds ismg.MsgIdGenerator
+	hooks  ismg.SentHooks // sending the status reports after the submit responses.
+
+	mu       sync.Mutex
+	received []cmpp.Pdu
+	notify   chan struct{} // closed and renewed when a packet is received.
+	conns    []*cmpp.Conn  // the connections logged in.
+	wg       sync.WaitGroup
+}
+
+// NewServer starts and returns a new Server of the protocol version
+// typ on a loopback address. The caller should call Close when
+// finished, to shut it down.
+func NewServer(typ cmpp.Type) *Server {
+	s := NewUnstartedServer(typ)
+	s.Start()
+	return s
+}
+
+// NewPipeServer starts and returns a new Server of the protocol
+// version typ in memory. The clients connect to it with Connect,
+// or by dialing with its Dialer.
+func NewPipeServer(typ cmpp.Type) *Server {
+	s := NewUnstartedServer(typ)
+	s.StartPipe()
+	return s
+}
+
+// NewUnstartedServer returns a new Server of the protocol version
+// typ but doesn't start it. After changing its configuration, the
+// caller should call Start or StartPipe.
+func NewUnstartedServer(typ cmpp.Type) *Server {
+	return &Server{
+		Config: &cmpp.Server{
+			Typ:    typ,
+			T:      time.Minute,
+			N:      3,
+			Logger: cmpp.NewNopLogger(),
+		},
+		notify: make(chan struct{}),
+	}
+}
+
+// Start starts the server on a loopback address.
+func (s *Server) Start() {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		if ln, err = net.Listen("tcp6", "[::1]:0"); err != nil {
+			panic(fmt.Sprintf("cmpptest: failed to listen on a port: %v", err))
+		}
+	}
+	s.serve(ln)
+}
+
+// StartPipe starts the server in memory.
+func (s *Server) StartPipe() {
+	s.pipe = newPipeListener()
+	s.serve(s.pipe)
+}
+
+func (s *Server) serve(ln net.Listener) {
+	if s.Listener != nil {
+		panic("cmpptest: server already started")
+	}
+	s.Listener = &trackListener{Listener: ln}
+	s.Addr = ln.Addr().String()
+	s.Config.Handler = cmpp.HandlerFunc(s.serveCmpp)
+	s.Config.RecvInterceptors = append(s.Config.RecvInterceptors, s.record)
+	s.Config.SendInterceptors = append(s.Config.SendInterceptors, s.hooks.Intercept)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.Config.Serve(s.Listener)
+	}()
+}
+
+// Close shuts down the server, closing all the connections.
+func (s *Server) Close() {
+	if s.Listener != nil {
+		s.Listener.Close()
+	}
+	s.wg.Wait()
+}
+
+// Dialer returns the dialer to connect to the server.
+func (s *Server) Dialer() cmpp.Dialer {
+	if s.pipe != nil {
+		return s.pipe
+	}
+	return &net.Dialer{Timeout: DefaultTimeout}
+}
+
+// Connect returns a new client of the protocol version of the server
+// logged in as account with secret.
+func (s *Server) Connect(account, secret string) (*cmpp.Client, error) {
+	cli := cmpp.NewClient(s.Config.Typ)
+	if err := cli.Dial(s.Dialer(), "tcp", s.Addr, account, secret, DefaultTimeout); err != nil {
+		return nil, err
+	}
+	return cli, nil
+}
+
+// record is the receive interceptor recording the packets received.
+func (s *Server) record(f *cmpp.Frame, next func(*cmpp.Frame) error) error {
+	err := next(f)
+	if p, ok := f.Packet.(cmpp.Pdu); ok && err == nil {
+		s.mu.Lock()
+		s.received = append(s.received, p)
+		close(s.notify)
+		s.notify = make(chan struct{})
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// Received returns all the packets received, in the order they
+// arrived.
+func (s *Server) Received() []cmpp.Pdu {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]cmpp.Pdu(nil), s.received...)
+}
+
+// ReceivedOf returns the packets of the command id received.
+func (s *Server) ReceivedOf(id cmpp.CommandId) []cmpp.Pdu {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.receivedOf(id)
+}
+
+func (s *Server) receivedOf(id cmpp.CommandId) []cmpp.Pdu {
+	var ps []cmpp.Pdu
+	for _, p := range s.received {
+		if p.CommandId() == id {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+// WaitReceived waits for at least n packets of the command id to be
+// received, and returns them. It returns the packets received so far
+// and ErrTimeout if the timeout expires first.
+func (s *Server) WaitReceived(id cmpp.CommandId, n int, timeout time.Duration) ([]cmpp.Pdu, error) {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	for {
+		s.mu.Lock()
+		ps, notify := s.receivedOf(id), s.notify
+		s.mu.Unlock()
+		if len(ps) >= n {
+			return ps, nil
+		}
+
+		select {
+		case <-notify:
+		case <-t.C:
+			return ps, ErrTimeout
+		}
+	}
+}
+
+// Reset forgets the packets received.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = nil
+}
+
+// serveCmpp is the handler of the server.
+func (s *Server) serveCmpp(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+	if s.Handler != nil {
+		next, err := s.Handler.ServeCmpp(r, p, l)
+		if err != nil || !next {
+			return false, err
+		}
+	}
+
+	switch req := p.Packer.(type) {
+	case *cmpp.CmppConnReqPkt:
+		return false, s.login(r, p, req)
+	case *cmpp.Cmpp2SubmitReqPkt:
+		s.submit(r, p, req.RegisteredDelivery, req.SrcId, req.DestTerminalId)
+	case *cmpp.Cmpp3SubmitReqPkt:
+		s.submit(r, p, req.RegisteredDelivery, req.SrcId, req.DestTerminalId)
+	}
+	return false, nil
+}
+
+// login checks the account and the authenticator in req.
+func (s *Server) login(r *cmpp.Response, p *cmpp.Packet, req *cmpp.CmppConnReqPkt) error {
+	if status := ismg.Login(r, req, s.Accounts, s.Config.Typ); status != 0 {
+		return cmpp.ConnRspStatusErrMap[status]
+	}
+
+	c := p.Conn
+	s.mu.Lock()
+	s.conns = append(s.conns, c)
+	s.mu.Unlock()
+	go func() {
+		<-c.Done()
+		s.hooks.Forget(c)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i := range s.conns {
+			if s.conns[i] == c {
+				s.conns = append(s.conns[:i:i], s.conns[i+1:]...)
+				break
+			}
+		}
+	}()
+	return nil
+}
+
+// submit answers a submit request, and sends back its status reports
+// if asked for, once the response is sent.
+func (s *Server) submit(r *cmpp.Response, p *cmpp.Packet, registered uint8, srcId string, dests []string) {
+	var result uint32
+	if s.SubmitResult != nil {
+		result = s.SubmitResult(p.Packer)
+	}
+	var msgId uint64
+	if result == 0 {
+		msgId = s.msgIds.Next(time.Now())
+	}
+	ismg.SetSubmitRsp(r.Packer, msgId, result)
+
+	if result != 0 || registered != 1 || s.ReportStat == "" {
+		return
+	}
+	s.hooks.Add(p.Conn, r.SeqId, func() {
+		for _, dest := range dests {
+			s.sendReport(p.Conn, msgId, srcId, dest, s.ReportStat)
+		}
+	})
+}
+
+// Send sends the request p on the connection logged in last, and
+// returns its SeqId.
+func (s *Server) Send(p cmpp.Packer) (uint32, error) {
+	c := s.conn()
+	if c == nil {
+		return 0, ErrNoConn
+	}
+	seqId := c.NextSeqId()
+	return seqId, c.SendPkt(p, seqId)
+}
+
+// conn returns the connection logged in last and still open.
+func (s *Server) conn() *cmpp.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.conns) - 1; i >= 0; i-- {
+		if c := s.conns[i]; c.State() != cmpp.CONN_CLOSED {
+			return c
+		}
+	}
+	return nil
+}
+
+// Deliver sends an MO message from src to dest with content, in
+// ASCII or in UCS2 if content is not ASCII only, and returns the
+// MsgId of the deliver request.
+func (s *Server) Deliver(src, dest, content string) (uint64, error) {
+	d, err := ismg.NewMO(src, dest, content, ismg.ContentMsgFmt(content))
+	if err != nil {
+		return 0, err
+	}
+	return s.deliver(s.conn(), d)
+}
+
+// Report sends a status report of the submit of msgId from srcId to
+// dest, with stat.
+func (s *Server) Report(msgId uint64, srcId, dest, stat string) error {
+	return s.sendReport(s.conn(), msgId, srcId, dest, stat)
+}
+
+func (s *Server) sendReport(c *cmpp.Conn, msgId uint64, srcId, dest, stat string) error {
+	now := time.Now().Format("0601021504")
+	d, err := ismg.NewReport(&cmpp.CmppReceiptPkt{
+		MsgId:          msgId,
+		Stat:           stat,
+		SubmitTime:     now,
+		DoneTime:       now,
+		DestTerminalId: dest,
+	}, srcId)
+	if err != nil {
+		return err
+	}
+	_, err = s.deliver(c, d)
+	return err
+}
+
+// deliver sends d on c, and returns its MsgId.
+func (s *Server) deliver(c *cmpp.Conn, d *ismg.Deliver) (uint64, error) {
+	if c == nil {
+		return 0, ErrNoConn
+	}
+	d.MsgId = s.msgIds.Next(time.Now())
+	return d.MsgId, c.SendPkt(d.Packet(s.Config.Typ), c.NextSeqId())
+}
@@ -0,0 +1,221 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpptest_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+	"github.com/bigwhite/gocmpp/cmpptest"
+	"github.com/bigwhite/gocmpp/utils"
+)
+
+func submit(t *testing.T, cli *cmpp.Client, typ cmpp.Type, registered uint8) uint32 {
+	var p cmpp.Packer = &cmpp.Cmpp3SubmitReqPkt{
+		RegisteredDelivery: registered,
+		FeeType:            "02",
+		SrcId:              "10690001",
+		DestUsrTl:          1,
+		DestTerminalId:     []string{"13500002696"},
+		MsgLength:          5,
+		MsgContent:         "hello",
+	}
+	if typ == cmpp.V21 {
+		p = &cmpp.Cmpp2SubmitReqPkt{
+			RegisteredDelivery: registered,
+			FeeType:            "02",
+			SrcId:              "10690001",
+			DestUsrTl:          1,
+			DestTerminalId:     []string{"13500002696"},
+			MsgLength:          5,
+			MsgContent:         "hello",
+		}
+	}
+	seqId, err := cli.SendReqPkt(p)
+	if err != nil {
+		t.Fatal("send submit error:", err)
+	}
+	return seqId
+}
+
+func recv(t *testing.T, cli *cmpp.Client) interface{} {
+	i, err := cli.RecvAndUnpackPkt(time.Second)
+	if err != nil {
+		t.Fatal("receive error:", err)
+	}
+	return i
+}
+
+func TestServer(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		typ  cmpp.Type
+		new  func(cmpp.Type) *cmpptest.Server
+	}{
+		{"tcp-v30", cmpp.V30, cmpptest.NewServer},
+		{"pipe-v30", cmpp.V30, cmpptest.NewPipeServer},
+		{"pipe-v21", cmpp.V21, cmpptest.NewPipeServer},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ts := c.new(c.typ)
+			defer ts.Close()
+			ts.ReportStat = "DELIVRD"
+
+			cli, err := ts.Connect("900001", "888888")
+			if err != nil {
+				t.Fatal("connect error:", err)
+			}
+			defer cli.Disconnect()
+
+			seqId := submit(t, cli, c.typ, 1)
+			var msgId uint64
+			switch rsp := recv(t, cli).(type) {
+			case *cmpp.Cmpp2SubmitRspPkt:
+				msgId = rsp.MsgId
+				if rsp.SeqId != seqId || rsp.Result != 0 {
+					t.Errorf("submit response: %v", rsp)
+				}
+			case *cmpp.Cmpp3SubmitRspPkt:
+				msgId = rsp.MsgId
+				if rsp.SeqId != seqId || rsp.Result != 0 {
+					t.Errorf("submit response: %v", rsp)
+				}
+			default:
+				t.Fatalf("submit response: %v", rsp)
+			}
+
+			var content string
+			switch d := recv(t, cli).(type) {
+			case *cmpp.Cmpp2DeliverReqPkt:
+				content = d.MsgContent
+			case *cmpp.Cmpp3DeliverReqPkt:
+				content = d.MsgContent
+			default:
+				t.Fatalf("status report: %v", d)
+			}
+			var rpt cmpp.CmppReceiptPkt
+			if err := rpt.Unpack([]byte(content)); err != nil || rpt.MsgId != msgId || rpt.Stat != "DELIVRD" {
+				t.Errorf("status report: %v, %v", &rpt, err)
+			}
+
+			ps, err := ts.WaitReceived(cmpp.CMPP_SUBMIT, 1, time.Second)
+			if err != nil || len(ps) != 1 || ps[0].SequenceId() != seqId {
+				t.Errorf("submits received: %v, %v", ps, err)
+			}
+			if ps := ts.Received(); len(ps) < 2 || ps[0].CommandId() != cmpp.CMPP_CONNECT {
+				t.Errorf("packets received: %v", ps)
+			}
+		})
+	}
+}
+
+func TestServerLogin(t *testing.T) {
+	ts := cmpptest.NewPipeServer(cmpp.V30)
+	defer ts.Close()
+	ts.Accounts = map[string]string{"900001": "888888"}
+
+	if _, err := ts.Connect("900001", "wrong"); !errors.Is(err, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnAuthFailed]) {
+		t.Errorf("connect with a wrong secret: %v", err)
+	}
+	if _, err := ts.Connect("900002", "888888"); !errors.Is(err, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnInvalidSrcAddr]) {
+		t.Errorf("connect with an unknown account: %v", err)
+	}
+	cli, err := ts.Connect("900001", "888888")
+	if err != nil {
+		t.Fatal("connect error:", err)
+	}
+	cli.Disconnect()
+}
+
+func TestServerScripted(t *testing.T) {
+	ts := cmpptest.NewUnstartedServer(cmpp.V30)
+	ts.SubmitResult = func(cmpp.Packer) uint32 {
+		return uint32(cmpp.ErrnoSubmitNotPassFlowControl)
+	}
+	ts.Handler = cmpp.HandlerFunc(func(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+		if _, ok := p.Packer.(*cmpp.CmppQueryReqPkt); ok {
+			r.Packer.(*cmpp.CmppQueryRspPkt).MtTlMsg = 42
+			return false, nil
+		}
+		return true, nil
+	})
+	ts.StartPipe()
+	defer ts.Close()
+
+	if _, err := ts.Deliver("13500002696", "10690001", "hi"); err != cmpptest.ErrNoConn {
+		t.Errorf("deliver without connection: %v", err)
+	}
+
+	cli, err := ts.Connect("900001", "888888")
+	if err != nil {
+		t.Fatal("connect error:", err)
+	}
+	defer cli.Disconnect()
+
+	submit(t, cli, cmpp.V30, 0)
+	if rsp, ok := recv(t, cli).(*cmpp.Cmpp3SubmitRspPkt); !ok || rsp.Result != uint32(cmpp.ErrnoSubmitNotPassFlowControl) {
+		t.Errorf("submit response: %v", rsp)
+	}
+
+	cli.SendReqPkt(&cmpp.CmppQueryReqPkt{Time: "20171105"})
+	if rsp, ok := recv(t, cli).(*cmpp.CmppQueryRspPkt); !ok || rsp.MtTlMsg != 42 {
+		t.Errorf("query response: %v", rsp)
+	}
+
+	if _, err := ts.Deliver("13500002696", "10690001", "你好"); err != nil {
+		t.Fatal("deliver error:", err)
+	}
+	d, ok := recv(t, cli).(*cmpp.Cmpp3DeliverReqPkt)
+	if !ok || d.MsgFmt != cmpp.MsgFmtUCS2 || d.SrcTerminalId != "13500002696" || d.DestId != "10690001" {
+		t.Fatalf("deliver: %v", d)
+	}
+	if content, _ := cmpputils.Ucs2ToUtf8(d.MsgContent); content != "你好" {
+		t.Errorf("deliver content: %q", content)
+	}
+	cli.SendRspPkt(&cmpp.Cmpp3DeliverRspPkt{MsgId: d.MsgId}, d.SeqId)
+	if ps, err := ts.WaitReceived(cmpp.CMPP_DELIVER_RESP, 1, time.Second); err != nil {
+		t.Errorf("deliver responses received: %v, %v", ps, err)
+	}
+
+	if err := ts.Report(7, "10690001", "13500002696", "UNDELIV"); err != nil {
+		t.Fatal("report error:", err)
+	}
+	if d, ok := recv(t, cli).(*cmpp.Cmpp3DeliverReqPkt); !ok || d.RegisterDelivery != 1 {
+		t.Errorf("report: %v", d)
+	}
+
+	ts.Reset()
+	if ps, err := ts.WaitReceived(cmpp.CMPP_SUBMIT, 1, 50*time.Millisecond); err != cmpptest.ErrTimeout || len(ps) != 0 {
+		t.Errorf("wait after reset: %v, %v", ps, err)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	ts := cmpptest.NewPipeServer(cmpp.V30)
+	cli, err := ts.Connect("900001", "888888")
+	if err != nil {
+		t.Fatal("connect error:", err)
+	}
+	defer cli.Disconnect()
+
+	ts.Close()
+	if i, err := cli.RecvAndUnpackPkt(time.Second); err == nil {
+		t.Errorf("receive after close: %v", i)
+	}
+	if _, err := ts.Connect("900001", "888888"); err != cmpptest.ErrListenerClosed {
+		t.Errorf("connect after close: %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// A Decoder reads and decodes cmpp frames from an input stream,
+// such as a captured tcp stream, an archive file or one direction
+// of a proxied connection. It does not set any deadline, wrap the
+// reader if needed.
+type Decoder struct {
+	r   io.Reader
+	typ Type
+	buf []byte
+}
+
+// NewDecoder returns a new decoder that reads the frames of the
+// protocol version typ from r.
+func NewDecoder(r io.Reader, typ Type) *Decoder {
+	return &Decoder{
+		r:   r,
+		typ: typ,
+	}
+}
+
+// ReadFrame reads the next whole frame, header included, without
+// decoding its body. The returned slice is only valid until the
+// next call to ReadFrame or Decode.
+//
+// ReadFrame returns io.EOF if the stream ends at a frame boundary,
+// and io.ErrUnexpectedEOF if it ends in the middle of a frame.
+func (d *Decoder) ReadFrame() ([]byte, error) {
+	if d.buf == nil {
+		d.buf = make([]byte, maxPacketLen(d.typ))
+	}
+
+	header := d.buf[:CMPP_HEADER_LEN-4]
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		return nil, err
+	}
+	totalLen, _, err := parseHeader(header, d.typ)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := d.buf[:totalLen]
+	if _, err := io.ReadFull(d.r, frame[len(header):]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return frame, nil
+}
+
+// Decode reads the next frame and returns the packet decoded from it.
+func (d *Decoder) Decode() (Pdu, error) {
+	frame, err := d.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	return DecodePacket(frame, d.typ)
+}
+
+// DecodePacket decodes the single whole frame in data, header included,
+// into a packet of the protocol version typ.
+func DecodePacket(data []byte, typ Type) (Pdu, error) {
+	if len(data) < int(CMPP_HEADER_LEN) {
+		return nil, ErrTotalLengthInvalid
+	}
+	totalLen, commandId, err := parseHeader(data, typ)
+	if err != nil {
+		return nil, err
+	}
+	if int(totalLen) != len(data) {
+		return nil, ErrTotalLengthInvalid
+	}
+
+	p, err := newPacket(commandId, typ)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.Unpack(data[CMPP_HEADER_LEN-4:]); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// An Encoder writes cmpp frames to an output stream.
+// Each frame is written by a single Write call.
+type Encoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w: w,
+	}
+}
+
+// Encode packs p with seqId and writes the frame to the stream.
+func (e *Encoder) Encode(p Packer, seqId uint32) error {
+	var data []byte
+	var err error
+	if ap, ok := p.(AppendPacker); ok {
+		e.buf, err = ap.AppendPack(e.buf[:0], seqId)
+		data = e.buf
+	} else {
+		data, err = p.Pack(seqId)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(data)
+	return err
+}
+
+// maxPacketLen returns the max Total_Length of the protocol version typ.
+func maxPacketLen(typ Type) uint32 {
+	if typ == V21 || typ == V20 {
+		return CMPP2_PACKET_MAX
+	}
+	return CMPP3_PACKET_MAX
+}
+
+// checkTotalLength checks Total_Length against the protocol version typ.
+func checkTotalLength(totalLen uint32, typ Type) error {
+	min := CMPP3_PACKET_MIN
+	if typ == V21 || typ == V20 {
+		min = CMPP2_PACKET_MIN
+	}
+	if totalLen < min || totalLen > maxPacketLen(typ) {
+		return ErrTotalLengthInvalid
+	}
+	return nil
+}
+
+// checkCommandId checks whether id is in the range of the cmpp
+// request or response command ids.
+func checkCommandId(id CommandId) error {
+	if !((id > CMPP_REQUEST_MIN && id < CMPP_REQUEST_MAX) ||
+		(id > CMPP_RESPONSE_MIN && id < CMPP_RESPONSE_MAX)) {
+		return ErrCommandIdInvalid
+	}
+	return nil
+}
+
+// parseHeader parses and checks the Total_Length and Command_Id
+// in the first 8 bytes of data.
+func parseHeader(data []byte, typ Type) (uint32, CommandId, error) {
+	totalLen := binary.BigEndian.Uint32(data)
+	if err := checkTotalLength(totalLen, typ); err != nil {
+		return 0, 0, err
+	}
+	commandId := CommandId(binary.BigEndian.Uint32(data[4:]))
+	if err := checkCommandId(commandId); err != nil {
+		return 0, 0, err
+	}
+	return totalLen, commandId, nil
+}
+
+// NewResponse returns a new empty response of the protocol version
+// typ to the request req, with the Sequence_Id of req.
+func NewResponse(req Pdu, typ Type) (Pdu, error) {
+	id := req.CommandId()
+	if !id.IsRequest() {
+		return nil, ErrNotRequest
+	}
+	rsp, err := newPacket(id.Response(), typ)
+	if err != nil {
+		return nil, err
+	}
+	rsp.setSequenceId(req.SequenceId())
+	return rsp, nil
+}
+
+// newPacket returns a new empty packet of the protocol version typ
+// for the command id.
+func newPacket(id CommandId, typ Type) (Pdu, error) {
+	v3 := typ == V30
+	switch id {
+	case CMPP_CONNECT:
+		return &CmppConnReqPkt{}, nil
+	case CMPP_CONNECT_RESP:
+		if v3 {
+			return &Cmpp3ConnRspPkt{}, nil
+		}
+		return &Cmpp2ConnRspPkt{}, nil
+	case CMPP_TERMINATE:
+		return &CmppTerminateReqPkt{}, nil
+	case CMPP_TERMINATE_RESP:
+		return &CmppTerminateRspPkt{}, nil
+	case CMPP_SUBMIT:
+		if v3 {
+			return &Cmpp3SubmitReqPkt{}, nil
+		}
+		return &Cmpp2SubmitReqPkt{}, nil
+	case CMPP_SUBMIT_RESP:
+		if v3 {
+			return &Cmpp3SubmitRspPkt{}, nil
+		}
+		return &Cmpp2SubmitRspPkt{}, nil
+	case CMPP_DELIVER:
+		if v3 {
+			return &Cmpp3DeliverReqPkt{}, nil
+		}
+		return &Cmpp2DeliverReqPkt{}, nil
+	case CMPP_DELIVER_RESP:
+		if v3 {
+			return &Cmpp3DeliverRspPkt{}, nil
+		}
+		return &Cmpp2DeliverRspPkt{}, nil
+	case CMPP_QUERY:
+		return &CmppQueryReqPkt{}, nil
+	case CMPP_QUERY_RESP:
+		return &CmppQueryRspPkt{}, nil
+	case CMPP_CANCEL:
+		return &CmppCancelReqPkt{}, nil
+	case CMPP_CANCEL_RESP:
+		if v3 {
+			return &Cmpp3CancelRspPkt{}, nil
+		}
+		return &Cmpp2CancelRspPkt{}, nil
+	case CMPP_FWD:
+		if v3 {
+			return &Cmpp3FwdReqPkt{}, nil
+		}
+		return &Cmpp2FwdReqPkt{}, nil
+	case CMPP_FWD_RESP:
+		if v3 {
+			return &Cmpp3FwdRspPkt{}, nil
+		}
+		return &Cmpp2FwdRspPkt{}, nil
+	case CMPP_ACTIVE_TEST:
+		return &CmppActiveTestReqPkt{}, nil
+	case CMPP_ACTIVE_TEST_RESP:
+		return &CmppActiveTestRspPkt{}, nil
+	}
+	return nil, ErrCommandIdNotSupported
+}
@@ -0,0 +1,2605 @@
+// Code generated by codecgen. DO NOT EDIT.
+
+package cmpp
+
+// CommandId returns the Command_Id of the CmppActiveTestReqPkt.
+func (p *CmppActiveTestReqPkt) CommandId() CommandId {
+	return CMPP_ACTIVE_TEST
+}
+
+// SequenceId returns the Sequence_Id of the CmppActiveTestReqPkt.
+func (p *CmppActiveTestReqPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *CmppActiveTestReqPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the CmppActiveTestReqPkt.
+func (p *CmppActiveTestReqPkt) ProtocolVersion() Type {
+	return 0
+}
+
+// String returns the fields of the CmppActiveTestReqPkt in a readable form.
+func (p *CmppActiveTestReqPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *CmppActiveTestReqPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *CmppActiveTestReqPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the CmppActiveTestReqPkt.
+func (p *CmppActiveTestReqPkt) Len() uint32 {
+	return CMPP_HEADER_LEN
+}
+
+// Validate checks that the fields of the CmppActiveTestReqPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *CmppActiveTestReqPkt) Validate() error {
+	return nil
+}
+
+// Pack packs the CmppActiveTestReqPkt to bytes stream.
+func (p *CmppActiveTestReqPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *CmppActiveTestReqPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_ACTIVE_TEST))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a CmppActiveTestReqPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *CmppActiveTestReqPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the CmppActiveTestRspPkt.
+func (p *CmppActiveTestRspPkt) CommandId() CommandId {
+	return CMPP_ACTIVE_TEST_RESP
+}
+
+// SequenceId returns the Sequence_Id of the CmppActiveTestRspPkt.
+func (p *CmppActiveTestRspPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *CmppActiveTestRspPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the CmppActiveTestRspPkt.
+func (p *CmppActiveTestRspPkt) ProtocolVersion() Type {
+	return 0
+}
+
+// String returns the fields of the CmppActiveTestRspPkt in a readable form.
+func (p *CmppActiveTestRspPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *CmppActiveTestRspPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *CmppActiveTestRspPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the CmppActiveTestRspPkt.
+func (p *CmppActiveTestRspPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 1
+}
+
+// Validate checks that the fields of the CmppActiveTestRspPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *CmppActiveTestRspPkt) Validate() error {
+	return nil
+}
+
+// Pack packs the CmppActiveTestRspPkt to bytes stream.
+func (p *CmppActiveTestRspPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *CmppActiveTestRspPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_ACTIVE_TEST_RESP))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint8(p.Reserved)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a CmppActiveTestRspPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *CmppActiveTestRspPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.Reserved = r.ReadUint8()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the CmppCancelReqPkt.
+func (p *CmppCancelReqPkt) CommandId() CommandId {
+	return CMPP_CANCEL
+}
+
+// SequenceId returns the Sequence_Id of the CmppCancelReqPkt.
+func (p *CmppCancelReqPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *CmppCancelReqPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the CmppCancelReqPkt.
+func (p *CmppCancelReqPkt) ProtocolVersion() Type {
+	return 0
+}
+
+// String returns the fields of the CmppCancelReqPkt in a readable form.
+func (p *CmppCancelReqPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *CmppCancelReqPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *CmppCancelReqPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the CmppCancelReqPkt.
+func (p *CmppCancelReqPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 8
+}
+
+// Validate checks that the fields of the CmppCancelReqPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *CmppCancelReqPkt) Validate() error {
+	return nil
+}
+
+// Pack packs the CmppCancelReqPkt to bytes stream.
+func (p *CmppCancelReqPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *CmppCancelReqPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_CANCEL))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint64(p.MsgId)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a CmppCancelReqPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *CmppCancelReqPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.MsgId = r.ReadUint64()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp2CancelRspPkt.
+func (p *Cmpp2CancelRspPkt) CommandId() CommandId {
+	return CMPP_CANCEL_RESP
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp2CancelRspPkt.
+func (p *Cmpp2CancelRspPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp2CancelRspPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp2CancelRspPkt.
+func (p *Cmpp2CancelRspPkt) ProtocolVersion() Type {
+	return V21
+}
+
+// String returns the fields of the Cmpp2CancelRspPkt in a readable form.
+func (p *Cmpp2CancelRspPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp2CancelRspPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp2CancelRspPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp2CancelRspPkt.
+func (p *Cmpp2CancelRspPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 1
+}
+
+// Validate checks that the fields of the Cmpp2CancelRspPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp2CancelRspPkt) Validate() error {
+	return nil
+}
+
+// Pack packs the Cmpp2CancelRspPkt to bytes stream.
+func (p *Cmpp2CancelRspPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp2CancelRspPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_CANCEL_RESP))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint8(p.SuccessId)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp2CancelRspPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp2CancelRspPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.SuccessId = r.ReadUint8()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp3CancelRspPkt.
+func (p *Cmpp3CancelRspPkt) CommandId() CommandId {
+	return CMPP_CANCEL_RESP
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp3CancelRspPkt.
+func (p *Cmpp3CancelRspPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp3CancelRspPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp3CancelRspPkt.
+func (p *Cmpp3CancelRspPkt) ProtocolVersion() Type {
+	return V30
+}
+
+// String returns the fields of the Cmpp3CancelRspPkt in a readable form.
+func (p *Cmpp3CancelRspPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp3CancelRspPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp3CancelRspPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp3CancelRspPkt.
+func (p *Cmpp3CancelRspPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 4
+}
+
+// Validate checks that the fields of the Cmpp3CancelRspPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp3CancelRspPkt) Validate() error {
+	return nil
+}
+
+// Pack packs the Cmpp3CancelRspPkt to bytes stream.
+func (p *Cmpp3CancelRspPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp3CancelRspPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_CANCEL_RESP))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint32(p.SuccessId)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp3CancelRspPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp3CancelRspPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.SuccessId = r.ReadUint32()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the CmppConnReqPkt.
+func (p *CmppConnReqPkt) CommandId() CommandId {
+	return CMPP_CONNECT
+}
+
+// SequenceId returns the Sequence_Id of the CmppConnReqPkt.
+func (p *CmppConnReqPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *CmppConnReqPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// String returns the fields of the CmppConnReqPkt in a readable form.
+func (p *CmppConnReqPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *CmppConnReqPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *CmppConnReqPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the CmppConnReqPkt.
+func (p *CmppConnReqPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 27
+}
+
+// Validate checks that the fields of the CmppConnReqPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *CmppConnReqPkt) Validate() error {
+	if len(p.SrcAddr) > 6 {
+		return invalidField("CmppConnReqPkt", "SrcAddr")
+	}
+	if len(p.AuthSrc) > 16 {
+		return invalidField("CmppConnReqPkt", "AuthSrc")
+	}
+	return nil
+}
+
+// Pack packs the CmppConnReqPkt to bytes stream.
+func (p *CmppConnReqPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *CmppConnReqPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	p.beforePack()
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_CONNECT))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteFixedSizeString(p.SrcAddr, 6)
+	w.WriteFixedSizeString(p.AuthSrc, 16)
+	w.WriteUint8(uint8(p.Version))
+	w.WriteUint32(p.Timestamp)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a CmppConnReqPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *CmppConnReqPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.SrcAddr = r.ReadString(6)
+	p.AuthSrc = r.ReadString(16)
+	p.Version = Type(r.ReadUint8())
+	p.Timestamp = r.ReadUint32()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp2ConnRspPkt.
+func (p *Cmpp2ConnRspPkt) CommandId() CommandId {
+	return CMPP_CONNECT_RESP
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp2ConnRspPkt.
+func (p *Cmpp2ConnRspPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp2ConnRspPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp2ConnRspPkt.
+func (p *Cmpp2ConnRspPkt) ProtocolVersion() Type {
+	return V21
+}
+
+// String returns the fields of the Cmpp2ConnRspPkt in a readable form.
+func (p *Cmpp2ConnRspPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp2ConnRspPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp2ConnRspPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp2ConnRspPkt.
+func (p *Cmpp2ConnRspPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 18
+}
+
+// Validate checks that the fields of the Cmpp2ConnRspPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp2ConnRspPkt) Validate() error {
+	if len(p.AuthIsmg) > 16 {
+		return invalidField("Cmpp2ConnRspPkt", "AuthIsmg")
+	}
+	return nil
+}
+
+// Pack packs the Cmpp2ConnRspPkt to bytes stream.
+func (p *Cmpp2ConnRspPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp2ConnRspPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	p.beforePack()
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_CONNECT_RESP))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint8(p.Status)
+	w.WriteFixedSizeString(p.AuthIsmg, 16)
+	w.WriteUint8(uint8(p.Version))
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp2ConnRspPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp2ConnRspPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.Status = r.ReadUint8()
+	p.AuthIsmg = r.ReadString(16)
+	p.Version = Type(r.ReadUint8())
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp3ConnRspPkt.
+func (p *Cmpp3ConnRspPkt) CommandId() CommandId {
+	return CMPP_CONNECT_RESP
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp3ConnRspPkt.
+func (p *Cmpp3ConnRspPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp3ConnRspPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp3ConnRspPkt.
+func (p *Cmpp3ConnRspPkt) ProtocolVersion() Type {
+	return V30
+}
+
+// String returns the fields of the Cmpp3ConnRspPkt in a readable form.
+func (p *Cmpp3ConnRspPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp3ConnRspPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp3ConnRspPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp3ConnRspPkt.
+func (p *Cmpp3ConnRspPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 21
+}
+
+// Validate checks that the fields of the Cmpp3ConnRspPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp3ConnRspPkt) Validate() error {
+	if len(p.AuthIsmg) > 16 {
+		return invalidField("Cmpp3ConnRspPkt", "AuthIsmg")
+	}
+	return nil
+}
+
+// Pack packs the Cmpp3ConnRspPkt to bytes stream.
+func (p *Cmpp3ConnRspPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp3ConnRspPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	p.beforePack()
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_CONNECT_RESP))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint32(p.Status)
+	w.WriteFixedSizeString(p.AuthIsmg, 16)
+	w.WriteUint8(uint8(p.Version))
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp3ConnRspPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp3ConnRspPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.Status = r.ReadUint32()
+	p.AuthIsmg = r.ReadString(16)
+	p.Version = Type(r.ReadUint8())
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp2DeliverReqPkt.
+func (p *Cmpp2DeliverReqPkt) CommandId() CommandId {
+	return CMPP_DELIVER
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp2DeliverReqPkt.
+func (p *Cmpp2DeliverReqPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp2DeliverReqPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp2DeliverReqPkt.
+func (p *Cmpp2DeliverReqPkt) ProtocolVersion() Type {
+	return V21
+}
+
+// String returns the fields of the Cmpp2DeliverReqPkt in a readable form.
+func (p *Cmpp2DeliverReqPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp2DeliverReqPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp2DeliverReqPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp2DeliverReqPkt.
+func (p *Cmpp2DeliverReqPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 73 + uint32(p.MsgLength)
+}
+
+// Validate checks that the fields of the Cmpp2DeliverReqPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp2DeliverReqPkt) Validate() error {
+	if len(p.DestId) > 21 {
+		return invalidField("Cmpp2DeliverReqPkt", "DestId")
+	}
+	if len(p.ServiceId) > 10 {
+		return invalidField("Cmpp2DeliverReqPkt", "ServiceId")
+	}
+	if len(p.SrcTerminalId) > 21 {
+		return invalidField("Cmpp2DeliverReqPkt", "SrcTerminalId")
+	}
+	if len(p.MsgContent) != int(p.MsgLength) {
+		return invalidField("Cmpp2DeliverReqPkt", "MsgContent")
+	}
+	if len(p.Reserve) > 8 {
+		return invalidField("Cmpp2DeliverReqPkt", "Reserve")
+	}
+	return nil
+}
+
+// Pack packs the Cmpp2DeliverReqPkt to bytes stream.
+func (p *Cmpp2DeliverReqPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp2DeliverReqPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_DELIVER))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint64(p.MsgId)
+	w.WriteFixedSizeString(p.DestId, 21)
+	w.WriteFixedSizeString(p.ServiceId, 10)
+	w.WriteUint8(p.TpPid)
+	w.WriteUint8(p.TpUdhi)
+	w.WriteUint8(p.MsgFmt)
+	w.WriteFixedSizeString(p.SrcTerminalId, 21)
+	w.WriteUint8(p.RegisterDelivery)
+	w.WriteUint8(p.MsgLength)
+	w.WriteString(p.MsgContent)
+	w.WriteFixedSizeString(p.Reserve, 8)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp2DeliverReqPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp2DeliverReqPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.MsgId = r.ReadUint64()
+	p.DestId = r.ReadCString(21)
+	p.ServiceId = r.ReadCString(10)
+	p.TpPid = r.ReadUint8()
+	p.TpUdhi = r.ReadUint8()
+	p.MsgFmt = r.ReadUint8()
+	p.SrcTerminalId = r.ReadCString(21)
+	p.RegisterDelivery = r.ReadUint8()
+	p.MsgLength = r.ReadUint8()
+	p.MsgContent = r.ReadString(int(p.MsgLength))
+	p.Reserve = r.ReadCString(8)
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp2DeliverRspPkt.
+func (p *Cmpp2DeliverRspPkt) CommandId() CommandId {
+	return CMPP_DELIVER_RESP
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp2DeliverRspPkt.
+func (p *Cmpp2DeliverRspPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp2DeliverRspPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp2DeliverRspPkt.
+func (p *Cmpp2DeliverRspPkt) ProtocolVersion() Type {
+	return V21
+}
+
+// String returns the fields of the Cmpp2DeliverRspPkt in a readable form.
+func (p *Cmpp2DeliverRspPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp2DeliverRspPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp2DeliverRspPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp2DeliverRspPkt.
+func (p *Cmpp2DeliverRspPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 9
+}
+
+// Validate checks that the fields of the Cmpp2DeliverRspPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp2DeliverRspPkt) Validate() error {
+	return nil
+}
+
+// Pack packs the Cmpp2DeliverRspPkt to bytes stream.
+func (p *Cmpp2DeliverRspPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp2DeliverRspPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_DELIVER_RESP))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint64(p.MsgId)
+	w.WriteUint8(p.Result)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp2DeliverRspPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp2DeliverRspPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.MsgId = r.ReadUint64()
+	p.Result = r.ReadUint8()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp3DeliverReqPkt.
+func (p *Cmpp3DeliverReqPkt) CommandId() CommandId {
+	return CMPP_DELIVER
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp3DeliverReqPkt.
+func (p *Cmpp3DeliverReqPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp3DeliverReqPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp3DeliverReqPkt.
+func (p *Cmpp3DeliverReqPkt) ProtocolVersion() Type {
+	return V30
+}
+
+// String returns the fields of the Cmpp3DeliverReqPkt in a readable form.
+func (p *Cmpp3DeliverReqPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp3DeliverReqPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp3DeliverReqPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp3DeliverReqPkt.
+func (p *Cmpp3DeliverReqPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 97 + uint32(p.MsgLength)
+}
+
+// Validate checks that the fields of the Cmpp3DeliverReqPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp3DeliverReqPkt) Validate() error {
+	if len(p.DestId) > 21 {
+		return invalidField("Cmpp3DeliverReqPkt", "DestId")
+	}
+	if len(p.ServiceId) > 10 {
+		return invalidField("Cmpp3DeliverReqPkt", "ServiceId")
+	}
+	if len(p.SrcTerminalId) > 32 {
+		return invalidField("Cmpp3DeliverReqPkt", "SrcTerminalId")
+	}
+	if len(p.MsgContent) != int(p.MsgLength) {
+		return invalidField("Cmpp3DeliverReqPkt", "MsgContent")
+	}
+	if len(p.LinkId) > 20 {
+		return invalidField("Cmpp3DeliverReqPkt", "LinkId")
+	}
+	return nil
+}
+
+// Pack packs the Cmpp3DeliverReqPkt to bytes stream.
+func (p *Cmpp3DeliverReqPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp3DeliverReqPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_DELIVER))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint64(p.MsgId)
+	w.WriteFixedSizeString(p.DestId, 21)
+	w.WriteFixedSizeString(p.ServiceId, 10)
+	w.WriteUint8(p.TpPid)
+	w.WriteUint8(p.TpUdhi)
+	w.WriteUint8(p.MsgFmt)
+	w.WriteFixedSizeString(p.SrcTerminalId, 32)
+	w.WriteUint8(p.SrcTerminalType)
+	w.WriteUint8(p.RegisterDelivery)
+	w.WriteUint8(p.MsgLength)
+	w.WriteString(p.MsgContent)
+	w.WriteFixedSizeString(p.LinkId, 20)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp3DeliverReqPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp3DeliverReqPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.MsgId = r.ReadUint64()
+	p.DestId = r.ReadCString(21)
+	p.ServiceId = r.ReadCString(10)
+	p.TpPid = r.ReadUint8()
+	p.TpUdhi = r.ReadUint8()
+	p.MsgFmt = r.ReadUint8()
+	p.SrcTerminalId = r.ReadCString(32)
+	p.SrcTerminalType = r.ReadUint8()
+	p.RegisterDelivery = r.ReadUint8()
+	p.MsgLength = r.ReadUint8()
+	p.MsgContent = r.ReadString(int(p.MsgLength))
+	p.LinkId = r.ReadCString(20)
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp3DeliverRspPkt.
+func (p *Cmpp3DeliverRspPkt) CommandId() CommandId {
+	return CMPP_DELIVER_RESP
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp3DeliverRspPkt.
+func (p *Cmpp3DeliverRspPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp3DeliverRspPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp3DeliverRspPkt.
+func (p *Cmpp3DeliverRspPkt) ProtocolVersion() Type {
+	return V30
+}
+
+// String returns the fields of the Cmpp3DeliverRspPkt in a readable form.
+func (p *Cmpp3DeliverRspPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp3DeliverRspPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp3DeliverRspPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp3DeliverRspPkt.
+func (p *Cmpp3DeliverRspPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 12
+}
+
+// Validate checks that the fields of the Cmpp3DeliverRspPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp3DeliverRspPkt) Validate() error {
+	return nil
+}
+
+// Pack packs the Cmpp3DeliverRspPkt to bytes stream.
+func (p *Cmpp3DeliverRspPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp3DeliverRspPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_DELIVER_RESP))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint64(p.MsgId)
+	w.WriteUint32(p.Result)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp3DeliverRspPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp3DeliverRspPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.MsgId = r.ReadUint64()
+	p.Result = r.ReadUint32()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp2FwdReqPkt.
+func (p *Cmpp2FwdReqPkt) CommandId() CommandId {
+	return CMPP_FWD
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp2FwdReqPkt.
+func (p *Cmpp2FwdReqPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp2FwdReqPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp2FwdReqPkt.
+func (p *Cmpp2FwdReqPkt) ProtocolVersion() Type {
+	return V21
+}
+
+// String returns the fields of the Cmpp2FwdReqPkt in a readable form.
+func (p *Cmpp2FwdReqPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp2FwdReqPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp2FwdReqPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp2FwdReqPkt.
+func (p *Cmpp2FwdReqPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 140 + uint32(p.DestUsrTl)*21 + uint32(p.MsgLength)
+}
+
+// Validate checks that the fields of the Cmpp2FwdReqPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp2FwdReqPkt) Validate() error {
+	if len(p.SourceId) > 6 {
+		return invalidField("Cmpp2FwdReqPkt", "SourceId")
+	}
+	if len(p.DestinationId) > 6 {
+		return invalidField("Cmpp2FwdReqPkt", "DestinationId")
+	}
+	if len(p.ServiceId) > 10 {
+		return invalidField("Cmpp2FwdReqPkt", "ServiceId")
+	}
+	if len(p.FeeTerminalId) > 21 {
+		return invalidField("Cmpp2FwdReqPkt", "FeeTerminalId")
+	}
+	if len(p.MsgSrc) > 6 {
+		return invalidField("Cmpp2FwdReqPkt", "MsgSrc")
+	}
+	if len(p.FeeType) > 2 {
+		return invalidField("Cmpp2FwdReqPkt", "FeeType")
+	}
+	if len(p.FeeCode) > 6 {
+		return invalidField("Cmpp2FwdReqPkt", "FeeCode")
+	}
+	if len(p.ValidTime) > 17 {
+		return invalidField("Cmpp2FwdReqPkt", "ValidTime")
+	}
+	if len(p.AtTime) > 17 {
+		return invalidField("Cmpp2FwdReqPkt", "AtTime")
+	}
+	if len(p.SrcId) > 21 {
+		return invalidField("Cmpp2FwdReqPkt", "SrcId")
+	}
+	if len(p.DestId) != int(p.DestUsrTl) {
+		return invalidField("Cmpp2FwdReqPkt", "DestId")
+	}
+	for _, s := range p.DestId {
+		if len(s) > 21 {
+			return invalidField("Cmpp2FwdReqPkt", "DestId")
+		}
+	}
+	if len(p.MsgContent) != int(p.MsgLength) {
+		return invalidField("Cmpp2FwdReqPkt", "MsgContent")
+	}
+	if len(p.Reserve) > 8 {
+		return invalidField("Cmpp2FwdReqPkt", "Reserve")
+	}
+	return nil
+}
+
+// Pack packs the Cmpp2FwdReqPkt to bytes stream.
+func (p *Cmpp2FwdReqPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp2FwdReqPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	p.beforePack()
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_FWD))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteFixedSizeString(p.SourceId, 6)
+	w.WriteFixedSizeString(p.DestinationId, 6)
+	w.WriteUint8(p.NodesCount)
+	w.WriteUint8(p.MsgFwdType)
+	w.WriteUint64(p.MsgId)
+	w.WriteUint8(p.PkTotal)
+	w.WriteUint8(p.PkNumber)
+	w.WriteUint8(p.RegisteredDelivery)
+	w.WriteUint8(p.MsgLevel)
+	w.WriteFixedSizeString(p.ServiceId, 10)
+	w.WriteUint8(p.FeeUserType)
+	w.WriteFixedSizeString(p.FeeTerminalId, 21)
+	w.WriteUint8(p.TpPid)
+	w.WriteUint8(p.TpUdhi)
+	w.WriteUint8(p.MsgFmt)
+	w.WriteFixedSizeString(p.MsgSrc, 6)
+	w.WriteFixedSizeString(p.FeeType, 2)
+	w.WriteFixedSizeString(p.FeeCode, 6)
+	w.WriteFixedSizeString(p.ValidTime, 17)
+	w.WriteFixedSizeString(p.AtTime, 17)
+	w.WriteFixedSizeString(p.SrcId, 21)
+	w.WriteUint8(p.DestUsrTl)
+	for _, s := range p.DestId {
+		w.WriteFixedSizeString(s, 21)
+	}
+	w.WriteUint8(p.MsgLength)
+	w.WriteString(p.MsgContent)
+	w.WriteFixedSizeString(p.Reserve, 8)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp2FwdReqPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp2FwdReqPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.SourceId = r.ReadCString(6)
+	p.DestinationId = r.ReadCString(6)
+	p.NodesCount = r.ReadUint8()
+	p.MsgFwdType = r.ReadUint8()
+	p.MsgId = r.ReadUint64()
+	p.PkTotal = r.ReadUint8()
+	p.PkNumber = r.ReadUint8()
+	p.RegisteredDelivery = r.ReadUint8()
+	p.MsgLevel = r.ReadUint8()
+	p.ServiceId = r.ReadCString(10)
+	p.FeeUserType = r.ReadUint8()
+	p.FeeTerminalId = r.ReadCString(21)
+	p.TpPid = r.ReadUint8()
+	p.TpUdhi = r.ReadUint8()
+	p.MsgFmt = r.ReadUint8()
+	p.MsgSrc = r.ReadCString(6)
+	p.FeeType = r.ReadString(2)
+	p.FeeCode = r.ReadCString(6)
+	p.ValidTime = r.ReadCString(17)
+	p.AtTime = r.ReadCString(17)
+	p.SrcId = r.ReadCString(21)
+	p.DestUsrTl = r.ReadUint8()
+	p.DestId = make([]string, 0, p.DestUsrTl)
+	for i := 0; i < int(p.DestUsrTl); i++ {
+		p.DestId = append(p.DestId, r.ReadCString(21))
+	}
+	p.MsgLength = r.ReadUint8()
+	p.MsgContent = r.ReadString(int(p.MsgLength))
+	p.Reserve = r.ReadCString(8)
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp2FwdRspPkt.
+func (p *Cmpp2FwdRspPkt) CommandId() CommandId {
+	return CMPP_FWD_RESP
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp2FwdRspPkt.
+func (p *Cmpp2FwdRspPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp2FwdRspPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp2FwdRspPkt.
+func (p *Cmpp2FwdRspPkt) ProtocolVersion() Type {
+	return V21
+}
+
+// String returns the fields of the Cmpp2FwdRspPkt in a readable form.
+func (p *Cmpp2FwdRspPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp2FwdRspPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp2FwdRspPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp2FwdRspPkt.
+func (p *Cmpp2FwdRspPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 11
+}
+
+// Validate checks that the fields of the Cmpp2FwdRspPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp2FwdRspPkt) Validate() error {
+	return nil
+}
+
+// Pack packs the Cmpp2FwdRspPkt to bytes stream.
+func (p *Cmpp2FwdRspPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp2FwdRspPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_FWD_RESP))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint64(p.MsgId)
+	w.WriteUint8(p.PkTotal)
+	w.WriteUint8(p.PkNumber)
+	w.WriteUint8(p.Result)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp2FwdRspPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp2FwdRspPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.MsgId = r.ReadUint64()
+	p.PkTotal = r.ReadUint8()
+	p.PkNumber = r.ReadUint8()
+	p.Result = r.ReadUint8()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp3FwdReqPkt.
+func (p *Cmpp3FwdReqPkt) CommandId() CommandId {
+	return CMPP_FWD
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp3FwdReqPkt.
+func (p *Cmpp3FwdReqPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp3FwdReqPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp3FwdReqPkt.
+func (p *Cmpp3FwdReqPkt) ProtocolVersion() Type {
+	return V30
+}
+
+// String returns the fields of the Cmpp3FwdReqPkt in a readable form.
+func (p *Cmpp3FwdReqPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp3FwdReqPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp3FwdReqPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp3FwdReqPkt.
+func (p *Cmpp3FwdReqPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 252 + uint32(p.DestUsrTl)*21 + uint32(p.MsgLength)
+}
+
+// Validate checks that the fields of the Cmpp3FwdReqPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp3FwdReqPkt) Validate() error {
+	if len(p.SourceId) > 6 {
+		return invalidField("Cmpp3FwdReqPkt", "SourceId")
+	}
+	if len(p.DestinationId) > 6 {
+		return invalidField("Cmpp3FwdReqPkt", "DestinationId")
+	}
+	if len(p.ServiceId) > 10 {
+		return invalidField("Cmpp3FwdReqPkt", "ServiceId")
+	}
+	if len(p.FeeTerminalId) > 21 {
+		return invalidField("Cmpp3FwdReqPkt", "FeeTerminalId")
+	}
+	if len(p.FeeTerminalPseudo) > 32 {
+		return invalidField("Cmpp3FwdReqPkt", "FeeTerminalPseudo")
+	}
+	if len(p.MsgSrc) > 6 {
+		return invalidField("Cmpp3FwdReqPkt", "MsgSrc")
+	}
+	if len(p.FeeType) > 2 {
+		return invalidField("Cmpp3FwdReqPkt", "FeeType")
+	}
+	if len(p.FeeCode) > 6 {
+		return invalidField("Cmpp3FwdReqPkt", "FeeCode")
+	}
+	if len(p.ValidTime) > 17 {
+		return invalidField("Cmpp3FwdReqPkt", "ValidTime")
+	}
+	if len(p.AtTime) > 17 {
+		return invalidField("Cmpp3FwdReqPkt", "AtTime")
+	}
+	if len(p.SrcId) > 21 {
+		return invalidField("Cmpp3FwdReqPkt", "SrcId")
+	}
+	if len(p.SrcPseudo) > 32 {
+		return invalidField("Cmpp3FwdReqPkt", "SrcPseudo")
+	}
+	if len(p.DestId) != int(p.DestUsrTl) {
+		return invalidField("Cmpp3FwdReqPkt", "DestId")
+	}
+	for _, s := range p.DestId {
+		if len(s) > 21 {
+			return invalidField("Cmpp3FwdReqPkt", "DestId")
+		}
+	}
+	if len(p.DestPseudo) > 32 {
+		return invalidField("Cmpp3FwdReqPkt", "DestPseudo")
+	}
+	if len(p.MsgContent) != int(p.MsgLength) {
+		return invalidField("Cmpp3FwdReqPkt", "MsgContent")
+	}
+	if len(p.LinkId) > 20 {
+		return invalidField("Cmpp3FwdReqPkt", "LinkId")
+	}
+	return nil
+}
+
+// Pack packs the Cmpp3FwdReqPkt to bytes stream.
+func (p *Cmpp3FwdReqPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp3FwdReqPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	p.beforePack()
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_FWD))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteFixedSizeString(p.SourceId, 6)
+	w.WriteFixedSizeString(p.DestinationId, 6)
+	w.WriteUint8(p.NodesCount)
+	w.WriteUint8(p.MsgFwdType)
+	w.WriteUint64(p.MsgId)
+	w.WriteUint8(p.PkTotal)
+	w.WriteUint8(p.PkNumber)
+	w.WriteUint8(p.RegisteredDelivery)
+	w.WriteUint8(p.MsgLevel)
+	w.WriteFixedSizeString(p.ServiceId, 10)
+	w.WriteUint8(p.FeeUserType)
+	w.WriteFixedSizeString(p.FeeTerminalId, 21)
+	w.WriteFixedSizeString(p.FeeTerminalPseudo, 32)
+	w.WriteUint8(p.FeeTerminalUserType)
+	w.WriteUint8(p.TpPid)
+	w.WriteUint8(p.TpUdhi)
+	w.WriteUint8(p.MsgFmt)
+	w.WriteFixedSizeString(p.MsgSrc, 6)
+	w.WriteFixedSizeString(p.FeeType, 2)
+	w.WriteFixedSizeString(p.FeeCode, 6)
+	w.WriteFixedSizeString(p.ValidTime, 17)
+	w.WriteFixedSizeString(p.AtTime, 17)
+	w.WriteFixedSizeString(p.SrcId, 21)
+	w.WriteFixedSizeString(p.SrcPseudo, 32)
+	w.WriteUint8(p.SrcUserType)
+	w.WriteUint8(p.SrcType)
+	w.WriteUint8(p.DestUsrTl)
+	for _, s := range p.DestId {
+		w.WriteFixedSizeString(s, 21)
+	}
+	w.WriteFixedSizeString(p.DestPseudo, 32)
+	w.WriteUint8(p.DestUserType)
+	w.WriteUint8(p.MsgLength)
+	w.WriteString(p.MsgContent)
+	w.WriteFixedSizeString(p.LinkId, 20)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp3FwdReqPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp3FwdReqPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.SourceId = r.ReadCString(6)
+	p.DestinationId = r.ReadCString(6)
+	p.NodesCount = r.ReadUint8()
+	p.MsgFwdType = r.ReadUint8()
+	p.MsgId = r.ReadUint64()
+	p.PkTotal = r.ReadUint8()
+	p.PkNumber = r.ReadUint8()
+	p.RegisteredDelivery = r.ReadUint8()
+	p.MsgLevel = r.ReadUint8()
+	p.ServiceId = r.ReadCString(10)
+	p.FeeUserType = r.ReadUint8()
+	p.FeeTerminalId = r.ReadCString(21)
+	p.FeeTerminalPseudo = r.ReadCString(32)
+	p.FeeTerminalUserType = r.ReadUint8()
+	p.TpPid = r.ReadUint8()
+	p.TpUdhi = r.ReadUint8()
+	p.MsgFmt = r.ReadUint8()
+	p.MsgSrc = r.ReadCString(6)
+	p.FeeType = r.ReadString(2)
+	p.FeeCode = r.ReadCString(6)
+	p.ValidTime = r.ReadCString(17)
+	p.AtTime = r.ReadCString(17)
+	p.SrcId = r.ReadCString(21)
+	p.SrcPseudo = r.ReadCString(32)
+	p.SrcUserType = r.ReadUint8()
+	p.SrcType = r.ReadUint8()
+	p.DestUsrTl = r.ReadUint8()
+	p.DestId = make([]string, 0, p.DestUsrTl)
+	for i := 0; i < int(p.DestUsrTl); i++ {
+		p.DestId = append(p.DestId, r.ReadCString(21))
+	}
+	p.DestPseudo = r.ReadCString(32)
+	p.DestUserType = r.ReadUint8()
+	p.MsgLength = r.ReadUint8()
+	p.MsgContent = r.ReadString(int(p.MsgLength))
+	p.LinkId = r.ReadCString(20)
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp3FwdRspPkt.
+func (p *Cmpp3FwdRspPkt) CommandId() CommandId {
+	return CMPP_FWD_RESP
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp3FwdRspPkt.
+func (p *Cmpp3FwdRspPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp3FwdRspPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp3FwdRspPkt.
+func (p *Cmpp3FwdRspPkt) ProtocolVersion() Type {
+	return V30
+}
+
+// String returns the fields of the Cmpp3FwdRspPkt in a readable form.
+func (p *Cmpp3FwdRspPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp3FwdRspPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp3FwdRspPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp3FwdRspPkt.
+func (p *Cmpp3FwdRspPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 14
+}
+
+// Validate checks that the fields of the Cmpp3FwdRspPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp3FwdRspPkt) Validate() error {
+	return nil
+}
+
+// Pack packs the Cmpp3FwdRspPkt to bytes stream.
+func (p *Cmpp3FwdRspPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp3FwdRspPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_FWD_RESP))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint64(p.MsgId)
+	w.WriteUint8(p.PkTotal)
+	w.WriteUint8(p.PkNumber)
+	w.WriteUint32(p.Result)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp3FwdRspPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp3FwdRspPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.MsgId = r.ReadUint64()
+	p.PkTotal = r.ReadUint8()
+	p.PkNumber = r.ReadUint8()
+	p.Result = r.ReadUint32()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the CmppQueryReqPkt.
+func (p *CmppQueryReqPkt) CommandId() CommandId {
+	return CMPP_QUERY
+}
+
+// SequenceId returns the Sequence_Id of the CmppQueryReqPkt.
+func (p *CmppQueryReqPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *CmppQueryReqPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the CmppQueryReqPkt.
+func (p *CmppQueryReqPkt) ProtocolVersion() Type {
+	return 0
+}
+
+// String returns the fields of the CmppQueryReqPkt in a readable form.
+func (p *CmppQueryReqPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *CmppQueryReqPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *CmppQueryReqPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the CmppQueryReqPkt.
+func (p *CmppQueryReqPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 27
+}
+
+// Validate checks that the fields of the CmppQueryReqPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *CmppQueryReqPkt) Validate() error {
+	if len(p.Time) > 8 {
+		return invalidField("CmppQueryReqPkt", "Time")
+	}
+	if len(p.QueryCode) > 10 {
+		return invalidField("CmppQueryReqPkt", "QueryCode")
+	}
+	if len(p.Reserve) > 8 {
+		return invalidField("CmppQueryReqPkt", "Reserve")
+	}
+	return nil
+}
+
+// Pack packs the CmppQueryReqPkt to bytes stream.
+func (p *CmppQueryReqPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *CmppQueryReqPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_QUERY))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteFixedSizeString(p.Time, 8)
+	w.WriteUint8(p.QueryType)
+	w.WriteFixedSizeString(p.QueryCode, 10)
+	w.WriteFixedSizeString(p.Reserve, 8)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a CmppQueryReqPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *CmppQueryReqPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.Time = r.ReadCString(8)
+	p.QueryType = r.ReadUint8()
+	p.QueryCode = r.ReadCString(10)
+	p.Reserve = r.ReadCString(8)
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the CmppQueryRspPkt.
+func (p *CmppQueryRspPkt) CommandId() CommandId {
+	return CMPP_QUERY_RESP
+}
+
+// SequenceId returns the Sequence_Id of the CmppQueryRspPkt.
+func (p *CmppQueryRspPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *CmppQueryRspPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the CmppQueryRspPkt.
+func (p *CmppQueryRspPkt) ProtocolVersion() Type {
+	return 0
+}
+
+// String returns the fields of the CmppQueryRspPkt in a readable form.
+func (p *CmppQueryRspPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *CmppQueryRspPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *CmppQueryRspPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the CmppQueryRspPkt.
+func (p *CmppQueryRspPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 51
+}
+
+// Validate checks that the fields of the CmppQueryRspPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *CmppQueryRspPkt) Validate() error {
+	if len(p.Time) > 8 {
+		return invalidField("CmppQueryRspPkt", "Time")
+	}
+	if len(p.QueryCode) > 10 {
+		return invalidField("CmppQueryRspPkt", "QueryCode")
+	}
+	return nil
+}
+
+// Pack packs the CmppQueryRspPkt to bytes stream.
+func (p *CmppQueryRspPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *CmppQueryRspPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_QUERY_RESP))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteFixedSizeString(p.Time, 8)
+	w.WriteUint8(p.QueryType)
+	w.WriteFixedSizeString(p.QueryCode, 10)
+	w.WriteUint32(p.MtTlMsg)
+	w.WriteUint32(p.MtTlUsr)
+	w.WriteUint32(p.MtScs)
+	w.WriteUint32(p.MtWt)
+	w.WriteUint32(p.MtFl)
+	w.WriteUint32(p.MoScs)
+	w.WriteUint32(p.MoWt)
+	w.WriteUint32(p.MoFl)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a CmppQueryRspPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *CmppQueryRspPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.Time = r.ReadCString(8)
+	p.QueryType = r.ReadUint8()
+	p.QueryCode = r.ReadCString(10)
+	p.MtTlMsg = r.ReadUint32()
+	p.MtTlUsr = r.ReadUint32()
+	p.MtScs = r.ReadUint32()
+	p.MtWt = r.ReadUint32()
+	p.MtFl = r.ReadUint32()
+	p.MoScs = r.ReadUint32()
+	p.MoWt = r.ReadUint32()
+	p.MoFl = r.ReadUint32()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp2SubmitReqPkt.
+func (p *Cmpp2SubmitReqPkt) CommandId() CommandId {
+	return CMPP_SUBMIT
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp2SubmitReqPkt.
+func (p *Cmpp2SubmitReqPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp2SubmitReqPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp2SubmitReqPkt.
+func (p *Cmpp2SubmitReqPkt) ProtocolVersion() Type {
+	return V21
+}
+
+// String returns the fields of the Cmpp2SubmitReqPkt in a readable form.
+func (p *Cmpp2SubmitReqPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp2SubmitReqPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp2SubmitReqPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp2SubmitReqPkt.
+func (p *Cmpp2SubmitReqPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 126 + uint32(p.DestUsrTl)*21 + uint32(p.MsgLength)
+}
+
+// Validate checks that the fields of the Cmpp2SubmitReqPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp2SubmitReqPkt) Validate() error {
+	if len(p.ServiceId) > 10 {
+		return invalidField("Cmpp2SubmitReqPkt", "ServiceId")
+	}
+	if len(p.FeeTerminalId) > 21 {
+		return invalidField("Cmpp2SubmitReqPkt", "FeeTerminalId")
+	}
+	if len(p.MsgSrc) > 6 {
+		return invalidField("Cmpp2SubmitReqPkt", "MsgSrc")
+	}
+	if len(p.FeeType) > 2 {
+		return invalidField("Cmpp2SubmitReqPkt", "FeeType")
+	}
+	if len(p.FeeCode) > 6 {
+		return invalidField("Cmpp2SubmitReqPkt", "FeeCode")
+	}
+	if len(p.ValidTime) > 17 {
+		return invalidField("Cmpp2SubmitReqPkt", "ValidTime")
+	}
+	if len(p.AtTime) > 17 {
+		return invalidField("Cmpp2SubmitReqPkt", "AtTime")
+	}
+	if len(p.SrcId) > 21 {
+		return invalidField("Cmpp2SubmitReqPkt", "SrcId")
+	}
+	if len(p.DestTerminalId) != int(p.DestUsrTl) {
+		return invalidField("Cmpp2SubmitReqPkt", "DestTerminalId")
+	}
+	for _, s := range p.DestTerminalId {
+		if len(s) > 21 {
+			return invalidField("Cmpp2SubmitReqPkt", "DestTerminalId")
+		}
+	}
+	if len(p.MsgContent) != int(p.MsgLength) {
+		return invalidField("Cmpp2SubmitReqPkt", "MsgContent")
+	}
+	if len(p.Reserve) > 8 {
+		return invalidField("Cmpp2SubmitReqPkt", "Reserve")
+	}
+	return nil
+}
+
+// Pack packs the Cmpp2SubmitReqPkt to bytes stream.
+func (p *Cmpp2SubmitReqPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp2SubmitReqPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	p.beforePack()
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_SUBMIT))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint64(p.MsgId)
+	w.WriteUint8(p.PkTotal)
+	w.WriteUint8(p.PkNumber)
+	w.WriteUint8(p.RegisteredDelivery)
+	w.WriteUint8(p.MsgLevel)
+	w.WriteFixedSizeString(p.ServiceId, 10)
+	w.WriteUint8(p.FeeUserType)
+	w.WriteFixedSizeString(p.FeeTerminalId, 21)
+	w.WriteUint8(p.TpPid)
+	w.WriteUint8(p.TpUdhi)
+	w.WriteUint8(p.MsgFmt)
+	w.WriteFixedSizeString(p.MsgSrc, 6)
+	w.WriteFixedSizeString(p.FeeType, 2)
+	w.WriteFixedSizeString(p.FeeCode, 6)
+	w.WriteFixedSizeString(p.ValidTime, 17)
+	w.WriteFixedSizeString(p.AtTime, 17)
+	w.WriteFixedSizeString(p.SrcId, 21)
+	w.WriteUint8(p.DestUsrTl)
+	for _, s := range p.DestTerminalId {
+		w.WriteFixedSizeString(s, 21)
+	}
+	w.WriteUint8(p.MsgLength)
+	w.WriteString(p.MsgContent)
+	w.WriteFixedSizeString(p.Reserve, 8)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp2SubmitReqPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp2SubmitReqPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.MsgId = r.ReadUint64()
+	p.PkTotal = r.ReadUint8()
+	p.PkNumber = r.ReadUint8()
+	p.RegisteredDelivery = r.ReadUint8()
+	p.MsgLevel = r.ReadUint8()
+	p.ServiceId = r.ReadCString(10)
+	p.FeeUserType = r.ReadUint8()
+	p.FeeTerminalId = r.ReadCString(21)
+	p.TpPid = r.ReadUint8()
+	p.TpUdhi = r.ReadUint8()
+	p.MsgFmt = r.ReadUint8()
+	p.MsgSrc = r.ReadCString(6)
+	p.FeeType = r.ReadString(2)
+	p.FeeCode = r.ReadCString(6)
+	p.ValidTime = r.ReadCString(17)
+	p.AtTime = r.ReadCString(17)
+	p.SrcId = r.ReadCString(21)
+	p.DestUsrTl = r.ReadUint8()
+	p.DestTerminalId = make([]string, 0, p.DestUsrTl)
+	for i := 0; i < int(p.DestUsrTl); i++ {
+		p.DestTerminalId = append(p.DestTerminalId, r.ReadCString(21))
+	}
+	p.MsgLength = r.ReadUint8()
+	p.MsgContent = r.ReadString(int(p.MsgLength))
+	p.Reserve = r.ReadCString(8)
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp2SubmitRspPkt.
+func (p *Cmpp2SubmitRspPkt) CommandId() CommandId {
+	return CMPP_SUBMIT_RESP
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp2SubmitRspPkt.
+func (p *Cmpp2SubmitRspPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp2SubmitRspPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp2SubmitRspPkt.
+func (p *Cmpp2SubmitRspPkt) ProtocolVersion() Type {
+	return V21
+}
+
+// String returns the fields of the Cmpp2SubmitRspPkt in a readable form.
+func (p *Cmpp2SubmitRspPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp2SubmitRspPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp2SubmitRspPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp2SubmitRspPkt.
+func (p *Cmpp2SubmitRspPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 9
+}
+
+// Validate checks that the fields of the Cmpp2SubmitRspPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp2SubmitRspPkt) Validate() error {
+	return nil
+}
+
+// Pack packs the Cmpp2SubmitRspPkt to bytes stream.
+func (p *Cmpp2SubmitRspPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp2SubmitRspPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_SUBMIT_RESP))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint64(p.MsgId)
+	w.WriteUint8(p.Result)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp2SubmitRspPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp2SubmitRspPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.MsgId = r.ReadUint64()
+	p.Result = r.ReadUint8()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp3SubmitReqPkt.
+func (p *Cmpp3SubmitReqPkt) CommandId() CommandId {
+	return CMPP_SUBMIT
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp3SubmitReqPkt.
+func (p *Cmpp3SubmitReqPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp3SubmitReqPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp3SubmitReqPkt.
+func (p *Cmpp3SubmitReqPkt) ProtocolVersion() Type {
+	return V30
+}
+
+// String returns the fields of the Cmpp3SubmitReqPkt in a readable form.
+func (p *Cmpp3SubmitReqPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp3SubmitReqPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp3SubmitReqPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp3SubmitReqPkt.
+func (p *Cmpp3SubmitReqPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 151 + uint32(p.DestUsrTl)*32 + uint32(p.MsgLength)
+}
+
+// Validate checks that the fields of the Cmpp3SubmitReqPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp3SubmitReqPkt) Validate() error {
+	if len(p.ServiceId) > 10 {
+		return invalidField("Cmpp3SubmitReqPkt", "ServiceId")
+	}
+	if len(p.FeeTerminalId) > 32 {
+		return invalidField("Cmpp3SubmitReqPkt", "FeeTerminalId")
+	}
+	if len(p.MsgSrc) > 6 {
+		return invalidField("Cmpp3SubmitReqPkt", "MsgSrc")
+	}
+	if len(p.FeeType) > 2 {
+		return invalidField("Cmpp3SubmitReqPkt", "FeeType")
+	}
+	if len(p.FeeCode) > 6 {
+		return invalidField("Cmpp3SubmitReqPkt", "FeeCode")
+	}
+	if len(p.ValidTime) > 17 {
+		return invalidField("Cmpp3SubmitReqPkt", "ValidTime")
+	}
+	if len(p.AtTime) > 17 {
+		return invalidField("Cmpp3SubmitReqPkt", "AtTime")
+	}
+	if len(p.SrcId) > 21 {
+		return invalidField("Cmpp3SubmitReqPkt", "SrcId")
+	}
+	if len(p.DestTerminalId) != int(p.DestUsrTl) {
+		return invalidField("Cmpp3SubmitReqPkt", "DestTerminalId")
+	}
+	for _, s := range p.DestTerminalId {
+		if len(s) > 32 {
+			return invalidField("Cmpp3SubmitReqPkt", "DestTerminalId")
+		}
+	}
+	if len(p.MsgContent) != int(p.MsgLength) {
+		return invalidField("Cmpp3SubmitReqPkt", "MsgContent")
+	}
+	if len(p.LinkId) > 20 {
+		return invalidField("Cmpp3SubmitReqPkt", "LinkId")
+	}
+	return nil
+}
+
+// Pack packs the Cmpp3SubmitReqPkt to bytes stream.
+func (p *Cmpp3SubmitReqPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp3SubmitReqPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	p.beforePack()
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_SUBMIT))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint64(p.MsgId)
+	w.WriteUint8(p.PkTotal)
+	w.WriteUint8(p.PkNumber)
+	w.WriteUint8(p.RegisteredDelivery)
+	w.WriteUint8(p.MsgLevel)
+	w.WriteFixedSizeString(p.ServiceId, 10)
+	w.WriteUint8(p.FeeUserType)
+	w.WriteFixedSizeString(p.FeeTerminalId, 32)
+	w.WriteUint8(p.FeeTerminalType)
+	w.WriteUint8(p.TpPid)
+	w.WriteUint8(p.TpUdhi)
+	w.WriteUint8(p.MsgFmt)
+	w.WriteFixedSizeString(p.MsgSrc, 6)
+	w.WriteFixedSizeString(p.FeeType, 2)
+	w.WriteFixedSizeString(p.FeeCode, 6)
+	w.WriteFixedSizeString(p.ValidTime, 17)
+	w.WriteFixedSizeString(p.AtTime, 17)
+	w.WriteFixedSizeString(p.SrcId, 21)
+	w.WriteUint8(p.DestUsrTl)
+	for _, s := range p.DestTerminalId {
+		w.WriteFixedSizeString(s, 32)
+	}
+	w.WriteUint8(p.DestTerminalType)
+	w.WriteUint8(p.MsgLength)
+	w.WriteString(p.MsgContent)
+	w.WriteFixedSizeString(p.LinkId, 20)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp3SubmitReqPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp3SubmitReqPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.MsgId = r.ReadUint64()
+	p.PkTotal = r.ReadUint8()
+	p.PkNumber = r.ReadUint8()
+	p.RegisteredDelivery = r.ReadUint8()
+	p.MsgLevel = r.ReadUint8()
+	p.ServiceId = r.ReadCString(10)
+	p.FeeUserType = r.ReadUint8()
+	p.FeeTerminalId = r.ReadCString(32)
+	p.FeeTerminalType = r.ReadUint8()
+	p.TpPid = r.ReadUint8()
+	p.TpUdhi = r.ReadUint8()
+	p.MsgFmt = r.ReadUint8()
+	p.MsgSrc = r.ReadCString(6)
+	p.FeeType = r.ReadString(2)
+	p.FeeCode = r.ReadCString(6)
+	p.ValidTime = r.ReadCString(17)
+	p.AtTime = r.ReadCString(17)
+	p.SrcId = r.ReadCString(21)
+	p.DestUsrTl = r.ReadUint8()
+	p.DestTerminalId = make([]string, 0, p.DestUsrTl)
+	for i := 0; i < int(p.DestUsrTl); i++ {
+		p.DestTerminalId = append(p.DestTerminalId, r.ReadCString(32))
+	}
+	p.DestTerminalType = r.ReadUint8()
+	p.MsgLength = r.ReadUint8()
+	p.MsgContent = r.ReadString(int(p.MsgLength))
+	p.LinkId = r.ReadCString(20)
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the Cmpp3SubmitRspPkt.
+func (p *Cmpp3SubmitRspPkt) CommandId() CommandId {
+	return CMPP_SUBMIT_RESP
+}
+
+// SequenceId returns the Sequence_Id of the Cmpp3SubmitRspPkt.
+func (p *Cmpp3SubmitRspPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *Cmpp3SubmitRspPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the Cmpp3SubmitRspPkt.
+func (p *Cmpp3SubmitRspPkt) ProtocolVersion() Type {
+	return V30
+}
+
+// String returns the fields of the Cmpp3SubmitRspPkt in a readable form.
+func (p *Cmpp3SubmitRspPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Cmpp3SubmitRspPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *Cmpp3SubmitRspPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the Cmpp3SubmitRspPkt.
+func (p *Cmpp3SubmitRspPkt) Len() uint32 {
+	return CMPP_HEADER_LEN + 12
+}
+
+// Validate checks that the fields of the Cmpp3SubmitRspPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *Cmpp3SubmitRspPkt) Validate() error {
+	return nil
+}
+
+// Pack packs the Cmpp3SubmitRspPkt to bytes stream.
+func (p *Cmpp3SubmitRspPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *Cmpp3SubmitRspPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_SUBMIT_RESP))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	// Pack body
+	w.WriteUint64(p.MsgId)
+	w.WriteUint32(p.Result)
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a Cmpp3SubmitRspPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *Cmpp3SubmitRspPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	// Body
+	p.MsgId = r.ReadUint64()
+	p.Result = r.ReadUint32()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the CmppTerminateReqPkt.
+func (p *CmppTerminateReqPkt) CommandId() CommandId {
+	return CMPP_TERMINATE
+}
+
+// SequenceId returns the Sequence_Id of the CmppTerminateReqPkt.
+func (p *CmppTerminateReqPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *CmppTerminateReqPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the CmppTerminateReqPkt.
+func (p *CmppTerminateReqPkt) ProtocolVersion() Type {
+	return 0
+}
+
+// String returns the fields of the CmppTerminateReqPkt in a readable form.
+func (p *CmppTerminateReqPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *CmppTerminateReqPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *CmppTerminateReqPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the CmppTerminateReqPkt.
+func (p *CmppTerminateReqPkt) Len() uint32 {
+	return CMPP_HEADER_LEN
+}
+
+// Validate checks that the fields of the CmppTerminateReqPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *CmppTerminateReqPkt) Validate() error {
+	return nil
+}
+
+// Pack packs the CmppTerminateReqPkt to bytes stream.
+func (p *CmppTerminateReqPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *CmppTerminateReqPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_TERMINATE))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a CmppTerminateReqPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *CmppTerminateReqPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	return r.Error()
+}
+
+// CommandId returns the Command_Id of the CmppTerminateRspPkt.
+func (p *CmppTerminateRspPkt) CommandId() CommandId {
+	return CMPP_TERMINATE_RESP
+}
+
+// SequenceId returns the Sequence_Id of the CmppTerminateRspPkt.
+func (p *CmppTerminateRspPkt) SequenceId() uint32 {
+	return p.SeqId
+}
+
+func (p *CmppTerminateRspPkt) setSequenceId(seqId uint32) {
+	p.SeqId = seqId
+}
+
+// ProtocolVersion returns the protocol version of the CmppTerminateRspPkt.
+func (p *CmppTerminateRspPkt) ProtocolVersion() Type {
+	return 0
+}
+
+// String returns the fields of the CmppTerminateRspPkt in a readable form.
+func (p *CmppTerminateRspPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *CmppTerminateRspPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *CmppTerminateRspPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
+
+// Len returns the Total_Length of the CmppTerminateRspPkt.
+func (p *CmppTerminateRspPkt) Len() uint32 {
+	return CMPP_HEADER_LEN
+}
+
+// Validate checks that the fields of the CmppTerminateRspPkt fit in their widths,
+// and agree with the length and count fields.
+func (p *CmppTerminateRspPkt) Validate() error {
+	return nil
+}
+
+// Pack packs the CmppTerminateRspPkt to bytes stream.
+func (p *CmppTerminateRspPkt) Pack(seqId uint32) ([]byte, error) {
+	return p.AppendPack(nil, seqId)
+}
+
+// AppendPack is like Pack, but appends the packet to dst and
+// returns the extended buffer.
+func (p *CmppTerminateRspPkt) AppendPack(dst []byte, seqId uint32) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return dst, err
+	}
+
+	var pktLen = p.Len()
+	var w = newPacketWriter(dst, pktLen)
+
+	// Pack header
+	w.WriteUint32(pktLen)
+	w.WriteUint32(uint32(CMPP_TERMINATE_RESP))
+	w.WriteUint32(seqId)
+	p.SeqId = seqId
+
+	return w.Bytes()
+}
+
+// Unpack unpack the binary byte stream to a CmppTerminateRspPkt variable.
+// Parameter data contains seqId in header and the whole packet body.
+func (p *CmppTerminateRspPkt) Unpack(data []byte) error {
+	var r = newPacketReader(data)
+
+	// Sequence Id
+	p.SeqId = r.ReadUint32()
+
+	return r.Error()
+}
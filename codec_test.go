@@ -0,0 +1,185 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp_test
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	var cases = []struct {
+		typ     cmpp.Type
+		packets []cmpp.Packer
+	}{
+		{cmpp.V30, []cmpp.Packer{
+			&cmpp.CmppActiveTestReqPkt{},
+			&cmpp.Cmpp3SubmitReqPkt{
+				MsgSrc:         "900001",
+				FeeType:        "02",
+				SrcId:          "900001",
+				DestUsrTl:      1,
+				DestTerminalId: []string{"13500002696"},
+				MsgLength:      5,
+				MsgContent:     "hello",
+			},
+			&cmpp.Cmpp3SubmitRspPkt{MsgId: 12878564852733378560},
+			&cmpp.CmppTerminateReqPkt{},
+		}},
+		{cmpp.V21, []cmpp.Packer{
+			&cmpp.Cmpp2DeliverReqPkt{
+				MsgId:         13052947396898652160,
+				DestId:        "900001",
+				SrcTerminalId: "13412340000",
+				MsgLength:     18,
+				MsgContent:    "This is a test MO.",
+			},
+			&cmpp.Cmpp2DeliverRspPkt{MsgId: 13052947396898652160},
+		}},
+	}
+
+	for _, c := range cases {
+		var buf bytes.Buffer
+		enc := cmpp.NewEncoder(&buf)
+		for i, p := range c.packets {
+			if err := enc.Encode(p, uint32(i+1)); err != nil {
+				t.Fatalf("%s: encode %T error: %v\n", c.typ, p, err)
+			}
+		}
+
+		dec := cmpp.NewDecoder(&buf, c.typ)
+		for _, wanted := range c.packets {
+			p, err := dec.Decode()
+			if err != nil {
+				t.Fatalf("%s: decode error: %v\n", c.typ, err)
+			}
+			if !reflect.DeepEqual(p, wanted) {
+				t.Fatalf("%s: decoded packet: actual [%#v], wanted [%#v]\n", c.typ, p, wanted)
+			}
+		}
+		if _, err := dec.Decode(); err != io.EOF {
+			t.Fatalf("%s: decode at the end: actual [%v], wanted [%v]\n", c.typ, err, io.EOF)
+		}
+	}
+}
+
+func TestDecoderTruncated(t *testing.T) {
+	data, _ := (&cmpp.Cmpp3SubmitRspPkt{MsgId: 1}).Pack(1)
+
+	dec := cmpp.NewDecoder(bytes.NewReader(data[:len(data)-1]), cmpp.V30)
+	if _, err := dec.Decode(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("decode a truncated frame: actual [%v], wanted [%v]\n", err, io.ErrUnexpectedEOF)
+	}
+
+	dec = cmpp.NewDecoder(bytes.NewReader(data[:6]), cmpp.V30)
+	if _, err := dec.Decode(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("decode a truncated header: actual [%v], wanted [%v]\n", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestDecodePacket(t *testing.T) {
+	data, _ := (&cmpp.CmppActiveTestRspPkt{}).Pack(7)
+
+	p, err := cmpp.DecodePacket(data, cmpp.V30)
+	if err != nil {
+		t.Fatal("decode packet error:", err)
+	}
+	if rsp, ok := p.(*cmpp.CmppActiveTestRspPkt); !ok || rsp.SeqId != 7 {
+		t.Fatalf("decoded packet: actual [%#v], wanted an active test response with seqId 7\n", p)
+	}
+
+	if _, err := cmpp.DecodePacket(append(data, 0), cmpp.V30); err != cmpp.ErrTotalLengthInvalid {
+		t.Fatalf("decode packet with trailing data: actual [%v], wanted [%v]\n", err, cmpp.ErrTotalLengthInvalid)
+	}
+	if _, err := cmpp.DecodePacket(data[:8], cmpp.V30); err != cmpp.ErrTotalLengthInvalid {
+		t.Fatalf("decode a short packet: actual [%v], wanted [%v]\n", err, cmpp.ErrTotalLengthInvalid)
+	}
+
+	data[4], data[7] = 0, 0x10 // CMPP_MT_ROUTE
+	if _, err := cmpp.DecodePacket(data, cmpp.V30); err != cmpp.ErrCommandIdNotSupported {
+		t.Fatalf("decode packet with an unsupported command id: actual [%v], wanted [%v]\n", err, cmpp.ErrCommandIdNotSupported)
+	}
+	data[7] = 0
+	if _, err := cmpp.DecodePacket(data, cmpp.V30); err != cmpp.ErrCommandIdInvalid {
+		t.Fatalf("decode packet with an invalid command id: actual [%v], wanted [%v]\n", err, cmpp.ErrCommandIdInvalid)
+	}
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	d := cmpp.NewDecoder(&fakeConn{reader: bytes.NewBuffer(data)}, cmpp.V30)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.Decode()
+	}
+}
+
+func TestNewResponse(t *testing.T) {
+	var tests = []struct {
+		req  cmpp.Pdu
+		typ  cmpp.Type
+		want cmpp.Pdu
+	}{
+		{&cmpp.CmppConnReqPkt{SeqId: seqId}, cmpp.V30, &cmpp.Cmpp3ConnRspPkt{SeqId: seqId}},
+		{&cmpp.CmppConnReqPkt{SeqId: seqId}, cmpp.V21, &cmpp.Cmpp2ConnRspPkt{SeqId: seqId}},
+		{&cmpp.Cmpp3SubmitReqPkt{SeqId: seqId}, cmpp.V30, &cmpp.Cmpp3SubmitRspPkt{SeqId: seqId}},
+		{&cmpp.Cmpp2DeliverReqPkt{SeqId: seqId}, cmpp.V20, &cmpp.Cmpp2DeliverRspPkt{SeqId: seqId}},
+		{&cmpp.CmppCancelReqPkt{SeqId: seqId}, cmpp.V30, &cmpp.Cmpp3CancelRspPkt{SeqId: seqId}},
+		{&cmpp.CmppActiveTestReqPkt{SeqId: seqId}, cmpp.V30, &cmpp.CmppActiveTestRspPkt{SeqId: seqId}},
+	}
+
+	for _, tt := range tests {
+		rsp, err := cmpp.NewResponse(tt.req, tt.typ)
+		if err != nil {
+			t.Fatalf("NewResponse(%T) error: %v", tt.req, err)
+		}
+		if !reflect.DeepEqual(rsp, tt.want) {
+			t.Errorf("NewResponse(%T) is %#v, not equal to the expected value: %#v", tt.req, rsp, tt.want)
+		}
+		if rsp.CommandId() != tt.req.CommandId().Response() {
+			t.Errorf("NewResponse(%T) returns a %v", tt.req, rsp.CommandId())
+		}
+		if rsp.SequenceId() != seqId {
+			t.Errorf("NewResponse(%T) returns a response with SequenceId %d", tt.req, rsp.SequenceId())
+		}
+	}
+
+	if _, err := cmpp.NewResponse(&cmpp.CmppTerminateRspPkt{}, cmpp.V30); err != cmpp.ErrNotRequest {
+		t.Errorf("NewResponse of a response returns %v, not %v", err, cmpp.ErrNotRequest)
+	}
+}
+
+func TestPduVersion(t *testing.T) {
+	var tests = []struct {
+		p    cmpp.Pdu
+		want cmpp.Type
+	}{
+		{&cmpp.Cmpp2SubmitReqPkt{}, cmpp.V21},
+		{&cmpp.Cmpp3FwdRspPkt{}, cmpp.V30},
+		{&cmpp.Cmpp3ConnRspPkt{}, cmpp.V30},
+		{&cmpp.CmppConnReqPkt{Version: cmpp.V20}, cmpp.V20},
+		{&cmpp.CmppQueryReqPkt{}, 0},
+	}
+
+	for _, tt := range tests {
+		if v := tt.p.ProtocolVersion(); v != tt.want {
+			t.Errorf("%T.ProtocolVersion() is %v, not %v", tt.p, v, tt.want)
+		}
+	}
+}
@@ -14,15 +14,17 @@
 package cmpp
 
 import (
+	"bufio"
 	"encoding/binary"
 	"errors"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type State uint8
+type State uint32
 
 // Errors for conn operations
 var (
@@ -33,6 +35,14 @@ var (
 
 var noDeadline = time.Time{}
 
+// DefaultMaxWriteDelay is the max duration a packet may stay in
+// the write buffer if EnableWriteBuffer is given no delay.
+const DefaultMaxWriteDelay = 5 * time.Millisecond
+
+// closeFlushTimeout bounds the time Close spends on writing out
+// the buffered packets.
+const closeFlushTimeout = time.Second
+
 // Conn States
 const (
 	CONN_CLOSED State = iota
@@ -40,77 +50,209 @@ const (
 	CONN_AUTHOK
 )
 
+// Conn is safe for concurrent use: packets sent by multiple
+// goroutines are written to the underlying net.Conn frame by frame,
+// and the state transitions are atomic. RecvAndUnpackPkt should
+// be called by one goroutine at a time.
 type Conn struct {
+	id uint64 // first for the 64-bit alignment of atomic operations.
+
 	net.Conn
-	State State
+	state uint32
 	Typ   Type
 
-	// for SeqId generator goroutine
-	SeqId <-chan uint32
-	done  chan<- struct{}
-}
+	// WriteTimeout is the max duration for writing a packet(or a
+	// batch of buffered packets) to the underlying net.Conn.
+	// Zero means no timeout.
+	WriteTimeout time.Duration
 
-func newSeqIdGenerator() (<-chan uint32, chan<- struct{}) {
-	out := make(chan uint32)
-	done := make(chan struct{})
-
-	go func() {
-		var i uint32
-		for {
-			select {
-			case out <- i:
-				i++
-			case <-done:
-				close(out)
-				return
-			}
-		}
-	}()
-	return out, done
+	// SeqGen generates the Sequence_Id of the requests sent on the
+	// connection. If nil, a new default generator is used. Set it
+	// before the connection is used to share a generator between
+	// connections, or to persist the ids.
+	SeqGen  SequenceGenerator
+	seqOnce sync.Once
+
+	sendInterceptors []Interceptor
+	recvInterceptors []Interceptor
+
+	wmu        sync.Mutex    // serializes frame writes
+	bw         *bufio.Writer // optional write buffer
+	maxDelay   time.Duration
+	flushTimer *time.Timer
+	doneOnce   sync.Once
+	done       chan struct{}
+	closeOnce  sync.Once
 }
 
 // New returns an abstract structure for successfully
-// established underlying net.Conn.
+// established underlying net.Conn. conn may be any stream
+// oriented net.Conn, such as a *net.TCPConn, a *tls.Conn,
+// a *net.UnixConn or one end of a net.Pipe.
 func NewConn(conn net.Conn, typ Type) *Conn {
-	seqId, done := newSeqIdGenerator()
 	c := &Conn{
-		Conn:  conn,
-		Typ:   typ,
-		SeqId: seqId,
-		done:  done,
+		Conn: conn,
+		Typ:  typ,
+	}
+	if tc, ok := c.Conn.(*net.TCPConn); ok {
+		tc.SetKeepAlive(true) //Keepalive as default
 	}
-	tc := c.Conn.(*net.TCPConn) // Always tcpconn
-	tc.SetKeepAlive(true)       //Keepalive as default
 	return c
 }
 
+// Close closes the connection. It is safe to call Close
+// more than once, and from multiple goroutines.
 func (c *Conn) Close() {
-	if c != nil {
-		if c.State == CONN_CLOSED {
-			return
-		}
-		close(c.done)  // let the SeqId goroutine exit.
+	if c == nil {
+		return
+	}
+
+	c.closeOnce.Do(func() {
+		// close done before storing the state, so that SetState
+		// can never bring a closed connection back.
+		close(c.doneChan())
+		atomic.StoreUint32(&c.state, uint32(CONN_CLOSED))
+
+		// flush the buffered packets, but never let a stuck
+		// write block Close for long.
+		c.Conn.SetWriteDeadline(time.Now().Add(closeFlushTimeout))
+		c.Flush()
+
 		c.Conn.Close() // close the underlying net.Conn
-		c.State = CONN_CLOSED
+	})
+}
+
+// NextSeqId returns the Sequence_Id for the next request
+// sent on the connection.
+func (c *Conn) NextSeqId() uint32 {
+	c.seqOnce.Do(func() {
+		if c.SeqGen == nil {
+			c.SeqGen = NewSequenceGenerator(0)
+		}
+	})
+	return c.SeqGen.NextSeqId()
+}
+
+// connIdSeq generates the ids of the connections.
+var connIdSeq uint64
+
+// ID returns the id of the connection, which is unique among the
+// connections in the process.
+func (c *Conn) ID() uint64 {
+	if id := atomic.LoadUint64(&c.id); id != 0 {
+		return id
 	}
+	atomic.CompareAndSwapUint64(&c.id, 0, atomic.AddUint64(&connIdSeq, 1))
+	return atomic.LoadUint64(&c.id)
+}
+
+// Done returns a channel that is closed when the connection
+// is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.doneChan()
 }
 
+func (c *Conn) doneChan() chan struct{} {
+	c.doneOnce.Do(func() {
+		c.done = make(chan struct{})
+	})
+	return c.done
+}
+
+// State returns the current state of the connection.
+func (c *Conn) State() State {
+	return State(atomic.LoadUint32(&c.state))
+}
+
+// SetState changes the state of the connection to state.
+// A closed connection stays closed.
 func (c *Conn) SetState(state State) {
-	c.State = state
+	for {
+		old := atomic.LoadUint32(&c.state)
+		if c.isClosed() {
+			return
+		}
+		if atomic.CompareAndSwapUint32(&c.state, old, uint32(state)) {
+			return
+		}
+	}
+}
+
+// isClosed reports whether Close has been called.
+func (c *Conn) isClosed() bool {
+	select {
+	case <-c.doneChan():
+		return true
+	default:
+	}
+	return false
 }
 
 // SendPkt pack the cmpp packet structure and send it to the other peer.
+// If the write buffer is enabled, the packet may be held in the buffer
+// for a while before being written out.
 func (c *Conn) SendPkt(packet Packer, seqId uint32) error {
-	if c.State == CONN_CLOSED {
+	if c.State() == CONN_CLOSED {
 		return ErrConnIsClosed
 	}
 
-	data, err := packet.Pack(seqId)
-	if err != nil {
-		return err
+	wb := writeBufferPool.Get().(*writeBuffer)
+	defer writeBufferPool.Put(wb)
+
+	if len(c.sendInterceptors) != 0 {
+		f := &Frame{
+			Conn:   c,
+			Packet: packet,
+			SeqId:  seqId,
+			Time:   time.Now(),
+		}
+		return intercept(c.sendInterceptors, f, func(f *Frame) error {
+			return c.sendFrame(f, wb)
+		})
+	}
+
+	f := Frame{
+		Packet: packet,
+		SeqId:  seqId,
+	}
+	return c.sendFrame(&f, wb)
+}
+
+// sendFrame packs f.Packet into wb, unless f.Data is set already,
+// and writes the frame.
+func (c *Conn) sendFrame(f *Frame, wb *writeBuffer) error {
+	var err error
+	if f.Data == nil {
+		if ap, ok := f.Packet.(AppendPacker); ok {
+			wb.data, err = ap.AppendPack(wb.data[:0], f.SeqId)
+			f.Data = wb.data
+		} else {
+			f.Data, err = f.Packet.Pack(f.SeqId)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !f.Time.IsZero() {
+		defer func() {
+			f.Elapsed = time.Since(f.Time)
+		}()
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.bw != nil {
+		if _, err = c.bw.Write(f.Data); err != nil {
+			return err
+		}
+		if c.bw.Buffered() > 0 && c.flushTimer == nil {
+			c.flushTimer = time.AfterFunc(c.maxDelay, c.delayedFlush)
+		}
+		return nil
 	}
 
-	_, err = c.Conn.Write(data) //block write
+	_, err = deadlineWriter{c}.Write(f.Data) //block write
 	if err != nil {
 		return err
 	}
@@ -118,8 +260,69 @@ func (c *Conn) SendPkt(packet Packer, seqId uint32) error {
 	return nil
 }
 
+// EnableWriteBuffer makes the packets sent by SendPkt be buffered
+// and written out in batches, which saves syscalls when lots of
+// small packets are sent. A packet stays in the buffer for at most
+// maxDelay(DefaultMaxWriteDelay if it is zero) before being written,
+// unless Flush is called earlier or the buffer of size bytes fills up.
+// Packets are always written in the order they are sent.
+//
+// EnableWriteBuffer should be called before the connection is used.
+func (c *Conn) EnableWriteBuffer(size int, maxDelay time.Duration) {
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxWriteDelay
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.bw = bufio.NewWriterSize(deadlineWriter{c}, size)
+	c.maxDelay = maxDelay
+}
+
+// Flush writes the buffered packets to the underlying net.Conn.
+// It is a no-op if the write buffer is not enabled.
+func (c *Conn) Flush() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.flushLocked()
+}
+
+func (c *Conn) flushLocked() error {
+	if c.bw == nil {
+		return nil
+	}
+	if c.flushTimer != nil {
+		c.flushTimer.Stop()
+		c.flushTimer = nil
+	}
+	return c.bw.Flush()
+}
+
+func (c *Conn) delayedFlush() {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.flushTimer = nil
+	c.bw.Flush() // the error sticks in bw, and returns on next write.
+}
+
+// deadlineWriter writes to the underlying net.Conn of the Conn
+// with its write timeout.
+type deadlineWriter struct {
+	c *Conn
+}
+
+func (w deadlineWriter) Write(data []byte) (int, error) {
+	if w.c.WriteTimeout == 0 {
+		return w.c.Conn.Write(data)
+	}
+	w.c.Conn.SetWriteDeadline(time.Now().Add(w.c.WriteTimeout))
+	defer w.c.Conn.SetWriteDeadline(noDeadline)
+	return w.c.Conn.Write(data)
+}
+
 const (
-	defaultReadBufferSize = 4096
+	defaultReadBufferSize  = 4096
+	defaultWriteBufferSize = 512 // grown as needed by larger packets.
 )
 
 // readBuffer is used to optimize the performance of
@@ -127,7 +330,7 @@ const (
 type readBuffer struct {
 	totalLen  uint32
 	commandId CommandId
-	leftData  [defaultReadBufferSize]byte
+	frame     [defaultReadBufferSize]byte // the whole frame, header included.
 }
 
 var readBufferPool = sync.Pool{
@@ -136,9 +339,23 @@ var readBufferPool = sync.Pool{
 	},
 }
 
+// writeBuffer is used to pack the packets sent by SendPkt
+// without allocating a new buffer for each of them.
+type writeBuffer struct {
+	data []byte
+}
+
+var writeBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &writeBuffer{
+			data: make([]byte, 0, defaultWriteBufferSize),
+		}
+	},
+}
+
 // RecvAndUnpackPkt receives cmpp byte stream, and unpack it to some cmpp packet structure.
 func (c *Conn) RecvAndUnpackPkt(timeout time.Duration) (interface{}, error) {
-	if c.State == CONN_CLOSED {
+	if c.State() == CONN_CLOSED {
 		return nil, ErrConnIsClosed
 	}
 	defer c.SetReadDeadline(noDeadline)
@@ -146,126 +363,94 @@ func (c *Conn) RecvAndUnpackPkt(timeout time.Duration) (interface{}, error) {
 	rb := readBufferPool.Get().(*readBuffer)
 	defer readBufferPool.Put(rb)
 
+	if len(c.recvInterceptors) != 0 {
+		f := &Frame{Conn: c}
+		err := intercept(c.recvInterceptors, f, func(f *Frame) error {
+			return c.recvFrame(f, rb, timeout)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return f.Packet, nil
+	}
+
+	var f Frame
+	if err := c.recvFrame(&f, rb, timeout); err != nil {
+		return nil, err
+	}
+	return f.Packet, nil
+}
+
+// recvFrame reads a frame into rb, and decodes it into f.
+func (c *Conn) recvFrame(f *Frame, rb *readBuffer, timeout time.Duration) error {
+	header := rb.frame[:8] // Total_Length and Command_Id
+
 	// Total_Length in packet
 	if timeout != 0 {
 		c.SetReadDeadline(time.Now().Add(timeout))
 	}
-	err := binary.Read(c.Conn, binary.BigEndian, &rb.totalLen)
+	_, err := io.ReadFull(c.Conn, header[:4])
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	if c.Typ == V30 {
-		if rb.totalLen < CMPP3_PACKET_MIN || rb.totalLen > CMPP3_PACKET_MAX {
-			return nil, ErrTotalLengthInvalid
-		}
+	if len(c.recvInterceptors) != 0 {
+		f.Time = time.Now()
 	}
-
-	if c.Typ == V21 || c.Typ == V20 {
-		if rb.totalLen < CMPP2_PACKET_MIN || rb.totalLen > CMPP2_PACKET_MAX {
-			return nil, ErrTotalLengthInvalid
-		}
+	rb.totalLen = binary.BigEndian.Uint32(header[:4])
+	if err = checkTotalLength(rb.totalLen, c.Typ); err != nil {
+		return err
 	}
 
 	// Command_Id
 	if timeout != 0 {
 		c.SetReadDeadline(time.Now().Add(timeout))
 	}
-	err = binary.Read(c.Conn, binary.BigEndian, &rb.commandId)
+	_, err = io.ReadFull(c.Conn, header[4:])
 	if err != nil {
 		netErr, ok := err.(net.Error)
 		if ok {
 			if netErr.Timeout() {
-				return nil, ErrReadCmdIDTimeout
+				return ErrReadCmdIDTimeout
 			}
 		}
-		return nil, err
+		return err
 	}
+	rb.commandId = CommandId(binary.BigEndian.Uint32(header[4:]))
 
-	if !((rb.commandId > CMPP_REQUEST_MIN && rb.commandId < CMPP_REQUEST_MAX) ||
-		(rb.commandId > CMPP_RESPONSE_MIN && rb.commandId < CMPP_RESPONSE_MAX)) {
-		return nil, ErrCommandIdInvalid
+	if err = checkCommandId(rb.commandId); err != nil {
+		return err
 	}
 
 	// The left packet data (start from seqId in header).
 	if timeout != 0 {
 		c.SetReadDeadline(time.Now().Add(timeout))
 	}
-	var leftData = rb.leftData[0:(rb.totalLen - 8)]
+	var leftData = rb.frame[8:rb.totalLen]
 	_, err = io.ReadFull(c.Conn, leftData)
 	if err != nil {
 		netErr, ok := err.(net.Error)
 		if ok {
 			if netErr.Timeout() {
-				return nil, ErrReadPktBodyTimeout
+				return ErrReadPktBodyTimeout
 			}
 		}
-		return nil, err
+		return err
 	}
+	f.Data = rb.frame[:rb.totalLen]
+	f.SeqId = binary.BigEndian.Uint32(leftData)
 
-	var p Packer
-	switch rb.commandId {
-	case CMPP_CONNECT:
-		p = &CmppConnReqPkt{}
-	case CMPP_CONNECT_RESP:
-		if c.Typ == V30 {
-			p = &Cmpp3ConnRspPkt{}
-		} else {
-			p = &Cmpp2ConnRspPkt{}
-		}
-	case CMPP_TERMINATE:
-		p = &CmppTerminateReqPkt{}
-	case CMPP_TERMINATE_RESP:
-		p = &CmppTerminateRspPkt{}
-	case CMPP_SUBMIT:
-		if c.Typ == V30 {
-			p = &Cmpp3SubmitReqPkt{}
-		} else {
-			p = &Cmpp2SubmitReqPkt{}
-		}
-	case CMPP_SUBMIT_RESP:
-		if c.Typ == V30 {
-			p = &Cmpp3SubmitRspPkt{}
-		} else {
-			p = &Cmpp2SubmitRspPkt{}
-		}
-	case CMPP_DELIVER:
-		if c.Typ == V30 {
-			p = &Cmpp3DeliverReqPkt{}
-		} else {
-			p = &Cmpp2DeliverReqPkt{}
-		}
-	case CMPP_DELIVER_RESP:
-		if c.Typ == V30 {
-			p = &Cmpp3DeliverRspPkt{}
-		} else {
-			p = &Cmpp2DeliverRspPkt{}
-		}
-	case CMPP_FWD:
-		if c.Typ == V30 {
-			p = &Cmpp3FwdReqPkt{}
-		} else {
-			p = &Cmpp2FwdReqPkt{}
-		}
-	case CMPP_FWD_RESP:
-		if c.Typ == V30 {
-			p = &Cmpp3FwdRspPkt{}
-		} else {
-			p = &Cmpp2FwdRspPkt{}
-		}
-	case CMPP_ACTIVE_TEST:
-		p = &CmppActiveTestReqPkt{}
-	case CMPP_ACTIVE_TEST_RESP:
-		p = &CmppActiveTestRspPkt{}
-
-	default:
-		p = nil
-		return nil, ErrCommandIdNotSupported
+	p, err := newPacket(rb.commandId, c.Typ)
+	if err != nil {
+		return err
 	}
 
 	err = p.Unpack(leftData)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	f.Packet = p
+	if !f.Time.IsZero() {
+		f.Elapsed = time.Since(f.Time)
 	}
-	return p, nil
+	return nil
 }
@@ -17,6 +17,7 @@ import (
 	"bytes"
 	"io"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -64,11 +65,176 @@ func BenchmarkRecvAndUnpackPkt(b *testing.B) {
 		Conn: &fakeConn{
 			reader: bytes.NewBuffer(data),
 		},
-		State: cmpp.CONN_AUTHOK,
-		Typ:   cmpp.V30,
+		Typ: cmpp.V30,
 	}
+	c.SetState(cmpp.CONN_AUTHOK)
 
+	b.ReportAllocs()
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		c.RecvAndUnpackPkt(0)
 	}
 }
+
+func TestConnConcurrentSend(t *testing.T) {
+	c1, c2 := net.Pipe()
+	sender, receiver := cmpp.NewConn(c1, cmpp.V30), cmpp.NewConn(c2, cmpp.V30)
+	sender.SetState(cmpp.CONN_AUTHOK)
+	receiver.SetState(cmpp.CONN_AUTHOK)
+	defer sender.Close()
+	defer receiver.Close()
+
+	const goroutines, packets = 8, 100
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < packets; j++ {
+				p := &cmpp.Cmpp3SubmitRspPkt{MsgId: uint64(i), Result: uint32(j)}
+				if err := sender.SendPkt(p, uint32(i*packets+j)); err != nil {
+					t.Error("send packet error:", err)
+					return
+				}
+			}
+		}(i)
+	}
+
+	for n := 0; n < goroutines*packets; n++ {
+		i, err := receiver.RecvAndUnpackPkt(5 * time.Second)
+		if err != nil {
+			t.Fatal("receive packet error:", err)
+		}
+		p, ok := i.(*cmpp.Cmpp3SubmitRspPkt)
+		if !ok {
+			t.Fatalf("received packet: actual [%#v], wanted a submit response\n", i)
+		}
+		if p.SeqId != uint32(p.MsgId)*packets+p.Result {
+			t.Fatalf("received packet is corrupted: %#v\n", p)
+		}
+	}
+	wg.Wait()
+}
+
+func TestConnClose(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	c := cmpp.NewConn(c1, cmpp.V30)
+	c.SetState(cmpp.CONN_AUTHOK)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Close()
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("Done is not closed after Close")
+	}
+
+	c.SetState(cmpp.CONN_AUTHOK)
+	if c.State() != cmpp.CONN_CLOSED {
+		t.Fatalf("state after Close: actual [%d], wanted [%d]\n", c.State(), cmpp.CONN_CLOSED)
+	}
+	if err := c.SendPkt(&cmpp.CmppActiveTestReqPkt{}, 1); err != cmpp.ErrConnIsClosed {
+		t.Fatalf("send after Close: actual [%v], wanted [%v]\n", err, cmpp.ErrConnIsClosed)
+	}
+}
+
+func TestConnWriteTimeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	c := cmpp.NewConn(c1, cmpp.V30)
+	defer c.Close()
+	c.SetState(cmpp.CONN_AUTHOK)
+	c.WriteTimeout = 50 * time.Millisecond
+
+	// nobody reads from c2.
+	err := c.SendPkt(&cmpp.CmppActiveTestReqPkt{}, 1)
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Fatalf("send with write timeout: actual [%v], wanted a timeout error\n", err)
+	}
+}
+
+// countingConn counts the writes to the underlying net.Conn.
+type countingConn struct {
+	net.Conn
+	mu     sync.Mutex
+	writes int
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	c.writes++
+	c.mu.Unlock()
+	return c.Conn.Write(b)
+}
+
+func TestConnWriteBuffer(t *testing.T) {
+	c1, c2 := net.Pipe()
+	cc := &countingConn{Conn: c1}
+	sender, receiver := cmpp.NewConn(cc, cmpp.V30), cmpp.NewConn(c2, cmpp.V30)
+	sender.SetState(cmpp.CONN_AUTHOK)
+	receiver.SetState(cmpp.CONN_AUTHOK)
+	defer sender.Close()
+	defer receiver.Close()
+	sender.EnableWriteBuffer(4096, 20*time.Millisecond)
+
+	const packets = 50
+	for i := 0; i < packets; i++ {
+		if err := sender.SendPkt(&cmpp.Cmpp3DeliverRspPkt{MsgId: uint64(i)}, uint32(i)); err != nil {
+			t.Fatal("send packet error:", err)
+		}
+	}
+
+	// the packets are written out after the max delay without Flush.
+	for i := 0; i < packets; i++ {
+		p, err := receiver.RecvAndUnpackPkt(5 * time.Second)
+		if err != nil {
+			t.Fatal("receive packet error:", err)
+		}
+		if rsp := p.(*cmpp.Cmpp3DeliverRspPkt); rsp.MsgId != uint64(i) || rsp.SeqId != uint32(i) {
+			t.Fatalf("packet %d: msgId/seqId is %d/%d\n", i, rsp.MsgId, rsp.SeqId)
+		}
+	}
+
+	cc.mu.Lock()
+	writes := cc.writes
+	cc.mu.Unlock()
+	if writes >= packets {
+		t.Fatalf("%d packets are written in %d writes, wanted them to be coalesced\n", packets, writes)
+	}
+
+}
+
+func TestConnFlush(t *testing.T) {
+	c1, c2 := net.Pipe()
+	sender, receiver := cmpp.NewConn(c1, cmpp.V30), cmpp.NewConn(c2, cmpp.V30)
+	sender.SetState(cmpp.CONN_AUTHOK)
+	receiver.SetState(cmpp.CONN_AUTHOK)
+	defer sender.Close()
+	defer receiver.Close()
+	sender.EnableWriteBuffer(4096, time.Hour)
+
+	if err := sender.SendPkt(&cmpp.CmppActiveTestReqPkt{}, 7); err != nil {
+		t.Fatal("send packet error:", err)
+	}
+	if _, err := receiver.RecvAndUnpackPkt(50 * time.Millisecond); err == nil {
+		t.Fatal("buffered packet is received before Flush")
+	}
+
+	go sender.Flush()
+	p, err := receiver.RecvAndUnpackPkt(5 * time.Second)
+	if err != nil {
+		t.Fatal("receive packet after Flush error:", err)
+	}
+	if p.(*cmpp.CmppActiveTestReqPkt).SeqId != 7 {
+		t.Fatalf("packet after Flush: %#v\n", p)
+	}
+}
@@ -69,13 +69,14 @@ func now() (string, uint32) {
 // unpack will fill the SourceAddr(SrcAddr), AuthSrc, Version, Timestamp
 // and SeqId
 //
+//cmpp:packet CMPP_CONNECT
 type CmppConnReqPkt struct {
-	SrcAddr   string
-	AuthSrc   string
-	Version   Type
+	SrcAddr   string `cmpp:"octet=6"`
+	AuthSrc   string `cmpp:"octet=16,binary"`
+	Version   Type   `cmpp:"uint8"`
 	Timestamp uint32
-	Secret    string
-	SeqId     uint32
+	Secret    string `cmpp:"-,secret"`
+	SeqId     uint32 `cmpp:"seqid"`
 }
 
 // Cmpp2ConnRspPkt represents a Cmpp2 connect response packet.
@@ -86,13 +87,14 @@ type CmppConnReqPkt struct {
 // when used in client side(unpack), nothing needed to be initialized.
 // unpack will fill the Status, AuthImsg, Version and SeqId
 //
+//cmpp:packet CMPP_CONNECT_RESP V21
 type Cmpp2ConnRspPkt struct {
 	Status   uint8
-	AuthIsmg string
-	Version  Type
-	Secret   string
-	AuthSrc  string
-	SeqId    uint32
+	AuthIsmg string `cmpp:"octet=16,binary"`
+	Version  Type   `cmpp:"uint8"`
+	Secret   string `cmpp:"-,secret"`
+	AuthSrc  string `cmpp:"-,binary"`
+	SeqId    uint32 `cmpp:"seqid"`
 }
 
 // Cmpp3ConnRspPkt represents a Cmpp3 connect response packet.
@@ -103,27 +105,19 @@ type Cmpp2ConnRspPkt struct {
 // when used in client side(unpack), nothing needed to be initialized.
 // unpack will fill the Status, AuthImsg, Version and SeqId
 //
+//cmpp:packet CMPP_CONNECT_RESP V30
 type Cmpp3ConnRspPkt struct {
 	Status   uint32
-	AuthIsmg string
-	Version  Type
-	Secret   string
-	AuthSrc  string
-	SeqId    uint32
+	AuthIsmg string `cmpp:"octet=16,binary"`
+	Version  Type   `cmpp:"uint8"`
+	Secret   string `cmpp:"-,secret"`
+	AuthSrc  string `cmpp:"-,binary"`
+	SeqId    uint32 `cmpp:"seqid"`
 }
 
-// Pack packs the CmppConnReqPkt to bytes stream for client side.
-// Before calling Pack, you should initialize a CmppConnReqPkt variable
-// with correct SourceAddr(SrcAddr), Secret and Version.
-func (p *CmppConnReqPkt) Pack(seqId uint32) ([]byte, error) {
-	var w = newPacketWriter(CmppConnReqPktLen)
-
-	// Pack header
-	w.WriteInt(binary.BigEndian, CmppConnReqPktLen)
-	w.WriteInt(binary.BigEndian, CMPP_CONNECT)
-	w.WriteInt(binary.BigEndian, seqId)
-	p.SeqId = seqId
-
+// beforePack sets the Timestamp to the current time if it is 0, and
+// computes the AuthSrc from the SrcAddr, the Secret and the Timestamp.
+func (p *CmppConnReqPkt) beforePack() {
 	var ts string
 	if p.Timestamp == 0 {
 		ts, p.Timestamp = now() //default: current time.
@@ -131,153 +125,39 @@ func (p *CmppConnReqPkt) Pack(seqId uint32) ([]byte, error) {
 		ts = cmpputils.TimeStamp2Str(p.Timestamp)
 	}
 
-	// Pack body
-	srcAddr := cmpputils.OctetString(p.SrcAddr, 6)
-	w.WriteString(srcAddr)
-
-	md5 := md5.Sum(bytes.Join([][]byte{[]byte(srcAddr),
+	md5 := md5.Sum(bytes.Join([][]byte{[]byte(cmpputils.OctetString(p.SrcAddr, 6)),
 		make([]byte, 9),
 		[]byte(p.Secret),
 		[]byte(ts)},
 		nil))
 	p.AuthSrc = string(md5[:])
-
-	w.WriteString(p.AuthSrc)
-	w.WriteInt(binary.BigEndian, p.Version)
-	w.WriteInt(binary.BigEndian, p.Timestamp)
-
-	return w.Bytes()
 }
 
-// Unpack unpack the binary byte stream to a CmppConnReqPkt variable.
-// Usually it is used in server side. After unpack, you will get SeqId, SourceAddr,
-// AuthenticatorSource, Version and Timestamp.
-func (p *CmppConnReqPkt) Unpack(data []byte) error {
-	var r = newPacketReader(data)
-
-	// Sequence Id
-	r.ReadInt(binary.BigEndian, &p.SeqId)
-
-	// Body: Source_Addr
-	var sa = make([]byte, 6)
-	r.ReadBytes(sa)
-	p.SrcAddr = string(sa)
-
-	// Body: AuthSrc
-	var as = make([]byte, 16)
-	r.ReadBytes(as)
-	p.AuthSrc = string(as)
-
-	// Body: Version
-	r.ReadInt(binary.BigEndian, &p.Version)
-	// Body: timestamp
-	r.ReadInt(binary.BigEndian, &p.Timestamp)
-
-	return r.Error()
+// ProtocolVersion returns the version the client asks for in
+// the CmppConnReqPkt.
+func (p *CmppConnReqPkt) ProtocolVersion() Type {
+	return p.Version
 }
 
-// Pack packs the Cmpp2ConnRspPkt to bytes stream for server side.
-// Before calling Pack, you should initialize a Cmpp2ConnRspPkt variable
-// with correct Status,AuthenticatorSource, Secret and Version.
-func (p *Cmpp2ConnRspPkt) Pack(seqId uint32) ([]byte, error) {
-	var w = newPacketWriter(Cmpp2ConnRspPktLen)
-
-	// pack header
-	w.WriteInt(binary.BigEndian, Cmpp2ConnRspPktLen)
-	w.WriteInt(binary.BigEndian, CMPP_CONNECT_RESP)
-	w.WriteInt(binary.BigEndian, seqId)
-	p.SeqId = seqId
-
-	// pack body
-	w.WriteInt(binary.BigEndian, p.Status)
-
+// beforePack computes the AuthIsmg from the Status, the AuthSrc of
+// the request and the Secret.
+func (p *Cmpp2ConnRspPkt) beforePack() {
 	md5 := md5.Sum(bytes.Join([][]byte{[]byte{p.Status},
 		[]byte(p.AuthSrc),
 		[]byte(p.Secret)},
 		nil))
 	p.AuthIsmg = string(md5[:])
-	w.WriteString(p.AuthIsmg)
-
-	w.WriteInt(binary.BigEndian, p.Version)
-
-	return w.Bytes()
 }
 
-// Unpack unpack the binary byte stream to a Cmpp2ConnRspPkt variable.
-// Usually it is used in client side. After unpack, you will get SeqId, Status,
-// AuthenticatorIsmg, and Version.
-// Parameter data contains seqId in header and the whole packet body.
-func (p *Cmpp2ConnRspPkt) Unpack(data []byte) error {
-	var r = newPacketReader(data)
-
-	// Sequence Id
-	r.ReadInt(binary.BigEndian, &p.SeqId)
-
-	// Body: Status
-	r.ReadInt(binary.BigEndian, &p.Status)
+// beforePack computes the AuthIsmg from the Status, the AuthSrc of
+// the request and the Secret.
+func (p *Cmpp3ConnRspPkt) beforePack() {
+	var statusBuf [4]byte
+	binary.BigEndian.PutUint32(statusBuf[:], p.Status)
 
-	// Body: AuthenticatorISMG
-	var s = make([]byte, 16)
-	r.ReadBytes(s)
-	p.AuthIsmg = string(s)
-
-	// Body: Version
-	r.ReadInt(binary.BigEndian, &p.Version)
-	return r.Error()
-}
-
-// Pack packs the Cmpp3ConnRspPkt to bytes stream for server side.
-// Before calling Pack, you should initialize a Cmpp3ConnRspPkt variable
-// with correct Status,AuthenticatorSource, Secret and Version.
-func (p *Cmpp3ConnRspPkt) Pack(seqId uint32) ([]byte, error) {
-	var w = newPacketWriter(Cmpp3ConnRspPktLen)
-
-	// pack header
-	w.WriteInt(binary.BigEndian, Cmpp3ConnRspPktLen)
-	w.WriteInt(binary.BigEndian, CMPP_CONNECT_RESP)
-	w.WriteInt(binary.BigEndian, seqId)
-	p.SeqId = seqId
-
-	// pack body
-	w.WriteInt(binary.BigEndian, p.Status)
-
-	var statusBuf = new(bytes.Buffer)
-	err := binary.Write(statusBuf, binary.BigEndian, p.Status)
-	if err != nil {
-		return nil, err
-	}
-
-	md5 := md5.Sum(bytes.Join([][]byte{statusBuf.Bytes(),
+	md5 := md5.Sum(bytes.Join([][]byte{statusBuf[:],
 		[]byte(p.AuthSrc),
 		[]byte(p.Secret)},
 		nil))
 	p.AuthIsmg = string(md5[:])
-	w.WriteString(p.AuthIsmg)
-
-	w.WriteInt(binary.BigEndian, p.Version)
-
-	return w.Bytes()
-}
-
-// Unpack unpack the binary byte stream to a Cmpp3ConnRspPkt variable.
-// Usually it is used in client side. After unpack, you will get SeqId, Status,
-// AuthenticatorIsmg, and Version.
-// Parameter data contains seqId in header and the whole packet body.
-func (p *Cmpp3ConnRspPkt) Unpack(data []byte) error {
-	var r = newPacketReader(data)
-
-	// Sequence Id
-	r.ReadInt(binary.BigEndian, &p.SeqId)
-
-	// Body: Status
-	r.ReadInt(binary.BigEndian, &p.Status)
-
-	// Body: AuthenticatorISMG
-	var s = make([]byte, 16)
-	r.ReadBytes(s)
-	p.AuthIsmg = string(s)
-
-	// Body: Version
-	r.ReadInt(binary.BigEndian, &p.Version)
-	return r.Error()
 }
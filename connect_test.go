@@ -298,7 +298,31 @@ func BenchmarkCmppConnReqPktUnpack(b *testing.B) {
 
 	p := &cmpp.CmppConnReqPkt{}
 
+	b.ReportAllocs()
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		p.Unpack(data)
 	}
 }
+
+func BenchmarkCmpp2ConnRspPktUnpack(b *testing.B) {
+	data, _ := (&cmpp.Cmpp2ConnRspPkt{Status: 0, AuthSrc: "authsrc", Secret: connSecret, Version: connVersion}).Pack(seqId)
+	p := &cmpp.Cmpp2ConnRspPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(data[8:])
+	}
+}
+
+func BenchmarkCmpp3ConnRspPktUnpack(b *testing.B) {
+	data, _ := (&cmpp.Cmpp3ConnRspPkt{Status: 0, AuthSrc: "authsrc", Secret: connSecret, Version: connVersion1}).Pack(seqId)
+	p := &cmpp.Cmpp3ConnRspPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(data[8:])
+	}
+}
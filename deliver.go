@@ -14,7 +14,6 @@
 package cmpp
 
 import (
-	"encoding/binary"
 	"errors"
 )
 
@@ -63,252 +62,57 @@ var (
 	errDeliverOtherError         = errors.New("deliver response status: other error")
 )
 
+//cmpp:packet CMPP_DELIVER V21
 type Cmpp2DeliverReqPkt struct {
 	MsgId            uint64
-	DestId           string
-	ServiceId        string
+	DestId           string `cmpp:"cstring=21"`
+	ServiceId        string `cmpp:"cstring=10"`
 	TpPid            uint8
 	TpUdhi           uint8
 	MsgFmt           uint8
-	SrcTerminalId    string
+	SrcTerminalId    string `cmpp:"cstring=21,phone"`
 	RegisterDelivery uint8
 	MsgLength        uint8
-	MsgContent       string
-	Reserve          string
+	MsgContent       string `cmpp:"len=MsgLength,content"`
+	Reserve          string `cmpp:"cstring=8"`
 
 	//session info
-	SeqId uint32
+	SeqId uint32 `cmpp:"seqid"`
 }
 
+//cmpp:packet CMPP_DELIVER_RESP V21
 type Cmpp2DeliverRspPkt struct {
 	MsgId  uint64
 	Result uint8
 
 	//session info
-	SeqId uint32
+	SeqId uint32 `cmpp:"seqid"`
 }
+
+//cmpp:packet CMPP_DELIVER V30
 type Cmpp3DeliverReqPkt struct {
 	MsgId            uint64
-	DestId           string
-	ServiceId        string
+	DestId           string `cmpp:"cstring=21"`
+	ServiceId        string `cmpp:"cstring=10"`
 	TpPid            uint8
 	TpUdhi           uint8
 	MsgFmt           uint8
-	SrcTerminalId    string
+	SrcTerminalId    string `cmpp:"cstring=32,phone"`
 	SrcTerminalType  uint8
 	RegisterDelivery uint8
 	MsgLength        uint8
-	MsgContent       string
-	LinkId           string
+	MsgContent       string `cmpp:"len=MsgLength,content"`
+	LinkId           string `cmpp:"cstring=20"`
 
 	//session info
-	SeqId uint32
+	SeqId uint32 `cmpp:"seqid"`
 }
+
+//cmpp:packet CMPP_DELIVER_RESP V30
 type Cmpp3DeliverRspPkt struct {
 	MsgId  uint64
 	Result uint32
 
 	//session info
-	SeqId uint32
-}
-
-// Pack packs the Cmpp2DeliverReqPkt to bytes stream for client side.
-func (p *Cmpp2DeliverReqPkt) Pack(seqId uint32) ([]byte, error) {
-	var pktLen uint32 = CMPP_HEADER_LEN + 65 + uint32(p.MsgLength) + 8
-
-	var w = newPacketWriter(pktLen)
-
-	// Pack header
-	w.WriteInt(binary.BigEndian, pktLen)
-	w.WriteInt(binary.BigEndian, CMPP_DELIVER)
-	w.WriteInt(binary.BigEndian, seqId)
-	p.SeqId = seqId
-
-	// Pack Body
-	w.WriteInt(binary.BigEndian, p.MsgId)
-	w.WriteFixedSizeString(p.DestId, 21)
-	w.WriteFixedSizeString(p.ServiceId, 10)
-	w.WriteByte(p.TpPid)
-	w.WriteByte(p.TpUdhi)
-	w.WriteByte(p.MsgFmt)
-	w.WriteFixedSizeString(p.SrcTerminalId, 21)
-	w.WriteByte(p.RegisterDelivery)
-	w.WriteByte(p.MsgLength)
-	w.WriteString(p.MsgContent)
-	w.WriteFixedSizeString(p.Reserve, 8)
-
-	return w.Bytes()
-}
-
-// Unpack unpack the binary byte stream to a Cmpp2DeliverReqPkt variable.
-// After unpack, you will get all value of fields in
-// Cmpp2DeliverReqPkt struct.
-func (p *Cmpp2DeliverReqPkt) Unpack(data []byte) error {
-	var r = newPacketReader(data)
-
-	// Sequence Id
-	r.ReadInt(binary.BigEndian, &p.SeqId)
-
-	// Body
-	r.ReadInt(binary.BigEndian, &p.MsgId)
-
-	destId := r.ReadCString(21)
-	p.DestId = string(destId)
-
-	serviceId := r.ReadCString(10)
-	p.ServiceId = string(serviceId)
-
-	p.TpPid = r.ReadByte()
-	p.TpUdhi = r.ReadByte()
-	p.MsgFmt = r.ReadByte()
-
-	srcTerminalId := r.ReadCString(21)
-	p.SrcTerminalId = string(srcTerminalId)
-
-	p.RegisterDelivery = r.ReadByte()
-	p.MsgLength = r.ReadByte()
-
-	msgContent := make([]byte, p.MsgLength)
-	r.ReadBytes(msgContent)
-	p.MsgContent = string(msgContent)
-
-	reserve := r.ReadCString(8)
-	p.Reserve = string(reserve)
-
-	return r.Error()
-}
-
-// Pack packs the Cmpp2DeliverRspPkt to bytes stream for client side.
-func (p *Cmpp2DeliverRspPkt) Pack(seqId uint32) ([]byte, error) {
-	var pktLen uint32 = Cmpp2DeliverRspPktLen
-
-	var w = newPacketWriter(pktLen)
-
-	// Pack header
-	w.WriteInt(binary.BigEndian, pktLen)
-	w.WriteInt(binary.BigEndian, CMPP_DELIVER_RESP)
-	w.WriteInt(binary.BigEndian, seqId)
-	p.SeqId = seqId
-
-	// Pack Body
-	w.WriteInt(binary.BigEndian, p.MsgId)
-	w.WriteByte(p.Result)
-
-	return w.Bytes()
-}
-
-// Unpack unpack the binary byte stream to a Cmpp2DeliverRspPkt variable.
-// After unpack, you will get all value of fields in
-// Cmpp2DeliverRspPkt struct.
-func (p *Cmpp2DeliverRspPkt) Unpack(data []byte) error {
-	var r = newPacketReader(data)
-
-	// Sequence Id
-	r.ReadInt(binary.BigEndian, &p.SeqId)
-
-	r.ReadInt(binary.BigEndian, &p.MsgId)
-	p.Result = r.ReadByte()
-
-	return r.Error()
-}
-
-// Pack packs the Cmpp3DeliverReqPkt to bytes stream for client side.
-func (p *Cmpp3DeliverReqPkt) Pack(seqId uint32) ([]byte, error) {
-	var pktLen uint32 = CMPP_HEADER_LEN + 77 + uint32(p.MsgLength) + 20
-
-	var w = newPacketWriter(pktLen)
-
-	// Pack header
-	w.WriteInt(binary.BigEndian, pktLen)
-	w.WriteInt(binary.BigEndian, CMPP_DELIVER)
-	w.WriteInt(binary.BigEndian, seqId)
-	p.SeqId = seqId
-
-	// Pack Body
-	w.WriteInt(binary.BigEndian, p.MsgId)
-	w.WriteFixedSizeString(p.DestId, 21)
-	w.WriteFixedSizeString(p.ServiceId, 10)
-	w.WriteByte(p.TpPid)
-	w.WriteByte(p.TpUdhi)
-	w.WriteByte(p.MsgFmt)
-	w.WriteFixedSizeString(p.SrcTerminalId, 32)
-	w.WriteByte(p.SrcTerminalType)
-	w.WriteByte(p.RegisterDelivery)
-	w.WriteByte(p.MsgLength)
-	w.WriteString(p.MsgContent)
-	w.WriteFixedSizeString(p.LinkId, 20)
-
-	return w.Bytes()
-}
-
-// Unpack unpack the binary byte stream to a Cmpp3DeliverReqPkt variable.
-// After unpack, you will get all value of fields in
-// Cmpp3DeliverReqPkt struct.
-func (p *Cmpp3DeliverReqPkt) Unpack(data []byte) error {
-	var r = newPacketReader(data)
-
-	// Sequence Id
-	r.ReadInt(binary.BigEndian, &p.SeqId)
-
-	// Body
-	r.ReadInt(binary.BigEndian, &p.MsgId)
-
-	destId := r.ReadCString(21)
-	p.DestId = string(destId)
-
-	serviceId := r.ReadCString(10)
-	p.ServiceId = string(serviceId)
-
-	p.TpPid = r.ReadByte()
-	p.TpUdhi = r.ReadByte()
-	p.MsgFmt = r.ReadByte()
-
-	srcTerminalId := r.ReadCString(32)
-	p.SrcTerminalId = string(srcTerminalId)
-	p.SrcTerminalType = r.ReadByte()
-
-	p.RegisterDelivery = r.ReadByte()
-	p.MsgLength = r.ReadByte()
-
-	msgContent := make([]byte, p.MsgLength)
-	r.ReadBytes(msgContent)
-	p.MsgContent = string(msgContent)
-
-	linkId := r.ReadCString(20)
-	p.LinkId = string(linkId)
-
-	return r.Error()
-}
-
-// Pack packs the Cmpp3DeliverRspPkt to bytes stream for client side.
-func (p *Cmpp3DeliverRspPkt) Pack(seqId uint32) ([]byte, error) {
-	var pktLen uint32 = Cmpp3DeliverRspPktLen
-	var w = newPacketWriter(pktLen)
-
-	// Pack header
-	w.WriteInt(binary.BigEndian, pktLen)
-	w.WriteInt(binary.BigEndian, CMPP_DELIVER_RESP)
-	w.WriteInt(binary.BigEndian, seqId)
-	p.SeqId = seqId
-
-	// Pack Body
-	w.WriteInt(binary.BigEndian, p.MsgId)
-	w.WriteInt(binary.BigEndian, p.Result)
-
-	return w.Bytes()
-}
-
-// Unpack unpack the binary byte stream to a Cmpp3DeliverRspPkt variable.
-// After unpack, you will get all value of fields in
-// Cmpp3DeliverRspPkt struct.
-func (p *Cmpp3DeliverRspPkt) Unpack(data []byte) error {
-	var r = newPacketReader(data)
-
-	// Sequence Id
-	r.ReadInt(binary.BigEndian, &p.SeqId)
-
-	r.ReadInt(binary.BigEndian, &p.MsgId)
-	r.ReadInt(binary.BigEndian, &p.Result)
-
-	return r.Error()
+	SeqId uint32 `cmpp:"seqid"`
 }
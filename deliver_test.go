@@ -342,6 +342,8 @@ func BenchmarkCmpp2DeliverReqPktUnpack(b *testing.B) {
 
 	p := &cmpp.Cmpp2DeliverReqPkt{}
 
+	b.ReportAllocs()
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		p.Unpack(data)
 	}
@@ -376,9 +378,33 @@ func BenchmarkCmpp3DeliverReqPktUnpack(b *testing.B) {
 		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
 	}
 
-	p := &cmpp.Cmpp2DeliverReqPkt{}
+	p := &cmpp.Cmpp3DeliverReqPkt{}
 
+	b.ReportAllocs()
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		p.Unpack(data)
 	}
 }
+
+func BenchmarkCmpp2DeliverRspPktUnpack(b *testing.B) {
+	data, _ := (&cmpp.Cmpp2DeliverRspPkt{MsgId: 13052947396898652160}).Pack(seqId)
+	p := &cmpp.Cmpp2DeliverRspPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(data[8:])
+	}
+}
+
+func BenchmarkCmpp3DeliverRspPktUnpack(b *testing.B) {
+	data, _ := (&cmpp.Cmpp3DeliverRspPkt{MsgId: 13025908756704198656}).Pack(seqId)
+	p := &cmpp.Cmpp3DeliverRspPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(data[8:])
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"crypto/md5"
 	"log"
-	"net"
 	"time"
 
 	cmpp "github.com/bigwhite/gocmpp"
@@ -16,7 +15,7 @@ const (
 	passwordS string = "888888"
 )
 
-func handleLogin(r *cmpp.Response, p *cmpp.Packet, l *log.Logger) (bool, error) {
+func handleLogin(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
 	req, ok := p.Packer.(*cmpp.CmppConnReqPkt)
 	if !ok {
 		// not a connect request, ignore it,
@@ -24,7 +23,6 @@ func handleLogin(r *cmpp.Response, p *cmpp.Packet, l *log.Logger) (bool, error)
 		return true, nil
 	}
 
-	l.Println("remote addr:", p.Conn.Conn.RemoteAddr().(*net.TCPAddr).IP.String())
 	resp := r.Packer.(*cmpp.Cmpp3ConnRspPkt)
 
 	// validate the user and password
@@ -32,7 +30,7 @@ func handleLogin(r *cmpp.Response, p *cmpp.Packet, l *log.Logger) (bool, error)
 	resp.Version = 0x30
 	addr := req.SrcAddr
 	if addr != cmpputils.OctetString(userS, 6) {
-		l.Println("handleLogin error:", cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnInvalidSrcAddr])
+		l.Warn("handleLogin error", cmpp.Field{Key: cmpp.LogKeyError, Value: cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnInvalidSrcAddr]})
 		resp.Status = uint32(cmpp.ErrnoConnInvalidSrcAddr)
 		return false, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnInvalidSrcAddr]
 	}
@@ -45,7 +43,7 @@ func handleLogin(r *cmpp.Response, p *cmpp.Packet, l *log.Logger) (bool, error)
 		nil))
 
 	if req.AuthSrc != string(authSrc[:]) {
-		l.Println("handleLogin error: ", cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnAuthFailed])
+		l.Warn("handleLogin error", cmpp.Field{Key: cmpp.LogKeyError, Value: cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnAuthFailed]})
 		resp.Status = uint32(cmpp.ErrnoConnAuthFailed)
 		return false, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnAuthFailed]
 	}
@@ -55,12 +53,12 @@ func handleLogin(r *cmpp.Response, p *cmpp.Packet, l *log.Logger) (bool, error)
 		[]byte(passwordS)},
 		nil))
 	resp.AuthIsmg = string(authIsmg[:])
-	l.Printf("handleLogin: %s login ok\n", addr)
+	l.Info("handleLogin: login ok", cmpp.Field{Key: cmpp.LogKeyAccount, Value: addr})
 
 	return false, nil
 }
 
-func handleSubmit(r *cmpp.Response, p *cmpp.Packet, l *log.Logger) (bool, error) {
+func handleSubmit(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
 	req, ok := p.Packer.(*cmpp.Cmpp3SubmitReqPkt)
 	if !ok {
 		return true, nil // go on to next handler
@@ -69,8 +67,11 @@ func handleSubmit(r *cmpp.Response, p *cmpp.Packet, l *log.Logger) (bool, error)
 	resp := r.Packer.(*cmpp.Cmpp3SubmitRspPkt)
 	resp.MsgId = 12878564852733378560 //0xb2, 0xb9, 0xda, 0x80, 0x00, 0x01, 0x00, 0x00
 	for i, d := range req.DestTerminalId {
-		l.Printf("handleSubmit: handle submit from %s ok! msgid[%d], srcId[%s], destTerminalId[%s]\n",
-			req.MsgSrc, resp.MsgId+uint64(i), req.SrcId, d)
+		l.Info("handleSubmit: handle submit ok",
+			cmpp.Field{Key: "msg_src", Value: req.MsgSrc},
+			cmpp.Field{Key: "msg_id", Value: resp.MsgId + uint64(i)},
+			cmpp.Field{Key: "src_id", Value: req.SrcId},
+			cmpp.Field{Key: "dest_terminal_id", Value: d})
 	}
 	return true, nil
 }
@@ -0,0 +1,579 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	cmpputils "github.com/bigwhite/gocmpp/utils"
+)
+
+// The String and MarshalJSON methods of the packets render the fields
+// in the order they are declared, as described by the options in their
+// `cmpp:"..."` tags:
+//
+//	binary   the string field is binary, e.g. the AuthenticatorSource,
+//	         and is rendered in hex
+//	phone    the string or []string field holds phone numbers, which
+//	         a Formatter masks if its MaskPhoneNumbers is set
+//	secret   the field is never rendered, e.g. the password
+//	content  the string field is the message content, rendered as
+//	         text decoded by the MsgFmt field of the packet, or as the
+//	         status report if the RegisterDelivery field is 1
+//
+// In JSON, the uint64 fields, e.g. the MsgId, are strings of decimal
+// digits, lest JavaScript rounds them. A string field that is not
+// valid UTF-8 is rendered in hex under its name suffixed with "Hex",
+// e.g. "MsgContentHex", and so is a message content that can not be
+// decoded by its MsgFmt exactly; the user data header of a content
+// with TpUdhi set is rendered in hex as "MsgContentUdh". UnmarshalJSON
+// accepts what MarshalJSON renders, so that the packets round-trip. It
+// also computes the length and count fields, e.g. the MsgLength, if
+// they are absent.
+
+// The msg_fmt values of the message contents.
+const (
+	MsgFmtASCII  uint8 = 0
+	MsgFmtCard   uint8 = 3
+	MsgFmtBinary uint8 = 4
+	MsgFmtUCS2   uint8 = 8
+	MsgFmtGB     uint8 = 15
+)
+
+// A Formatter renders the packets as their String and MarshalJSON
+// methods do, which use the zero Formatter, but with its options.
+// E.g. a logger keeping the phone numbers out of the logs:
+//
+//	f := cmpp.Formatter{MaskPhoneNumbers: true}
+//	log.Printf("receive %s", f.Format(p))
+type Formatter struct {
+	// MaskPhoneNumbers masks the phone numbers, in the text as well
+	// as in the JSON, including the ones in the status reports. A
+	// masked number keeps its first 3 and last 4 digits, so the
+	// masked JSON does not round-trip.
+	MaskPhoneNumbers bool
+}
+
+// Format returns the fields of the packet p, e.g. a *Cmpp3SubmitReqPkt
+// or a *CmppReceiptPkt, in the form of Name{Field:value ...}. Any other
+// value is formatted by fmt.Sprint.
+func (fm Formatter) Format(p interface{}) string {
+	v, ok := packetValue(p)
+	if !ok {
+		return fmt.Sprint(p)
+	}
+	return fm.format(v)
+}
+
+// Marshal returns the JSON encoding of the packet p. Any other value
+// than a packet of this package is encoded by json.Marshal.
+func (fm Formatter) Marshal(p interface{}) ([]byte, error) {
+	v, ok := packetValue(p)
+	if !ok {
+		return json.Marshal(p)
+	}
+	return fm.marshal(v)
+}
+
+// packetValue returns the struct p points to.
+func packetValue(p interface{}) (reflect.Value, bool) {
+	v := reflect.ValueOf(p)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	return v.Elem(), true
+}
+
+func maskPhone(s string) string {
+	if len(s) <= 7 {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:3] + strings.Repeat("*", len(s)-7) + s[len(s)-4:]
+}
+
+// fieldFormat describes how a field of a packet is rendered.
+type fieldFormat struct {
+	index   int
+	name    string
+	kind    reflect.Kind
+	binary  bool
+	phone   bool
+	secret  bool
+	content bool
+	ref     string // the len or count field.
+}
+
+// packetFormat describes how a packet type is rendered.
+type packetFormat struct {
+	name   string
+	fields []fieldFormat
+
+	// the indexes of the fields the content depends on, or -1.
+	msgFmt, tpUdhi, registerDelivery int
+}
+
+var packetFormats sync.Map // reflect.Type -> *packetFormat
+
+func formatOf(t reflect.Type) *packetFormat {
+	if pf, ok := packetFormats.Load(t); ok {
+		return pf.(*packetFormat)
+	}
+
+	pf := &packetFormat{name: t.Name(), msgFmt: -1, tpUdhi: -1, registerDelivery: -1}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		f := fieldFormat{index: i, name: sf.Name, kind: sf.Type.Kind()}
+		for _, opt := range strings.Split(sf.Tag.Get("cmpp"), ",") {
+			kv := strings.SplitN(opt, "=", 2)
+			switch kv[0] {
+			case "binary":
+				f.binary = true
+			case "phone":
+				f.phone = true
+			case "secret":
+				f.secret = true
+			case "content":
+				f.content = true
+			case "len", "count":
+				if len(kv) == 2 {
+					f.ref = kv[1]
+				}
+			}
+		}
+		switch sf.Name {
+		case "MsgFmt":
+			pf.msgFmt = i
+		case "TpUdhi":
+			pf.tpUdhi = i
+		case "RegisterDelivery":
+			pf.registerDelivery = i
+		}
+		pf.fields = append(pf.fields, f)
+	}
+
+	packetFormats.Store(t, pf)
+	return pf
+}
+
+func (pf *packetFormat) uintField(v reflect.Value, i int) uint64 {
+	if i < 0 {
+		return 0
+	}
+	return v.Field(i).Uint()
+}
+
+// formatPacket implements the String methods of the packets.
+func formatPacket(p interface{}) string {
+	return Formatter{}.Format(p)
+}
+
+func (fm Formatter) format(v reflect.Value) string {
+	pf := formatOf(v.Type())
+	mask := fm.MaskPhoneNumbers
+
+	var b strings.Builder
+	b.WriteString(pf.name)
+	b.WriteByte('{')
+	sep := ""
+	for _, f := range pf.fields {
+		if f.secret {
+			continue
+		}
+		b.WriteString(sep)
+		sep = " "
+		b.WriteString(f.name)
+		b.WriteByte(':')
+
+		fv := v.Field(f.index)
+		switch {
+		case f.content:
+			fm.formatContent(&b, pf, v, fv.String())
+		case f.kind == reflect.String:
+			b.WriteString(formatString(fv.String(), f, mask))
+		case f.kind == reflect.Slice:
+			b.WriteByte('[')
+			for i := 0; i < fv.Len(); i++ {
+				if i > 0 {
+					b.WriteByte(' ')
+				}
+				b.WriteString(formatString(fv.Index(i).String(), f, mask))
+			}
+			b.WriteByte(']')
+		case f.kind == reflect.Int8: // the Type.
+			fmt.Fprintf(&b, "%#x", fv.Int())
+		default:
+			b.WriteString(strconv.FormatUint(fv.Uint(), 10))
+		}
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatString(s string, f fieldFormat, mask bool) string {
+	switch {
+	case f.binary || !utf8.ValidString(s):
+		return "0x" + hex.EncodeToString([]byte(s))
+	case f.phone && mask:
+		return strconv.Quote(maskPhone(s))
+	}
+	return strconv.Quote(s)
+}
+
+func (fm Formatter) formatContent(b *strings.Builder, pf *packetFormat, v reflect.Value, content string) {
+	c := pf.decodeContent(v, content)
+	switch {
+	case c.report != nil:
+		b.WriteString(fm.Format(c.report))
+	case c.bin:
+		b.WriteString("0x" + hex.EncodeToString([]byte(content)))
+	default:
+		if c.udh != "" {
+			b.WriteString("0x" + hex.EncodeToString([]byte(c.udh)) + "+")
+		}
+		b.WriteString(strconv.Quote(c.text))
+	}
+}
+
+// decodedContent is a message content decoded.
+type decodedContent struct {
+	report *CmppReceiptPkt
+	udh    string
+	text   string
+	bin    bool // the content is binary, or can not be decoded exactly.
+}
+
+func (pf *packetFormat) decodeContent(v reflect.Value, content string) decodedContent {
+	if pf.uintField(v, pf.registerDelivery) == 1 {
+		var rpt CmppReceiptPkt
+		if rpt.Unpack([]byte(content)) == nil {
+			if data, err := rpt.Pack(); err == nil && string(data) == content {
+				return decodedContent{report: &rpt}
+			}
+		}
+		return decodedContent{bin: true}
+	}
+
+	var c decodedContent
+	text := content
+	if pf.uintField(v, pf.tpUdhi) == 1 && len(content) > 0 {
+		n := int(content[0]) + 1
+		if n > len(content) {
+			return decodedContent{bin: true}
+		}
+		c.udh, text = content[:n], content[n:]
+	}
+
+	msgFmt := uint8(pf.uintField(v, pf.msgFmt))
+	decoded, err := decodeText(text, msgFmt)
+	if err != nil {
+		return decodedContent{bin: true}
+	}
+	if encoded, err := encodeText(decoded, msgFmt); err != nil || encoded != text {
+		return decodedContent{bin: true}
+	}
+	c.text = decoded
+	return c
+}
+
+// decodeText converts the message text in msgFmt to UTF-8.
+func decodeText(s string, msgFmt uint8) (string, error) {
+	switch msgFmt {
+	case MsgFmtUCS2:
+		return cmpputils.Ucs2ToUtf8(s)
+	case MsgFmtGB:
+		return cmpputils.GB18030ToUtf8(s)
+	case MsgFmtCard, MsgFmtBinary:
+		return "", errBinaryContent
+	}
+	if !utf8.ValidString(s) {
+		return "", cmpputils.ErrInvalidUtf8Rune
+	}
+	return s, nil
+}
+
+// encodeText converts the UTF-8 text s to msgFmt.
+func encodeText(s string, msgFmt uint8) (string, error) {
+	switch msgFmt {
+	case MsgFmtUCS2:
+		return cmpputils.Utf8ToUcs2(s)
+	case MsgFmtGB:
+		return cmpputils.Utf8ToGB18030(s)
+	case MsgFmtCard, MsgFmtBinary:
+		return "", errBinaryContent
+	}
+	return s, nil
+}
+
+var errBinaryContent = errors.New("the message content is binary")
+
+// marshalPacket implements the MarshalJSON methods of the packets.
+func marshalPacket(p interface{}) ([]byte, error) {
+	return Formatter{}.Marshal(p)
+}
+
+func (fm Formatter) marshal(v reflect.Value) ([]byte, error) {
+	pf := formatOf(v.Type())
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+	add := func(name string, value interface{}) error {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Quote(name))
+		b.WriteByte(':')
+		b.Write(data)
+		return nil
+	}
+
+	for _, f := range pf.fields {
+		if f.secret {
+			continue
+		}
+		fv := v.Field(f.index)
+		var err error
+		switch {
+		case f.content:
+			c := pf.decodeContent(v, fv.String())
+			switch {
+			case c.report != nil:
+				var data []byte
+				if data, err = fm.Marshal(c.report); err == nil {
+					err = add(f.name, json.RawMessage(data))
+				}
+			case c.bin:
+				err = add(f.name+"Hex", hex.EncodeToString([]byte(fv.String())))
+			default:
+				if c.udh != "" {
+					err = add(f.name+"Udh", hex.EncodeToString([]byte(c.udh)))
+				}
+				if err == nil {
+					err = add(f.name, c.text)
+				}
+			}
+		case f.kind == reflect.String:
+			s := fv.String()
+			if f.binary {
+				err = add(f.name, hex.EncodeToString([]byte(s)))
+			} else if !utf8.ValidString(s) {
+				err = add(f.name+"Hex", hex.EncodeToString([]byte(s)))
+			} else if f.phone && fm.MaskPhoneNumbers {
+				err = add(f.name, maskPhone(s))
+			} else {
+				err = add(f.name, s)
+			}
+		case f.kind == reflect.Slice:
+			ss := fv.Interface().([]string)
+			if ss == nil {
+				ss = []string{}
+			}
+			if validStrings(ss) {
+				if f.phone && fm.MaskPhoneNumbers {
+					masked := make([]string, len(ss))
+					for i, s := range ss {
+						masked[i] = maskPhone(s)
+					}
+					ss = masked
+				}
+				err = add(f.name, ss)
+			} else {
+				hs := make([]string, len(ss))
+				for i, s := range ss {
+					hs[i] = hex.EncodeToString([]byte(s))
+				}
+				err = add(f.name+"Hex", hs)
+			}
+		case f.kind == reflect.Uint64:
+			err = add(f.name, strconv.FormatUint(fv.Uint(), 10))
+		case f.kind == reflect.Int8:
+			err = add(f.name, fv.Int())
+		default:
+			err = add(f.name, fv.Uint())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func validStrings(ss []string) bool {
+	for _, s := range ss {
+		if !utf8.ValidString(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// unmarshalPacket decodes the JSON encoding of a packet into p.
+func unmarshalPacket(p interface{}, data []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if m == nil {
+		return nil // null
+	}
+
+	v := reflect.ValueOf(p).Elem()
+	pf := formatOf(v.Type())
+	for _, f := range pf.fields {
+		if err := pf.unmarshalField(v, f, m); err != nil {
+			return fmt.Errorf("cmpp: invalid %s.%s in JSON: %v", pf.name, f.name, err)
+		}
+	}
+
+	// compute the length and count fields absent.
+	for _, f := range pf.fields {
+		if f.ref == "" {
+			continue
+		}
+		if _, ok := m[f.ref]; ok {
+			continue
+		}
+		if ref := v.FieldByName(f.ref); ref.IsValid() {
+			ref.SetUint(uint64(v.Field(f.index).Len()))
+		}
+	}
+	return nil
+}
+
+func (pf *packetFormat) unmarshalField(v reflect.Value, f fieldFormat, m map[string]json.RawMessage) error {
+	fv := v.Field(f.index)
+	if f.content {
+		return pf.unmarshalContent(v, fv, f.name, m)
+	}
+
+	if raw, ok := m[f.name+"Hex"]; ok && !f.binary {
+		switch f.kind {
+		case reflect.String:
+			s, err := unmarshalHex(raw)
+			if err != nil {
+				return err
+			}
+			fv.SetString(s)
+		case reflect.Slice:
+			var hs []string
+			if err := json.Unmarshal(raw, &hs); err != nil {
+				return err
+			}
+			ss := make([]string, len(hs))
+			for i, h := range hs {
+				b, err := hex.DecodeString(h)
+				if err != nil {
+					return err
+				}
+				ss[i] = string(b)
+			}
+			fv.Set(reflect.ValueOf(ss))
+		}
+		return nil
+	}
+
+	raw, ok := m[f.name]
+	if !ok {
+		return nil
+	}
+	switch {
+	case f.binary:
+		s, err := unmarshalHex(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetString(s)
+		return nil
+	case f.kind == reflect.Uint64:
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return err
+		}
+		u, err := strconv.ParseUint(n.String(), 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetUint(u)
+		return nil
+	}
+	return json.Unmarshal(raw, fv.Addr().Interface())
+}
+
+func (pf *packetFormat) unmarshalContent(v, fv reflect.Value, name string, m map[string]json.RawMessage) error {
+	if raw, ok := m[name+"Hex"]; ok {
+		s, err := unmarshalHex(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetString(s)
+		return nil
+	}
+	raw, ok := m[name]
+	if !ok {
+		return nil
+	}
+
+	if pf.uintField(v, pf.registerDelivery) == 1 {
+		var rpt CmppReceiptPkt
+		if err := json.Unmarshal(raw, &rpt); err != nil {
+			return err
+		}
+		data, err := rpt.Pack()
+		if err != nil {
+			return err
+		}
+		fv.SetString(string(data))
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return err
+	}
+	content, err := encodeText(text, uint8(pf.uintField(v, pf.msgFmt)))
+	if err != nil {
+		return err
+	}
+	if raw, ok := m[name+"Udh"]; ok {
+		udh, err := unmarshalHex(raw)
+		if err != nil {
+			return err
+		}
+		content = udh + content
+	}
+	fv.SetString(content)
+	return nil
+}
+
+func unmarshalHex(raw json.RawMessage) (string, error) {
+	var h string
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return "", err
+	}
+	b, err := hex.DecodeString(h)
+	return string(b), err
+}
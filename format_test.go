@@ -0,0 +1,267 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bigwhite/gocmpp"
+	"github.com/bigwhite/gocmpp/utils"
+)
+
+func mustUcs2(s string) string {
+	u, err := cmpputils.Utf8ToUcs2(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func mustGB(s string) string {
+	g, err := cmpputils.Utf8ToGB18030(s)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+func receiptContent() string {
+	data, _ := (&cmpp.CmppReceiptPkt{
+		MsgId:          0xb2b9da8000010001,
+		Stat:           "DELIVRD",
+		SubmitTime:     "1711051429",
+		DoneTime:       "1711051430",
+		DestTerminalId: "13500002696",
+		SmscSequence:   3,
+	}).Pack()
+	return string(data)
+}
+
+func TestPacketJSONRoundTrip(t *testing.T) {
+	udh := "\x05\x00\x03\x2a\x02\x01"
+	var cases = []struct {
+		typ cmpp.Type
+		p   cmpp.Packer
+	}{
+		{cmpp.V30, &cmpp.CmppConnReqPkt{SrcAddr: "900001", Secret: "888888", Version: cmpp.V30, Timestamp: 1021080510}},
+		{cmpp.V21, &cmpp.Cmpp2ConnRspPkt{Status: 3, Version: cmpp.V21, Secret: "888888", AuthSrc: "0123456789abcdef"}},
+		{cmpp.V30, &cmpp.Cmpp3ConnRspPkt{Status: 0x100, Version: cmpp.V30, Secret: "888888", AuthSrc: "0123456789abcdef"}},
+		{cmpp.V30, &cmpp.Cmpp3SubmitReqPkt{
+			MsgId:          0xb2b9da8000010000,
+			MsgFmt:         cmpp.MsgFmtUCS2,
+			FeeType:        "02",
+			DestUsrTl:      2,
+			DestTerminalId: []string{"13500002696", "13500002697"},
+			MsgLength:      uint8(len(mustUcs2("测试gocmpp"))),
+			MsgContent:     mustUcs2("测试gocmpp"),
+		}},
+		{cmpp.V30, &cmpp.Cmpp3SubmitReqPkt{
+			TpUdhi:     1,
+			MsgFmt:     cmpp.MsgFmtUCS2,
+			FeeType:    "02",
+			MsgLength:  uint8(len(udh + mustUcs2("长短信"))),
+			MsgContent: udh + mustUcs2("长短信"),
+		}},
+		{cmpp.V21, &cmpp.Cmpp2SubmitReqPkt{
+			MsgFmt:     cmpp.MsgFmtUCS2,
+			FeeType:    "02",
+			MsgLength:  3,
+			MsgContent: "\x00\x41\x00", // not UCS2, in hex.
+		}},
+		{cmpp.V21, &cmpp.Cmpp2SubmitReqPkt{
+			MsgFmt:     cmpp.MsgFmtBinary,
+			FeeType:    "02",
+			MsgLength:  4,
+			MsgContent: "\x00\x01\xfe\xff",
+		}},
+		{cmpp.V30, &cmpp.Cmpp3SubmitRspPkt{MsgId: 0xffffffffffffffff, Result: 8}},
+		{cmpp.V21, &cmpp.Cmpp2DeliverReqPkt{
+			MsgId:            1,
+			SrcTerminalId:    "13500002696",
+			RegisterDelivery: 1,
+			MsgLength:        uint8(len(receiptContent())),
+			MsgContent:       receiptContent(),
+		}},
+		{cmpp.V30, &cmpp.Cmpp3DeliverReqPkt{
+			MsgFmt:        cmpp.MsgFmtGB,
+			SrcTerminalId: "13500002696",
+			MsgLength:     uint8(len(mustGB("中文"))),
+			MsgContent:    mustGB("中文"),
+			LinkId:        "\xff\xfe", // not UTF-8, in hex.
+		}},
+		{cmpp.V30, &cmpp.Cmpp3DeliverRspPkt{MsgId: 2, Result: 1}},
+		{cmpp.V21, &cmpp.Cmpp2FwdReqPkt{
+			SourceId:   "100201",
+			MsgFmt:     cmpp.MsgFmtASCII,
+			FeeType:    "02",
+			DestUsrTl:  1,
+			DestId:     []string{"13500002696"},
+			MsgLength:  5,
+			MsgContent: "hello",
+		}},
+		{cmpp.V30, &cmpp.Cmpp3FwdRspPkt{MsgId: 3, PkTotal: 1, PkNumber: 1, Result: 1}},
+		{cmpp.V30, &cmpp.CmppQueryReqPkt{Time: "20171105", QueryType: 1, QueryCode: "test"}},
+		{cmpp.V30, &cmpp.CmppQueryRspPkt{Time: "20171105", QueryType: 1, MtTlMsg: 10}},
+		{cmpp.V30, &cmpp.CmppCancelReqPkt{MsgId: 4}},
+		{cmpp.V21, &cmpp.Cmpp2CancelRspPkt{SuccessId: 1}},
+		{cmpp.V30, &cmpp.CmppActiveTestReqPkt{}},
+		{cmpp.V30, &cmpp.CmppActiveTestRspPkt{}},
+		{cmpp.V30, &cmpp.CmppTerminateReqPkt{}},
+		{cmpp.V30, &cmpp.CmppTerminateRspPkt{}},
+	}
+
+	for _, c := range cases {
+		name := fmt.Sprintf("%T", c.p)
+		data, err := c.p.Pack(7)
+		if err != nil {
+			t.Fatalf("%s: pack error: %v", name, err)
+		}
+		p, err := cmpp.DecodePacket(data, c.typ)
+		if err != nil {
+			t.Fatalf("%s: decode error: %v", name, err)
+		}
+
+		j, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("%s: marshal error: %v", name, err)
+		}
+		q := reflect.New(reflect.TypeOf(p).Elem()).Interface().(cmpp.Pdu)
+		if err := json.Unmarshal(j, q); err != nil {
+			t.Fatalf("%s: unmarshal %s error: %v", name, j, err)
+		}
+		if !reflect.DeepEqual(p, q) {
+			t.Errorf("%s: round trip of %s: actual [%v], wanted [%v]", name, j, q, p)
+		}
+		switch p.(type) {
+		case *cmpp.CmppConnReqPkt, *cmpp.Cmpp2ConnRspPkt, *cmpp.Cmpp3ConnRspPkt:
+			continue // the authenticators are computed from the Secret by Pack.
+		}
+		if data2, err := q.Pack(7); err != nil || !bytes.Equal(data, data2) {
+			t.Errorf("%s: pack after round trip: actual [%x, %v], wanted [%x]", name, data2, err, data)
+		}
+	}
+}
+
+func TestPacketJSON(t *testing.T) {
+	p := &cmpp.Cmpp3DeliverReqPkt{
+		MsgId:            0xb2b9da8000010000,
+		SrcTerminalId:    "13500002696",
+		RegisterDelivery: 1,
+		MsgLength:        uint8(len(receiptContent())),
+		MsgContent:       receiptContent(),
+	}
+	j, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+	for _, s := range []string{
+		`"MsgId":"12878564852733378560"`,
+		`"MsgContent":{"MsgId":"12878564852733378561","Stat":"DELIVRD",`,
+		`"SrcTerminalId":"13500002696"`,
+	} {
+		if !strings.Contains(string(j), s) {
+			t.Errorf("%s is not in %s", s, j)
+		}
+	}
+
+	c := &cmpp.Cmpp3ConnRspPkt{Secret: "888888", AuthSrc: "\x01\x02"}
+	j, _ = json.Marshal(c)
+	if strings.Contains(string(j), "Secret") || !strings.Contains(string(j), `"AuthSrc":"0102"`) {
+		t.Errorf("connect response in JSON: %s", j)
+	}
+
+	// the length and count fields are computed if absent, and the
+	// MsgId may be a number.
+	var s cmpp.Cmpp3SubmitReqPkt
+	err = json.Unmarshal([]byte(`{"MsgId":42,"MsgFmt":8,"FeeType":"02","DestTerminalId":["13500002696"],"MsgContent":"你好"}`), &s)
+	if err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+	if s.MsgId != 42 || s.DestUsrTl != 1 || s.MsgLength != 4 || s.MsgContent != mustUcs2("你好") {
+		t.Errorf("unmarshal: %+v", s)
+	}
+	if _, err := s.Pack(1); err != nil {
+		t.Errorf("pack the submit unmarshaled error: %v", err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"MsgFmt":4,"MsgContent":"abc"}`), &s); err == nil {
+		t.Errorf("unmarshal a binary content in text: no error")
+	}
+}
+
+func TestPacketString(t *testing.T) {
+	p := &cmpp.Cmpp3SubmitReqPkt{
+		MsgFmt:         cmpp.MsgFmtUCS2,
+		FeeTerminalId:  "13500002696",
+		DestUsrTl:      1,
+		DestTerminalId: []string{"13500002696"},
+		MsgLength:      4,
+		MsgContent:     mustUcs2("你好"),
+		SeqId:          7,
+	}
+	s := fmt.Sprint(p)
+	for _, sub := range []string{
+		`Cmpp3SubmitReqPkt{MsgId:0 `,
+		` FeeTerminalId:"13500002696" `,
+		` DestTerminalId:["13500002696"] `,
+		` MsgContent:"你好" `,
+		` SeqId:7}`,
+	} {
+		if !strings.Contains(s, sub) {
+			t.Errorf("%q is not in %s", sub, s)
+		}
+	}
+
+	if s := (cmpp.Formatter{}).Format(p); s != p.String() {
+		t.Errorf("zero Formatter: %s, wanted %s", s, p.String())
+	}
+	masking := cmpp.Formatter{MaskPhoneNumbers: true}
+	s = masking.Format(p)
+	if !strings.Contains(s, `FeeTerminalId:"135****2696"`) || !strings.Contains(s, `DestTerminalId:["135****2696"]`) {
+		t.Errorf("the phone numbers are not masked: %s", s)
+	}
+	j, err := masking.Marshal(p)
+	if err != nil || strings.Contains(string(j), "13500002696") ||
+		!strings.Contains(string(j), `"FeeTerminalId":"135****2696"`) || !strings.Contains(string(j), `"DestTerminalId":["135****2696"]`) {
+		t.Errorf("the phone numbers are not masked in JSON: %s, %v", j, err)
+	}
+	if j, _ := json.Marshal(p); !strings.Contains(string(j), "13500002696") {
+		t.Errorf("the phone numbers are masked in JSON by default: %s", j)
+	}
+
+	c := &cmpp.CmppConnReqPkt{SrcAddr: "900001", AuthSrc: "\x01\xff", Version: cmpp.V30, Secret: "888888"}
+	if s := c.String(); s != `CmppConnReqPkt{SrcAddr:"900001" AuthSrc:0x01ff Version:0x30 Timestamp:0 SeqId:0}` {
+		t.Errorf("connect request String: %s", s)
+	}
+
+	d := &cmpp.Cmpp2DeliverReqPkt{
+		RegisterDelivery: 1,
+		MsgLength:        uint8(len(receiptContent())),
+		MsgContent:       receiptContent(),
+	}
+	if s := d.String(); !strings.Contains(s, `MsgContent:CmppReceiptPkt{MsgId:12878564852733378561 Stat:"DELIVRD" `) {
+		t.Errorf("deliver String: %s", s)
+	}
+	if s := masking.Format(d); !strings.Contains(s, `DestTerminalId:"135****2696"`) {
+		t.Errorf("the phone number in the status report is not masked: %s", s)
+	}
+	if j, _ := masking.Marshal(d); strings.Contains(string(j), "13500002696") {
+		t.Errorf("the phone number in the status report is not masked in JSON: %s", j)
+	}
+}
@@ -14,7 +14,6 @@
 package cmpp
 
 import (
-	"encoding/binary"
 	"errors"
 )
 
@@ -62,9 +61,10 @@ var (
 	errFwdNoPrivilege        = errors.New("fwd response status: msg has no fwd privilege")
 )
 
+//cmpp:packet CMPP_FWD V21
 type Cmpp2FwdReqPkt struct {
-	SourceId           string
-	DestinationId      string
+	SourceId           string `cmpp:"cstring=6"`
+	DestinationId      string `cmpp:"cstring=6"`
 	NodesCount         uint8
 	MsgFwdType         uint8
 	MsgId              uint64
@@ -72,28 +72,29 @@ type Cmpp2FwdReqPkt struct {
 	PkNumber           uint8
 	RegisteredDelivery uint8
 	MsgLevel           uint8
-	ServiceId          string
+	ServiceId          string `cmpp:"cstring=10"`
 	FeeUserType        uint8
-	FeeTerminalId      string
+	FeeTerminalId      string `cmpp:"cstring=21,phone"`
 	TpPid              uint8
 	TpUdhi             uint8
 	MsgFmt             uint8
-	MsgSrc             string
-	FeeType            string
-	FeeCode            string
-	ValidTime          string
-	AtTime             string
-	SrcId              string
+	MsgSrc             string `cmpp:"cstring=6"`
+	FeeType            string `cmpp:"octet=2"`
+	FeeCode            string `cmpp:"cstring=6"`
+	ValidTime          string `cmpp:"cstring=17"`
+	AtTime             string `cmpp:"cstring=17"`
+	SrcId              string `cmpp:"cstring=21,phone"`
 	DestUsrTl          uint8
-	DestId             []string
+	DestId             []string `cmpp:"cstring=21,count=DestUsrTl,phone"`
 	MsgLength          uint8
-	MsgContent         string
-	Reserve            string
+	MsgContent         string `cmpp:"len=MsgLength,content"`
+	Reserve            string `cmpp:"cstring=8"`
 
 	// session info
-	SeqId uint32
+	SeqId uint32 `cmpp:"seqid"`
 }
 
+//cmpp:packet CMPP_FWD_RESP V21
 type Cmpp2FwdRspPkt struct {
 	MsgId    uint64
 	PkTotal  uint8
@@ -101,11 +102,13 @@ type Cmpp2FwdRspPkt struct {
 	Result   uint8
 
 	// session info
-	SeqId uint32
+	SeqId uint32 `cmpp:"seqid"`
 }
+
+//cmpp:packet CMPP_FWD V30
 type Cmpp3FwdReqPkt struct {
-	SourceId            string
-	DestinationId       string
+	SourceId            string `cmpp:"cstring=6"`
+	DestinationId       string `cmpp:"cstring=6"`
 	NodesCount          uint8
 	MsgFwdType          uint8
 	MsgId               uint64
@@ -113,35 +116,36 @@ type Cmpp3FwdReqPkt struct {
 	PkNumber            uint8
 	RegisteredDelivery  uint8
 	MsgLevel            uint8
-	ServiceId           string
+	ServiceId           string `cmpp:"cstring=10"`
 	FeeUserType         uint8
-	FeeTerminalId       string
-	FeeTerminalPseudo   string
+	FeeTerminalId       string `cmpp:"cstring=21,phone"`
+	FeeTerminalPseudo   string `cmpp:"cstring=32"`
 	FeeTerminalUserType uint8
 	TpPid               uint8
 	TpUdhi              uint8
 	MsgFmt              uint8
-	MsgSrc              string
-	FeeType             string
-	FeeCode             string
-	ValidTime           string
-	AtTime              string
-	SrcId               string
-	SrcPseudo           string
+	MsgSrc              string `cmpp:"cstring=6"`
+	FeeType             string `cmpp:"octet=2"`
+	FeeCode             string `cmpp:"cstring=6"`
+	ValidTime           string `cmpp:"cstring=17"`
+	AtTime              string `cmpp:"cstring=17"`
+	SrcId               string `cmpp:"cstring=21,phone"`
+	SrcPseudo           string `cmpp:"cstring=32"`
 	SrcUserType         uint8
 	SrcType             uint8
 	DestUsrTl           uint8
-	DestId              []string
-	DestPseudo          string
+	DestId              []string `cmpp:"cstring=21,count=DestUsrTl,phone"`
+	DestPseudo          string   `cmpp:"cstring=32"`
 	DestUserType        uint8
 	MsgLength           uint8
-	MsgContent          string
-	LinkId              string
+	MsgContent          string `cmpp:"len=MsgLength,content"`
+	LinkId              string `cmpp:"cstring=20"`
 
 	// session info
-	SeqId uint32
+	SeqId uint32 `cmpp:"seqid"`
 }
 
+//cmpp:packet CMPP_FWD_RESP V30
 type Cmpp3FwdRspPkt struct {
 	MsgId    uint64
 	PkTotal  uint8
@@ -149,341 +153,19 @@ type Cmpp3FwdRspPkt struct {
 	Result   uint32
 
 	// session info
-	SeqId uint32
+	SeqId uint32 `cmpp:"seqid"`
 }
 
-// Pack packs the Cmpp2FwdReqPkt to bytes stream for client side.
-// Before calling Pack, you should initialize a Cmpp2FwdReqPkt variable
-// with correct field value.
-func (p *Cmpp2FwdReqPkt) Pack(seqId uint32) ([]byte, error) {
-	var pktLen uint32 = CMPP_HEADER_LEN + 131 + uint32(p.DestUsrTl)*21 + 1 + uint32(p.MsgLength) + 8
-	var w = newPacketWriter(pktLen)
-
-	// Pack header
-	w.WriteInt(binary.BigEndian, pktLen)
-	w.WriteInt(binary.BigEndian, CMPP_FWD)
-	w.WriteInt(binary.BigEndian, seqId)
-	p.SeqId = seqId
-
-	// Pack Body
-	w.WriteFixedSizeString(p.SourceId, 6)
-	w.WriteFixedSizeString(p.DestinationId, 6)
-	w.WriteByte(p.NodesCount)
-	w.WriteByte(p.MsgFwdType)
-	w.WriteInt(binary.BigEndian, p.MsgId)
-
+// beforePack sets PkTotal and PkNumber to 1 if both of them are 0.
+func (p *Cmpp2FwdReqPkt) beforePack() {
 	if p.PkTotal == 0 && p.PkNumber == 0 {
 		p.PkTotal, p.PkNumber = 1, 1
 	}
-	w.WriteByte(p.PkTotal)
-	w.WriteByte(p.PkNumber)
-
-	w.WriteByte(p.RegisteredDelivery)
-	w.WriteByte(p.MsgLevel)
-	w.WriteFixedSizeString(p.ServiceId, 10)
-	w.WriteByte(p.FeeUserType)
-	w.WriteFixedSizeString(p.FeeTerminalId, 21)
-	w.WriteByte(p.TpPid)
-	w.WriteByte(p.TpUdhi)
-	w.WriteByte(p.MsgFmt)
-	w.WriteFixedSizeString(p.MsgSrc, 6)
-	w.WriteFixedSizeString(p.FeeType, 2)
-	w.WriteFixedSizeString(p.FeeCode, 6)
-	w.WriteFixedSizeString(p.ValidTime, 17)
-	w.WriteFixedSizeString(p.AtTime, 17)
-	w.WriteFixedSizeString(p.SrcId, 21)
-	w.WriteByte(p.DestUsrTl)
-	for _, d := range p.DestId {
-		w.WriteFixedSizeString(d, 21)
-	}
-	w.WriteByte(p.MsgLength)
-	w.WriteString(p.MsgContent)
-	w.WriteFixedSizeString(p.Reserve, 8)
-
-	return w.Bytes()
-}
-
-// Unpack unpack the binary byte stream to a Cmpp2FwdReqPkt variable.
-// After unpack, you will get all value of fields in Cmpp2FwdReqPkt struct.
-func (p *Cmpp2FwdReqPkt) Unpack(data []byte) error {
-	var r = newPacketReader(data)
-
-	// Sequence Id
-	r.ReadInt(binary.BigEndian, &p.SeqId)
-
-	sourceId := r.ReadCString(6)
-	p.SourceId = string(sourceId)
-	destinationId := r.ReadCString(6)
-	p.DestinationId = string(destinationId)
-	p.NodesCount = r.ReadByte()
-	p.MsgFwdType = r.ReadByte()
-
-	r.ReadInt(binary.BigEndian, &p.MsgId)
-
-	p.PkTotal = r.ReadByte()
-	p.PkNumber = r.ReadByte()
-	p.RegisteredDelivery = r.ReadByte()
-	p.MsgLevel = r.ReadByte()
-	serviceId := r.ReadCString(10)
-	p.ServiceId = string(serviceId)
-	p.FeeUserType = r.ReadByte()
-	feeTerminalId := r.ReadCString(21)
-	p.FeeTerminalId = string(feeTerminalId)
-	p.TpPid = r.ReadByte()
-	p.TpUdhi = r.ReadByte()
-	p.MsgFmt = r.ReadByte()
-
-	msgSrc := r.ReadCString(6)
-	p.MsgSrc = string(msgSrc)
-
-	feeType := make([]byte, 2)
-	r.ReadBytes(feeType)
-	p.FeeType = string(feeType)
-
-	feeCode := r.ReadCString(6)
-	p.FeeCode = string(feeCode)
-
-	validTime := r.ReadCString(17)
-	p.ValidTime = string(validTime)
-
-	atTime := r.ReadCString(17)
-	p.AtTime = string(atTime)
-
-	srcId := r.ReadCString(21)
-	p.SrcId = string(srcId)
-
-	p.DestUsrTl = r.ReadByte()
-	for i := 0; i < int(p.DestUsrTl); i++ {
-		destId := r.ReadCString(21)
-		p.DestId = append(p.DestId, string(destId))
-	}
-
-	p.MsgLength = r.ReadByte()
-
-	msgContent := make([]byte, p.MsgLength)
-	r.ReadBytes(msgContent)
-	p.MsgContent = string(msgContent)
-
-	reserve := r.ReadCString(8)
-	p.Reserve = string(reserve)
-
-	return r.Error()
 }
 
-// Pack packs the Cmpp2FwdRspPkt to bytes stream for server side.
-// Before calling Pack, you should initialize a Cmpp2FwdRspPkt variable
-// with correct field value.
-func (p *Cmpp2FwdRspPkt) Pack(seqId uint32) ([]byte, error) {
-	var pktLen = Cmpp2FwdRspPktLen
-	var w = newPacketWriter(pktLen)
-
-	// Pack header
-	w.WriteInt(binary.BigEndian, pktLen)
-	w.WriteInt(binary.BigEndian, CMPP_FWD_RESP)
-	w.WriteInt(binary.BigEndian, seqId)
-	p.SeqId = seqId
-
-	// Pack Body
-	w.WriteInt(binary.BigEndian, p.MsgId)
-	w.WriteByte(p.PkTotal)
-	w.WriteByte(p.PkNumber)
-	w.WriteByte(p.Result)
-
-	return w.Bytes()
-}
-
-// Unpack unpack the binary byte stream to a Cmpp2FwdRspPkt variable.
-// After unpack, you will get all value of fields in Cmpp2FwdRspPkt struct.
-func (p *Cmpp2FwdRspPkt) Unpack(data []byte) error {
-	var r = newPacketReader(data)
-
-	// Sequence Id
-	r.ReadInt(binary.BigEndian, &p.SeqId)
-
-	r.ReadInt(binary.BigEndian, &p.MsgId)
-	p.PkTotal = r.ReadByte()
-	p.PkNumber = r.ReadByte()
-	p.Result = r.ReadByte()
-
-	return r.Error()
-}
-
-// Pack packs the Cmpp3FwdReqPkt to bytes stream for client side.
-// Before calling Pack, you should initialize a Cmpp3FwdReqPkt variable
-// with correct field value.
-func (p *Cmpp3FwdReqPkt) Pack(seqId uint32) ([]byte, error) {
-	var pktLen uint32 = CMPP_HEADER_LEN + 198 + uint32(p.DestUsrTl)*21 + 32 + 1 + 1 + uint32(p.MsgLength) + 20
-
-	var w = newPacketWriter(pktLen)
-
-	// Pack header
-	w.WriteInt(binary.BigEndian, pktLen)
-	w.WriteInt(binary.BigEndian, CMPP_FWD)
-	w.WriteInt(binary.BigEndian, seqId)
-	p.SeqId = seqId
-
-	// Pack Body
-	w.WriteFixedSizeString(p.SourceId, 6)
-	w.WriteFixedSizeString(p.DestinationId, 6)
-	w.WriteByte(p.NodesCount)
-	w.WriteByte(p.MsgFwdType)
-	w.WriteInt(binary.BigEndian, p.MsgId)
-
+// beforePack sets PkTotal and PkNumber to 1 if both of them are 0.
+func (p *Cmpp3FwdReqPkt) beforePack() {
 	if p.PkTotal == 0 && p.PkNumber == 0 {
 		p.PkTotal, p.PkNumber = 1, 1
 	}
-	w.WriteByte(p.PkTotal)
-	w.WriteByte(p.PkNumber)
-	w.WriteByte(p.RegisteredDelivery)
-	w.WriteByte(p.MsgLevel)
-	w.WriteFixedSizeString(p.ServiceId, 10)
-	w.WriteByte(p.FeeUserType)
-	w.WriteFixedSizeString(p.FeeTerminalId, 21)
-	w.WriteFixedSizeString(p.FeeTerminalPseudo, 32)
-	w.WriteByte(p.FeeTerminalUserType)
-	w.WriteByte(p.TpPid)
-	w.WriteByte(p.TpUdhi)
-	w.WriteByte(p.MsgFmt)
-	w.WriteFixedSizeString(p.MsgSrc, 6)
-	w.WriteFixedSizeString(p.FeeType, 2)
-	w.WriteFixedSizeString(p.FeeCode, 6)
-	w.WriteFixedSizeString(p.ValidTime, 17)
-	w.WriteFixedSizeString(p.AtTime, 17)
-	w.WriteFixedSizeString(p.SrcId, 21)
-	w.WriteFixedSizeString(p.SrcPseudo, 32)
-	w.WriteByte(p.SrcUserType)
-	w.WriteByte(p.SrcType)
-	w.WriteByte(p.DestUsrTl)
-
-	for _, d := range p.DestId {
-		w.WriteFixedSizeString(d, 21)
-	}
-	w.WriteFixedSizeString(p.DestPseudo, 32)
-	w.WriteByte(p.DestUserType)
-	w.WriteByte(p.MsgLength)
-	w.WriteString(p.MsgContent)
-	w.WriteFixedSizeString(p.LinkId, 20)
-
-	return w.Bytes()
-}
-
-// Unpack unpack the binary byte stream to a Cmpp3FwdReqPkt variable.
-// After unpack, you will get all value of fields in Cmpp3FwdReqPkt struct.
-func (p *Cmpp3FwdReqPkt) Unpack(data []byte) error {
-	var r = newPacketReader(data)
-
-	// Sequence Id
-	r.ReadInt(binary.BigEndian, &p.SeqId)
-
-	// Body
-	sourceId := r.ReadCString(6)
-	p.SourceId = string(sourceId)
-	destinationId := r.ReadCString(6)
-	p.DestinationId = string(destinationId)
-	p.NodesCount = r.ReadByte()
-	p.MsgFwdType = r.ReadByte()
-
-	r.ReadInt(binary.BigEndian, &p.MsgId)
-
-	p.PkTotal = r.ReadByte()
-	p.PkNumber = r.ReadByte()
-	p.RegisteredDelivery = r.ReadByte()
-	p.MsgLevel = r.ReadByte()
-
-	serviceId := r.ReadCString(10)
-	p.ServiceId = string(serviceId)
-
-	p.FeeUserType = r.ReadByte()
-
-	feeTerminalId := r.ReadCString(21)
-	p.FeeTerminalId = string(feeTerminalId)
-	feeTerminalPseudo := r.ReadCString(32)
-	p.FeeTerminalPseudo = string(feeTerminalPseudo)
-	p.FeeTerminalUserType = r.ReadByte()
-
-	p.TpPid = r.ReadByte()
-	p.TpUdhi = r.ReadByte()
-	p.MsgFmt = r.ReadByte()
-
-	msgSrc := r.ReadCString(6)
-	p.MsgSrc = string(msgSrc)
-
-	feeType := make([]byte, 2)
-	r.ReadBytes(feeType)
-	p.FeeType = string(feeType)
-
-	feeCode := r.ReadCString(6)
-	p.FeeCode = string(feeCode)
-
-	validTime := r.ReadCString(17)
-	p.ValidTime = string(validTime)
-
-	atTime := r.ReadCString(17)
-	p.AtTime = string(atTime)
-
-	srcId := r.ReadCString(21)
-	p.SrcId = string(srcId)
-
-	srcPseudo := r.ReadCString(32)
-	p.SrcPseudo = string(srcPseudo)
-	p.SrcUserType = r.ReadByte()
-	p.SrcType = r.ReadByte()
-
-	p.DestUsrTl = r.ReadByte()
-	for i := 0; i < int(p.DestUsrTl); i++ {
-		destId := r.ReadCString(21)
-		p.DestId = append(p.DestId, string(destId))
-	}
-	destPseudo := r.ReadCString(32)
-	p.DestPseudo = string(destPseudo)
-	p.DestUserType = r.ReadByte()
-
-	p.MsgLength = r.ReadByte()
-	msgContent := make([]byte, p.MsgLength)
-	r.ReadBytes(msgContent)
-	p.MsgContent = string(msgContent)
-
-	linkId := r.ReadCString(20)
-	p.LinkId = string(linkId)
-
-	return r.Error()
-}
-
-// Pack packs the Cmpp3FwdRspPkt to bytes stream for server side.
-// Before calling Pack, you should initialize a Cmpp3FwdRspPkt variable
-// with correct field value.
-func (p *Cmpp3FwdRspPkt) Pack(seqId uint32) ([]byte, error) {
-	var pktLen = Cmpp3FwdRspPktLen
-	var w = newPacketWriter(pktLen)
-
-	// Pack header
-	w.WriteInt(binary.BigEndian, pktLen)
-	w.WriteInt(binary.BigEndian, CMPP_FWD_RESP)
-	w.WriteInt(binary.BigEndian, seqId)
-	p.SeqId = seqId
-
-	// Pack Body
-	w.WriteInt(binary.BigEndian, p.MsgId)
-	w.WriteByte(p.PkTotal)
-	w.WriteByte(p.PkNumber)
-	w.WriteInt(binary.BigEndian, p.Result)
-
-	return w.Bytes()
-
-}
-
-// Unpack unpack the binary byte stream to a Cmpp3FwdRspPkt variable.
-// After unpack, you will get all value of fields in Cmpp3FwdRspPkt struct.
-func (p *Cmpp3FwdRspPkt) Unpack(data []byte) error {
-	var r = newPacketReader(data)
-
-	// Sequence Id
-	r.ReadInt(binary.BigEndian, &p.SeqId)
-
-	r.ReadInt(binary.BigEndian, &p.MsgId)
-	p.PkTotal = r.ReadByte()
-	p.PkNumber = r.ReadByte()
-	r.ReadInt(binary.BigEndian, &p.Result)
-
-	return r.Error()
 }
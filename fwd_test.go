@@ -522,6 +522,8 @@ func BenchmarkCmpp2FwdReqPktUnpack(b *testing.B) {
 
 	p := &cmpp.Cmpp2FwdReqPkt{}
 
+	b.ReportAllocs()
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		p.Unpack(data)
 	}
@@ -588,7 +590,31 @@ func BenchmarkCmpp3FwdReqPktUnpack(b *testing.B) {
 	}
 	p := &cmpp.Cmpp3FwdReqPkt{}
 
+	b.ReportAllocs()
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		p.Unpack(data)
 	}
 }
+
+func BenchmarkCmpp2FwdRspPktUnpack(b *testing.B) {
+	data, _ := (&cmpp.Cmpp2FwdRspPkt{MsgId: 12878564852733378560, PkTotal: 1, PkNumber: 1}).Pack(seqId)
+	p := &cmpp.Cmpp2FwdRspPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(data[8:])
+	}
+}
+
+func BenchmarkCmpp3FwdRspPktUnpack(b *testing.B) {
+	data, _ := (&cmpp.Cmpp3FwdRspPkt{MsgId: 12878564852733378560, PkTotal: 1, PkNumber: 1}).Pack(seqId)
+	p := &cmpp.Cmpp3FwdRspPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(data[8:])
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp
+
+import "time"
+
+// Frame is a packet sent or received on a Conn, as seen by the
+// interceptors.
+type Frame struct {
+	// Conn is the connection the frame is sent or received on.
+	Conn *Conn
+
+	// Packet is the packet sent, or the packet decoded from the
+	// frame received.
+	Packet Packer
+
+	// SeqId is the Sequence_Id of the frame.
+	SeqId uint32
+
+	// Data is the whole frame, header included. It is only valid
+	// until the interceptor returns, copy it to keep it.
+	Data []byte
+
+	// Time is when SendPkt is called, or when the first bytes of
+	// the frame received arrive.
+	Time time.Time
+
+	// Elapsed is the time spent on packing and writing the frame,
+	// or on reading and decoding the frame.
+	Elapsed time.Duration
+}
+
+// Interceptor intercepts the frames sent or received on a Conn.
+// It must call next to go on, and may return an error without
+// calling next to reject the frame.
+//
+// A send interceptor is called with the packet before it is packed.
+// It may modify or replace f.Packet and f.SeqId, or set f.Data to
+// send the raw bytes instead of packing f.Packet. Data and Elapsed
+// are filled in once next returns.
+//
+// A receive interceptor is called with an empty frame, all the
+// fields are filled in once next returns. It may then modify or
+// replace f.Packet, which is returned by RecvAndUnpackPkt.
+//
+// An error returned by the interceptors is returned by SendPkt or
+// RecvAndUnpackPkt.
+type Interceptor func(f *Frame, next func(*Frame) error) error
+
+// InterceptSend adds interceptors for the frames sent by SendPkt.
+// The first one added is the outermost one. InterceptSend should
+// be called before the connection is used.
+func (c *Conn) InterceptSend(is ...Interceptor) {
+	c.sendInterceptors = append(c.sendInterceptors, is...)
+}
+
+// InterceptRecv adds interceptors for the frames received by
+// RecvAndUnpackPkt. The first one added is the outermost one.
+// InterceptRecv should be called before the connection is used.
+func (c *Conn) InterceptRecv(is ...Interceptor) {
+	c.recvInterceptors = append(c.recvInterceptors, is...)
+}
+
+// intercept calls the interceptors is in order, and last at the end.
+func intercept(is []Interceptor, f *Frame, last func(*Frame) error) error {
+	if len(is) == 0 {
+		return last(f)
+	}
+	return is[0](f, func(f *Frame) error {
+		return intercept(is[1:], f, last)
+	})
+}
@@ -0,0 +1,164 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+func TestConnInterceptors(t *testing.T) {
+	c1, c2 := net.Pipe()
+	sender, receiver := cmpp.NewConn(c1, cmpp.V30), cmpp.NewConn(c2, cmpp.V30)
+	sender.SetState(cmpp.CONN_AUTHOK)
+	receiver.SetState(cmpp.CONN_AUTHOK)
+	defer sender.Close()
+	defer receiver.Close()
+
+	var order []string
+	var sent []byte
+	errRejected := errors.New("rejected")
+	sender.InterceptSend(
+		func(f *cmpp.Frame, next func(*cmpp.Frame) error) error {
+			order = append(order, "outer")
+			if err := next(f); err != nil {
+				return err
+			}
+			sent = append([]byte(nil), f.Data...)
+			if f.Elapsed <= 0 || f.Time.IsZero() {
+				t.Errorf("send timing is not set: %v, %v", f.Time, f.Elapsed)
+			}
+			return nil
+		},
+		func(f *cmpp.Frame, next func(*cmpp.Frame) error) error {
+			order = append(order, "inner")
+			p := f.Packet.(*cmpp.Cmpp3SubmitRspPkt)
+			if p.Result != 0 {
+				return errRejected
+			}
+			p.MsgId = 0xff // rewrite the packet.
+			return next(f)
+		},
+	)
+
+	var received []byte
+	receiver.InterceptRecv(func(f *cmpp.Frame, next func(*cmpp.Frame) error) error {
+		if err := next(f); err != nil {
+			return err
+		}
+		received = append([]byte(nil), f.Data...)
+		if f.SeqId != 7 {
+			t.Errorf("received SeqId: actual [%d], wanted [7]", f.SeqId)
+		}
+		f.Packet.(*cmpp.Cmpp3SubmitRspPkt).Result = 9 // rewrite the packet.
+		return nil
+	})
+
+	if err := sender.SendPkt(&cmpp.Cmpp3SubmitRspPkt{Result: 1}, 6); err != errRejected {
+		t.Fatalf("send rejected packet: actual [%v], wanted [%v]", err, errRejected)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sender.SendPkt(&cmpp.Cmpp3SubmitRspPkt{}, 7)
+	}()
+	i, err := receiver.RecvAndUnpackPkt(5 * time.Second)
+	if err != nil {
+		t.Fatal("receive packet error:", err)
+	}
+	if err = <-done; err != nil {
+		t.Fatal("send packet error:", err)
+	}
+
+	wanted := cmpp.Cmpp3SubmitRspPkt{MsgId: 0xff, Result: 9, SeqId: 7}
+	if p := i.(*cmpp.Cmpp3SubmitRspPkt); *p != wanted {
+		t.Fatalf("received packet: actual [%#v], wanted [%#v]", *p, wanted)
+	}
+	if !bytes.Equal(sent, received) || len(sent) != int(cmpp.Cmpp3SubmitRspPktLen) {
+		t.Fatalf("frame data: sent [%x], received [%x]", sent, received)
+	}
+	if len(order) != 4 || order[0] != "outer" || order[1] != "inner" {
+		t.Fatalf("interceptors are called in order: %v", order)
+	}
+}
+
+func TestConnInterceptRawData(t *testing.T) {
+	c1, c2 := net.Pipe()
+	sender, receiver := cmpp.NewConn(c1, cmpp.V30), cmpp.NewConn(c2, cmpp.V30)
+	sender.SetState(cmpp.CONN_AUTHOK)
+	receiver.SetState(cmpp.CONN_AUTHOK)
+	defer sender.Close()
+	defer receiver.Close()
+
+	// inject a frame in place of the packet sent.
+	raw, _ := (&cmpp.CmppActiveTestRspPkt{}).Pack(3)
+	sender.InterceptSend(func(f *cmpp.Frame, next func(*cmpp.Frame) error) error {
+		f.Data = raw
+		return next(f)
+	})
+
+	go sender.SendPkt(&cmpp.CmppActiveTestReqPkt{}, 1)
+	i, err := receiver.RecvAndUnpackPkt(5 * time.Second)
+	if err != nil {
+		t.Fatal("receive packet error:", err)
+	}
+	if p, ok := i.(*cmpp.CmppActiveTestRspPkt); !ok || p.SeqId != 3 {
+		t.Fatalf("received packet: actual [%#v], wanted the injected one", i)
+	}
+}
+
+func TestClientServerInterceptors(t *testing.T) {
+	srvRecv := make(chan cmpp.CommandId, 1)
+	addr := startServer(t, &cmpp.Server{
+		Handler: chain(acceptLogin),
+		Typ:     cmpp.V30,
+		RecvInterceptors: []cmpp.Interceptor{
+			func(f *cmpp.Frame, next func(*cmpp.Frame) error) error {
+				err := next(f)
+				if err == nil {
+					select {
+					case srvRecv <- f.Packet.(cmpp.Pdu).CommandId():
+					default:
+					}
+				}
+				return err
+			},
+		},
+	})
+
+	var cliSent []cmpp.CommandId
+	c := cmpp.NewClient(cmpp.V30)
+	c.SendInterceptors = []cmpp.Interceptor{
+		func(f *cmpp.Frame, next func(*cmpp.Frame) error) error {
+			cliSent = append(cliSent, f.Packet.(cmpp.Pdu).CommandId())
+			return next(f)
+		},
+	}
+	if err := c.Connect(addr, "900001", "888888", time.Second); err != nil {
+		t.Fatal("client connect error:", err)
+	}
+	defer c.Disconnect()
+
+	if len(cliSent) != 1 || cliSent[0] != cmpp.CMPP_CONNECT {
+		t.Fatalf("client sent: actual %v, wanted [CMPP_CONNECT]", cliSent)
+	}
+	if id := <-srvRecv; id != cmpp.CMPP_CONNECT {
+		t.Fatalf("server received: actual %v, wanted CMPP_CONNECT", id)
+	}
+}
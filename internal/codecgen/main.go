@@ -0,0 +1,543 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Codecgen generates the Pack, AppendPack, Unpack, Len and Validate
+// methods, and the Pdu methods of the cmpp packets from their struct
+// definitions.
+//
+// A packet is a struct type whose doc comment has the directive
+//
+//	//cmpp:packet CMPP_SUBMIT [V30|V21]
+//
+// naming its Command_Id, and the protocol version if the packet is
+// specific to one of them. The fields are encoded in the order they are
+// declared. Integer fields (uint8, uint16, uint32 and uint64) need no
+// tag; the other fields are described by a `cmpp:"..."` tag holding
+// comma separated options:
+//
+//	seqid          the uint32 field holding the Sequence_Id of the header
+//	-              the field is not encoded; it must be the first option
+//	uint8, uint16, a field of a named integer type, e.g. cmpp.Type,
+//	uint32, uint64 encoded as an integer of the width
+//	cstring=N      a string padded with zeros to N bytes, the zeros
+//	               are trimmed when decoding
+//	octet=N        a string of N bytes, kept as is when decoding
+//	len=Field      a string whose length is the value of the integer
+//	               field Field, which must be declared before it
+//	count=Field    a []string field, whose number of elements is the
+//	               value of the integer field Field; the elements are
+//	               described by cstring=N or octet=N
+//
+// The options binary, phone, secret and content tell how the field is
+// rendered by the String, MarshalJSON and UnmarshalJSON methods, which
+// are generated too; see format.go of the cmpp package.
+//
+// If the packet type has a method beforePack(), AppendPack calls it
+// before validating the packet, e.g. to fill in default values or to
+// compute the authenticators.
+//
+// The Pdu, String and JSON methods declared by hand on a packet type,
+// e.g. ProtocolVersion, are not generated.
+//
+// Usage:
+//
+//	codecgen [-dir dir] [-output file]
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const directive = "//cmpp:packet "
+
+type fieldKind int
+
+const (
+	kindUint fieldKind = iota
+	kindSeqId
+	kindFixed  // cstring=N or octet=N
+	kindVarLen // len=Field
+	kindList   // count=Field
+)
+
+type field struct {
+	name    string
+	kind    fieldKind
+	bits    int    // kindUint
+	conv    string // the named type of kindUint, if any.
+	size    int    // kindFixed, kindList
+	cstring bool   // kindFixed, kindList
+	ref     string // the len or count field of kindVarLen and kindList
+}
+
+type packet struct {
+	name    string
+	command string
+	version string // "0" if the packet is shared by all the versions.
+	seqId   string // the name of the seqid field.
+	fields  []*field
+	methods map[string]bool // the methods declared by hand.
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("codecgen: ")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: codecgen [-dir dir] [-output file]\n")
+		flag.PrintDefaults()
+	}
+
+	dir := flag.String("dir", ".", "the directory of the cmpp package")
+	output := flag.String("output", "codec_gen.go", "the output file name, relative to dir")
+	flag.Parse()
+
+	src, err := generate(*dir, *output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(*dir, *output), src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate parses the package in dir, except the output file and the
+// test files, and returns the formatted source of the output file.
+func generate(dir, output string) ([]byte, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range names {
+		base := filepath.Base(name)
+		if base == output || strings.HasSuffix(base, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no go files in %s", dir)
+	}
+
+	methods := make(map[string]map[string]bool) // type -> the methods declared.
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Recv == nil {
+				continue
+			}
+			if star, ok := fd.Recv.List[0].Type.(*ast.StarExpr); ok {
+				if id, ok := star.X.(*ast.Ident); ok {
+					if methods[id.Name] == nil {
+						methods[id.Name] = make(map[string]bool)
+					}
+					methods[id.Name][fd.Name.Name] = true
+				}
+			}
+		}
+	}
+
+	var packets []*packet
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				doc := ts.Doc
+				if doc == nil && len(gd.Specs) == 1 {
+					doc = gd.Doc
+				}
+				args := strings.Fields(packetCommand(doc))
+				if len(args) == 0 {
+					continue
+				}
+				version := "0"
+				if len(args) > 1 {
+					version = args[1]
+				}
+				if len(args) > 2 || !validVersion(version) {
+					return nil, fmt.Errorf("%s: invalid directive %s%s", fset.Position(ts.Pos()), directive, strings.Join(args, " "))
+				}
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok {
+					return nil, fmt.Errorf("%s: %s is not a struct", fset.Position(ts.Pos()), ts.Name.Name)
+				}
+				p, err := parsePacket(ts.Name.Name, args[0], st)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", fset.Position(ts.Pos()), err)
+				}
+				p.version = version
+				p.methods = methods[p.name]
+				packets = append(packets, p)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by codecgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n", files[0].Name.Name)
+	for _, p := range packets {
+		p.emit(&buf)
+	}
+	return format.Source(buf.Bytes())
+}
+
+// packetCommand returns the Command_Id named by the directive
+// in doc, or "" if there is no directive.
+func packetCommand(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	for _, c := range doc.List {
+		if strings.HasPrefix(c.Text, directive) {
+			return strings.TrimSpace(strings.TrimPrefix(c.Text, directive))
+		}
+	}
+	return ""
+}
+
+// validVersion reports whether v names a protocol version.
+func validVersion(v string) bool {
+	switch v {
+	case "0", "V30", "V21", "V20":
+		return true
+	}
+	return false
+}
+
+func parsePacket(name, command string, st *ast.StructType) (*packet, error) {
+	p := &packet{
+		name:    name,
+		command: command,
+	}
+	uints := make(map[string]bool) // the integer fields declared so far.
+
+	for _, f := range st.Fields.List {
+		var tag string
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(s).Get("cmpp")
+		}
+		if strings.Split(tag, ",")[0] == "-" {
+			continue
+		}
+
+		for _, n := range f.Names {
+			fd, err := parseField(n.Name, f.Type, tag)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", n.Name, err)
+			}
+			if fd.ref != "" && !uints[fd.ref] {
+				return nil, fmt.Errorf("field %s: %s is not an integer field declared before it", n.Name, fd.ref)
+			}
+			switch fd.kind {
+			case kindSeqId:
+				if p.seqId != "" {
+					return nil, fmt.Errorf("field %s: duplicate seqid field", n.Name)
+				}
+				p.seqId = n.Name
+				continue
+			case kindUint:
+				uints[fd.name] = true
+			}
+			p.fields = append(p.fields, fd)
+		}
+	}
+	if p.seqId == "" {
+		return nil, fmt.Errorf("%s has no seqid field", name)
+	}
+	return p, nil
+}
+
+func parseField(name string, typ ast.Expr, tag string) (*field, error) {
+	fd := &field{name: name}
+
+	var elem string // the element type of a slice.
+	var ident string
+	switch t := typ.(type) {
+	case *ast.Ident:
+		ident = t.Name
+	case *ast.ArrayType:
+		id, ok := t.Elt.(*ast.Ident)
+		if t.Len != nil || !ok {
+			return nil, fmt.Errorf("unsupported type")
+		}
+		elem = id.Name
+	default:
+		return nil, fmt.Errorf("unsupported type")
+	}
+
+	opts := make(map[string]string)
+	if tag != "" {
+		for _, opt := range strings.Split(tag, ",") {
+			kv := strings.SplitN(opt, "=", 2)
+			if len(kv) == 2 {
+				opts[kv[0]] = kv[1]
+			} else {
+				opts[kv[0]] = ""
+			}
+		}
+	}
+
+	size := func() error {
+		for _, k := range []string{"cstring", "octet"} {
+			if v, ok := opts[k]; ok {
+				n, err := strconv.Atoi(v)
+				if err != nil || n <= 0 {
+					return fmt.Errorf("invalid %s size %q", k, v)
+				}
+				fd.size, fd.cstring = n, k == "cstring"
+				return nil
+			}
+		}
+		return fmt.Errorf("cstring=N or octet=N is required")
+	}
+
+	var width string // the uintN option of a named integer type.
+	for _, k := range []string{"uint8", "uint16", "uint32", "uint64"} {
+		if _, ok := opts[k]; ok {
+			width = k
+		}
+	}
+
+	switch {
+	case width != "" && ident != "" && ident != "string":
+		fd.bits, _ = strconv.Atoi(strings.TrimPrefix(width, "uint"))
+		fd.conv = ident
+	case ident == "uint8" || ident == "uint16" || ident == "uint32" || ident == "uint64":
+		fd.bits, _ = strconv.Atoi(strings.TrimPrefix(ident, "uint"))
+		if _, ok := opts["seqid"]; ok {
+			if ident != "uint32" {
+				return nil, fmt.Errorf("seqid must be uint32")
+			}
+			fd.kind = kindSeqId
+		}
+	case ident == "string":
+		if ref, ok := opts["len"]; ok {
+			fd.kind, fd.ref = kindVarLen, ref
+			break
+		}
+		fd.kind = kindFixed
+		if err := size(); err != nil {
+			return nil, err
+		}
+	case elem == "string":
+		ref, ok := opts["count"]
+		if !ok {
+			return nil, fmt.Errorf("count=Field is required")
+		}
+		fd.kind, fd.ref = kindList, ref
+		if err := size(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type")
+	}
+	return fd, nil
+}
+
+func (p *packet) emit(w *bytes.Buffer) {
+	pf := func(format string, args ...interface{}) {
+		fmt.Fprintf(w, format, args...)
+	}
+
+	// gen reports whether the method is to be generated, i.e. it is
+	// not declared by hand.
+	gen := func(method string) bool {
+		return !p.methods[method]
+	}
+
+	// Pdu
+	if gen("CommandId") {
+		pf("\n// CommandId returns the Command_Id of the %s.\n", p.name)
+		pf("func (p *%s) CommandId() CommandId {\n\treturn %s\n}\n", p.name, p.command)
+	}
+	if gen("SequenceId") {
+		pf("\n// SequenceId returns the Sequence_Id of the %s.\n", p.name)
+		pf("func (p *%s) SequenceId() uint32 {\n\treturn p.%s\n}\n", p.name, p.seqId)
+	}
+	if gen("setSequenceId") {
+		pf("\nfunc (p *%s) setSequenceId(seqId uint32) {\n\tp.%s = seqId\n}\n", p.name, p.seqId)
+	}
+	if gen("ProtocolVersion") {
+		pf("\n// ProtocolVersion returns the protocol version of the %s.\n", p.name)
+		pf("func (p *%s) ProtocolVersion() Type {\n\treturn %s\n}\n", p.name, p.version)
+	}
+
+	// String and JSON
+	if gen("String") {
+		pf("\n// String returns the fields of the %s in a readable form.\n", p.name)
+		pf("func (p *%s) String() string {\n\treturn formatPacket(p)\n}\n", p.name)
+	}
+	if gen("MarshalJSON") {
+		pf("\n// MarshalJSON implements the json.Marshaler interface.\n")
+		pf("func (p *%s) MarshalJSON() ([]byte, error) {\n\treturn marshalPacket(p)\n}\n", p.name)
+	}
+	if gen("UnmarshalJSON") {
+		pf("\n// UnmarshalJSON implements the json.Unmarshaler interface.\n")
+		pf("func (p *%s) UnmarshalJSON(data []byte) error {\n\treturn unmarshalPacket(p, data)\n}\n", p.name)
+	}
+
+	// Len
+	fixed := 0
+	var vars []string
+	for _, f := range p.fields {
+		switch f.kind {
+		case kindUint:
+			fixed += f.bits / 8
+		case kindFixed:
+			fixed += f.size
+		case kindVarLen:
+			vars = append(vars, fmt.Sprintf("uint32(p.%s)", f.ref))
+		case kindList:
+			vars = append(vars, fmt.Sprintf("uint32(p.%s)*%d", f.ref, f.size))
+		}
+	}
+	pf("\n// Len returns the Total_Length of the %s.\n", p.name)
+	pf("func (p *%s) Len() uint32 {\n", p.name)
+	pf("\treturn CMPP_HEADER_LEN")
+	if fixed > 0 {
+		pf(" + %d", fixed)
+	}
+	for _, v := range vars {
+		pf(" + %s", v)
+	}
+	pf("\n}\n")
+
+	// Validate
+	pf("\n// Validate checks that the fields of the %s fit in their widths,\n", p.name)
+	pf("// and agree with the length and count fields.\n")
+	pf("func (p *%s) Validate() error {\n", p.name)
+	for _, f := range p.fields {
+		switch f.kind {
+		case kindFixed:
+			pf("\tif len(p.%s) > %d {\n", f.name, f.size)
+			pf("\t\treturn invalidField(%q, %q)\n\t}\n", p.name, f.name)
+		case kindVarLen:
+			pf("\tif len(p.%s) != int(p.%s) {\n", f.name, f.ref)
+			pf("\t\treturn invalidField(%q, %q)\n\t}\n", p.name, f.name)
+		case kindList:
+			pf("\tif len(p.%s) != int(p.%s) {\n", f.name, f.ref)
+			pf("\t\treturn invalidField(%q, %q)\n\t}\n", p.name, f.name)
+			pf("\tfor _, s := range p.%s {\n", f.name)
+			pf("\t\tif len(s) > %d {\n", f.size)
+			pf("\t\t\treturn invalidField(%q, %q)\n\t\t}\n\t}\n", p.name, f.name)
+		}
+	}
+	pf("\treturn nil\n}\n")
+
+	// Pack
+	pf("\n// Pack packs the %s to bytes stream.\n", p.name)
+	pf("func (p *%s) Pack(seqId uint32) ([]byte, error) {\n", p.name)
+	pf("\treturn p.AppendPack(nil, seqId)\n}\n")
+
+	// AppendPack
+	pf("\n// AppendPack is like Pack, but appends the packet to dst and\n")
+	pf("// returns the extended buffer.\n")
+	pf("func (p *%s) AppendPack(dst []byte, seqId uint32) ([]byte, error) {\n", p.name)
+	if p.methods["beforePack"] {
+		pf("\tp.beforePack()\n")
+	}
+	pf("\tif err := p.Validate(); err != nil {\n\t\treturn dst, err\n\t}\n\n")
+	pf("\tvar pktLen = p.Len()\n")
+	pf("\tvar w = newPacketWriter(dst, pktLen)\n\n")
+	pf("\t// Pack header\n")
+	pf("\tw.WriteUint32(pktLen)\n")
+	pf("\tw.WriteUint32(uint32(%s))\n", p.command)
+	pf("\tw.WriteUint32(seqId)\n")
+	pf("\tp.%s = seqId\n", p.seqId)
+	if len(p.fields) > 0 {
+		pf("\n\t// Pack body\n")
+	}
+	for _, f := range p.fields {
+		switch f.kind {
+		case kindUint:
+			if f.conv != "" {
+				pf("\tw.WriteUint%d(uint%d(p.%s))\n", f.bits, f.bits, f.name)
+				break
+			}
+			pf("\tw.WriteUint%d(p.%s)\n", f.bits, f.name)
+		case kindFixed:
+			pf("\tw.WriteFixedSizeString(p.%s, %d)\n", f.name, f.size)
+		case kindVarLen:
+			pf("\tw.WriteString(p.%s)\n", f.name)
+		case kindList:
+			pf("\tfor _, s := range p.%s {\n", f.name)
+			pf("\t\tw.WriteFixedSizeString(s, %d)\n\t}\n", f.size)
+		}
+	}
+	pf("\n\treturn w.Bytes()\n}\n")
+
+	// Unpack
+	pf("\n// Unpack unpack the binary byte stream to a %s variable.\n", p.name)
+	pf("// Parameter data contains seqId in header and the whole packet body.\n")
+	pf("func (p *%s) Unpack(data []byte) error {\n", p.name)
+	pf("\tvar r = newPacketReader(data)\n\n")
+	pf("\t// Sequence Id\n")
+	pf("\tp.%s = r.ReadUint32()\n", p.seqId)
+	if len(p.fields) > 0 {
+		pf("\n\t// Body\n")
+	}
+	read := func(f *field) string {
+		if f.cstring {
+			return fmt.Sprintf("r.ReadCString(%d)", f.size)
+		}
+		return fmt.Sprintf("r.ReadString(%d)", f.size)
+	}
+	for _, f := range p.fields {
+		switch f.kind {
+		case kindUint:
+			if f.conv != "" {
+				pf("\tp.%s = %s(r.ReadUint%d())\n", f.name, f.conv, f.bits)
+				break
+			}
+			pf("\tp.%s = r.ReadUint%d()\n", f.name, f.bits)
+		case kindFixed:
+			pf("\tp.%s = %s\n", f.name, read(f))
+		case kindVarLen:
+			pf("\tp.%s = r.ReadString(int(p.%s))\n", f.name, f.ref)
+		case kindList:
+			pf("\tp.%s = make([]string, 0, p.%s)\n", f.name, f.ref)
+			pf("\tfor i := 0; i < int(p.%s); i++ {\n", f.ref)
+			pf("\t\tp.%s = append(p.%s, %s)\n\t}\n", f.name, f.name, read(f))
+		}
+	}
+	pf("\n\treturn r.Error()\n}\n")
+}
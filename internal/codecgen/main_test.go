@@ -0,0 +1,67 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestGeneratedCodeUpToDate(t *testing.T) {
+	dir := filepath.Join("..", "..")
+	src, err := generate(dir, "codec_gen.go")
+	if err != nil {
+		t.Fatal("generate error:", err)
+	}
+
+	old, err := ioutil.ReadFile(filepath.Join(dir, "codec_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, old) {
+		t.Fatal("codec_gen.go is out of date, run go generate")
+	}
+}
+
+func TestParsePacketErrors(t *testing.T) {
+	var tests = []struct {
+		name string
+		src  string
+	}{
+		{"no seqid", "struct { A uint8 }"},
+		{"duplicate seqid", "struct { A uint32 `cmpp:\"seqid\"`; B uint32 `cmpp:\"seqid\"` }"},
+		{"seqid not uint32", "struct { A uint8 `cmpp:\"seqid\"` }"},
+		{"string without size", "struct { A string; S uint32 `cmpp:\"seqid\"` }"},
+		{"invalid size", "struct { A string `cmpp:\"cstring=x\"`; S uint32 `cmpp:\"seqid\"` }"},
+		{"list without count", "struct { A []string `cmpp:\"cstring=21\"`; S uint32 `cmpp:\"seqid\"` }"},
+		{"len after field", "struct { A string `cmpp:\"len=N\"`; N uint8; S uint32 `cmpp:\"seqid\"` }"},
+		{"unsupported type", "struct { A int; S uint32 `cmpp:\"seqid\"` }"},
+		{"named type without width", "struct { A Type; S uint32 `cmpp:\"seqid\"` }"},
+		{"string with width", "struct { A string `cmpp:\"uint8\"`; S uint32 `cmpp:\"seqid\"` }"},
+	}
+
+	for _, tt := range tests {
+		expr, err := parser.ParseExpr(tt.src)
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", tt.name, err)
+		}
+		if _, err = parsePacket("P", "CMPP_X", expr.(*ast.StructType)); err == nil {
+			t.Errorf("%s: parsePacket returns no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ismg provides the building blocks of a gateway acting as an
+// ISMG, shared by cmpptest and cmd/ismg-sim.
+package ismg
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+	"github.com/bigwhite/gocmpp/utils"
+)
+
+// ErrUnknownMsgFmt is returned by NewMO for a msg_fmt it can not
+// encode the content in.
+var ErrUnknownMsgFmt = errors.New("ismg: unknown msg_fmt")
+
+// Login sets the connect response in r to the request req, as an
+// ISMG of the protocol version typ, with the accounts allowed to log
+// in mapped to their secrets in secrets, or allowing any account with
+// any secret if secrets is nil. It returns the Status of the response.
+func Login(r *cmpp.Response, req *cmpp.CmppConnReqPkt, secrets map[string]string, typ cmpp.Type) uint8 {
+	account := strings.TrimRight(req.SrcAddr, "\x00")
+	secret, ok := secrets[account]
+
+	var status uint8
+	switch {
+	case secrets != nil && !ok:
+		status = cmpp.ErrnoConnInvalidSrcAddr
+	case secrets != nil && req.AuthSrc != AuthSrc(account, secret, req.Timestamp):
+		status = cmpp.ErrnoConnAuthFailed
+	case req.Version > typ:
+		status = cmpp.ErrnoConnVerTooHigh
+	case req.Version>>4 != typ>>4:
+		status = cmpp.ErrnoConnOthers
+	}
+
+	switch rsp := r.Packer.(type) {
+	case *cmpp.Cmpp2ConnRspPkt:
+		rsp.Status, rsp.AuthSrc, rsp.Secret, rsp.Version = status, req.AuthSrc, secret, typ
+	case *cmpp.Cmpp3ConnRspPkt:
+		rsp.Status, rsp.AuthSrc, rsp.Secret, rsp.Version = uint32(status), req.AuthSrc, secret, typ
+	}
+	return status
+}
+
+// AuthSrc computes the AuthenticatorSource of a connect request of
+// account with secret at timestamp.
+func AuthSrc(account, secret string, timestamp uint32) string {
+	sum := md5.Sum(bytes.Join([][]byte{[]byte(cmpputils.OctetString(account, 6)),
+		make([]byte, 9),
+		[]byte(secret),
+		[]byte(cmpputils.TimeStamp2Str(timestamp))},
+		nil))
+	return string(sum[:])
+}
+
+// SetSubmitRsp sets the MsgId and the Result of the submit response p
+// of either protocol version.
+func SetSubmitRsp(p cmpp.Packer, msgId uint64, result uint32) {
+	switch rsp := p.(type) {
+	case *cmpp.Cmpp2SubmitRspPkt:
+		rsp.MsgId, rsp.Result = msgId, uint8(result)
+	case *cmpp.Cmpp3SubmitRspPkt:
+		rsp.MsgId, rsp.Result = msgId, result
+	}
+}
+
+// A MsgIdGenerator generates the MsgIds in the format of the ISMGs,
+// see cmpp.MsgIdParts. It is safe for concurrent use.
+type MsgIdGenerator struct {
+	GatewayId uint32
+	seq       uint32
+}
+
+// Next returns a new MsgId generated at t.
+func (g *MsgIdGenerator) Next(t time.Time) uint64 {
+	return cmpp.MsgIdParts{
+		Month:     uint8(t.Month()),
+		Day:       uint8(t.Day()),
+		Hour:      uint8(t.Hour()),
+		Minute:    uint8(t.Minute()),
+		Second:    uint8(t.Second()),
+		GatewayId: g.GatewayId,
+		Seq:       uint16(atomic.AddUint32(&g.seq, 1)),
+	}.MsgId()
+}
+
+// A Deliver is a deliver request to send, an MO message or a status
+// report, of either protocol version.
+type Deliver struct {
+	MsgId            uint64
+	DestId           string
+	ServiceId        string
+	MsgFmt           uint8
+	SrcTerminalId    string
+	RegisterDelivery uint8
+	MsgContent       string
+}
+
+// NewMO returns the deliver request of an MO message from src to dest,
+// with the UTF-8 content encoded in msgFmt.
+func NewMO(src, dest, content string, msgFmt uint8) (*Deliver, error) {
+	var err error
+	switch msgFmt {
+	case cmpp.MsgFmtASCII, cmpp.MsgFmtCard, cmpp.MsgFmtBinary:
+	case cmpp.MsgFmtUCS2:
+		content, err = cmpputils.Utf8ToUcs2(content)
+	case cmpp.MsgFmtGB:
+		content, err = cmpputils.Utf8ToGB18030(content)
+	default:
+		err = ErrUnknownMsgFmt
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Deliver{
+		DestId:        dest,
+		MsgFmt:        msgFmt,
+		SrcTerminalId: src,
+		MsgContent:    content,
+	}, nil
+}
+
+// ContentMsgFmt returns the msg_fmt to encode the UTF-8 content in:
+// ASCII if it is ASCII only, or else UCS2.
+func ContentMsgFmt(content string) uint8 {
+	if strings.IndexFunc(content, func(r rune) bool { return r >= 0x80 }) >= 0 {
+		return cmpp.MsgFmtUCS2
+	}
+	return cmpp.MsgFmtASCII
+}
+
+// NewReport returns the deliver request of the status report rpt of
+// a submit from srcId.
+func NewReport(rpt *cmpp.CmppReceiptPkt, srcId string) (*Deliver, error) {
+	content, err := rpt.Pack()
+	if err != nil {
+		return nil, err
+	}
+	return &Deliver{
+		DestId:           srcId,
+		SrcTerminalId:    rpt.DestTerminalId,
+		RegisterDelivery: 1,
+		MsgContent:       string(content),
+	}, nil
+}
+
+// Packet returns the deliver request packet of the protocol version typ.
+func (d *Deliver) Packet(typ cmpp.Type) cmpp.Packer {
+	if typ == cmpp.V30 {
+		return &cmpp.Cmpp3DeliverReqPkt{
+			MsgId:            d.MsgId,
+			DestId:           d.DestId,
+			ServiceId:        d.ServiceId,
+			MsgFmt:           d.MsgFmt,
+			SrcTerminalId:    d.SrcTerminalId,
+			RegisterDelivery: d.RegisterDelivery,
+			MsgLength:        uint8(len(d.MsgContent)),
+			MsgContent:       d.MsgContent,
+		}
+	}
+	return &cmpp.Cmpp2DeliverReqPkt{
+		MsgId:            d.MsgId,
+		DestId:           d.DestId,
+		ServiceId:        d.ServiceId,
+		MsgFmt:           d.MsgFmt,
+		SrcTerminalId:    d.SrcTerminalId,
+		RegisterDelivery: d.RegisterDelivery,
+		MsgLength:        uint8(len(d.MsgContent)),
+		MsgContent:       d.MsgContent,
+	}
+}
+
+// SentHooks runs the functions added for the responses once they are
+// sent, e.g. to send the status reports of a submit only after its
+// response. Its Intercept must be one of the SendInterceptors of the
+// server. It is safe for concurrent use.
+type SentHooks struct {
+	mu sync.Mutex
+	m  map[*cmpp.Conn]map[uint32][]func()
+}
+
+// Add adds fn to be run once the response of seqId is sent on c. fn
+// is run by the goroutine sending the response, after it is written;
+// and is dropped if the response fails to be sent.
+func (h *SentHooks) Add(c *cmpp.Conn, seqId uint32, fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.m == nil {
+		h.m = make(map[*cmpp.Conn]map[uint32][]func())
+	}
+	if h.m[c] == nil {
+		h.m[c] = make(map[uint32][]func())
+	}
+	h.m[c][seqId] = append(h.m[c][seqId], fn)
+}
+
+// Forget drops the functions added for c, e.g. once it is closed.
+func (h *SentHooks) Forget(c *cmpp.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.m, c)
+}
+
+// Intercept is the send interceptor running the functions.
+func (h *SentHooks) Intercept(f *cmpp.Frame, next func(*cmpp.Frame) error) error {
+	err := next(f)
+	// the requests sent by the server have SeqIds of their own.
+	if p, ok := f.Packet.(cmpp.Pdu); !ok || p.CommandId().IsRequest() {
+		return err
+	}
+
+	h.mu.Lock()
+	fns := h.m[f.Conn][f.SeqId]
+	delete(h.m[f.Conn], f.SeqId)
+	h.mu.Unlock()
+	if err == nil {
+		for _, fn := range fns {
+			fn()
+		}
+	}
+	return err
+}
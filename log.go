@@ -0,0 +1,154 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger is the leveled, structured logger used by the client and
+// the server. The fields of a record are key-value pairs, see the
+// LogKey constants for the keys this package uses.
+//
+// Use NewStdLogger to log through a *log.Logger, NewSlogLogger to
+// log through a *slog.Logger(with go1.21 and later), or implement it
+// to plug in any other logging library.
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+
+	// With returns a Logger adding fields to all its records.
+	With(fields ...Field) Logger
+}
+
+// Field is a key-value pair of a log record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// The keys of the fields logged by this package.
+const (
+	LogKeyRemoteAddr = "remote_addr"
+	LogKeyAccount    = "account"
+	LogKeyCommand    = "command"
+	LogKeySeqId      = "seq_id"
+	LogKeyError      = "error"
+)
+
+// LogLevel is the level of a log record. The values are the same
+// as the ones of the slog levels.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = -4
+	LevelInfo  LogLevel = 0
+	LevelWarn  LogLevel = 4
+	LevelError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+}
+
+// stdLogger is a Logger writing the records of level and above
+// to a *log.Logger, in the form of
+//
+//	INFO accept a connection remote_addr=127.0.0.1:51234
+type stdLogger struct {
+	l      *log.Logger
+	level  LogLevel
+	prefix string // the formatted fields added by With.
+}
+
+// NewStdLogger returns a Logger writing the records of level
+// and above to l.
+func NewStdLogger(l *log.Logger, level LogLevel) Logger {
+	return &stdLogger{
+		l:     l,
+		level: level,
+	}
+}
+
+func (s *stdLogger) Debug(msg string, fields ...Field) { s.log(LevelDebug, msg, fields) }
+func (s *stdLogger) Info(msg string, fields ...Field)  { s.log(LevelInfo, msg, fields) }
+func (s *stdLogger) Warn(msg string, fields ...Field)  { s.log(LevelWarn, msg, fields) }
+func (s *stdLogger) Error(msg string, fields ...Field) { s.log(LevelError, msg, fields) }
+
+func (s *stdLogger) With(fields ...Field) Logger {
+	var buf bytes.Buffer
+	buf.WriteString(s.prefix)
+	appendFields(&buf, fields)
+	return &stdLogger{
+		l:      s.l,
+		level:  s.level,
+		prefix: buf.String(),
+	}
+}
+
+func (s *stdLogger) log(level LogLevel, msg string, fields []Field) {
+	if level < s.level {
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString(level.String())
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+	buf.WriteString(s.prefix)
+	appendFields(&buf, fields)
+	s.l.Output(3, buf.String())
+}
+
+func appendFields(buf *bytes.Buffer, fields []Field) {
+	for _, f := range fields {
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		v := fmt.Sprint(f.Value)
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = fmt.Sprintf("%q", v)
+		}
+		buf.WriteString(v)
+	}
+}
+
+// nopLogger discards all the records.
+type nopLogger struct{}
+
+// NewNopLogger returns a Logger discarding all the records.
+func NewNopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(msg string, fields ...Field) {}
+func (nopLogger) Info(msg string, fields ...Field)  {}
+func (nopLogger) Warn(msg string, fields ...Field)  {}
+func (nopLogger) Error(msg string, fields ...Field) {}
+func (n nopLogger) With(fields ...Field) Logger     { return n }
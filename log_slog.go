@@ -0,0 +1,58 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package cmpp
+
+import (
+	"context"
+	"log/slog"
+)
+
+// slogLogger is a Logger backed by a *slog.Logger.
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger returns a Logger writing the records to l.
+// The fields become the attributes of the records.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+func (s slogLogger) Debug(msg string, fields ...Field) { s.log(slog.LevelDebug, msg, fields) }
+func (s slogLogger) Info(msg string, fields ...Field)  { s.log(slog.LevelInfo, msg, fields) }
+func (s slogLogger) Warn(msg string, fields ...Field)  { s.log(slog.LevelWarn, msg, fields) }
+func (s slogLogger) Error(msg string, fields ...Field) { s.log(slog.LevelError, msg, fields) }
+
+func (s slogLogger) With(fields ...Field) Logger {
+	return slogLogger{l: slog.New(s.l.Handler().WithAttrs(attrs(fields)))}
+}
+
+func (s slogLogger) log(level slog.Level, msg string, fields []Field) {
+	ctx := context.Background()
+	if !s.l.Enabled(ctx, level) {
+		return
+	}
+	s.l.LogAttrs(ctx, level, msg, attrs(fields)...)
+}
+
+func attrs(fields []Field) []slog.Attr {
+	as := make([]slog.Attr, len(fields))
+	for i, f := range fields {
+		as[i] = slog.Any(f.Key, f.Value)
+	}
+	return as
+}
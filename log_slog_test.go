@@ -0,0 +1,50 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+// +build go1.21
+
+package cmpp_test
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	h := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	l := cmpp.NewSlogLogger(slog.New(h))
+
+	l.Debug("receive a packet")
+	if buf.Len() != 0 {
+		t.Fatalf("debug record is logged at info level: %q", buf.String())
+	}
+
+	l.With(cmpp.Field{Key: cmpp.LogKeyAccount, Value: "900001"}).
+		Info("login ok", cmpp.Field{Key: cmpp.LogKeySeqId, Value: uint32(1)})
+	wanted := "level=INFO msg=\"login ok\" account=900001 seq_id=1\n"
+	if buf.String() != wanted {
+		t.Fatalf("log record is %q, not equal to the expected value: %q", buf.String(), wanted)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp_test
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := cmpp.NewStdLogger(log.New(&buf, "", 0), cmpp.LevelInfo)
+
+	l.Debug("receive a packet", cmpp.Field{Key: cmpp.LogKeySeqId, Value: 1})
+	if buf.Len() != 0 {
+		t.Fatalf("debug record is logged at info level: %q", buf.String())
+	}
+
+	l = l.With(cmpp.Field{Key: cmpp.LogKeyRemoteAddr, Value: "127.0.0.1:8888"})
+	l.Warn("refuse the login",
+		cmpp.Field{Key: cmpp.LogKeyAccount, Value: "900001"},
+		cmpp.Field{Key: cmpp.LogKeyError, Value: errors.New("auth failed")})
+
+	wanted := `WARN refuse the login remote_addr=127.0.0.1:8888 account=900001 error="auth failed"` + "\n"
+	if buf.String() != wanted {
+		t.Fatalf("log record is %q, not equal to the expected value: %q", buf.String(), wanted)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestServerDebugLog(t *testing.T) {
+	var buf syncBuffer
+	addr := startServer(t, &cmpp.Server{
+		Handler: chain(acceptLogin),
+		Typ:     cmpp.V30,
+		Logger:  cmpp.NewStdLogger(log.New(&buf, "", 0), cmpp.LevelDebug),
+	})
+	c := connectClient(t, addr)
+	defer c.Disconnect()
+
+	// the connect request and response are logged before
+	// the client is logged in.
+	logs := buf.String()
+	for _, s := range []string{
+		"INFO accept a connection remote_addr=",
+		"DEBUG receive a packet remote_addr=",
+		"command=CMPP_CONNECT seq_id=",
+		"DEBUG send a packet remote_addr=",
+		"account=900001 command=CMPP_CONNECT_RESP",
+	} {
+		if !strings.Contains(logs, s) {
+			t.Errorf("%q is not logged in:\n%s", s, logs)
+		}
+	}
+}
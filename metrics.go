@@ -0,0 +1,100 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp
+
+import "time"
+
+// Labels identify the connection a metric is observed on.
+type Labels struct {
+	// Conn is the address of the peer, the remote address of the
+	// client on the server side, and the server address on the
+	// client side.
+	Conn string
+
+	// Account is the account logged in, or "" before the login.
+	Account string
+}
+
+// Metrics receives the metrics of the client and the server. The
+// methods are called synchronously while the packets are sent and
+// received, so they must be fast and safe for concurrent use.
+//
+// The metrics subpackage provides an implementation exporting the
+// metrics in the Prometheus text format.
+type Metrics interface {
+	// PacketSent is called for every packet sent.
+	PacketSent(l Labels, cmd CommandId)
+
+	// PacketReceived is called for every packet received.
+	PacketReceived(l Labels, cmd CommandId)
+
+	// RequestLatency observes the latency of the request cmd. The
+	// server measures it from receiving the request to sending back
+	// the response, and the client from sending the request to
+	// receiving the response.
+	RequestLatency(l Labels, cmd CommandId, d time.Duration)
+
+	// InFlight adds delta to the number of requests in flight,
+	// i.e. the ones being handled by the server, or the ones sent
+	// and not answered yet by the client.
+	InFlight(l Labels, delta int)
+
+	// ResponseStatus is called for every connect, submit, deliver
+	// and fwd response sent or received, with its Status(or Result).
+	ResponseStatus(l Labels, cmd CommandId, code uint32)
+
+	// ActiveTestFailed is called when the server closes a connection
+	// for getting no active test responses.
+	ActiveTestFailed(l Labels)
+
+	// Reconnected is called when a client connects again.
+	Reconnected(l Labels)
+
+	// ConnClosed is called when a server side connection is closed,
+	// so that the per-connection metrics may be retired. Counters
+	// should not go down because of it.
+	ConnClosed(l Labels)
+}
+
+// nopMetrics discards all the metrics.
+type nopMetrics struct{}
+
+func (nopMetrics) PacketSent(l Labels, cmd CommandId)                      {}
+func (nopMetrics) PacketReceived(l Labels, cmd CommandId)                  {}
+func (nopMetrics) RequestLatency(l Labels, cmd CommandId, d time.Duration) {}
+func (nopMetrics) InFlight(l Labels, delta int)                            {}
+func (nopMetrics) ResponseStatus(l Labels, cmd CommandId, code uint32)     {}
+func (nopMetrics) ActiveTestFailed(l Labels)                               {}
+func (nopMetrics) Reconnected(l Labels)                                    {}
+func (nopMetrics) ConnClosed(l Labels)                                     {}
+
+// observeSent reports the packet p sent to m.
+func observeSent(m Metrics, l Labels, p Packer) {
+	pdu, ok := p.(Pdu)
+	if !ok {
+		return
+	}
+	m.PacketSent(l, pdu.CommandId())
+	if code, ok := responseStatus(pdu); ok {
+		m.ResponseStatus(l, pdu.CommandId(), code)
+	}
+}
+
+// observeReceived reports the packet p received to m.
+func observeReceived(m Metrics, l Labels, p Pdu) {
+	m.PacketReceived(l, p.CommandId())
+	if code, ok := responseStatus(p); ok {
+		m.ResponseStatus(l, p.CommandId(), code)
+	}
+}
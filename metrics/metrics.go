@@ -0,0 +1,376 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics implements cmpp.Metrics, and exports the metrics
+// in the Prometheus text format without any external dependency:
+//
+//	reg := metrics.NewRegistry()
+//	srv := &cmpp.Server{Metrics: reg, ...}
+//	http.Handle("/metrics", reg)
+//
+// The metrics exported are
+//
+//	cmpp_packets_sent_total{conn,account,command}
+//	cmpp_packets_received_total{conn,account,command}
+//	cmpp_request_duration_seconds{conn,account,command}  histogram
+//	cmpp_requests_in_flight{conn,account}                gauge
+//	cmpp_response_status_total{conn,account,command,code}
+//	cmpp_active_test_failures_total{account}
+//	cmpp_reconnects_total{account}
+//
+// Once a connection is closed, its counters are added to the ones
+// with an empty conn label of the same account, and its gauges are
+// dropped, so that the counters summed by account never go down
+// while the registry does not grow with the connections.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+// DefaultBuckets are the upper bounds of the request latency
+// histogram buckets in seconds, used if NewRegistry is given none.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type cmdKey struct {
+	labels cmpp.Labels
+	cmd    cmpp.CommandId
+}
+
+type statusKey struct {
+	labels cmpp.Labels
+	cmd    cmpp.CommandId
+	code   uint32
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative; the last one is +Inf.
+	sum    float64
+	count  uint64
+}
+
+// Registry collects the metrics of the cmpp clients and servers
+// using it. It is safe for concurrent use.
+type Registry struct {
+	buckets []float64
+
+	mu                 sync.Mutex
+	sent               map[cmdKey]uint64
+	received           map[cmdKey]uint64
+	latency            map[cmdKey]*histogram
+	inFlight           map[cmpp.Labels]int64
+	status             map[statusKey]uint64
+	activeTestFailures map[string]uint64 // by account.
+	reconnects         map[string]uint64 // by account.
+}
+
+// NewRegistry returns a new Registry with the latency histogram
+// buckets, or DefaultBuckets if none is given.
+func NewRegistry(buckets ...float64) *Registry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &Registry{
+		buckets:            buckets,
+		sent:               make(map[cmdKey]uint64),
+		received:           make(map[cmdKey]uint64),
+		latency:            make(map[cmdKey]*histogram),
+		inFlight:           make(map[cmpp.Labels]int64),
+		status:             make(map[statusKey]uint64),
+		activeTestFailures: make(map[string]uint64),
+		reconnects:         make(map[string]uint64),
+	}
+}
+
+// PacketSent implements cmpp.Metrics.
+func (r *Registry) PacketSent(l cmpp.Labels, cmd cmpp.CommandId) {
+	r.mu.Lock()
+	r.sent[cmdKey{l, cmd}]++
+	r.mu.Unlock()
+}
+
+// PacketReceived implements cmpp.Metrics.
+func (r *Registry) PacketReceived(l cmpp.Labels, cmd cmpp.CommandId) {
+	r.mu.Lock()
+	r.received[cmdKey{l, cmd}]++
+	r.mu.Unlock()
+}
+
+// RequestLatency implements cmpp.Metrics.
+func (r *Registry) RequestLatency(l cmpp.Labels, cmd cmpp.CommandId, d time.Duration) {
+	v := d.Seconds()
+	i := sort.SearchFloat64s(r.buckets, v) // the first bucket v fits in.
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := r.latency[cmdKey{l, cmd}]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(r.buckets)+1)}
+		r.latency[cmdKey{l, cmd}] = h
+	}
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// InFlight implements cmpp.Metrics.
+func (r *Registry) InFlight(l cmpp.Labels, delta int) {
+	r.mu.Lock()
+	r.inFlight[l] += int64(delta)
+	r.mu.Unlock()
+}
+
+// ResponseStatus implements cmpp.Metrics.
+func (r *Registry) ResponseStatus(l cmpp.Labels, cmd cmpp.CommandId, code uint32) {
+	r.mu.Lock()
+	r.status[statusKey{l, cmd, code}]++
+	r.mu.Unlock()
+}
+
+// ActiveTestFailed implements cmpp.Metrics.
+func (r *Registry) ActiveTestFailed(l cmpp.Labels) {
+	r.mu.Lock()
+	r.activeTestFailures[l.Account]++
+	r.mu.Unlock()
+}
+
+// Reconnected implements cmpp.Metrics.
+func (r *Registry) Reconnected(l cmpp.Labels) {
+	r.mu.Lock()
+	r.reconnects[l.Account]++
+	r.mu.Unlock()
+}
+
+// ConnClosed adds the counters of the connection l.Conn to the ones
+// of its account with an empty conn label, and drops its gauges.
+func (r *Registry) ConnClosed(l cmpp.Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	foldCmdCounters(r.sent, l.Conn)
+	foldCmdCounters(r.received, l.Conn)
+	for k, h := range r.latency {
+		if k.labels.Conn != l.Conn {
+			continue
+		}
+		delete(r.latency, k)
+		k.labels.Conn = ""
+		total := r.latency[k]
+		if total == nil {
+			r.latency[k] = h
+			continue
+		}
+		for i, n := range h.counts {
+			total.counts[i] += n
+		}
+		total.sum += h.sum
+		total.count += h.count
+	}
+	for k, n := range r.status {
+		if k.labels.Conn == l.Conn {
+			delete(r.status, k)
+			k.labels.Conn = ""
+			r.status[k] += n
+		}
+	}
+	for k := range r.inFlight {
+		if k.Conn == l.Conn {
+			delete(r.inFlight, k)
+		}
+	}
+}
+
+// foldCmdCounters adds the counters in m of the connection conn to
+// the ones with an empty conn label.
+func foldCmdCounters(m map[cmdKey]uint64, conn string) {
+	for k, n := range m {
+		if k.labels.Conn == conn {
+			delete(m, k)
+			k.labels.Conn = ""
+			m[k] += n
+		}
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	r.mu.Lock()
+	r.writeCmdCounters(bw, "cmpp_packets_sent_total", "The number of packets sent.", r.sent)
+	r.writeCmdCounters(bw, "cmpp_packets_received_total", "The number of packets received.", r.received)
+	r.writeLatency(bw)
+	r.writeConnMetric(bw, "cmpp_requests_in_flight", "The number of requests in flight.", "gauge", r.inFlight)
+	r.writeStatus(bw)
+	r.writeAccountCounter(bw, "cmpp_active_test_failures_total",
+		"The number of connections closed for no active test responses.", r.activeTestFailures)
+	r.writeAccountCounter(bw, "cmpp_reconnects_total", "The number of reconnects of the clients.", r.reconnects)
+	r.mu.Unlock()
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (r *Registry) writeCmdCounters(w *bufio.Writer, name, help string, m map[cmdKey]uint64) {
+	writeHeader(w, name, help, "counter")
+	keys := make([]cmdKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sortCmdKeys(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s,command=%q} %d\n", name, labelPairs(k.labels), k.cmd.String(), m[k])
+	}
+}
+
+func (r *Registry) writeLatency(w *bufio.Writer) {
+	const name = "cmpp_request_duration_seconds"
+	writeHeader(w, name, "The latency of the requests in seconds.", "histogram")
+	keys := make([]cmdKey, 0, len(r.latency))
+	for k := range r.latency {
+		keys = append(keys, k)
+	}
+	sortCmdKeys(keys)
+	for _, k := range keys {
+		h := r.latency[k]
+		labels := fmt.Sprintf("%s,command=%q", labelPairs(k.labels), k.cmd.String())
+		var cum uint64
+		for i, le := range r.buckets {
+			cum += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(le), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+	}
+}
+
+func (r *Registry) writeStatus(w *bufio.Writer) {
+	const name = "cmpp_response_status_total"
+	writeHeader(w, name, "The number of responses by the Status or Result code.", "counter")
+	keys := make([]statusKey, 0, len(r.status))
+	for k := range r.status {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.labels != b.labels {
+			return lessLabels(a.labels, b.labels)
+		}
+		if a.cmd != b.cmd {
+			return a.cmd < b.cmd
+		}
+		return a.code < b.code
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s,command=%q,code=\"%d\"} %d\n", name, labelPairs(k.labels), k.cmd.String(), k.code, r.status[k])
+	}
+}
+
+func (r *Registry) writeConnMetric(w *bufio.Writer, name, help, typ string, m map[cmpp.Labels]int64) {
+	writeHeader(w, name, help, typ)
+	keys := make([]cmpp.Labels, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return lessLabels(keys[i], keys[j])
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, labelPairs(k), m[k])
+	}
+}
+
+func (r *Registry) writeAccountCounter(w *bufio.Writer, name, help string, m map[string]uint64) {
+	writeHeader(w, name, help, "counter")
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{account=\"%s\"} %d\n", name, escape(k), m[k])
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sortCmdKeys(keys []cmdKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.labels != b.labels {
+			return lessLabels(a.labels, b.labels)
+		}
+		return a.cmd < b.cmd
+	})
+}
+
+func lessLabels(a, b cmpp.Labels) bool {
+	if a.Conn != b.Conn {
+		return a.Conn < b.Conn
+	}
+	return a.Account < b.Account
+}
+
+// labelPairs formats the conn and account labels.
+func labelPairs(l cmpp.Labels) string {
+	return `conn="` + escape(l.Conn) + `",account="` + escape(l.Account) + `"`
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escape escapes a label value as the text format requires.
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
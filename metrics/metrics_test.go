@@ -0,0 +1,262 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics_test
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+	"github.com/bigwhite/gocmpp/metrics"
+)
+
+func TestRegistry(t *testing.T) {
+	reg := metrics.NewRegistry(0.5, 0.1)
+	l := cmpp.Labels{Conn: "127.0.0.1:1234", Account: `9000"01`}
+
+	reg.PacketSent(l, cmpp.CMPP_SUBMIT)
+	reg.PacketSent(l, cmpp.CMPP_SUBMIT)
+	reg.RequestLatency(l, cmpp.CMPP_SUBMIT, 50*time.Millisecond)
+	reg.RequestLatency(l, cmpp.CMPP_SUBMIT, 200*time.Millisecond)
+	reg.RequestLatency(l, cmpp.CMPP_SUBMIT, time.Second)
+	reg.InFlight(l, 2)
+	reg.InFlight(l, -1)
+	reg.ResponseStatus(l, cmpp.CMPP_SUBMIT_RESP, 0x100)
+	reg.Reconnected(l)
+	reg.ActiveTestFailed(l)
+
+	var buf bytes.Buffer
+	if _, err := reg.WriteTo(&buf); err != nil {
+		t.Fatal("WriteTo error:", err)
+	}
+	out := buf.String()
+
+	labels := `conn="127.0.0.1:1234",account="9000\"01"`
+	for _, s := range []string{
+		"# TYPE cmpp_packets_sent_total counter\n",
+		`cmpp_packets_sent_total{` + labels + `,command="CMPP_SUBMIT"} 2` + "\n",
+		"# TYPE cmpp_request_duration_seconds histogram\n",
+		`cmpp_request_duration_seconds_bucket{` + labels + `,command="CMPP_SUBMIT",le="0.1"} 1` + "\n",
+		`cmpp_request_duration_seconds_bucket{` + labels + `,command="CMPP_SUBMIT",le="0.5"} 2` + "\n",
+		`cmpp_request_duration_seconds_bucket{` + labels + `,command="CMPP_SUBMIT",le="+Inf"} 3` + "\n",
+		`cmpp_request_duration_seconds_sum{` + labels + `,command="CMPP_SUBMIT"} 1.25` + "\n",
+		`cmpp_request_duration_seconds_count{` + labels + `,command="CMPP_SUBMIT"} 3` + "\n",
+		`cmpp_requests_in_flight{` + labels + `} 1` + "\n",
+		`cmpp_response_status_total{` + labels + `,command="CMPP_SUBMIT_RESP",code="256"} 1` + "\n",
+		`cmpp_reconnects_total{account="9000\"01"} 1` + "\n",
+		`cmpp_active_test_failures_total{account="9000\"01"} 1` + "\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("%q is not in the output:\n%s", s, out)
+		}
+	}
+
+	// the counters of the closed connections are kept by account.
+	reg.ConnClosed(l)
+	l2 := cmpp.Labels{Conn: "127.0.0.1:5678", Account: l.Account}
+	reg.PacketSent(l2, cmpp.CMPP_SUBMIT)
+	reg.RequestLatency(l2, cmpp.CMPP_SUBMIT, time.Second)
+	reg.ConnClosed(l2)
+	buf.Reset()
+	reg.WriteTo(&buf)
+	out = buf.String()
+	if strings.Contains(out, "127.0.0.1:") || strings.Contains(out, "cmpp_requests_in_flight{") {
+		t.Errorf("the metrics of the closed connections are not retired:\n%s", out)
+	}
+	labels = `conn="",account="9000\"01"`
+	for _, s := range []string{
+		`cmpp_packets_sent_total{` + labels + `,command="CMPP_SUBMIT"} 3` + "\n",
+		`cmpp_request_duration_seconds_bucket{` + labels + `,command="CMPP_SUBMIT",le="0.5"} 2` + "\n",
+		`cmpp_request_duration_seconds_count{` + labels + `,command="CMPP_SUBMIT"} 4` + "\n",
+		`cmpp_response_status_total{` + labels + `,command="CMPP_SUBMIT_RESP",code="256"} 1` + "\n",
+		`cmpp_reconnects_total{account="9000\"01"} 1` + "\n",
+		`cmpp_active_test_failures_total{account="9000\"01"} 1` + "\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("%q is not in the output after the connections closed:\n%s", s, out)
+		}
+	}
+}
+
+func TestServerAndClientMetrics(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen error:", err)
+	}
+	srvReg := metrics.NewRegistry()
+	srv := &cmpp.Server{
+		Handler: cmpp.HandlerFunc(func(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+			switch rsp := r.Packer.(type) {
+			case *cmpp.Cmpp3ConnRspPkt:
+				rsp.Version = cmpp.V30
+			case *cmpp.Cmpp3SubmitRspPkt:
+				rsp.Result = uint32(cmpp.ErrnoSubmitNotPassFlowControl)
+			}
+			return false, nil
+		}),
+		Typ:     cmpp.V30,
+		T:       time.Minute,
+		N:       3,
+		Logger:  cmpp.NewNopLogger(),
+		Metrics: srvReg,
+	}
+	go srv.Serve(ln)
+
+	cliReg := metrics.NewRegistry()
+	c := cmpp.NewClient(cmpp.V30)
+	c.Metrics = cliReg
+	if err := c.Connect(ln.Addr().String(), "900001", "888888", time.Second); err != nil {
+		t.Fatal("client connect error:", err)
+	}
+	defer c.Disconnect()
+
+	if _, err := c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{FeeType: "02"}); err != nil {
+		t.Fatal("send submit error:", err)
+	}
+	if _, err := c.RecvAndUnpackPkt(time.Second); err != nil {
+		t.Fatal("receive submit response error:", err)
+	}
+
+	var buf bytes.Buffer
+	cliReg.WriteTo(&buf)
+	labels := `conn="` + ln.Addr().String() + `",account="900001"`
+	for _, s := range []string{
+		`cmpp_packets_sent_total{` + labels + `,command="CMPP_SUBMIT"} 1`,
+		`cmpp_packets_received_total{` + labels + `,command="CMPP_SUBMIT_RESP"} 1`,
+		`cmpp_request_duration_seconds_count{` + labels + `,command="CMPP_SUBMIT"} 1`,
+		`cmpp_requests_in_flight{` + labels + `} 0`,
+		`cmpp_response_status_total{` + labels + `,command="CMPP_SUBMIT_RESP",code="8"} 1`,
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("%q is not in the client metrics:\n%s", s, buf.String())
+		}
+	}
+
+	buf.Reset()
+	srvReg.WriteTo(&buf)
+	for _, s := range []string{
+		`account="900001",command="CMPP_SUBMIT"} 1`,
+		`account="",command="CMPP_CONNECT"} 1`,
+		`account="900001",command="CMPP_CONNECT_RESP",code="0"} 1`,
+		`account="900001",command="CMPP_SUBMIT_RESP",code="8"} 1`,
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("%q is not in the server metrics:\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestActiveTestFailureMetrics(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen error:", err)
+	}
+	defer ln.Close()
+	reg := metrics.NewRegistry()
+	srv := &cmpp.Server{
+		Handler: cmpp.HandlerFunc(func(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+			if rsp, ok := r.Packer.(*cmpp.Cmpp3ConnRspPkt); ok {
+				rsp.Version = cmpp.V30
+			}
+			return false, nil
+		}),
+		Typ:         cmpp.V30,
+		T:           20 * time.Millisecond,
+		N:           1,
+		ReadTimeout: 20 * time.Millisecond,
+		Logger:      cmpp.NewNopLogger(),
+		Metrics:     reg,
+	}
+	go srv.Serve(ln)
+
+	// the client never answers the active tests.
+	c := cmpp.NewClient(cmpp.V30)
+	if err := c.Connect(ln.Addr().String(), "900001", "888888", time.Second); err != nil {
+		t.Fatal("client connect error:", err)
+	}
+	defer c.Disconnect()
+
+	want := `cmpp_active_test_failures_total{account="900001"} 1` + "\n"
+	var buf bytes.Buffer
+	for i := 0; i < 100; i++ {
+		buf.Reset()
+		reg.WriteTo(&buf)
+		// scraped after the connection is closed and retired.
+		closed := strings.Contains(buf.String(), `{conn="",account="900001",command="CMPP_ACTIVE_TEST"}`)
+		if closed && strings.Contains(buf.String(), want) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Errorf("%q is not in the metrics:\n%s", want, buf.String())
+}
+
+func TestInFlightMetricsSerial(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen error:", err)
+	}
+	defer ln.Close()
+	reg := metrics.NewRegistry()
+	release := make(chan struct{})
+	srv := &cmpp.Server{
+		Handler: cmpp.HandlerFunc(func(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+			switch r.Packer.(type) {
+			case *cmpp.Cmpp3ConnRspPkt:
+				r.Packer.(*cmpp.Cmpp3ConnRspPkt).Version = cmpp.V30
+			case *cmpp.Cmpp3SubmitRspPkt:
+				<-release
+			}
+			return false, nil
+		}),
+		Typ:     cmpp.V30, // and the default Window.
+		T:       time.Minute,
+		N:       3,
+		Logger:  cmpp.NewNopLogger(),
+		Metrics: reg,
+	}
+	go srv.Serve(ln)
+
+	c := cmpp.NewClient(cmpp.V30)
+	if err := c.Connect(ln.Addr().String(), "900001", "888888", time.Second); err != nil {
+		t.Fatal("client connect error:", err)
+	}
+	defer c.Disconnect()
+
+	waitFor := func(want string) {
+		var buf bytes.Buffer
+		for i := 0; i < 100; i++ {
+			buf.Reset()
+			reg.WriteTo(&buf)
+			if strings.Contains(buf.String(), want) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("%q is not in the metrics:\n%s", want, buf.String())
+	}
+
+	if _, err := c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{FeeType: "02"}); err != nil {
+		t.Fatal("send submit error:", err)
+	}
+	waitFor(`,account="900001"} 1` + "\n# HELP cmpp_response_status_total")
+	close(release)
+	if _, err := c.RecvAndUnpackPkt(time.Second); err != nil {
+		t.Fatal("receive submit response error:", err)
+	}
+	waitFor(`,account="900001"} 0` + "\n# HELP cmpp_response_status_total")
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp
+
+import "fmt"
+
+// MsgIdParts are the components of a Msg_Id generated by an ISMG.
+// From the most significant bit, a Msg_Id is made of
+//
+//	bits 64-61  month, 1-12
+//	bits 60-56  day, 1-31
+//	bits 55-51  hour, 0-23
+//	bits 50-45  minute, 0-59
+//	bits 44-39  second, 0-59
+//	bits 38-17  the code of the ISMG
+//	bits 16-1   the sequence number, wrapping around
+type MsgIdParts struct {
+	Month     uint8  `json:"month"`
+	Day       uint8  `json:"day"`
+	Hour      uint8  `json:"hour"`
+	Minute    uint8  `json:"minute"`
+	Second    uint8  `json:"second"`
+	GatewayId uint32 `json:"gateway_id"`
+	Seq       uint16 `json:"seq"`
+}
+
+// SplitMsgId returns the components of the Msg_Id id.
+func SplitMsgId(id uint64) MsgIdParts {
+	return MsgIdParts{
+		Month:     uint8(id >> 60 & 0xf),
+		Day:       uint8(id >> 55 & 0x1f),
+		Hour:      uint8(id >> 50 & 0x1f),
+		Minute:    uint8(id >> 44 & 0x3f),
+		Second:    uint8(id >> 38 & 0x3f),
+		GatewayId: uint32(id >> 16 & 0x3fffff),
+		Seq:       uint16(id),
+	}
+}
+
+// MsgId returns the Msg_Id made of p. The components out of range
+// are truncated.
+func (p MsgIdParts) MsgId() uint64 {
+	return uint64(p.Month&0xf)<<60 |
+		uint64(p.Day&0x1f)<<55 |
+		uint64(p.Hour&0x1f)<<50 |
+		uint64(p.Minute&0x3f)<<44 |
+		uint64(p.Second&0x3f)<<38 |
+		uint64(p.GatewayId&0x3fffff)<<16 |
+		uint64(p.Seq)
+}
+
+// String returns p as "MMDDhhmmss-gateway-seq".
+func (p MsgIdParts) String() string {
+	return fmt.Sprintf("%02d%02d%02d%02d%02d-%d-%d",
+		p.Month, p.Day, p.Hour, p.Minute, p.Second, p.GatewayId, p.Seq)
+}
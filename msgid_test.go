@@ -0,0 +1,48 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp_test
+
+import (
+	"testing"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+func TestSplitMsgId(t *testing.T) {
+	const id uint64 = 0xb2b9da8000010000 // 11-05 14:29:42, gateway 1, seq 0.
+	wanted := cmpp.MsgIdParts{
+		Month:     11,
+		Day:       5,
+		Hour:      14,
+		Minute:    29,
+		Second:    42,
+		GatewayId: 1,
+	}
+
+	p := cmpp.SplitMsgId(id)
+	if p != wanted {
+		t.Fatalf("SplitMsgId: actual [%+v], wanted [%+v]", p, wanted)
+	}
+	if p.MsgId() != id {
+		t.Errorf("MsgId: actual [%#x], wanted [%#x]", p.MsgId(), id)
+	}
+	if s := p.String(); s != "1105142942-1-0" {
+		t.Errorf("String: actual [%s], wanted [1105142942-1-0]", s)
+	}
+
+	p = cmpp.MsgIdParts{Month: 12, Day: 31, Hour: 23, Minute: 59, Second: 59, GatewayId: 0x3fffff, Seq: 0xffff}
+	if q := cmpp.SplitMsgId(p.MsgId()); q != p {
+		t.Errorf("SplitMsgId(MsgId()): actual [%+v], wanted [%+v]", q, p)
+	}
+}
@@ -11,6 +11,8 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:generate go run ./internal/codecgen
+
 package cmpp
 
 import (
@@ -18,7 +20,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"strings"
+	"io"
 )
 
 type Type int8
@@ -135,11 +137,52 @@ func (id CommandId) String() string {
 	return "unknown"
 }
 
+// IsRequest reports whether id is the Command_Id of a request.
+func (id CommandId) IsRequest() bool {
+	return id > CMPP_REQUEST_MIN && id < CMPP_REQUEST_MAX
+}
+
+// Response returns the Command_Id of the response to the request id.
+// It returns id itself if id is not a request.
+func (id CommandId) Response() CommandId {
+	if !id.IsRequest() {
+		return id
+	}
+	return id | CMPP_RESPONSE_MIN
+}
+
 type Packer interface {
 	Pack(seqId uint32) ([]byte, error)
 	Unpack(data []byte) error
 }
 
+// Pdu is implemented by all the packets of this package. It exposes
+// the header fields of a packet, so that the code handling any kind
+// of packets, such as logging, metrics or request and response
+// correlation, needs no type switch.
+type Pdu interface {
+	Packer
+
+	// CommandId returns the Command_Id of the packet.
+	CommandId() CommandId
+
+	// SequenceId returns the Sequence_Id of the packet, which is
+	// set by Pack and Unpack.
+	SequenceId() uint32
+
+	// ProtocolVersion returns the protocol version the packet
+	// belongs to, V21 for the cmpp2 packets and V30 for the cmpp3
+	// ones. It returns 0 for the packets shared by all the versions,
+	// except that the CmppConnReqPkt returns the version it asks for.
+	ProtocolVersion() Type
+
+	setSequenceId(seqId uint32)
+}
+
+// ErrNotRequest is returned by NewResponse if the packet
+// passed in is not a request.
+var ErrNotRequest = errors.New("packet is not a request")
+
 // OpError is the error type usually returned by functions in the cmpppacket
 // package. It describes the operation and the error which the operation caused.
 type OpError struct {
@@ -170,74 +213,100 @@ func (e *OpError) Cause() error {
 	return e.err
 }
 
+// Unwrap returns the origin error, so that errors.Is and errors.As
+// see through the OpError.
+func (e *OpError) Unwrap() error {
+	return e.err
+}
+
 func (e *OpError) Op() string {
 	return e.op
 }
 
+// AppendPacker is implemented by the packets which can be packed
+// into a caller-provided buffer. All the packets of this package
+// implement it. Conn.SendPkt uses it to pack the packets into pooled
+// buffers.
+type AppendPacker interface {
+	Packer
+
+	// AppendPack appends the packet to dst and returns the extended
+	// buffer. dst is returned unchanged if an error occurs.
+	AppendPack(dst []byte, seqId uint32) ([]byte, error)
+}
+
+// invalidField returns the error of Validate for the field of pkt.
+func invalidField(pkt, field string) error {
+	return NewOpError(ErrMethodParamsInvalid, pkt+".Validate checks "+field)
+}
+
+// packetWriter encodes the fields of a packet by appending them to
+// a byte slice directly, without reflection or intermediate buffers.
 type packetWriter struct {
-	wb  *bytes.Buffer
+	dst []byte // the buffer passed in, returned on error.
+	buf []byte
 	err *OpError
 }
 
-func newPacketWriter(initSize uint32) *packetWriter {
-	buf := make([]byte, 0, initSize)
+// newPacketWriter returns a packetWriter appending to dst, which is
+// grown to have room for size more bytes at least.
+func newPacketWriter(dst []byte, size uint32) *packetWriter {
+	buf := dst
+	if n := len(dst) + int(size); n > cap(dst) {
+		buf = make([]byte, len(dst), n)
+		copy(buf, dst)
+	}
 	return &packetWriter{
-		wb: bytes.NewBuffer(buf),
+		dst: dst,
+		buf: buf,
 	}
 }
 
-// Bytes returns a slice of the contents of the inner buffer;
-// If the caller changes the contents of the
-// returned slice, the contents of the buffer will change provided there
-// are no intervening method calls on the Buffer.
+// Bytes returns the buffer with the packet appended,
+// or the buffer passed to newPacketWriter and the error.
 func (w *packetWriter) Bytes() ([]byte, error) {
 	if w.err != nil {
-		return nil, w.err
+		return w.dst, w.err
 	}
-	len := w.wb.Len()
-	return (w.wb.Bytes())[:len], nil
+	return w.buf, nil
 }
 
-// WriteByte appends the byte of b to the inner buffer, growing the buffer as
-// needed.
-func (w *packetWriter) WriteByte(b byte) {
+// WriteUint8 appends b to the buffer.
+func (w *packetWriter) WriteUint8(b uint8) {
 	if w.err != nil {
 		return
 	}
+	w.buf = append(w.buf, b)
+}
 
-	err := w.wb.WriteByte(b)
-	if err != nil {
-		w.err = NewOpError(err,
-			fmt.Sprintf("packetWriter.WriteByte writes: %x", b))
+// WriteUint16 appends i to the buffer in big-endian.
+func (w *packetWriter) WriteUint16(i uint16) {
+	if w.err != nil {
 		return
 	}
+	w.buf = append(w.buf, byte(i>>8), byte(i))
 }
 
-// WriteFixedSizeString writes a string to buffer, if the length of s is less than size,
-// Pad binary zero to the right.
-func (w *packetWriter) WriteFixedSizeString(s string, size int) {
+// WriteUint32 appends i to the buffer in big-endian.
+func (w *packetWriter) WriteUint32(i uint32) {
 	if w.err != nil {
 		return
 	}
+	w.buf = append(w.buf, byte(i>>24), byte(i>>16), byte(i>>8), byte(i))
+}
 
-	l1 := len(s)
-	l2 := l1
-	if l2 > 10 {
-		l2 = 10
-	}
-
-	if l1 > size {
-		w.err = NewOpError(ErrMethodParamsInvalid,
-			fmt.Sprintf("packetWriter.WriteFixedSizeString writes: %s", s[0:l2]))
+// WriteUint64 appends i to the buffer in big-endian.
+func (w *packetWriter) WriteUint64(i uint64) {
+	if w.err != nil {
 		return
 	}
-
-	w.WriteString(strings.Join([]string{s, string(make([]byte, size-l1))}, ""))
+	w.buf = append(w.buf, byte(i>>56), byte(i>>48), byte(i>>40), byte(i>>32),
+		byte(i>>24), byte(i>>16), byte(i>>8), byte(i))
 }
 
-// WriteString appends the contents of s to the inner buffer, growing the buffer as
-// needed.
-func (w *packetWriter) WriteString(s string) {
+// WriteFixedSizeString writes a string to buffer, if the length of s is less than size,
+// Pad binary zero to the right.
+func (w *packetWriter) WriteFixedSizeString(s string, size int) {
 	if w.err != nil {
 		return
 	}
@@ -248,131 +317,149 @@ func (w *packetWriter) WriteString(s string) {
 		l2 = 10
 	}
 
-	n, err := w.wb.WriteString(s)
-	if err != nil {
-		w.err = NewOpError(err,
-			fmt.Sprintf("packetWriter.WriteString writes: %s", s[0:l2]))
+	if l1 > size {
+		w.err = NewOpError(ErrMethodParamsInvalid,
+			fmt.Sprintf("packetWriter.WriteFixedSizeString writes: %s", s[0:l2]))
 		return
 	}
 
-	if n != l1 {
-		w.err = NewOpError(fmt.Errorf("WriteString writes %d bytes, not equal to %d we expected", n, l1),
-			fmt.Sprintf("packetWriter.WriteString writes: %s", s[0:l2]))
-		return
+	w.buf = append(w.buf, s...)
+	for i := l1; i < size; i++ {
+		w.buf = append(w.buf, 0)
 	}
 }
 
-// WriteInt appends the content of data to the inner buffer in order, growing the buffer as
-// needed.
-func (w *packetWriter) WriteInt(order binary.ByteOrder, data interface{}) {
+// WriteString appends the contents of s to the buffer.
+func (w *packetWriter) WriteString(s string) {
 	if w.err != nil {
 		return
 	}
-
-	err := binary.Write(w.wb, order, data)
-	if err != nil {
-		w.err = NewOpError(err,
-			fmt.Sprintf("packetWriter.WriteInt writes: %#v", data))
-		return
-	}
+	w.buf = append(w.buf, s...)
 }
 
-const maxCStringSize = 160
-
+// packetReader decodes the fields of a packet from a byte slice by
+// slicing it directly, without reflection or intermediate buffers.
+//
+// All the string fields of a packet share the memory of a single copy
+// of the packet data, which is made when the first string field is
+// read. So unpacking a packet allocates at most once for its strings,
+// plus once for a slice of string fields, e.g. the DestTerminalId of a
+// submit request.
 type packetReader struct {
-	rb   *bytes.Buffer
+	data []byte
+	s    string // the copy of data, made by the first string field read.
+	off  int
 	err  *OpError
-	cbuf [maxCStringSize]byte
 }
 
 func newPacketReader(data []byte) *packetReader {
 	return &packetReader{
-		rb: bytes.NewBuffer(data),
+		data: data,
 	}
 }
 
-// ReadByte reads and returns the next byte from the inner buffer.
-// If no byte is available, it returns an OpError.
-func (r *packetReader) ReadByte() byte {
+// next returns the offset of the next n bytes and advances over them.
+// If less than n bytes are left, an OpError for op is stored in r.err
+// and ok is false.
+func (r *packetReader) next(n int, op string) (off int, ok bool) {
 	if r.err != nil {
-		return 0
+		return 0, false
 	}
 
-	b, err := r.rb.ReadByte()
-	if err != nil {
-		r.err = NewOpError(err,
-			"packetReader.ReadByte")
+	if left := len(r.data) - r.off; left < n {
+		err := io.ErrUnexpectedEOF
+		if left == 0 {
+			err = io.EOF
+		}
+		r.err = NewOpError(err, op)
+		r.off = len(r.data)
+		return 0, false
+	}
+	off = r.off
+	r.off += n
+	return off, true
+}
+
+// ReadUint8 reads and returns the next byte from the data.
+// If no byte is available, an OpError would be stored in r.err.
+func (r *packetReader) ReadUint8() uint8 {
+	off, ok := r.next(1, "packetReader.ReadUint8")
+	if !ok {
 		return 0
 	}
-	return b
+	return r.data[off]
 }
 
-// ReadInt reads reads structured binary data from r into data.
-// Data must be a pointer to a fixed-size value or a slice
-// of fixed-size values.
-// Bytes read from r are decoded using the specified byte order
-// and written to successive fields of the data.
-func (r *packetReader) ReadInt(order binary.ByteOrder, data interface{}) {
-	if r.err != nil {
-		return
+// ReadUint16 reads the next big-endian uint16 from the data.
+func (r *packetReader) ReadUint16() uint16 {
+	off, ok := r.next(2, "packetReader.ReadUint16")
+	if !ok {
+		return 0
 	}
+	return binary.BigEndian.Uint16(r.data[off:])
+}
 
-	err := binary.Read(r.rb, order, data)
-	if err != nil {
-		r.err = NewOpError(err,
-			"packetReader.ReadInt")
-		return
+// ReadUint32 reads the next big-endian uint32 from the data.
+func (r *packetReader) ReadUint32() uint32 {
+	off, ok := r.next(4, "packetReader.ReadUint32")
+	if !ok {
+		return 0
 	}
+	return binary.BigEndian.Uint32(r.data[off:])
 }
 
-// ReadBytes reads the next len(s) bytes from the inner buffer to s.
-// If the buffer has no data to return, an OpError would be stored in r.err.
-func (r *packetReader) ReadBytes(s []byte) {
-	if r.err != nil {
-		return
+// ReadUint64 reads the next big-endian uint64 from the data.
+func (r *packetReader) ReadUint64() uint64 {
+	off, ok := r.next(8, "packetReader.ReadUint64")
+	if !ok {
+		return 0
 	}
+	return binary.BigEndian.Uint64(r.data[off:])
+}
 
-	n, err := r.rb.Read(s)
-	if err != nil {
-		r.err = NewOpError(err,
-			"packetReader.ReadBytes")
+// ReadBytes reads the next len(s) bytes from the data to s.
+// If the data has not enough bytes, an OpError would be stored in r.err.
+func (r *packetReader) ReadBytes(s []byte) {
+	off, ok := r.next(len(s), "packetReader.ReadBytes")
+	if !ok {
 		return
 	}
+	copy(s, r.data[off:])
+}
 
-	if n != len(s) {
-		r.err = NewOpError(fmt.Errorf("ReadBytes reads %d bytes, not equal to %d we expected", n, len(s)),
-			"packetWriter.ReadBytes")
-		return
+// ReadString reads the next length bytes from the data as a string.
+func (r *packetReader) ReadString(length int) string {
+	off, ok := r.next(length, "packetReader.ReadString")
+	if !ok {
+		return ""
 	}
+	return r.str(off, off+length)
 }
 
-// ReadCString read bytes from packerReader's inner buffer,
+// ReadCString reads the next length bytes from the data as a string,
 // it would trim the tail-zero byte and the bytes after that.
-func (r *packetReader) ReadCString(length int) []byte {
-	if r.err != nil {
-		return nil
+func (r *packetReader) ReadCString(length int) string {
+	off, ok := r.next(length, "packetReader.ReadCString")
+	if !ok {
+		return ""
 	}
 
-	var tmp = r.cbuf[:length]
-	n, err := r.rb.Read(tmp)
-	if err != nil {
-		r.err = NewOpError(err,
-			"packetReader.ReadCString")
-		return nil
+	end := off + length
+	if i := bytes.IndexByte(r.data[off:end], 0); i != -1 {
+		end = off + i
 	}
+	return r.str(off, end)
+}
 
-	if n != length {
-		r.err = NewOpError(fmt.Errorf("ReadCString reads %d bytes, not equal to %d we expected", n, length),
-			"packetWriter.ReadCString")
-		return nil
+// str returns data[i:j] as a string sharing the copy of the data.
+func (r *packetReader) str(i, j int) string {
+	if i == j {
+		return ""
 	}
-
-	i := bytes.IndexByte(tmp, 0)
-	if i == -1 {
-		return tmp
-	} else {
-		return tmp[:i]
+	if r.s == "" {
+		r.s = string(r.data)
 	}
+	return r.s[i:j]
 }
 
 // Error return the inner err.
@@ -14,7 +14,7 @@
 package cmpp
 
 import (
-	"encoding/binary"
+	"bytes"
 	"errors"
 	"io"
 	"testing"
@@ -135,7 +135,7 @@ func TestOpError(t *testing.T) {
 
 func TestPacketWriter(t *testing.T) {
 	//test WriteString
-	w1 := newPacketWriter(11)
+	w1 := newPacketWriter(nil, 11)
 
 	w1.WriteString("hello")
 	w1.WriteString(" golang")
@@ -151,8 +151,8 @@ func TestPacketWriter(t *testing.T) {
 
 	// test WriteInt
 	var i uint16 = 0x1234
-	w2 := newPacketWriter(10)
-	w2.WriteInt(binary.BigEndian, i)
+	w2 := newPacketWriter(nil, 10)
+	w2.WriteUint16(i)
 
 	s2, e := w2.Bytes()
 	if e != nil {
@@ -164,7 +164,7 @@ func TestPacketWriter(t *testing.T) {
 	}
 
 	// test WriteFixedSizeString
-	w3 := newPacketWriter(10)
+	w3 := newPacketWriter(nil, 10)
 	w3.WriteFixedSizeString("hello", 9)
 	s3, e := w3.Bytes()
 	if e != nil {
@@ -180,9 +180,9 @@ func TestPacketWriter(t *testing.T) {
 	}
 
 	// test WriteByte
-	w4 := newPacketWriter(10)
-	w4.WriteByte('h')
-	w4.WriteByte('e')
+	w4 := newPacketWriter(nil, 10)
+	w4.WriteUint8('h')
+	w4.WriteUint8('e')
 	s4, e := w4.Bytes()
 	if e != nil {
 		t.Fatalf("packetWriter's err : actual [%#v], wanted[nil]\n", e)
@@ -197,6 +197,46 @@ func TestPacketWriter(t *testing.T) {
 	}
 }
 
+func TestAppendPack(t *testing.T) {
+	p := &Cmpp3SubmitReqPkt{
+		MsgSrc:         "900001",
+		SrcId:          "900001",
+		DestUsrTl:      1,
+		DestTerminalId: []string{"13500002696"},
+		MsgLength:      5,
+		MsgContent:     "hello",
+	}
+	data, err := p.Pack(1)
+	if err != nil {
+		t.Fatal("pack error:", err)
+	}
+
+	prefix := []byte("prefix")
+	dst, err := p.AppendPack(prefix, 1)
+	if err != nil {
+		t.Fatal("append pack error:", err)
+	}
+	if string(dst[:len(prefix)]) != "prefix" || !bytes.Equal(dst[len(prefix):], data) {
+		t.Fatalf("append pack: actual [%x], wanted prefix + [%x]\n", dst, data)
+	}
+
+	// no allocation if dst has room for the packet.
+	buf := make([]byte, 0, 512)
+	n := testing.AllocsPerRun(100, func() {
+		p.AppendPack(buf, 1)
+	})
+	if n != 0 {
+		t.Fatalf("allocs of append pack: actual [%v], wanted [0]\n", n)
+	}
+
+	// dst is returned unchanged on error.
+	p.MsgSrc = "too long msg src"
+	dst, err = p.AppendPack(prefix, 1)
+	if err == nil || string(dst) != "prefix" {
+		t.Fatalf("append pack with an invalid field: actual [%q, %v], wanted [prefix, non-nil]\n", dst, err)
+	}
+}
+
 func TestPacketReader(t *testing.T) {
 	// test ReadBytes
 	s1 := []byte{'h', 'e', 'l', 'l', 'o'}
@@ -222,7 +262,7 @@ func TestPacketReader(t *testing.T) {
 	s2 := []byte{0x12, 0x34}
 	var i uint16
 	r2 := newPacketReader(s2)
-	r2.ReadInt(binary.BigEndian, &i)
+	i = r2.ReadUint16()
 	if r2.Error() != nil {
 		t.Fatalf("packetReader's err : actual [%#v], wanted[nil]\n", r1.Error())
 	}
@@ -233,22 +273,22 @@ func TestPacketReader(t *testing.T) {
 	// test ReadByte
 	s3 := []byte{'h', 'e', 'l', 'l', 'o'}
 	r3 := newPacketReader(s3)
-	c := r3.ReadByte()
+	c := r3.ReadUint8()
 	if c != 'h' {
 		t.Fatalf("packetReader's err : actual [%c], wanted[%c]\n", c, 'h')
 	}
-	r3.ReadByte()
-	r3.ReadByte()
-	c = r3.ReadByte()
+	r3.ReadUint8()
+	r3.ReadUint8()
+	c = r3.ReadUint8()
 	if c != 'l' {
 		t.Fatalf("packetReader's err : actual [%c], wanted[%c]\n", c, 'l')
 	}
-	c = r3.ReadByte()
+	c = r3.ReadUint8()
 	if c != 'o' {
 		t.Fatalf("packetReader's err : actual [%c], wanted[%c]\n", c, 'o')
 	}
 
-	c = r3.ReadByte()
+	c = r3.ReadUint8()
 	if c != 0 {
 		t.Fatalf("packetReader's err : actual [%x], wanted[%d]\n", c, 0)
 	}
@@ -274,4 +314,77 @@ func TestPacketReader(t *testing.T) {
 	if string(d4) != "hello" {
 		t.Fatalf("packetReader's err : actual [%s], wanted [%s]\n", string(d4), "hello")
 	}
+
+	// test ReadUint32, ReadUint64 and ReadString
+	s5 := []byte{0x12, 0x34, 0x56, 0x78, 0, 0, 0, 0, 0, 0, 0x01, 0x02, 'a', 'b', 0, 'c', 0xff}
+	r5 := newPacketReader(s5)
+	if u := r5.ReadUint32(); u != 0x12345678 {
+		t.Fatalf("packetReader's err : actual [%x], wanted [%x]\n", u, 0x12345678)
+	}
+	if u := r5.ReadUint64(); u != 0x0102 {
+		t.Fatalf("packetReader's err : actual [%x], wanted [%x]\n", u, 0x0102)
+	}
+	if d := r5.ReadString(4); d != "ab\x00c" {
+		t.Fatalf("packetReader's err : actual [%q], wanted [%q]\n", d, "ab\x00c")
+	}
+
+	// a partial field is an unexpected EOF.
+	r5.ReadUint16()
+	oe, _ = r5.Error().(*OpError)
+	if oe == nil || oe.Cause() != io.ErrUnexpectedEOF {
+		t.Fatalf("packetReader's err : actual [%#v], wanted io.ErrUnexpectedEOF\n", r5.Error())
+	}
+}
+
+func TestPacketReaderAllocs(t *testing.T) {
+	rsp, _ := (&Cmpp3SubmitRspPkt{MsgId: 12878564852733378560}).Pack(1)
+	n := testing.AllocsPerRun(100, func() {
+		var p Cmpp3SubmitRspPkt
+		p.Unpack(rsp[8:])
+	})
+	if n != 0 {
+		t.Fatalf("allocs of unpacking a submit response: actual [%v], wanted [0]\n", n)
+	}
+
+	// all the strings share one copy of the packet data, and
+	// DestTerminalId is allocated once.
+	req, _ := (&Cmpp3SubmitReqPkt{
+		ServiceId:      "test",
+		MsgSrc:         "900001",
+		SrcId:          "900001",
+		DestUsrTl:      2,
+		DestTerminalId: []string{"13500002696", "13500002697"},
+		MsgLength:      5,
+		MsgContent:     "hello",
+	}).Pack(1)
+	p := &Cmpp3SubmitReqPkt{}
+	n = testing.AllocsPerRun(100, func() {
+		p.Unpack(req[8:])
+	})
+	if n > 2 {
+		t.Fatalf("allocs of unpacking a submit request: actual [%v], wanted <= [2]\n", n)
+	}
+}
+
+func TestCommandIdResponse(t *testing.T) {
+	var tests = []struct {
+		id   CommandId
+		req  bool
+		want CommandId
+	}{
+		{CMPP_CONNECT, true, CMPP_CONNECT_RESP},
+		{CMPP_FWD, true, CMPP_FWD_RESP},
+		{CMPP_GET_MO_ROUTE, true, CMPP_GET_MO_ROUTE_RESP},
+		{CMPP_SUBMIT_RESP, false, CMPP_SUBMIT_RESP},
+		{CMPP_REQUEST_MIN, false, CMPP_REQUEST_MIN},
+	}
+
+	for _, tt := range tests {
+		if tt.id.IsRequest() != tt.req {
+			t.Errorf("%v.IsRequest() is %v", tt.id, !tt.req)
+		}
+		if rsp := tt.id.Response(); rsp != tt.want {
+			t.Errorf("%v.Response() is %v, not %v", tt.id, rsp, tt.want)
+		}
+	}
 }
@@ -0,0 +1,58 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp
+
+// Packet length const for cmpp query request and response packets.
+// They are the same in cmpp2 and cmpp3.
+const (
+	CmppQueryReqPktLen uint32 = 12 + 27 //39d, 0x27
+	CmppQueryRspPktLen uint32 = 12 + 51 //63d, 0x3f
+)
+
+// Query types in query request.
+const (
+	QueryTypeTotal   uint8 = 0 // query the total statistics.
+	QueryTypeService uint8 = 1 // query the statistics of the service in QueryCode.
+)
+
+// CmppQueryReqPkt queries the statistics of the messages of a day.
+//
+//cmpp:packet CMPP_QUERY
+type CmppQueryReqPkt struct {
+	Time      string `cmpp:"cstring=8"` // YYYYMMDD
+	QueryType uint8
+	QueryCode string `cmpp:"cstring=10"`
+	Reserve   string `cmpp:"cstring=8"`
+
+	// session info
+	SeqId uint32 `cmpp:"seqid"`
+}
+
+//cmpp:packet CMPP_QUERY_RESP
+type CmppQueryRspPkt struct {
+	Time      string `cmpp:"cstring=8"` // YYYYMMDD
+	QueryType uint8
+	QueryCode string `cmpp:"cstring=10"`
+	MtTlMsg   uint32 // total MT messages received from the SP.
+	MtTlUsr   uint32 // total users of the MT messages.
+	MtScs     uint32 // MT messages delivered successfully.
+	MtWt      uint32 // MT messages waiting to be delivered.
+	MtFl      uint32 // MT messages failed to be delivered.
+	MoScs     uint32 // MO messages delivered to the SP successfully.
+	MoWt      uint32 // MO messages waiting to be delivered to the SP.
+	MoFl      uint32 // MO messages failed to be delivered to the SP.
+
+	// session info
+	SeqId uint32 `cmpp:"seqid"`
+}
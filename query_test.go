@@ -0,0 +1,126 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+var queryReqData = []byte{
+	0x00, 0x00, 0x00, 0x27, 0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0x17,
+	0x32, 0x30, 0x31, 0x35, 0x31, 0x31, 0x31, 0x32, 0x01, 0x74, 0x65, 0x73,
+	0x74, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00,
+}
+
+var queryRspData = []byte{
+	0x00, 0x00, 0x00, 0x3f, 0x80, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0x17,
+	0x32, 0x30, 0x31, 0x35, 0x31, 0x31, 0x31, 0x32, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x64, 0x00,
+	0x00, 0x00, 0x32, 0x00, 0x00, 0x00, 0x5a, 0x00, 0x00, 0x00, 0x04, 0x00,
+	0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x01,
+}
+
+func TestCmppQueryReqPktPack(t *testing.T) {
+	p := &cmpp.CmppQueryReqPkt{
+		Time:      "20151112",
+		QueryType: cmpp.QueryTypeService,
+		QueryCode: "test",
+	}
+
+	data, err := p.Pack(seqId)
+	if err != nil {
+		t.Fatal("CmppQueryReqPkt pack error:", err)
+	}
+	if p.SeqId != seqId {
+		t.Fatalf("After pack, seqId is %d, not equal to expected: %d\n", p.SeqId, seqId)
+	}
+	if !bytes.Equal(data, queryReqData) {
+		t.Fatalf("After pack, data is %x, not equal to dataExpected: %x\n", data, queryReqData)
+	}
+}
+
+func TestCmppQueryReqPktUnpack(t *testing.T) {
+	p := &cmpp.CmppQueryReqPkt{}
+	if err := p.Unpack(queryReqData[8:]); err != nil {
+		t.Fatal("CmppQueryReqPkt unpack error:", err)
+	}
+
+	wanted := cmpp.CmppQueryReqPkt{
+		Time:      "20151112",
+		QueryType: cmpp.QueryTypeService,
+		QueryCode: "test",
+		SeqId:     seqId,
+	}
+	if *p != wanted {
+		t.Fatalf("After unpack, packet is %#v, not equal to the expected value: %#v\n", *p, wanted)
+	}
+}
+
+func TestCmppQueryRspPktPack(t *testing.T) {
+	p := &cmpp.CmppQueryRspPkt{
+		Time:    "20151112",
+		MtTlMsg: 100,
+		MtTlUsr: 50,
+		MtScs:   90,
+		MtWt:    4,
+		MtFl:    6,
+		MoScs:   10,
+		MoFl:    1,
+	}
+
+	data, err := p.Pack(seqId)
+	if err != nil {
+		t.Fatal("CmppQueryRspPkt pack error:", err)
+	}
+	if !bytes.Equal(data, queryRspData) {
+		t.Fatalf("After pack, data is %x, not equal to dataExpected: %x\n", data, queryRspData)
+	}
+}
+
+func TestCmppQueryRspPktUnpack(t *testing.T) {
+	p := &cmpp.CmppQueryRspPkt{}
+	if err := p.Unpack(queryRspData[8:]); err != nil {
+		t.Fatal("CmppQueryRspPkt unpack error:", err)
+	}
+
+	wanted := cmpp.CmppQueryRspPkt{
+		Time:    "20151112",
+		MtTlMsg: 100,
+		MtTlUsr: 50,
+		MtScs:   90,
+		MtWt:    4,
+		MtFl:    6,
+		MoScs:   10,
+		MoFl:    1,
+		SeqId:   seqId,
+	}
+	if *p != wanted {
+		t.Fatalf("After unpack, packet is %#v, not equal to the expected value: %#v\n", *p, wanted)
+	}
+}
+
+func BenchmarkCmppQueryRspPktUnpack(b *testing.B) {
+	p := &cmpp.CmppQueryRspPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(queryRspData[8:])
+	}
+}
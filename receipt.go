@@ -13,8 +13,6 @@
 
 package cmpp
 
-import "encoding/binary"
-
 // Packet length const for cmpp receipt packet.
 const (
 	CmppReceiptPktLen uint32 = 60 //60d, 0x3c
@@ -25,22 +23,28 @@ type CmppReceiptPkt struct {
 	Stat           string
 	SubmitTime     string // YYMMDDHHMM
 	DoneTime       string // YYMMDDHHMM
-	DestTerminalId string
+	DestTerminalId string `cmpp:"phone"`
 	SmscSequence   uint32
 }
 
 // Pack packs the CmppReceiptPkt to bytes stream for client side.
 func (p *CmppReceiptPkt) Pack() ([]byte, error) {
+	return p.AppendPack(nil)
+}
+
+// AppendPack is like Pack, but appends the receipt to dst and
+// returns the extended buffer.
+func (p *CmppReceiptPkt) AppendPack(dst []byte) ([]byte, error) {
 	var pktLen uint32 = CmppReceiptPktLen
 
-	var w = newPacketWriter(pktLen)
+	var w = newPacketWriter(dst, pktLen)
 
-	w.WriteInt(binary.BigEndian, p.MsgId)
+	w.WriteUint64(p.MsgId)
 	w.WriteFixedSizeString(p.Stat, 7)
 	w.WriteFixedSizeString(p.SubmitTime, 10)
 	w.WriteFixedSizeString(p.DoneTime, 10)
 	w.WriteFixedSizeString(p.DestTerminalId, 21)
-	w.WriteInt(binary.BigEndian, p.SmscSequence)
+	w.WriteUint32(p.SmscSequence)
 
 	return w.Bytes()
 }
@@ -51,20 +55,31 @@ func (p *CmppReceiptPkt) Pack() ([]byte, error) {
 func (p *CmppReceiptPkt) Unpack(data []byte) error {
 	var r = newPacketReader(data)
 
-	r.ReadInt(binary.BigEndian, &p.MsgId)
+	p.MsgId = r.ReadUint64()
 
-	stat := r.ReadCString(7)
-	p.Stat = string(stat)
+	p.Stat = r.ReadCString(7)
 
-	submitTime := r.ReadCString(10)
-	p.SubmitTime = string(submitTime)
+	p.SubmitTime = r.ReadCString(10)
 
-	doneTime := r.ReadCString(10)
-	p.DoneTime = string(doneTime)
+	p.DoneTime = r.ReadCString(10)
 
-	destTerminalId := r.ReadCString(21)
-	p.DestTerminalId = string(destTerminalId)
+	p.DestTerminalId = r.ReadCString(21)
 
-	r.ReadInt(binary.BigEndian, &p.SmscSequence)
+	p.SmscSequence = r.ReadUint32()
 	return r.Error()
 }
+
+// String returns the fields of the CmppReceiptPkt in a readable form.
+func (p *CmppReceiptPkt) String() string {
+	return formatPacket(p)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *CmppReceiptPkt) MarshalJSON() ([]byte, error) {
+	return marshalPacket(p)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (p *CmppReceiptPkt) UnmarshalJSON(data []byte) error {
+	return unmarshalPacket(p, data)
+}
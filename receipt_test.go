@@ -87,3 +87,21 @@ func TestCmppReceiptPktUnpack(t *testing.T) {
 		}
 	}
 }
+
+func BenchmarkCmppReceiptPktUnpack(b *testing.B) {
+	data, _ := (&cmpp.CmppReceiptPkt{
+		MsgId:          13025908756704198656,
+		Stat:           "DELIVRD",
+		SubmitTime:     "1511120955",
+		DoneTime:       "1511120957",
+		DestTerminalId: "13412340000",
+		SmscSequence:   0x12345678,
+	}).Pack()
+	p := &cmpp.CmppReceiptPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(data)
+	}
+}
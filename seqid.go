@@ -0,0 +1,152 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// SequenceGenerator generates the Sequence_Id of the request packets.
+// A generator may be shared by several connections, e.g. by the
+// connections a client makes when it reconnects, so that a late
+// response to the old connection never collides with a new request.
+// Implementations must be safe for concurrent use.
+type SequenceGenerator interface {
+	NextSeqId() uint32
+}
+
+// counterSeqGenerator is the default lock-free SequenceGenerator.
+type counterSeqGenerator struct {
+	next uint32
+}
+
+// NewSequenceGenerator returns a lock-free SequenceGenerator whose
+// first Sequence_Id is start. The ids wrap around to 0 after 0xffffffff.
+func NewSequenceGenerator(start uint32) SequenceGenerator {
+	return &counterSeqGenerator{next: start}
+}
+
+func (g *counterSeqGenerator) NextSeqId() uint32 {
+	return atomic.AddUint32(&g.next, 1) - 1
+}
+
+// DefaultSeqIdReserveStep is the number of Sequence_Ids a
+// FileSequenceGenerator reserves each time it writes its file.
+const DefaultSeqIdReserveStep = 1000
+
+// FileSequenceGenerator is a SequenceGenerator persisting its state
+// in a file, so that the Sequence_Ids keep increasing across process
+// restarts. It reserves ids in blocks of step, and writes the end of
+// the reserved block to the file before handing out any id of it.
+// After a restart, it starts from the end of the last reserved block,
+// so that some ids may be skipped but none is reused.
+type FileSequenceGenerator struct {
+	mu       sync.Mutex
+	path     string
+	step     uint32
+	skipZero bool
+	next     uint32 // the next id to hand out
+	limit    uint32 // the end of the reserved block
+	err      error
+}
+
+// NewFileSequenceGenerator returns a FileSequenceGenerator persisting
+// its state in the file of path, which is created if it does not exist.
+// If step is 0, DefaultSeqIdReserveStep is used. If skipZero is true,
+// 0 is never handed out, even when the ids wrap around.
+func NewFileSequenceGenerator(path string, step uint32, skipZero bool) (*FileSequenceGenerator, error) {
+	if step == 0 {
+		step = DefaultSeqIdReserveStep
+	}
+
+	g := &FileSequenceGenerator{
+		path:     path,
+		step:     step,
+		skipZero: skipZero,
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		n, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32)
+		if err != nil {
+			return nil, NewOpError(err, "NewFileSequenceGenerator parses "+path)
+		}
+		g.next = uint32(n)
+	}
+
+	g.limit = g.next
+	if err := g.reserve(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// NextSeqId returns the next Sequence_Id. If the file can not be
+// written, it keeps handing out ids from memory, and Err reports
+// the error.
+func (g *FileSequenceGenerator) NextSeqId() uint32 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for {
+		if g.next == g.limit {
+			g.err = g.reserve()
+		}
+		id := g.next
+		g.next++
+		if id != 0 || !g.skipZero {
+			return id
+		}
+	}
+}
+
+// Err returns the last error of writing the file, or nil.
+func (g *FileSequenceGenerator) Err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// reserve reserves the next block of ids. The block is reserved in
+// memory even if it fails to be written to the file.
+func (g *FileSequenceGenerator) reserve() error {
+	g.limit += g.step // wraps around as the ids do.
+
+	tmp, err := ioutil.TempFile(filepath.Dir(g.path), filepath.Base(g.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(strconv.FormatUint(uint64(g.limit), 10) + "\n")
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err1 := tmp.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), g.path)
+}
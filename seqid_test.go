@@ -0,0 +1,123 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+func TestSequenceGenerator(t *testing.T) {
+	g := cmpp.NewSequenceGenerator(0xfffffffe)
+	for _, wanted := range []uint32{0xfffffffe, 0xffffffff, 0, 1} {
+		if id := g.NextSeqId(); id != wanted {
+			t.Fatalf("seqId: actual [%d], wanted [%d]\n", id, wanted)
+		}
+	}
+}
+
+func TestSequenceGeneratorConcurrent(t *testing.T) {
+	g := cmpp.NewSequenceGenerator(0)
+
+	const goroutines, ids = 8, 1000
+	var mu sync.Mutex
+	seen := make(map[uint32]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < ids; j++ {
+				id := g.NextSeqId()
+				mu.Lock()
+				if seen[id] {
+					t.Errorf("seqId %d is handed out twice\n", id)
+				}
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != goroutines*ids {
+		t.Fatalf("unique seqIds: actual [%d], wanted [%d]\n", len(seen), goroutines*ids)
+	}
+}
+
+func TestFileSequenceGenerator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmpp-seqid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "seqid")
+
+	g, err := cmpp.NewFileSequenceGenerator(path, 10, false)
+	if err != nil {
+		t.Fatal("new generator error:", err)
+	}
+	var last uint32
+	for i := 0; i < 15; i++ {
+		last = g.NextSeqId()
+	}
+	if last != 14 {
+		t.Fatalf("seqId: actual [%d], wanted [%d]\n", last, 14)
+	}
+	if err := g.Err(); err != nil {
+		t.Fatal("generator error:", err)
+	}
+
+	// a restarted process goes on after the last reserved block.
+	g, err = cmpp.NewFileSequenceGenerator(path, 10, false)
+	if err != nil {
+		t.Fatal("reopen generator error:", err)
+	}
+	if id := g.NextSeqId(); id <= last {
+		t.Fatalf("seqId after restart: actual [%d], wanted > [%d]\n", id, last)
+	}
+}
+
+func TestFileSequenceGeneratorSkipZero(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmpp-seqid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "seqid")
+
+	if err := ioutil.WriteFile(path, []byte("4294967294\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := cmpp.NewFileSequenceGenerator(path, 0, true)
+	if err != nil {
+		t.Fatal("new generator error:", err)
+	}
+	for _, wanted := range []uint32{0xfffffffe, 0xffffffff, 1, 2} {
+		if id := g.NextSeqId(); id != wanted {
+			t.Fatalf("seqId: actual [%d], wanted [%d]\n", id, wanted)
+		}
+	}
+
+	if err := ioutil.WriteFile(path, []byte("bad"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cmpp.NewFileSequenceGenerator(path, 0, true); err == nil {
+		t.Fatal("new generator with a corrupted file: wanted an error")
+	}
+}
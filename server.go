@@ -14,12 +14,17 @@
 package cmpp
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -29,21 +34,119 @@ var (
 	ErrEmptyServerAddr = errors.New("cmpp server listen: empty server addr")
 	ErrNoHandlers      = errors.New("cmpp server: no connection handler")
 	ErrUnsupportedPkt  = errors.New("cmpp server read packet: receive a unsupported pkt")
+
+	ErrNoClientCert        = errors.New("cmpp server: no client certificate")
+	ErrCertAccountMismatch = errors.New("cmpp server: login account does not match the client certificate")
+
+	ErrTooManyConns    = errors.New("cmpp server: too many connections")
+	ErrTooManySessions = errors.New("cmpp server: too many sessions of the account")
+	ErrAccountChanged  = errors.New("cmpp server: login with another account on an authenticated connection")
+
+	ErrResponseNotDeferred = errors.New("cmpp server: response is not deferred")
+	ErrResponseFinished    = errors.New("cmpp server: response has been finished or timed out")
+	ErrLoginTimedOut       = errors.New("cmpp server: deferred connect response timed out")
+)
+
+// Default timeouts of the server.
+const (
+	DefaultReadTimeout     = 2 * time.Second
+	DefaultKeepAlivePeriod = 1 * time.Minute
+)
+
+// DefaultDeferTimeout is used for a deferred response when neither
+// Response.Defer nor Server.DeferTimeout specifies a timeout.
+const DefaultDeferTimeout = 30 * time.Second
+
+// States of a deferred response.
+const (
+	deferPending int32 = iota
+	deferFinished
+	deferExpired
 )
 
 type Packet struct {
 	Packer
 	*Conn
+
+	ctx     context.Context
+	session *Session
+
+	recvTime time.Time // when the packet is received.
+	labels   Labels    // the metrics labels when the packet is received.
+}
+
+// Context returns the context of the connection the packet
+// arrived on. It is canceled when the connection is closed.
+func (p *Packet) Context() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+// Session returns the session of the connection the packet
+// arrived on.
+func (p *Packet) Session() *Session {
+	return p.session
 }
 
 type Response struct {
 	*Packet
 	Packer
 	SeqId uint32
+
+	// for deferred response
+	deferred bool
+	timeout  time.Duration
+	done     chan struct{}
+	state    int32
+	expired  bool // sent in place of a deferred response timed out.
 }
 
+// Defer tells the server not to send r back when the handler returns.
+// The handler takes over the ownership of r and should fill r.Packer
+// and call r.Finish later, usually from another goroutine.
+//
+// If r is not finished within timeout (Server.DeferTimeout if timeout
+// is 0), the server sends back a new response packet instead, with
+// its Result(or Status) set to Server.DeferResult. A connect response
+// timed out is the exception: it is sent back with the Status
+// ErrnoConnOthers, whatever Server.DeferResult is, and the connection
+// is closed, so that a login never succeeds by timing out.
+//
+// The packets following r on the connection are handled meanwhile,
+// even if Server.Window <= 1, except that a connect or terminate
+// request waits for r to be sent back first.
+//
+// Defer must be called by the handler before it returns.
+func (r *Response) Defer(timeout time.Duration) {
+	if r.deferred {
+		return
+	}
+	r.deferred = true
+	r.timeout = timeout
+	r.done = make(chan struct{})
+}
+
+// Finish tells the server to send the deferred response r back.
+// It returns ErrResponseFinished if r has been finished or has
+// timed out, and r.Packer will not be sent in that case.
+func (r *Response) Finish() error {
+	if !r.deferred {
+		return ErrResponseNotDeferred
+	}
+	if !atomic.CompareAndSwapInt32(&r.state, deferPending, deferFinished) {
+		return ErrResponseFinished
+	}
+	close(r.done)
+	return nil
+}
+
+// A Handler handles the packets received by the server. The Logger
+// passed in logs with the remote address and, once logged in, the
+// account of the connection.
 type Handler interface {
-	ServeCmpp(*Response, *Packet, *log.Logger) (bool, error)
+	ServeCmpp(*Response, *Packet, Logger) (bool, error)
 }
 
 // The HandlerFunc type is an adapter to allow the use of
@@ -57,13 +160,55 @@ type Handler interface {
 // The second return value shows the error returned from the handler. And
 // if it is non-nil, server will close the client connection
 // after sending back the corresponding response.
-type HandlerFunc func(*Response, *Packet, *log.Logger) (bool, error)
+type HandlerFunc func(*Response, *Packet, Logger) (bool, error)
 
-// ServeCmpp calls f(r, p).
-func (f HandlerFunc) ServeCmpp(r *Response, p *Packet, l *log.Logger) (bool, error) {
+// ServeCmpp calls f(r, p, l).
+func (f HandlerFunc) ServeCmpp(r *Response, p *Packet, l Logger) (bool, error) {
 	return f(r, p, l)
 }
 
+// A ConnState represents the state of a server side connection.
+// It's used by the optional Server.ConnState hook.
+type ConnState int
+
+const (
+	// StateNew represents a new connection just accepted.
+	StateNew ConnState = iota
+
+	// StateAuthenticated represents a connection whose peer has
+	// just logged in successfully.
+	StateAuthenticated
+
+	// StateIdle represents a connection on which no packet has
+	// arrived within the read timeout. It is reported once per
+	// idle period.
+	StateIdle
+
+	// StateActiveTestFailed represents a connection on which the
+	// peer has not answered N active tests in a row. The connection
+	// will be closed soon.
+	StateActiveTestFailed
+
+	// StateClosed represents a closed connection.
+	// This is a terminal state.
+	StateClosed
+)
+
+var connStateName = map[ConnState]string{
+	StateNew:              "new",
+	StateAuthenticated:    "authenticated",
+	StateIdle:             "idle",
+	StateActiveTestFailed: "active-test-failed",
+	StateClosed:           "closed",
+}
+
+func (c ConnState) String() string {
+	if s, ok := connStateName[c]; ok {
+		return s
+	}
+	return "unknown"
+}
+
 type Server struct {
 	Addr    string
 	Handler Handler
@@ -73,11 +218,121 @@ type Server struct {
 	T   time.Duration // interval betwwen two active tests
 	N   int32         // continuous send times when no response back
 
-	// ErrorLog specifies an optional logger for errors accepting
-	// connections and unexpected behavior from handlers.
-	// If nil, logging goes to os.Stderr via the log package's
-	// standard logger.
+	// TLSConfig optionally provides a TLS configuration for use
+	// by ServeTLS and ListenAndServeTLS.
+	TLSConfig *tls.Config
+
+	// CertAccount optionally maps the client certificate of a TLS
+	// connection to a cmpp account. If set, a login is refused with
+	// status ErrnoConnAuthFailed unless its SourceAddr equals the
+	// account of the client certificate.
+	CertAccount func(*x509.Certificate) (string, error)
+
+	// ReadTimeout is the max duration for reading a packet. The
+	// connection keeps waiting for the next packet after a timeout
+	// unless IdleTimeout is exceeded.
+	// If zero, DefaultReadTimeout is used.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the max duration for writing a packet.
+	// Zero means no timeout.
+	WriteTimeout time.Duration
+
+	// WriteBufferSize enables a buffered writer of the size on each
+	// connection, which coalesces the small response packets into
+	// fewer writes under load. Zero means every packet is written
+	// to the connection at once. See Conn.EnableWriteBuffer.
+	WriteBufferSize int
+
+	// MaxWriteDelay is the max duration a packet may stay in the
+	// write buffer. If zero, DefaultMaxWriteDelay is used.
+	MaxWriteDelay time.Duration
+
+	// IdleTimeout is the max duration a connection may stay
+	// without receiving any packet before it is closed.
+	// Zero means no timeout.
+	IdleTimeout time.Duration
+
+	// KeepAlivePeriod is the tcp keep-alive period set on the
+	// connections accepted by ListenAndServe.
+	// If zero, DefaultKeepAlivePeriod is used.
+	KeepAlivePeriod time.Duration
+
+	// MaxConns is the max number of connections served at the
+	// same time. Zero means no limit.
+	MaxConns int
+
+	// MaxConnsPerIP is the max number of connections served at
+	// the same time from one ip address. Zero means no limit.
+	MaxConnsPerIP int
+
+	// MaxSessionsPerAccount is the max number of logged in
+	// connections of one account. A login exceeding the limit is
+	// refused with status ErrnoConnOthers. Zero means no limit.
+	MaxSessionsPerAccount int
+
+	// Window is the max number of requests that may be handled
+	// concurrently on one connection (the cmpp sliding window).
+	// Responses are sent as soon as their handlers finish and
+	// stay correlated with the requests by SeqId. If Window <= 1,
+	// a request is handled and answered before the next packet
+	// is read.
+	Window int
+
+	// MaxInFlight is the max number of requests that may be handled
+	// concurrently across all connections of the server.
+	// Zero means no server-wide limit.
+	MaxInFlight int
+
+	// OrderedReplies makes a connection send its responses in the
+	// order the requests arrived, even if their handlers finish
+	// out of order. It only matters when Window > 1.
+	OrderedReplies bool
+
+	// DeferTimeout is the default timeout of the deferred responses.
+	// If zero, DefaultDeferTimeout is used.
+	DeferTimeout time.Duration
+
+	// DeferResult is the Result(or Status for connect response)
+	// sent back when a deferred response times out. Note that
+	// zero means success in cmpp.
+	DeferResult uint32
+
+	// ConnState specifies an optional callback function that is
+	// called when a connection changes state. The session carries
+	// the remote address and, once logged in, the account of the
+	// connection. It is called synchronously, and should return
+	// quickly.
+	ConnState func(*Session, ConnState)
+
+	// Logger specifies an optional logger for the server and the
+	// handlers. The packets sent and received are logged at the
+	// debug level. If nil, ErrorLog is used at the info level.
+	Logger Logger
+
+	// SendInterceptors and RecvInterceptors are added to every
+	// connection accepted, see Conn.InterceptSend and InterceptRecv.
+	SendInterceptors []Interceptor
+	RecvInterceptors []Interceptor
+
+	// Metrics optionally receives the metrics of the connections,
+	// see the metrics subpackage for an implementation.
+	Metrics Metrics
+
+	// ErrorLog specifies an optional logger used if Logger is nil.
+	// If both are nil, logging goes to os.Stderr via the log
+	// package's standard logger.
+	//
+	// Deprecated: use Logger instead.
 	ErrorLog *log.Logger
+
+	inFlightOnce sync.Once
+	inFlight     chan struct{} // server-wide in-flight semaphore
+
+	mu       sync.Mutex // guards the counters below
+	nConns   int
+	ipConns  map[string]int
+	sessions map[string]int
 }
 
 // A conn represents the server side of a Cmpp connection.
@@ -85,12 +340,36 @@ type conn struct {
 	*Conn
 	server *Server // the Server on which the connection arrived
 
+	ctx     context.Context
+	cancel  context.CancelFunc
+	session *Session
+	account string // the account counted in server's sessions
+
 	// for active test
 	t       time.Duration // interval betwwen two active tests
 	n       int32         // continuous send times when no response back
 	done    chan struct{}
 	exceed  chan struct{}
 	counter int32
+
+	// for concurrent request handling
+	window   chan struct{}    // per-connection in-flight semaphore
+	replies  chan chan *reply // reply slots in request order
+	wg       sync.WaitGroup   // requests being handled
+	deferred sync.WaitGroup   // deferred responses awaited, if Window <= 1
+	failed   chan struct{}    // closed when the connection should be closed
+	failOnce sync.Once
+}
+
+// reply is the outcome of handling one request.
+type reply struct {
+	r   *Response
+	err error
+
+	// captured before r is handed to the handler, which may still
+	// be filling r.Packer when a deferred response times out.
+	rspId CommandId // the command id of r.Packer, 0 if none.
+	seqId uint32
 }
 
 // Serve accepts incoming connections on the Listener l, creating a
@@ -98,6 +377,17 @@ type conn struct {
 // then call srv.Handler to reply to them.
 func (srv *Server) Serve(l net.Listener) error {
 	defer l.Close()
+	if srv.Handler == nil {
+		return ErrNoHandlers
+	}
+	if srv.Logger == nil {
+		errorLog := srv.ErrorLog
+		if errorLog == nil {
+			errorLog = log.New(os.Stderr, "cmppserver: ", log.LstdFlags)
+		}
+		srv.Logger = NewStdLogger(errorLog, LevelInfo)
+	}
+
 	var tempDelay time.Duration // how long to sleep on accept failure
 	for {
 		rw, e := l.Accept()
@@ -111,239 +401,269 @@ func (srv *Server) Serve(l net.Listener) error {
 				if max := 1 * time.Second; tempDelay > max {
 					tempDelay = max
 				}
-				srv.ErrorLog.Printf("accept error: %v; retrying in %v", e, tempDelay)
+				srv.Logger.Error("accept error, retrying",
+					Field{LogKeyError, e}, Field{"delay", tempDelay})
 				time.Sleep(tempDelay)
 				continue
 			}
 			return e
 		}
 		tempDelay = 0
+		if err := srv.trackConn(rw.RemoteAddr(), true); err != nil {
+			srv.Logger.Warn("refuse a connection",
+				Field{LogKeyRemoteAddr, rw.RemoteAddr()}, Field{LogKeyError, err})
+			rw.Close()
+			continue
+		}
 		c, err := srv.newConn(rw)
 		if err != nil {
+			srv.trackConn(rw.RemoteAddr(), false)
 			continue
 		}
 
-		srv.ErrorLog.Printf("accept a connection from %v\n", c.Conn.RemoteAddr())
+		c.session.logger().Info("accept a connection")
+		c.setState(StateNew)
 		go c.serve()
 	}
 }
 
 func (c *conn) readPacket() (*Response, error) {
-	readTimeout := time.Second * 2
+	readTimeout := c.server.ReadTimeout
+	if readTimeout == 0 {
+		readTimeout = DefaultReadTimeout
+	}
 	i, err := c.Conn.RecvAndUnpackPkt(readTimeout)
 	if err != nil {
 		return nil, err
 	}
-	typ := c.server.Typ
-
-	var pkt *Packet
-	var rsp *Response
-	switch p := i.(type) {
-	case *CmppConnReqPkt:
-		pkt = &Packet{
-			Packer: p,
-			Conn:   c.Conn,
-		}
-
-		if typ == V30 {
-			rsp = &Response{
-				Packet: pkt,
-				Packer: &Cmpp3ConnRspPkt{
-					SeqId: p.SeqId,
-				},
-				SeqId: p.SeqId,
-			}
-			c.server.ErrorLog.Printf("receive a cmpp30 connect request from %v[%d]\n",
-				c.Conn.RemoteAddr(), p.SeqId)
-		} else {
-			rsp = &Response{
-				Packet: pkt,
-				Packer: &Cmpp2ConnRspPkt{
-					SeqId: p.SeqId,
-				},
-				SeqId: p.SeqId,
-			}
-			c.server.ErrorLog.Printf("receive a cmpp20 connect request from %v[%d]\n",
-				c.Conn.RemoteAddr(), p.SeqId)
-		}
-
-	case *Cmpp2SubmitReqPkt:
-		pkt = &Packet{
-			Packer: p,
-			Conn:   c.Conn,
-		}
 
-		rsp = &Response{
-			Packet: pkt,
-			Packer: &Cmpp2SubmitRspPkt{
-				SeqId: p.SeqId,
-			},
-			SeqId: p.SeqId,
-		}
-		c.server.ErrorLog.Printf("receive a cmpp20 submit request from %v[%d]\n",
-			c.Conn.RemoteAddr(), p.SeqId)
+	p, ok := i.(Pdu)
+	if !ok || !serverAccepts(p.CommandId()) {
+		return nil, NewOpError(ErrUnsupportedPkt,
+			fmt.Sprintf("readPacket: receive unsupported packet type: %#v", i))
+	}
 
-	case *Cmpp3SubmitReqPkt:
-		pkt = &Packet{
-			Packer: p,
-			Conn:   c.Conn,
+	pkt := &Packet{
+		Packer:   p,
+		Conn:     c.Conn,
+		ctx:      c.ctx,
+		session:  c.session,
+		recvTime: time.Now(),
+		labels:   c.labels(),
+	}
+	observeReceived(c.metrics(), pkt.labels, p)
+	rsp := &Response{
+		Packet: pkt,
+	}
+	if p.CommandId().IsRequest() {
+		// For requests, build an empty response for the handlers.
+		if rsp.Packer, err = NewResponse(p, c.server.Typ); err != nil {
+			return nil, err
 		}
+		rsp.SeqId = p.SequenceId()
+	}
+	c.session.logger().Debug("receive a packet",
+		Field{LogKeyCommand, p.CommandId()}, Field{LogKeySeqId, p.SequenceId()})
+	return rsp, nil
+}
 
-		rsp = &Response{
-			Packet: pkt,
-			Packer: &Cmpp3SubmitRspPkt{
-				SeqId: p.SeqId,
-			},
-			SeqId: p.SeqId,
-		}
-		c.server.ErrorLog.Printf("receive a cmpp30 submit request from %v[%d]\n",
-			c.Conn.RemoteAddr(), p.SeqId)
+// serverAccepts reports whether the server accepts the packets
+// of the command id from the clients.
+func serverAccepts(id CommandId) bool {
+	switch id {
+	case CMPP_CONNECT, CMPP_SUBMIT, CMPP_FWD, CMPP_QUERY, CMPP_CANCEL,
+		CMPP_DELIVER_RESP,
+		CMPP_ACTIVE_TEST, CMPP_ACTIVE_TEST_RESP,
+		CMPP_TERMINATE, CMPP_TERMINATE_RESP:
+		return true
+	}
+	return false
+}
 
-	case *Cmpp2FwdReqPkt:
-		pkt = &Packet{
-			Packer: p,
-			Conn:   c.Conn,
-		}
+// Close the connection.
+func (c *conn) close() {
+	p := &CmppTerminateReqPkt{}
 
-		rsp = &Response{
-			Packet: pkt,
-			Packer: &Cmpp2FwdRspPkt{
-				SeqId: p.SeqId,
-			},
-			SeqId: p.SeqId,
-		}
-		c.server.ErrorLog.Printf("receive a cmpp20 forward request from %v[%d]\n",
-			c.Conn.RemoteAddr(), p.SeqId)
+	err := c.sendPkt(p, c.Conn.NextSeqId())
+	if err != nil {
+		c.session.logger().Warn("send terminate request error", Field{LogKeyError, err})
+	}
 
-	case *Cmpp3FwdReqPkt:
-		pkt = &Packet{
-			Packer: p,
-			Conn:   c.Conn,
-		}
+	close(c.done)
+	c.session.logger().Info("close the connection")
+	c.Conn.Close()
+	c.cancel()
 
-		rsp = &Response{
-			Packet: pkt,
-			Packer: &Cmpp3FwdRspPkt{
-				SeqId: p.SeqId,
-			},
-			SeqId: p.SeqId,
-		}
-		c.server.ErrorLog.Printf("receive a cmpp30 forward request from %v[%d]\n",
-			c.Conn.RemoteAddr(), p.SeqId)
+	if c.account != "" {
+		c.server.trackSession(c.account, false)
+	}
+	c.server.trackConn(c.Conn.RemoteAddr(), false)
+	c.setState(StateClosed)
+	c.metrics().ConnClosed(c.labels())
+}
 
-	case *Cmpp2DeliverRspPkt:
-		pkt = &Packet{
-			Packer: p,
-			Conn:   c.Conn,
-		}
+// sendPkt sends p to the peer, logging it at the debug level
+// and counting it in the metrics.
+func (c *conn) sendPkt(p Packer, seqId uint32) error {
+	if pdu, ok := p.(Pdu); ok {
+		c.session.logger().Debug("send a packet",
+			Field{LogKeyCommand, pdu.CommandId()}, Field{LogKeySeqId, seqId})
+	}
+	observeSent(c.metrics(), c.labels(), p)
+	return c.Conn.SendPkt(p, seqId)
+}
 
-		rsp = &Response{
-			Packet: pkt,
-		}
-		c.server.ErrorLog.Printf("receive a cmpp20 deliver response from %v[%d]\n",
-			c.Conn.RemoteAddr(), p.SeqId)
+// metrics returns the Metrics of the server, which is never nil.
+func (c *conn) metrics() Metrics {
+	if m := c.server.Metrics; m != nil {
+		return m
+	}
+	return nopMetrics{}
+}
 
-	case *Cmpp3DeliverRspPkt:
-		pkt = &Packet{
-			Packer: p,
-			Conn:   c.Conn,
-		}
+// labels returns the current metrics labels of the connection.
+func (c *conn) labels() Labels {
+	return Labels{
+		Conn:    c.session.RemoteAddr().String(),
+		Account: c.session.Account(),
+	}
+}
 
-		rsp = &Response{
-			Packet: pkt,
-		}
-		c.server.ErrorLog.Printf("receive a cmpp30 deliver response from %v[%d]\n",
-			c.Conn.RemoteAddr(), p.SeqId)
+func (c *conn) setState(state ConnState) {
+	if hook := c.server.ConnState; hook != nil {
+		hook(c.session, state)
+	}
+}
 
-	case *CmppActiveTestReqPkt:
-		pkt = &Packet{
-			Packer: p,
-			Conn:   c.Conn,
-		}
+func (c *conn) finishPacket(r *Response) error {
+	if _, ok := r.Packet.Packer.(*CmppActiveTestRspPkt); ok {
+		atomic.AddInt32(&c.counter, -1)
+		return nil
+	}
 
-		rsp = &Response{
-			Packet: pkt,
-			Packer: &CmppActiveTestRspPkt{
-				SeqId: p.SeqId,
-			},
-			SeqId: p.SeqId,
-		}
-		c.server.ErrorLog.Printf("receive a cmpp active request from %v[%d]\n",
-			c.Conn.RemoteAddr(), p.SeqId)
+	if r.Packer == nil {
+		// For response packet received, it need not
+		// to send anything back.
+		return nil
+	}
 
-	case *CmppActiveTestRspPkt:
-		pkt = &Packet{
-			Packer: p,
-			Conn:   c.Conn,
+	if req, ok := r.Packet.Packer.(*CmppConnReqPkt); ok && !r.expired {
+		if status, ok := connRspStatus(r.Packer); ok && status == 0 {
+			return c.login(req, r)
 		}
+	}
 
-		rsp = &Response{
-			Packet: pkt,
-		}
-		c.server.ErrorLog.Printf("receive a cmpp active response from %v[%d]\n",
-			c.Conn.RemoteAddr(), p.SeqId)
+	return c.sendPkt(r.Packer, r.SeqId)
+}
 
-	case *CmppTerminateReqPkt:
-		pkt = &Packet{
-			Packer: p,
-			Conn:   c.Conn,
+// login records the session info of a successful login and sends
+// back the connect response r. If the account has too many
+// sessions, the login is refused and ErrTooManySessions is returned;
+// and a login with another account on an authenticated connection
+// is refused with ErrAccountChanged.
+func (c *conn) login(req *CmppConnReqPkt, r *Response) error {
+	account := strings.TrimRight(req.SrcAddr, "\x00")
+	if err := c.verifyCert(account); err != nil {
+		c.session.logger().Warn("refuse the login",
+			Field{LogKeyAccount, account}, Field{LogKeyError, err})
+		setConnRspStatus(r.Packer, uint32(ErrnoConnAuthFailed))
+		if err1 := c.sendPkt(r.Packer, r.SeqId); err1 != nil {
+			return err1
 		}
+		return err
+	}
 
-		rsp = &Response{
-			Packet: pkt,
-			Packer: &CmppTerminateRspPkt{
-				SeqId: p.SeqId,
-			},
-			SeqId: p.SeqId,
+	if c.account == "" {
+		if err := c.server.trackSession(account, true); err != nil {
+			return c.refuseLogin(account, r, err)
 		}
-		c.server.ErrorLog.Printf("receive a cmpp terminate request from %v[%d]\n",
-			c.Conn.RemoteAddr(), p.SeqId)
+		c.account = account
+	} else if account != c.account {
+		return c.refuseLogin(account, r, ErrAccountChanged)
+	}
 
-	case *CmppTerminateRspPkt:
-		pkt = &Packet{
-			Packer: p,
-			Conn:   c.Conn,
-		}
+	// the version negotiated is the one in the response, not the
+	// one the peer asked for.
+	c.session.login(account, connRspVersion(r.Packer, c.server.Typ), time.Now())
+	c.Conn.SetState(CONN_AUTHOK)
+	err := c.sendPkt(r.Packer, r.SeqId)
+	c.setState(StateAuthenticated)
+	return err
+}
 
-		rsp = &Response{
-			Packet: pkt,
-		}
-		c.server.ErrorLog.Printf("receive a cmpp terminate response from %v[%d]\n",
-			c.Conn.RemoteAddr(), p.SeqId)
-	default:
-		return nil, NewOpError(ErrUnsupportedPkt,
-			fmt.Sprintf("readPacket: receive unsupported packet type: %#v", p))
+// refuseLogin sends back the connect response r with the status
+// ErrnoConnOthers, and returns err.
+func (c *conn) refuseLogin(account string, r *Response, err error) error {
+	c.session.logger().Warn("refuse the login",
+		Field{LogKeyAccount, account}, Field{LogKeyError, err})
+	setConnRspStatus(r.Packer, uint32(ErrnoConnOthers))
+	if err1 := c.sendPkt(r.Packer, r.SeqId); err1 != nil {
+		return err1
 	}
-	return rsp, nil
+	return err
 }
 
-// Close the connection.
-func (c *conn) close() {
-	p := &CmppTerminateReqPkt{}
+// verifyCert cross-checks the account logging in with the one
+// srv.CertAccount maps the client certificate to.
+func (c *conn) verifyCert(account string) error {
+	hook := c.server.CertAccount
+	if hook == nil {
+		return nil
+	}
 
-	err := c.Conn.SendPkt(p, <-c.Conn.SeqId)
-	if err != nil {
-		c.server.ErrorLog.Printf("send cmpp terminate request packet to %v error: %v\n", c.Conn.RemoteAddr(), err)
+	tc, ok := c.Conn.Conn.(*tls.Conn)
+	if !ok {
+		return ErrNoClientCert
+	}
+	certs := tc.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return ErrNoClientCert
 	}
 
-	close(c.done)
-	c.server.ErrorLog.Printf("close connection with %v!\n", c.Conn.RemoteAddr())
-	c.Conn.Close()
+	certAccount, err := hook(certs[0])
+	if err != nil {
+		return err
+	}
+	if certAccount != account {
+		return ErrCertAccountMismatch
+	}
+	return nil
 }
 
-func (c *conn) finishPacket(r *Response) error {
-	if _, ok := r.Packet.Packer.(*CmppActiveTestRspPkt); ok {
-		atomic.AddInt32(&c.counter, -1)
-		return nil
+// connRspStatus returns the status in the connect response p.
+func connRspStatus(p Packer) (uint32, bool) {
+	switch rsp := p.(type) {
+	case *Cmpp2ConnRspPkt:
+		return uint32(rsp.Status), true
+	case *Cmpp3ConnRspPkt:
+		return rsp.Status, true
 	}
+	return 0, false
+}
 
-	if r.Packer == nil {
-		// For response packet received, it need not
-		// to send anything back.
-		return nil
+func setConnRspStatus(p Packer, status uint32) {
+	switch rsp := p.(type) {
+	case *Cmpp2ConnRspPkt:
+		rsp.Status = uint8(status)
+	case *Cmpp3ConnRspPkt:
+		rsp.Status = status
 	}
+}
 
-	return c.Conn.SendPkt(r.Packer, r.SeqId)
+// connRspVersion returns the Version of the connect response p, or
+// typ if it is not set.
+func connRspVersion(p Packer, typ Type) Type {
+	var v Type
+	switch rsp := p.(type) {
+	case *Cmpp2ConnRspPkt:
+		v = rsp.Version
+	case *Cmpp3ConnRspPkt:
+		v = rsp.Version
+	}
+	if v == 0 {
+		return typ
+	}
+	return v
 }
 
 func startActiveTest(c *conn) {
@@ -362,16 +682,22 @@ func startActiveTest(c *conn) {
 			case <-t.C:
 				// check whether c.counter exceeds
 				if atomic.LoadInt32(&c.counter) >= c.n {
-					c.server.ErrorLog.Printf("no cmpp active test response returned from %v for %d times!",
-						c.Conn.RemoteAddr(), c.n)
-					exceed <- struct{}{}
+					c.session.logger().Warn("no active test response returned",
+						Field{"times", c.n})
+					c.setState(StateActiveTestFailed)
+					c.metrics().ActiveTestFailed(c.labels())
+					select {
+					case exceed <- struct{}{}:
+					case <-done:
+						return
+					}
 					break
 				}
 				// send a active test packet to peer, increase the active test counter
 				p := &CmppActiveTestReqPkt{}
-				err := c.Conn.SendPkt(p, <-c.Conn.SeqId)
+				err := c.sendPkt(p, c.Conn.NextSeqId())
 				if err != nil {
-					c.server.ErrorLog.Printf("send cmpp active test request to %v error: %v", c.Conn.RemoteAddr(), err)
+					c.session.logger().Warn("send active test request error", Field{LogKeyError, err})
 				} else {
 					atomic.AddInt32(&c.counter, 1)
 				}
@@ -384,7 +710,7 @@ func startActiveTest(c *conn) {
 func (c *conn) serve() {
 	defer func() {
 		if err := recover(); err != nil {
-			c.server.ErrorLog.Printf("panic serving %v: %v\n", c.Conn.RemoteAddr(), err)
+			c.session.logger().Error("panic serving", Field{LogKeyError, err})
 		}
 	}()
 
@@ -393,67 +719,488 @@ func (c *conn) serve() {
 	// start a goroutine for sending active test.
 	startActiveTest(c)
 
+	if c.replies != nil {
+		go c.sendReplies()
+	}
+	defer func() {
+		// wait for the requests in flight to be answered, the
+		// pending deferred responses are dropped.
+		c.fail()
+		c.wg.Wait()
+		c.deferred.Wait()
+		if c.replies != nil {
+			close(c.replies)
+		}
+	}()
+
+	lastRecv, idle := time.Now(), false
 	for {
 		select {
 		case <-c.exceed:
 			return // close the connection.
+		case <-c.failed:
+			return
 		default:
 		}
 
 		r, err := c.readPacket()
 		if err != nil {
 			if e, ok := err.(net.Error); ok && e.Timeout() {
+				if d := c.server.IdleTimeout; d != 0 && time.Since(lastRecv) > d {
+					c.session.logger().Info("connection is idle", Field{"idle_timeout", d})
+					break
+				}
+				if !idle {
+					idle = true
+					c.setState(StateIdle)
+				}
 				continue
 			}
 			break
 		}
+		lastRecv, idle = time.Now(), false
 
-		_, err = c.server.Handler.ServeCmpp(r, r.Packet, c.server.ErrorLog)
-		if err1 := c.finishPacket(r); err1 != nil {
-			break
+		if c.window == nil || isBarrier(r) {
+			// handle the packet in the serve goroutine after
+			// all the requests in flight have been answered. The
+			// deferred responses only hold back the barriers, so
+			// that the active tests are still answered meanwhile.
+			c.wg.Wait()
+			barrier := isBarrier(r)
+			if barrier {
+				c.deferred.Wait()
+			} else {
+				// counted like the dispatched ones.
+				c.metrics().InFlight(r.Packet.labels, 1)
+			}
+			rp := c.handle(r)
+			if r.deferred && !barrier {
+				// wait for the deferred response in background.
+				c.deferred.Add(1)
+				go func() {
+					defer c.deferred.Done()
+					defer c.metrics().InFlight(r.Packet.labels, -1)
+					if err := c.finish(c.await(rp)); err != nil {
+						c.fail()
+					}
+				}()
+				continue
+			}
+			if r.deferred {
+				rp = c.await(rp)
+			}
+			err = c.finish(rp)
+			if !barrier {
+				c.metrics().InFlight(r.Packet.labels, -1)
+			}
+			if err != nil {
+				break
+			}
+			continue
 		}
 
-		if err != nil {
+		if !c.dispatch(r) {
 			break
 		}
 	}
 }
 
+// isBarrier reports whether the packet in r must not be handled
+// concurrently with other requests on the same connection.
+func isBarrier(r *Response) bool {
+	switch r.Packet.Packer.(type) {
+	case *CmppConnReqPkt, *CmppTerminateReqPkt:
+		return true
+	}
+	return false
+}
+
+// handle runs the server handler on r.
+func (c *conn) handle(r *Response) (rp *reply) {
+	rp = &reply{r: r, seqId: r.SeqId}
+	if pdu, ok := r.Packer.(Pdu); ok {
+		rp.rspId = pdu.CommandId()
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			c.session.logger().Error("panic in handler", Field{LogKeyError, err})
+			rp.err = fmt.Errorf("cmpp server: panic in handler: %v", err)
+		}
+	}()
+	_, rp.err = c.server.Handler.ServeCmpp(r, r.Packet, c.session.logger())
+	return rp
+}
+
+// finish sends back the response of a handled request. The returned
+// error is non-nil if the connection should be closed.
+func (c *conn) finish(rp *reply) error {
+	if err := c.finishPacket(rp.r); err != nil {
+		return err
+	}
+	if r := rp.r; r.Packer != nil && !r.Packet.recvTime.IsZero() {
+		req := r.Packet.Packer.(Pdu)
+		c.metrics().RequestLatency(c.labels(), req.CommandId(), time.Since(r.Packet.recvTime))
+	}
+	return rp.err
+}
+
+// await waits for the deferred response in rp to be finished.
+// If it times out, a default response is returned instead; and if
+// the connection is going to be closed, a response with nothing
+// to be sent is returned.
+func (c *conn) await(rp *reply) *reply {
+	r := rp.r
+	timeout := r.timeout
+	if timeout == 0 {
+		timeout = c.server.DeferTimeout
+	}
+	if timeout == 0 {
+		timeout = DefaultDeferTimeout
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	var expired bool
+	select {
+	case <-r.done:
+		return rp
+	case <-t.C:
+		expired = true
+	case <-c.failed:
+	}
+
+	if !atomic.CompareAndSwapInt32(&r.state, deferPending, deferExpired) {
+		<-r.done // finished just now.
+		return rp
+	}
+
+	// r is still owned by the handler, only the fields captured
+	// in rp are used from now on.
+	if !expired || rp.rspId == 0 {
+		return &reply{r: &Response{Packet: r.Packet}, err: rp.err}
+	}
+
+	result, err := c.server.DeferResult, rp.err
+	if rp.rspId == CMPP_CONNECT_RESP {
+		// refuse the login, and close the connection.
+		result = uint32(ErrnoConnOthers)
+		if err == nil {
+			err = ErrLoginTimedOut
+		}
+	}
+	c.session.logger().Warn("deferred response timed out",
+		Field{LogKeySeqId, rp.seqId}, Field{"result", result})
+	return &reply{
+		r: &Response{
+			Packet:  r.Packet,
+			Packer:  defaultResponse(rp.rspId, c.server.Typ, result),
+			SeqId:   rp.seqId,
+			expired: true,
+		},
+		err: err,
+	}
+}
+
+// defaultResponse returns a new response packet of the command id,
+// with its Result(or Status) set to result.
+func defaultResponse(id CommandId, typ Type, result uint32) Packer {
+	p, err := newPacket(id, typ)
+	if err != nil {
+		return nil
+	}
+	switch rsp := p.(type) {
+	case *Cmpp2ConnRspPkt:
+		rsp.Status, rsp.Version = uint8(result), typ
+	case *Cmpp3ConnRspPkt:
+		rsp.Status, rsp.Version = result, typ
+	case *Cmpp2SubmitRspPkt:
+		rsp.Result = uint8(result)
+	case *Cmpp3SubmitRspPkt:
+		rsp.Result = result
+	case *Cmpp2FwdRspPkt:
+		rsp.Result = uint8(result)
+	case *Cmpp3FwdRspPkt:
+		rsp.Result = result
+	case *Cmpp2CancelRspPkt:
+		rsp.SuccessId = 1 // not canceled.
+	case *Cmpp3CancelRspPkt:
+		rsp.SuccessId = 1
+	}
+	return p
+}
+
+// dispatch handles r in a new goroutine once there is room in
+// the in-flight windows. It returns false if the connection
+// should be closed instead.
+func (c *conn) dispatch(r *Response) bool {
+	if !c.acquire() {
+		return false
+	}
+	c.metrics().InFlight(r.Packet.labels, 1)
+
+	var slot chan *reply
+	if c.replies != nil {
+		slot = make(chan *reply, 1)
+		c.replies <- slot
+	}
+
+	c.wg.Add(1)
+	go func() {
+		rp := c.handle(r)
+		if r.deferred {
+			rp = c.await(rp)
+		}
+		if slot != nil {
+			slot <- rp // sendReplies will finish it.
+			return
+		}
+		c.complete(rp)
+	}()
+	return true
+}
+
+// complete finishes a dispatched request and releases its room
+// in the in-flight windows.
+func (c *conn) complete(rp *reply) {
+	defer c.wg.Done()
+	defer c.release()
+	defer c.metrics().InFlight(rp.r.Packet.labels, -1)
+	if err := c.finish(rp); err != nil {
+		c.fail()
+	}
+}
+
+// sendReplies finishes the dispatched requests in the order they
+// arrived.
+func (c *conn) sendReplies() {
+	for slot := range c.replies {
+		c.complete(<-slot)
+	}
+}
+
+func (c *conn) acquire() bool {
+	select {
+	case c.window <- struct{}{}:
+	case <-c.exceed:
+		return false
+	case <-c.failed:
+		return false
+	}
+
+	if sem := c.server.inFlightSem(); sem != nil {
+		select {
+		case sem <- struct{}{}:
+		case <-c.exceed:
+			<-c.window
+			return false
+		case <-c.failed:
+			<-c.window
+			return false
+		}
+	}
+	return true
+}
+
+func (c *conn) release() {
+	if sem := c.server.inFlightSem(); sem != nil {
+		<-sem
+	}
+	<-c.window
+}
+
+// fail marks the connection to be closed by the serve goroutine.
+func (c *conn) fail() {
+	c.failOnce.Do(func() {
+		close(c.failed)
+	})
+}
+
 // Create new connection from rwc.
 func (srv *Server) newConn(rwc net.Conn) (c *conn, err error) {
 	c = new(conn)
 	c.server = srv
 	c.Conn = NewConn(rwc, srv.Typ)
+	c.Conn.WriteTimeout = srv.WriteTimeout
+	c.Conn.InterceptSend(srv.SendInterceptors...)
+	c.Conn.InterceptRecv(srv.RecvInterceptors...)
+	if srv.WriteBufferSize > 0 {
+		c.Conn.EnableWriteBuffer(srv.WriteBufferSize, srv.MaxWriteDelay)
+	}
 	c.Conn.SetState(CONN_CONNECTED)
 	c.n = c.server.N
 	c.t = c.server.T
+	c.failed = make(chan struct{})
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.session = newSession(rwc.RemoteAddr(), srv.Logger)
+	if srv.Window > 1 {
+		c.window = make(chan struct{}, srv.Window)
+		if srv.OrderedReplies {
+			c.replies = make(chan chan *reply, srv.Window)
+		}
+	}
 	return c, nil
 }
 
-func (srv *Server) listenAndServe() error {
+// trackConn counts the connection from addr in(add is true) or
+// out(add is false). It returns an error if adding the connection
+// would exceed srv.MaxConns or srv.MaxConnsPerIP.
+func (srv *Server) trackConn(addr net.Addr, add bool) error {
+	ip := addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.ipConns == nil {
+		srv.ipConns = make(map[string]int)
+	}
+
+	if !add {
+		srv.nConns--
+		if srv.ipConns[ip]--; srv.ipConns[ip] <= 0 {
+			delete(srv.ipConns, ip)
+		}
+		return nil
+	}
+
+	if srv.MaxConns > 0 && srv.nConns >= srv.MaxConns {
+		return ErrTooManyConns
+	}
+	if srv.MaxConnsPerIP > 0 && srv.ipConns[ip] >= srv.MaxConnsPerIP {
+		return ErrTooManyConns
+	}
+	srv.nConns++
+	srv.ipConns[ip]++
+	return nil
+}
+
+// trackSession counts a logged in session of account in(add is true)
+// or out(add is false). It returns an error if adding the session
+// would exceed srv.MaxSessionsPerAccount.
+func (srv *Server) trackSession(account string, add bool) error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.sessions == nil {
+		srv.sessions = make(map[string]int)
+	}
+
+	if !add {
+		if srv.sessions[account]--; srv.sessions[account] <= 0 {
+			delete(srv.sessions, account)
+		}
+		return nil
+	}
+
+	if srv.MaxSessionsPerAccount > 0 && srv.sessions[account] >= srv.MaxSessionsPerAccount {
+		return ErrTooManySessions
+	}
+	srv.sessions[account]++
+	return nil
+}
+
+// inFlightSem returns the server-wide in-flight semaphore, or nil
+// if srv.MaxInFlight is not set.
+func (srv *Server) inFlightSem() chan struct{} {
+	srv.inFlightOnce.Do(func() {
+		if srv.MaxInFlight > 0 {
+			srv.inFlight = make(chan struct{}, srv.MaxInFlight)
+		}
+	})
+	return srv.inFlight
+}
+
+// ListenAndServe listens on the TCP network address srv.Addr
+// and then calls Serve to handle requests on incoming connections.
+func (srv *Server) ListenAndServe() error {
+	ln, err := srv.listen()
+	if err != nil {
+		return err
+	}
+	return srv.Serve(ln)
+}
+
+// ListenAndServeTLS acts identically to ListenAndServe, except that it
+// expects cmpp over TLS connections. A certificate and matching private
+// key for the server must be provided, either by certFile and keyFile,
+// or by srv.TLSConfig.Certificates(or GetCertificate) if both files are
+// empty. Set srv.TLSConfig.ClientAuth to require client certificates.
+func (srv *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	ln, err := srv.listen()
+	if err != nil {
+		return err
+	}
+	return srv.ServeTLS(ln, certFile, keyFile)
+}
+
+// ServeTLS accepts incoming connections on the Listener l, performs
+// the TLS handshakes with srv.TLSConfig, and then serves them like
+// Serve does. The certFile and keyFile are used as in ListenAndServeTLS.
+func (srv *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	config := &tls.Config{}
+	if srv.TLSConfig != nil {
+		config = srv.TLSConfig.Clone()
+	}
+
+	if certFile != "" || keyFile != "" || (len(config.Certificates) == 0 && config.GetCertificate == nil) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			l.Close()
+			return err
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+	return srv.Serve(tls.NewListener(l, config))
+}
+
+func (srv *Server) listen() (net.Listener, error) {
 	if srv.Addr == "" {
-		return ErrEmptyServerAddr
+		return nil, ErrEmptyServerAddr
 	}
 	ln, err := net.Listen("tcp", srv.Addr)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	period := srv.KeepAlivePeriod
+	if period == 0 {
+		period = DefaultKeepAlivePeriod
 	}
-	return srv.Serve(tcpKeepAliveListener{ln.(*net.TCPListener)})
+	return tcpKeepAliveListener{ln.(*net.TCPListener), period}, nil
 }
 
 // ListenAndServe listens on the TCP network address addr
 // and then calls Serve with handler to handle requests.
 func ListenAndServe(addr string, typ Type, t time.Duration, n int32, logWriter io.Writer, handlers ...Handler) error {
+	server, err := newServer(addr, typ, t, n, logWriter, handlers...)
+	if err != nil {
+		return err
+	}
+	return server.ListenAndServe()
+}
+
+// ListenAndServeTLS acts identically to ListenAndServe, except that it
+// expects cmpp over TLS connections. Files containing a certificate and
+// matching private key for the server must be provided.
+func ListenAndServeTLS(addr, certFile, keyFile string, typ Type, t time.Duration, n int32, logWriter io.Writer, handlers ...Handler) error {
+	server, err := newServer(addr, typ, t, n, logWriter, handlers...)
+	if err != nil {
+		return err
+	}
+	return server.ListenAndServeTLS(certFile, keyFile)
+}
+
+func newServer(addr string, typ Type, t time.Duration, n int32, logWriter io.Writer, handlers ...Handler) (*Server, error) {
 	if addr == "" {
-		return ErrEmptyServerAddr
+		return nil, ErrEmptyServerAddr
 	}
 
 	if handlers == nil {
-		return ErrNoHandlers
+		return nil, ErrNoHandlers
 	}
 
 	var handler Handler
-	handler = HandlerFunc(func(r *Response, p *Packet, l *log.Logger) (bool, error) {
+	handler = HandlerFunc(func(r *Response, p *Packet, l Logger) (bool, error) {
 		for _, h := range handlers {
 			next, err := h.ServeCmpp(r, p, l)
 			if err != nil || !next {
@@ -466,10 +1213,9 @@ func ListenAndServe(addr string, typ Type, t time.Duration, n int32, logWriter i
 	if logWriter == nil {
 		logWriter = os.Stderr
 	}
-	server := &Server{Addr: addr, Handler: handler, Typ: typ,
+	return &Server{Addr: addr, Handler: handler, Typ: typ,
 		T: t, N: n,
-		ErrorLog: log.New(logWriter, "cmppserver: ", log.LstdFlags)}
-	return server.listenAndServe()
+		Logger: NewStdLogger(log.New(logWriter, "cmppserver: ", log.LstdFlags), LevelInfo)}, nil
 }
 
 // tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
@@ -479,6 +1225,7 @@ func ListenAndServe(addr string, typ Type, t time.Duration, n int32, logWriter i
 // http package.
 type tcpKeepAliveListener struct {
 	*net.TCPListener
+	period time.Duration
 }
 
 func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
@@ -487,6 +1234,6 @@ func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
 		return
 	}
 	tc.SetKeepAlive(true)
-	tc.SetKeepAlivePeriod(1 * time.Minute) // 1min
+	tc.SetKeepAlivePeriod(ln.period)
 	return tc, nil
 }
@@ -0,0 +1,739 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+// startServer starts srv on a loopback listener and returns the
+// address it listens on.
+func startServer(t *testing.T, srv *cmpp.Server) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen error:", err)
+	}
+	if srv.Logger == nil {
+		srv.Logger = cmpp.NewNopLogger()
+	}
+	if srv.T == 0 {
+		srv.T = time.Minute
+		srv.N = 3
+	}
+	go srv.Serve(l)
+	return l.Addr().String()
+}
+
+// acceptLogin is a handler accepting every login request.
+func acceptLogin(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+	if _, ok := p.Packer.(*cmpp.CmppConnReqPkt); !ok {
+		return true, nil
+	}
+	if rsp, ok := r.Packer.(*cmpp.Cmpp3ConnRspPkt); ok {
+		rsp.Version = cmpp.V30
+	}
+	return false, nil
+}
+
+// chain builds a handler invoking hs in order.
+func chain(hs ...cmpp.HandlerFunc) cmpp.Handler {
+	return cmpp.HandlerFunc(func(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+		for _, h := range hs {
+			next, err := h(r, p, l)
+			if err != nil || !next {
+				return next, err
+			}
+		}
+		return false, nil
+	})
+}
+
+// slowSubmit answers a submit request after sleeping MsgId milliseconds,
+// and echoes the MsgId back in the response.
+func slowSubmit(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+	req, ok := p.Packer.(*cmpp.Cmpp3SubmitReqPkt)
+	if !ok {
+		return true, nil
+	}
+	time.Sleep(time.Duration(req.MsgId) * time.Millisecond)
+	r.Packer.(*cmpp.Cmpp3SubmitRspPkt).MsgId = req.MsgId
+	return false, nil
+}
+
+func connectClient(t *testing.T, addr string) *cmpp.Client {
+	c := cmpp.NewClient(cmpp.V30)
+	if err := c.Connect(addr, "900001", "888888", time.Second); err != nil {
+		t.Fatal("client connect error:", err)
+	}
+	return c
+}
+
+// recvSubmitRsps receives n submit responses from c.
+func recvSubmitRsps(t *testing.T, c *cmpp.Client, n int) []*cmpp.Cmpp3SubmitRspPkt {
+	var rsps []*cmpp.Cmpp3SubmitRspPkt
+	for len(rsps) < n {
+		i, err := c.RecvAndUnpackPkt(5 * time.Second)
+		if err != nil {
+			t.Fatal("client recv error:", err)
+		}
+		if rsp, ok := i.(*cmpp.Cmpp3SubmitRspPkt); ok {
+			rsps = append(rsps, rsp)
+		}
+	}
+	return rsps
+}
+
+func TestServerWindow(t *testing.T) {
+	addr := startServer(t, &cmpp.Server{
+		Handler: chain(acceptLogin, slowSubmit),
+		Typ:     cmpp.V30,
+		Window:  8,
+	})
+	c := connectClient(t, addr)
+	defer c.Disconnect()
+
+	start := time.Now()
+	for i := 0; i < 8; i++ {
+		if _, err := c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{MsgId: 200}); err != nil {
+			t.Fatal("client send error:", err)
+		}
+	}
+	recvSubmitRsps(t, c, 8)
+
+	if d := time.Since(start); d > 1200*time.Millisecond {
+		t.Fatalf("8 submits handled in %v, wanted them to be handled concurrently\n", d)
+	}
+}
+
+func TestServerOrderedReplies(t *testing.T) {
+	addr := startServer(t, &cmpp.Server{
+		Handler:        chain(acceptLogin, slowSubmit),
+		Typ:            cmpp.V30,
+		Window:         4,
+		OrderedReplies: true,
+	})
+	c := connectClient(t, addr)
+	defer c.Disconnect()
+
+	var seqs []uint32
+	for i := 4; i > 0; i-- {
+		seq, err := c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{MsgId: uint64(i * 50)})
+		if err != nil {
+			t.Fatal("client send error:", err)
+		}
+		seqs = append(seqs, seq)
+	}
+
+	rsps := recvSubmitRsps(t, c, 4)
+	for i, rsp := range rsps {
+		if rsp.SeqId != seqs[i] {
+			t.Fatalf("response %d: seqId is %d, wanted %d\n", i, rsp.SeqId, seqs[i])
+		}
+	}
+}
+
+func TestServerSerial(t *testing.T) {
+	addr := startServer(t, &cmpp.Server{
+		Handler: chain(acceptLogin, slowSubmit),
+		Typ:     cmpp.V30,
+	})
+	c := connectClient(t, addr)
+	defer c.Disconnect()
+
+	var seqs []uint32
+	for i := 3; i > 0; i-- {
+		seq, err := c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{MsgId: uint64(i * 30)})
+		if err != nil {
+			t.Fatal("client send error:", err)
+		}
+		seqs = append(seqs, seq)
+	}
+
+	rsps := recvSubmitRsps(t, c, 3)
+	for i, rsp := range rsps {
+		if rsp.SeqId != seqs[i] || rsp.MsgId != uint64((3-i)*30) {
+			t.Fatalf("response %d: seqId/msgId is %d/%d, wanted %d/%d\n",
+				i, rsp.SeqId, rsp.MsgId, seqs[i], (3-i)*30)
+		}
+	}
+}
+
+func TestServerDeferredResponse(t *testing.T) {
+	deferSubmit := func(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+		req, ok := p.Packer.(*cmpp.Cmpp3SubmitReqPkt)
+		if !ok {
+			return true, nil
+		}
+		if req.MsgId == 0 {
+			// never finished, let it time out.
+			r.Defer(100 * time.Millisecond)
+			return false, nil
+		}
+		if req.MsgId == 1 {
+			// never finished, and not timed out during the test.
+			r.Defer(time.Minute)
+			return false, nil
+		}
+
+		r.Defer(0)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			r.Packer.(*cmpp.Cmpp3SubmitRspPkt).MsgId = req.MsgId
+			if err := r.Finish(); err != nil {
+				t.Error("finish deferred response error:", err)
+			}
+			if err := r.Finish(); err != cmpp.ErrResponseFinished {
+				t.Errorf("finish deferred response twice: actual [%v], wanted [%v]\n", err, cmpp.ErrResponseFinished)
+			}
+		}()
+		return false, nil
+	}
+
+	addr := startServer(t, &cmpp.Server{
+		Handler:     chain(acceptLogin, deferSubmit),
+		Typ:         cmpp.V30,
+		DeferResult: 8,
+	})
+	c := connectClient(t, addr)
+	defer c.Disconnect()
+
+	seq1, _ := c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{MsgId: 0})
+	seq2, _ := c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{MsgId: 7})
+
+	for _, rsp := range recvSubmitRsps(t, c, 2) {
+		switch rsp.SeqId {
+		case seq1:
+			if rsp.Result != 8 {
+				t.Fatalf("timed out response: result is %d, wanted %d\n", rsp.Result, 8)
+			}
+		case seq2:
+			if rsp.Result != 0 || rsp.MsgId != 7 {
+				t.Fatalf("finished response: result/msgId is %d/%d, wanted %d/%d\n", rsp.Result, rsp.MsgId, 0, 7)
+			}
+		default:
+			t.Fatalf("unexpected response seqId: %d\n", rsp.SeqId)
+		}
+	}
+
+	// the active tests are answered while a response is deferred.
+	c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{MsgId: 1})
+	seq3, _ := c.SendReqPkt(&cmpp.CmppActiveTestReqPkt{})
+	i, err := c.RecvAndUnpackPkt(5 * time.Second)
+	if rsp, ok := i.(*cmpp.CmppActiveTestRspPkt); !ok || rsp.SeqId != seq3 {
+		t.Fatalf("active test during a deferred response: actual [%v, %v], wanted the active test response\n", i, err)
+	}
+}
+
+func TestServerDeferredLoginTimeout(t *testing.T) {
+	var mu sync.Mutex
+	var states []cmpp.ConnState
+	deferLogin := func(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+		if _, ok := p.Packer.(*cmpp.CmppConnReqPkt); ok {
+			r.Defer(50 * time.Millisecond) // never finished.
+		}
+		return true, nil
+	}
+
+	addr := startServer(t, &cmpp.Server{
+		Handler: chain(deferLogin, acceptLogin),
+		Typ:     cmpp.V30,
+		ConnState: func(s *cmpp.Session, state cmpp.ConnState) {
+			mu.Lock()
+			states = append(states, state)
+			mu.Unlock()
+		},
+	})
+	c := cmpp.NewClient(cmpp.V30)
+	if err := c.Connect(addr, "900001", "888888", 5*time.Second); !errors.Is(err, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnOthers]) {
+		t.Fatalf("login timed out: actual [%v], wanted [%v]\n", err, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnOthers])
+	}
+
+	// the connection is closed without being authenticated.
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		closed := len(states) > 0 && states[len(states)-1] == cmpp.StateClosed
+		mu.Unlock()
+		if closed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, state := range states {
+		if state == cmpp.StateAuthenticated {
+			t.Fatalf("the peer is authenticated by a login timed out: %v\n", states)
+		}
+	}
+	if len(states) == 0 || states[len(states)-1] != cmpp.StateClosed {
+		t.Fatalf("the connection is not closed after a login timed out: %v\n", states)
+	}
+}
+
+func TestServerSession(t *testing.T) {
+	ctxs := make(chan context.Context, 1)
+	checkSession := func(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+		if _, ok := p.Packer.(*cmpp.Cmpp3SubmitReqPkt); !ok {
+			return true, nil
+		}
+		s := p.Session()
+		if s.Account() != "900001" || s.Version() != cmpp.V30 || !s.Authenticated() {
+			t.Errorf("session: account/version is %s/%v, wanted %s/%v\n", s.Account(), s.Version(), "900001", cmpp.V30)
+		}
+		if s.Get("count") == nil {
+			s.Set("count", 0)
+		}
+		s.Set("count", s.Get("count").(int)+1)
+		r.Packer.(*cmpp.Cmpp3SubmitRspPkt).MsgId = uint64(s.Get("count").(int))
+		ctxs <- p.Context()
+		return false, nil
+	}
+
+	addr := startServer(t, &cmpp.Server{
+		Handler: chain(acceptLogin, checkSession),
+		Typ:     cmpp.V30,
+	})
+	c := connectClient(t, addr)
+
+	for i := 1; i <= 2; i++ {
+		c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{})
+		rsp := recvSubmitRsps(t, c, 1)[0]
+		if rsp.MsgId != uint64(i) {
+			t.Fatalf("session attribute: actual [%d], wanted [%d]\n", rsp.MsgId, i)
+		}
+		<-ctxs
+	}
+
+	c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{})
+	ctx := <-ctxs
+	c.Disconnect()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context is not canceled after the connection is closed")
+	}
+}
+
+func TestServerSessionVersion(t *testing.T) {
+	versions := make(chan cmpp.Type, 1)
+	addr := startServer(t, &cmpp.Server{
+		Handler: chain(acceptLogin, func(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+			versions <- p.Session().Version()
+			return false, nil
+		}),
+		Typ: cmpp.V30,
+	})
+
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal("dial error:", err)
+	}
+	c := cmpp.NewConn(nc, cmpp.V30)
+	defer c.Close()
+	c.SetState(cmpp.CONN_CONNECTED)
+
+	// asks for a version newer than the one of the server.
+	if err := c.SendPkt(&cmpp.CmppConnReqPkt{SrcAddr: "900001", Version: 0x31}, 1); err != nil {
+		t.Fatal("send connect request error:", err)
+	}
+	i, err := c.RecvAndUnpackPkt(time.Second)
+	if err != nil {
+		t.Fatal("receive connect response error:", err)
+	}
+	if rsp, ok := i.(*cmpp.Cmpp3ConnRspPkt); !ok || rsp.Status != 0 || rsp.Version != cmpp.V30 {
+		t.Fatalf("connect response: %#v\n", i)
+	}
+
+	c.SetState(cmpp.CONN_AUTHOK)
+	if err := c.SendPkt(&cmpp.Cmpp3SubmitReqPkt{FeeType: "02"}, 2); err != nil {
+		t.Fatal("send submit error:", err)
+	}
+	if v := <-versions; v != cmpp.V30 {
+		t.Fatalf("session version: actual [%v], wanted [%v]\n", v, cmpp.V30)
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	addr := startServer(t, &cmpp.Server{
+		Handler:               chain(acceptLogin),
+		Typ:                   cmpp.V30,
+		MaxSessionsPerAccount: 1,
+	})
+	c1 := connectClient(t, addr)
+	c2 := cmpp.NewClient(cmpp.V30)
+	if err := c2.Connect(addr, "900001", "888888", time.Second); !errors.Is(err, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnOthers]) {
+		t.Fatalf("login exceeding the session limit: actual [%v], wanted [%v]\n", err, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnOthers])
+	}
+
+	// the session is released once the connection is closed.
+	c1.Disconnect()
+	var err error
+	for i := 0; i < 50; i++ {
+		if err = c2.Connect(addr, "900001", "888888", time.Second); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal("login after the session released error:", err)
+	}
+
+	// a login with another account on the connection is refused.
+	c2.SendReqPkt(&cmpp.CmppConnReqPkt{SrcAddr: "900002", Version: cmpp.V30})
+	i, err := c2.RecvAndUnpackPkt(5 * time.Second)
+	if rsp, ok := i.(*cmpp.Cmpp3ConnRspPkt); !ok || rsp.Status != uint32(cmpp.ErrnoConnOthers) {
+		t.Fatalf("login with another account: actual [%v, %v], wanted status [%d]\n", i, err, cmpp.ErrnoConnOthers)
+	}
+	c2.Disconnect()
+
+	addr = startServer(t, &cmpp.Server{
+		Handler:       chain(acceptLogin),
+		Typ:           cmpp.V30,
+		MaxConnsPerIP: 1,
+	})
+	c3 := connectClient(t, addr)
+	defer c3.Disconnect()
+	c4 := cmpp.NewClient(cmpp.V30)
+	if err := c4.Connect(addr, "900001", "888888", time.Second); err == nil {
+		t.Fatal("connection exceeding the per-ip limit is not refused")
+	}
+
+	addr = startServer(t, &cmpp.Server{
+		Handler:  chain(acceptLogin),
+		Typ:      cmpp.V30,
+		MaxConns: 1,
+	})
+	c5 := connectClient(t, addr)
+	defer c5.Disconnect()
+	c6 := cmpp.NewClient(cmpp.V30)
+	if err := c6.Connect(addr, "900002", "888888", time.Second); err == nil {
+		t.Fatal("connection exceeding the server limit is not refused")
+	}
+}
+
+func TestServerMaxInFlight(t *testing.T) {
+	entered, release := make(chan struct{}, 3), make(chan struct{})
+	blockSubmit := func(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+		if _, ok := p.Packer.(*cmpp.Cmpp3SubmitReqPkt); ok {
+			entered <- struct{}{}
+			<-release
+		}
+		return false, nil
+	}
+	addr := startServer(t, &cmpp.Server{
+		Handler:     chain(acceptLogin, blockSubmit),
+		Typ:         cmpp.V30,
+		Window:      4,
+		MaxInFlight: 2,
+	})
+	c1, c2 := connectClient(t, addr), connectClient(t, addr)
+	defer c1.Disconnect()
+	defer c2.Disconnect()
+
+	// fill MaxInFlight with a request on each connection.
+	for _, c := range []*cmpp.Client{c1, c2} {
+		if _, err := c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{}); err != nil {
+			t.Fatal("client send error:", err)
+		}
+		select {
+		case <-entered:
+		case <-time.After(5 * time.Second):
+			t.Fatal("request within MaxInFlight is not handled")
+		}
+	}
+
+	// the next one waits, though the window of c2 is not full.
+	if _, err := c2.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{}); err != nil {
+		t.Fatal("client send error:", err)
+	}
+	select {
+	case <-entered:
+		t.Fatal("request exceeding MaxInFlight is handled")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request waiting for MaxInFlight is not handled")
+	}
+	recvSubmitRsps(t, c1, 1)
+	recvSubmitRsps(t, c2, 2)
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	addr := startServer(t, &cmpp.Server{
+		Handler:     chain(acceptLogin),
+		Typ:         cmpp.V30,
+		ReadTimeout: 50 * time.Millisecond,
+		IdleTimeout: 200 * time.Millisecond,
+	})
+	c := connectClient(t, addr)
+	defer c.Disconnect()
+
+	start := time.Now()
+	for {
+		if _, err := c.RecvAndUnpackPkt(5 * time.Second); err != nil {
+			break
+		}
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("idle connection is closed after %v\n", d)
+	}
+}
+
+func TestServerConnState(t *testing.T) {
+	states := make(chan string, 16)
+	addr := startServer(t, &cmpp.Server{
+		Handler:     chain(acceptLogin),
+		Typ:         cmpp.V30,
+		ReadTimeout: 50 * time.Millisecond,
+		ConnState: func(s *cmpp.Session, state cmpp.ConnState) {
+			if s.RemoteAddr() == nil {
+				t.Error("session without remote addr")
+			}
+			states <- state.String() + ":" + s.Account()
+		},
+	})
+	c := connectClient(t, addr)
+	time.Sleep(100 * time.Millisecond)
+	c.Disconnect()
+
+	wanted := []string{"new:", "authenticated:900001", "idle:900001", "closed:900001"}
+	for _, w := range wanted {
+		select {
+		case s := <-states:
+			if s != w {
+				t.Fatalf("conn state: actual [%s], wanted [%s]\n", s, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("conn state %s is not reported\n", w)
+		}
+	}
+}
+
+// pipeListener is a net.Listener serving the server ends of
+// in-memory net.Pipe connections.
+type pipeListener struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, errors.New("pipe listener closed")
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+func (l *pipeListener) Dial(network, addr string) (net.Conn, error) {
+	c1, c2 := net.Pipe()
+	l.conns <- c2
+	return c1, nil
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+func TestServerOverNonTCPConn(t *testing.T) {
+	handler := chain(acceptLogin, slowSubmit)
+
+	// in-memory pipe
+	pl := newPipeListener()
+	defer pl.Close()
+	srv := &cmpp.Server{
+		Handler:      handler,
+		Typ:          cmpp.V30,
+		T:            time.Minute,
+		N:            3,
+		WriteTimeout: time.Second,
+		Logger:       cmpp.NewNopLogger(),
+	}
+	go srv.Serve(pl)
+
+	c := cmpp.NewClient(cmpp.V30)
+	if err := c.Dial(pl, "pipe", "", "900001", "888888", time.Second); err != nil {
+		t.Fatal("client connect over pipe error:", err)
+	}
+	c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{MsgId: 1})
+	if rsp := recvSubmitRsps(t, c, 1)[0]; rsp.MsgId != 1 {
+		t.Fatalf("submit response over pipe: msgId is %d, wanted %d\n", rsp.MsgId, 1)
+	}
+	c.Disconnect()
+
+	// unix domain socket
+	dir, err := ioutil.TempDir("", "gocmpp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ul, err := net.Listen("unix", filepath.Join(dir, "cmpp.sock"))
+	if err != nil {
+		t.Skip("unix domain socket is not supported:", err)
+	}
+	srv = &cmpp.Server{
+		Handler: handler,
+		Typ:     cmpp.V30,
+		T:       time.Minute,
+		N:       3,
+		Logger:  cmpp.NewNopLogger(),
+	}
+	go srv.Serve(ul)
+
+	c = cmpp.NewClient(cmpp.V30)
+	if err := c.Dial(&net.Dialer{}, "unix", ul.Addr().String(), "900001", "888888", time.Second); err != nil {
+		t.Fatal("client connect over unix socket error:", err)
+	}
+	defer c.Disconnect()
+	c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{MsgId: 2})
+	if rsp := recvSubmitRsps(t, c, 1)[0]; rsp.MsgId != 2 {
+		t.Fatalf("submit response over unix socket: msgId is %d, wanted %d\n", rsp.MsgId, 2)
+	}
+}
+
+// newCert issues a certificate for commonName (and 127.0.0.1) signed by
+// parent. If parent is nil, a self-signed CA certificate is returned.
+func newCert(t *testing.T, commonName string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signerCert, signerKey := tmpl, interface{}(key)
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		signerCert, signerKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestServerTLS(t *testing.T) {
+	ca := newCert(t, "gocmpp test ca", nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen error:", err)
+	}
+	srv := &cmpp.Server{
+		Handler: chain(acceptLogin, slowSubmit),
+		Typ:     cmpp.V30,
+		T:       time.Minute,
+		N:       3,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{newCert(t, "ismg", &ca)},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    pool,
+		},
+		CertAccount: func(cert *x509.Certificate) (string, error) {
+			return cert.Subject.CommonName, nil
+		},
+		Logger: cmpp.NewNopLogger(),
+	}
+	go srv.ServeTLS(l, "", "")
+	addr := l.Addr().String()
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{newCert(t, "900001", &ca)},
+		RootCAs:      pool,
+	}
+
+	c := cmpp.NewClient(cmpp.V30)
+	c.TLSConfig = config
+	if err := c.Connect(addr, "900001", "888888", time.Second); err != nil {
+		t.Fatal("client connect over tls error:", err)
+	}
+	defer c.Disconnect()
+	c.SendReqPkt(&cmpp.Cmpp3SubmitReqPkt{MsgId: 3})
+	if rsp := recvSubmitRsps(t, c, 1)[0]; rsp.MsgId != 3 {
+		t.Fatalf("submit response over tls: msgId is %d, wanted %d\n", rsp.MsgId, 3)
+	}
+
+	// login with an account not matching the client certificate.
+	c1 := cmpp.NewClient(cmpp.V30)
+	c1.TLSConfig = config
+	err = c1.Connect(addr, "900002", "888888", time.Second)
+	if !errors.Is(err, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnAuthFailed]) {
+		t.Fatalf("login with mismatched certificate: actual [%v], wanted [%v]\n", err, cmpp.ConnRspStatusErrMap[cmpp.ErrnoConnAuthFailed])
+	}
+
+	// no client certificate
+	c2 := cmpp.NewClient(cmpp.V30)
+	c2.TLSConfig = &tls.Config{RootCAs: pool}
+	if err := c2.Connect(addr, "900001", "888888", time.Second); err == nil {
+		t.Fatal("login without client certificate is not refused")
+	}
+}
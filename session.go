@@ -0,0 +1,124 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session holds the state of one server side connection. It is
+// created when the connection is accepted, and filled with the
+// login info once a connect request is answered with status 0.
+//
+// A Session is safe for concurrent use by multiple handlers.
+type Session struct {
+	remoteAddr net.Addr
+
+	mu        sync.RWMutex
+	account   string
+	version   Type
+	loginTime time.Time
+	attrs     map[string]interface{}
+	baseLog   Logger // with the remote addr.
+	log       Logger // baseLog with the account once logged in.
+}
+
+func newSession(remoteAddr net.Addr, log Logger) *Session {
+	log = log.With(Field{LogKeyRemoteAddr, remoteAddr})
+	return &Session{
+		remoteAddr: remoteAddr,
+		baseLog:    log,
+		log:        log,
+	}
+}
+
+// RemoteAddr returns the remote network address of the connection.
+func (s *Session) RemoteAddr() net.Addr {
+	return s.remoteAddr
+}
+
+// Account returns the SourceAddr the peer logged in with, or ""
+// if the peer has not logged in.
+func (s *Session) Account() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.account
+}
+
+// Version returns the protocol version negotiated at login.
+func (s *Session) Version() Type {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version
+}
+
+// LoginTime returns the time the peer logged in, or the zero time
+// if the peer has not logged in.
+func (s *Session) LoginTime() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.loginTime
+}
+
+// Authenticated reports whether the peer has logged in.
+func (s *Session) Authenticated() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !s.loginTime.IsZero()
+}
+
+// Get returns the user attribute stored in the session for key,
+// or nil if no value is present.
+func (s *Session) Get(key string) interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.attrs[key]
+}
+
+// Set stores the user attribute value for key in the session.
+// The attributes live as long as the connection does.
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+}
+
+// Delete removes the user attribute for key from the session.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attrs, key)
+}
+
+func (s *Session) login(account string, version Type, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.account = strings.TrimRight(account, "\x00")
+	s.version = version
+	s.loginTime = t
+	s.log = s.baseLog.With(Field{LogKeyAccount, s.account})
+}
+
+// logger returns the Logger of the connection.
+func (s *Session) logger() Logger {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.log
+}
@@ -0,0 +1,147 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// StatusError is the error of a response carrying a non-zero
+// Status(or Result) code, such as a connect response refusing the
+// login, or a submit response rejecting the message.
+//
+// The code is kept as is, so the vendor specific codes above the
+// range of the spec are not lost. errors.Is reports whether a
+// StatusError matches another StatusError of the same command and
+// code, or the error of its code in ConnRspStatusErrMap,
+// SubmitRspResultErrMap, DeliverRspResultErrMap or FwdRspResultErrMap:
+//
+//	if errors.Is(err, cmpp.SubmitRspResultErrMap[cmpp.ErrnoSubmitNotPassFlowControl]) {
+//		...
+//	}
+//
+// Use errors.As to get the code, or to check whether to retry:
+//
+//	var se *cmpp.StatusError
+//	if errors.As(err, &se) && se.Retryable {
+//		...
+//	}
+type StatusError struct {
+	// Command is the Command_Id of the response, e.g. CMPP_SUBMIT_RESP.
+	Command CommandId
+
+	// Code is the raw Status or Result code of the response.
+	Code uint32
+
+	// Retryable reports whether the request may succeed if sent
+	// again later, e.g. when it is refused by the flow control.
+	Retryable bool
+}
+
+// NewStatusError returns the StatusError of the code in the
+// response cmd. Retryable is set according to the spec.
+func NewStatusError(cmd CommandId, code uint32) *StatusError {
+	return &StatusError{
+		Command:   cmd,
+		Code:      code,
+		Retryable: retryable(cmd, code),
+	}
+}
+
+func (e *StatusError) Error() string {
+	if err := e.sentinel(); err != nil {
+		return err.Error()
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(e.Command.String(), "CMPP_"), "_RESP")
+	return strings.ToLower(name) + " response status: unknown code " + strconv.FormatUint(uint64(e.Code), 10)
+}
+
+// Is reports whether target is a StatusError of the same command and
+// code, or the error of the code in the error maps of the command.
+func (e *StatusError) Is(target error) bool {
+	if t, ok := target.(*StatusError); ok {
+		return t.Command == e.Command && t.Code == e.Code
+	}
+	err := e.sentinel()
+	return err != nil && err == target
+}
+
+// sentinel returns the error of the code in the error maps, or nil
+// if the code is not in the spec.
+func (e *StatusError) sentinel() error {
+	var m map[uint8]error
+	switch e.Command {
+	case CMPP_CONNECT_RESP:
+		m = ConnRspStatusErrMap
+	case CMPP_SUBMIT_RESP:
+		m = SubmitRspResultErrMap
+	case CMPP_DELIVER_RESP:
+		m = DeliverRspResultErrMap
+	case CMPP_FWD_RESP:
+		m = FwdRspResultErrMap
+	}
+	if e.Code > 0xff {
+		return nil
+	}
+	return m[uint8(e.Code)]
+}
+
+// retryable reports whether the code of the response cmd is
+// a transient one.
+func retryable(cmd CommandId, code uint32) bool {
+	switch cmd {
+	case CMPP_SUBMIT_RESP:
+		return code == uint32(ErrnoSubmitNotPassFlowControl)
+	case CMPP_DELIVER_RESP:
+		return code == uint32(ErrnoDeliverNotPassFlowControl)
+	case CMPP_FWD_RESP:
+		return code == uint32(ErrnoFwdNotPassFlowControl)
+	}
+	return false
+}
+
+// ResponseError returns the StatusError of the response rsp, or nil
+// if its Status(or Result) is zero or it has no status at all.
+func ResponseError(rsp Pdu) error {
+	code, _ := responseStatus(rsp)
+	if code == 0 {
+		return nil
+	}
+	return NewStatusError(rsp.CommandId(), code)
+}
+
+// responseStatus returns the Status(or Result) of the response rsp.
+// ok is false if rsp has no status.
+func responseStatus(rsp Pdu) (code uint32, ok bool) {
+	switch p := rsp.(type) {
+	case *Cmpp2ConnRspPkt:
+		return uint32(p.Status), true
+	case *Cmpp3ConnRspPkt:
+		return p.Status, true
+	case *Cmpp2SubmitRspPkt:
+		return uint32(p.Result), true
+	case *Cmpp3SubmitRspPkt:
+		return p.Result, true
+	case *Cmpp2DeliverRspPkt:
+		return uint32(p.Result), true
+	case *Cmpp3DeliverRspPkt:
+		return p.Result, true
+	case *Cmpp2FwdRspPkt:
+		return uint32(p.Result), true
+	case *Cmpp3FwdRspPkt:
+		return p.Result, true
+	}
+	return 0, false
+}
@@ -0,0 +1,95 @@
+// Copyright 2015 Tony Bai.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmpp_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bigwhite/gocmpp"
+)
+
+func TestStatusError(t *testing.T) {
+	err := cmpp.ResponseError(&cmpp.Cmpp3SubmitRspPkt{Result: uint32(cmpp.ErrnoSubmitNotPassFlowControl)})
+	if !errors.Is(err, cmpp.SubmitRspResultErrMap[cmpp.ErrnoSubmitNotPassFlowControl]) {
+		t.Fatalf("errors.Is(%v, the error in SubmitRspResultErrMap) is false", err)
+	}
+	if errors.Is(err, cmpp.SubmitRspResultErrMap[cmpp.ErrnoSubmitInvalidStruct]) {
+		t.Fatalf("errors.Is(%v, the error of another code) is true", err)
+	}
+	if !errors.Is(err, cmpp.NewStatusError(cmpp.CMPP_SUBMIT_RESP, 8)) {
+		t.Fatalf("errors.Is(%v, a StatusError of the same code) is false", err)
+	}
+	if err.Error() != cmpp.SubmitRspResultErrMap[cmpp.ErrnoSubmitNotPassFlowControl].Error() {
+		t.Fatalf("the error message is %q", err.Error())
+	}
+
+	// wrapped in an OpError.
+	var se *cmpp.StatusError
+	if !errors.As(cmpp.NewOpError(err, "submit"), &se) {
+		t.Fatal("errors.As can not find the StatusError in an OpError")
+	}
+	if se.Command != cmpp.CMPP_SUBMIT_RESP || se.Code != 8 || !se.Retryable {
+		t.Fatalf("StatusError is %#v", se)
+	}
+
+	// vendor specific code.
+	err = cmpp.ResponseError(&cmpp.Cmpp3DeliverRspPkt{Result: 0x1234})
+	if !errors.As(err, &se) || se.Code != 0x1234 || se.Retryable {
+		t.Fatalf("StatusError is %#v", se)
+	}
+	if err.Error() != "deliver response status: unknown code 4660" {
+		t.Fatalf("the error message is %q", err.Error())
+	}
+
+	if err = cmpp.ResponseError(&cmpp.Cmpp2FwdRspPkt{}); err != nil {
+		t.Fatal("ResponseError of a zero result is", err)
+	}
+	if err = cmpp.ResponseError(&cmpp.CmppActiveTestRspPkt{}); err != nil {
+		t.Fatal("ResponseError of a packet without status is", err)
+	}
+}
+
+func TestOpErrorUnwrap(t *testing.T) {
+	if err := cmpp.NewOpError(io.EOF, "read"); !errors.Is(err, io.EOF) {
+		t.Fatal("errors.Is can not see through the OpError")
+	}
+}
+
+func TestClientConnectStatus(t *testing.T) {
+	addr := startServer(t, &cmpp.Server{
+		Handler: cmpp.HandlerFunc(func(r *cmpp.Response, p *cmpp.Packet, l cmpp.Logger) (bool, error) {
+			if rsp, ok := r.Packer.(*cmpp.Cmpp3ConnRspPkt); ok {
+				rsp.Status = 0x100 // vendor specific
+				rsp.Version = cmpp.V30
+			}
+			return false, nil
+		}),
+		Typ: cmpp.V30,
+	})
+
+	c := cmpp.NewClient(cmpp.V30)
+	defer c.Disconnect()
+	err := c.Connect(addr, "900001", "888888", time.Second)
+
+	var se *cmpp.StatusError
+	if !errors.As(err, &se) {
+		t.Fatalf("login refused: actual [%v], wanted a StatusError\n", err)
+	}
+	if se.Command != cmpp.CMPP_CONNECT_RESP || se.Code != 0x100 {
+		t.Fatalf("login refused: actual [%#v], wanted code 0x100\n", se)
+	}
+}
@@ -455,6 +455,8 @@ func BenchmarkCmpp2SubmitReqPktUnpack(b *testing.B) {
 
 	p := &cmpp.Cmpp2SubmitReqPkt{}
 
+	b.ReportAllocs()
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		p.Unpack(data)
 	}
@@ -489,6 +491,39 @@ func BenchmarkCmpp3SubmitReqPktPack(b *testing.B) {
 	}
 }
 
+func BenchmarkCmpp3SubmitReqPktAppendPack(b *testing.B) {
+	p := &cmpp.Cmpp3SubmitReqPkt{
+		PkTotal:            pkTotal,
+		PkNumber:           pkNumber,
+		RegisteredDelivery: registeredDelivery,
+		MsgLevel:           msgLevel,
+		ServiceId:          serviceId,
+		FeeUserType:        feeUserType,
+		FeeTerminalId:      feeTerminalId,
+		FeeTerminalType:    feeTerminalType,
+		MsgFmt:             msgFmt,
+		MsgSrc:             msgSrc,
+		FeeType:            feeType,
+		FeeCode:            feeCode,
+		ValidTime:          validTime,
+		AtTime:             atTime,
+		SrcId:              srcId,
+		DestUsrTl:          destUsrTl,
+		DestTerminalId:     destTerminalId,
+		DestTerminalType:   destTerminalType,
+		MsgLength:          msgLength,
+		MsgContent:         msgContent,
+	}
+
+	buf := make([]byte, 0, cmpp.Cmpp3SubmitReqPktMaxLen)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, _ = p.AppendPack(buf[:0], seqId)
+	}
+}
+
 func BenchmarkCmpp3SubmitReqPktUnpack(b *testing.B) {
 	data := []byte{
 		0x00, 0x00, 0x00, 0x17, 0x00, 0x00, 0x00, 0x00,
@@ -510,7 +545,57 @@ func BenchmarkCmpp3SubmitReqPktUnpack(b *testing.B) {
 
 	p := &cmpp.Cmpp2SubmitReqPkt{}
 
+	b.ReportAllocs()
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		p.Unpack(data)
 	}
 }
+
+func BenchmarkCmpp2SubmitRspPktUnpack(b *testing.B) {
+	data, _ := (&cmpp.Cmpp2SubmitRspPkt{MsgId: 12878564852733378560}).Pack(seqId)
+	p := &cmpp.Cmpp2SubmitRspPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(data[8:])
+	}
+}
+
+func BenchmarkCmpp3SubmitRspPktUnpack(b *testing.B) {
+	data, _ := (&cmpp.Cmpp3SubmitRspPkt{MsgId: 12878564852733378560}).Pack(seqId)
+	p := &cmpp.Cmpp3SubmitRspPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(data[8:])
+	}
+}
+
+func TestCmpp3SubmitReqPktValidate(t *testing.T) {
+	p := &cmpp.Cmpp3SubmitReqPkt{
+		FeeType:        "02",
+		DestUsrTl:      2,
+		DestTerminalId: []string{"13500002696"},
+		MsgContent:     "hello",
+		MsgLength:      5,
+	}
+	if err := p.Validate(); err == nil {
+		t.Fatal("Validate returns no error when DestUsrTl does not match DestTerminalId")
+	}
+	if _, err := p.Pack(seqId); err == nil {
+		t.Fatal("Pack returns no error for an invalid packet")
+	}
+
+	p.DestUsrTl = 1
+	if err := p.Validate(); err != nil {
+		t.Fatal("Validate error:", err)
+	}
+
+	p.ServiceId = "12345678901"
+	if err := p.Validate(); err == nil {
+		t.Fatal("Validate returns no error for a too long ServiceId")
+	}
+}
@@ -13,71 +13,20 @@
 
 package cmpp
 
-import "encoding/binary"
-
 // Packet length const for cmpp terminate request and response packets.
 const (
 	CmppTerminateReqPktLen uint32 = 12 //12d, 0xc
 	CmppTerminateRspPktLen uint32 = 12 //12d, 0xc
 )
 
+//cmpp:packet CMPP_TERMINATE
 type CmppTerminateReqPkt struct {
 	// session info
-	SeqId uint32
+	SeqId uint32 `cmpp:"seqid"`
 }
+
+//cmpp:packet CMPP_TERMINATE_RESP
 type CmppTerminateRspPkt struct {
 	// session info
-	SeqId uint32
-}
-
-// Pack packs the CmppTerminateReqPkt to bytes stream for client side.
-func (p *CmppTerminateReqPkt) Pack(seqId uint32) ([]byte, error) {
-	var pktLen = CmppTerminateReqPktLen
-
-	var w = newPacketWriter(pktLen)
-
-	// Pack header
-	w.WriteInt(binary.BigEndian, pktLen)
-	w.WriteInt(binary.BigEndian, CMPP_TERMINATE)
-	w.WriteInt(binary.BigEndian, seqId)
-	p.SeqId = seqId
-
-	return w.Bytes()
-}
-
-// Unpack unpack the binary byte stream to a CmppTerminateReqPkt variable.
-// After unpack, you will get all value of fields in
-// CmppTerminateReqPkt struct.
-func (p *CmppTerminateReqPkt) Unpack(data []byte) error {
-	var r = newPacketReader(data)
-
-	// Sequence Id
-	r.ReadInt(binary.BigEndian, &p.SeqId)
-	return r.Error()
-}
-
-// Pack packs the CmppTerminateRspPkt to bytes stream for client side.
-func (p *CmppTerminateRspPkt) Pack(seqId uint32) ([]byte, error) {
-	var pktLen = CmppTerminateRspPktLen
-
-	var w = newPacketWriter(pktLen)
-
-	// Pack header
-	w.WriteInt(binary.BigEndian, pktLen)
-	w.WriteInt(binary.BigEndian, CMPP_TERMINATE_RESP)
-	w.WriteInt(binary.BigEndian, seqId)
-	p.SeqId = seqId
-
-	return w.Bytes()
-}
-
-// Unpack unpack the binary byte stream to a CmppTerminateRspPkt variable.
-// After unpack, you will get all value of fields in
-// CmppTerminateRspPkt struct.
-func (p *CmppTerminateRspPkt) Unpack(data []byte) error {
-	var r = newPacketReader(data)
-
-	// Sequence Id
-	r.ReadInt(binary.BigEndian, &p.SeqId)
-	return r.Error()
+	SeqId uint32 `cmpp:"seqid"`
 }
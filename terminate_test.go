@@ -112,3 +112,25 @@ func TestCmppTerminateRspUnpack(t *testing.T) {
 		t.Fatalf("After unpack, seqId in packet is %x, not equal to the expected value: %x\n", p.SeqId, seqId)
 	}
 }
+
+func BenchmarkCmppTerminateReqPktUnpack(b *testing.B) {
+	data, _ := (&cmpp.CmppTerminateReqPkt{}).Pack(seqId)
+	p := &cmpp.CmppTerminateReqPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(data[8:])
+	}
+}
+
+func BenchmarkCmppTerminateRspPktUnpack(b *testing.B) {
+	data, _ := (&cmpp.CmppTerminateRspPkt{}).Pack(seqId)
+	p := &cmpp.CmppTerminateRspPkt{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Unpack(data[8:])
+	}
+}